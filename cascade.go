@@ -0,0 +1,127 @@
+package html2img
+
+// cssWideKeywords are the values every property takes.
+var cssWideKeywords = map[string]bool{
+	"inherit": true,
+	"initial": true,
+	"unset":   true,
+}
+
+// keywordShorthands are the shorthands whose syntax does not take a single
+// value, with the longhands a CSS-wide keyword is set on.
+var keywordShorthands = map[string][]string{
+	"flex":          {"flex-grow", "flex-shrink", "flex-basis"},
+	"flex-flow":     {"flex-direction", "flex-wrap"},
+	"grid-template": {"grid-template-rows", "grid-template-columns", "grid-template-areas"},
+	"columns":       {"column-width", "column-count"},
+	"column-rule":   {"column-rule-width", "column-rule-style", "column-rule-color"},
+	"list-style":    {"list-style-type", "list-style-position", "list-style-image"},
+}
+
+// resolveKeywords replaces the CSS-wide keywords of style by the values of
+// its parent style or by the initial values. It runs after the inheritable
+// properties without value took the ones of the parent.
+func resolveKeywords(style *TagStyle, pStyle *TagStyle) {
+	if pStyle == nil {
+		pStyle = &TagStyle{}
+	}
+	// Inheritable
+	resolveKeyword(&style.Color, pStyle.Color, "", true)
+	resolveKeyword(&style.FontSize, pStyle.FontSize, "", true)
+	resolveKeyword(&style.LineHeight, pStyle.LineHeight, "", true)
+	resolveKeyword(&style.FontFamily, pStyle.FontFamily, "", true)
+	resolveKeyword(&style.Visibility, pStyle.Visibility, "", true)
+	resolveKeyword(&style.TextAlign, pStyle.TextAlign, "", true)
+	resolveKeyword(&style.FontWeight, pStyle.FontWeight, "", true)
+	resolveKeyword(&style.FontStyle, pStyle.FontStyle, "", true)
+	resolveKeyword(&style.WhiteSpace, pStyle.WhiteSpace, "", true)
+	resolveKeyword(&style.BorderCollapse, pStyle.BorderCollapse, "", true)
+	resolveKeyword(&style.BorderSpacing, pStyle.BorderSpacing, "", true)
+	resolveKeyword(&style.CaptionSide, pStyle.CaptionSide, "", true)
+	resolveKeyword(&style.ListStyleType, pStyle.ListStyleType, "disc", true)
+	resolveKeyword(&style.ListStylePosition, pStyle.ListStylePosition, "", true)
+	resolveKeyword(&style.ListStyleImage, pStyle.ListStyleImage, "", true)
+
+	// Not Inheritable
+	resolveKeyword(&style.BackgroundColor, pStyle.BackgroundColor, "", false)
+	resolveKeyword(&style.BackgroundImage, pStyle.BackgroundImage, "", false)
+	resolveKeyword(&style.Width, pStyle.Width, "", false)
+	resolveKeyword(&style.Height, pStyle.Height, "", false)
+	resolveKeyword(&style.Display, pStyle.Display, "inline", false)
+	resolveKeyword(&style.Position, pStyle.Position, "", false)
+	resolveKeyword(&style.ZIndex, pStyle.ZIndex, "", false)
+	resolveKeyword(&style.Opacity, pStyle.Opacity, "", false)
+	resolveKeyword(&style.Transform, pStyle.Transform, "", false)
+	resolveKeyword(&style.TransformOrigin, pStyle.TransformOrigin, "", false)
+	resolveKeyword(&style.VerticalAlign, pStyle.VerticalAlign, "", false)
+	resolveKeyword(&style.TextDecoration, pStyle.TextDecoration, "", false)
+	resolveKeyword(&style.FlexDirection, pStyle.FlexDirection, "", false)
+	resolveKeyword(&style.FlexWrap, pStyle.FlexWrap, "", false)
+	resolveKeyword(&style.FlexGrow, pStyle.FlexGrow, "", false)
+	resolveKeyword(&style.FlexShrink, pStyle.FlexShrink, "", false)
+	resolveKeyword(&style.FlexBasis, pStyle.FlexBasis, "", false)
+	resolveKeyword(&style.Order, pStyle.Order, "", false)
+	resolveKeyword(&style.JustifyContent, pStyle.JustifyContent, "", false)
+	resolveKeyword(&style.AlignItems, pStyle.AlignItems, "", false)
+	resolveKeyword(&style.AlignSelf, pStyle.AlignSelf, "", false)
+	resolveKeyword(&style.AlignContent, pStyle.AlignContent, "", false)
+	resolveKeyword(&style.RowGap, pStyle.RowGap, "", false)
+	resolveKeyword(&style.ColumnGap, pStyle.ColumnGap, "", false)
+	resolveKeyword(&style.JustifyItems, pStyle.JustifyItems, "", false)
+	resolveKeyword(&style.JustifySelf, pStyle.JustifySelf, "", false)
+	resolveKeyword(&style.GridTemplateColumns, pStyle.GridTemplateColumns, "", false)
+	resolveKeyword(&style.GridTemplateRows, pStyle.GridTemplateRows, "", false)
+	resolveKeyword(&style.GridTemplateAreas, pStyle.GridTemplateAreas, "", false)
+	resolveKeyword(&style.GridAutoColumns, pStyle.GridAutoColumns, "", false)
+	resolveKeyword(&style.GridAutoRows, pStyle.GridAutoRows, "", false)
+	resolveKeyword(&style.GridAutoFlow, pStyle.GridAutoFlow, "", false)
+	resolveKeyword(&style.GridRowStart, pStyle.GridRowStart, "", false)
+	resolveKeyword(&style.GridRowEnd, pStyle.GridRowEnd, "", false)
+	resolveKeyword(&style.GridColumnStart, pStyle.GridColumnStart, "", false)
+	resolveKeyword(&style.GridColumnEnd, pStyle.GridColumnEnd, "", false)
+	resolveKeyword(&style.TableLayout, pStyle.TableLayout, "", false)
+	resolveKeyword(&style.Float, pStyle.Float, "", false)
+	resolveKeyword(&style.Clear, pStyle.Clear, "", false)
+	resolveKeyword(&style.Overflow, pStyle.Overflow, "", false)
+	resolveKeyword(&style.ColumnCount, pStyle.ColumnCount, "", false)
+	resolveKeyword(&style.ColumnWidth, pStyle.ColumnWidth, "", false)
+	resolveKeyword(&style.ColumnRuleWidth, pStyle.ColumnRuleWidth, "", false)
+	resolveKeyword(&style.ColumnRuleStyle, pStyle.ColumnRuleStyle, "", false)
+	resolveKeyword(&style.ColumnRuleColor, pStyle.ColumnRuleColor, "", false)
+	resolveKeyword(&style.Content, pStyle.Content, "", false)
+	resolveKeyword(&style.CounterReset, pStyle.CounterReset, "", false)
+	resolveKeyword(&style.CounterIncrement, pStyle.CounterIncrement, "", false)
+	resolveKeyword(&style.CounterSet, pStyle.CounterSet, "", false)
+	resolvePosKeywords(&style.BorderRadius, pStyle.BorderRadius)
+	resolvePosKeywords(&style.Offset, pStyle.Offset)
+	resolvePosKeywords(&style.Margin, pStyle.Margin)
+	resolvePosKeywords(&style.Padding, pStyle.Padding)
+	resolvePosKeywords(&style.BorderWidth, pStyle.BorderWidth)
+	resolvePosKeywords(&style.BorderColor, pStyle.BorderColor)
+	resolvePosKeywords(&style.BorderStyle, pStyle.BorderStyle)
+}
+
+// resolveKeyword resolves a CSS-wide keyword: inherit takes the value of the
+// parent, initial the initial value, and unset behaves as inherit for an
+// inheritable property and as initial otherwise.
+func resolveKeyword(value *string, parent string, initial string, inheritable bool) {
+	switch *value {
+	case "inherit":
+		*value = parent
+	case "initial":
+		*value = initial
+	case "unset":
+		if inheritable {
+			*value = parent
+		} else {
+			*value = initial
+		}
+	}
+}
+
+func resolvePosKeywords(pos *Pos, parent Pos) {
+	resolveKeyword(&pos.Left, parent.Left, "", false)
+	resolveKeyword(&pos.Top, parent.Top, "", false)
+	resolveKeyword(&pos.Right, parent.Right, "", false)
+	resolveKeyword(&pos.Bottom, parent.Bottom, "", false)
+}
@@ -0,0 +1,59 @@
+package html2img
+
+import "testing"
+
+func TestSpecificity(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     specificity
+	}{
+		{"*", specificity{0, 0, 0}},
+		{"p", specificity{0, 0, 1}},
+		{"div p", specificity{0, 0, 2}},
+		{".a", specificity{0, 1, 0}},
+		{"p.a.b", specificity{0, 2, 1}},
+		{"#x", specificity{1, 0, 0}},
+		{"#x p > .a", specificity{1, 1, 1}},
+		{"[title]", specificity{0, 1, 0}},
+		{"li:first-child", specificity{0, 1, 1}},
+		{"p::before", specificity{0, 0, 2}},
+		{":not(#x, .a)", specificity{1, 0, 0}},
+		{":is(p, .a)", specificity{0, 1, 0}},
+		{":where(#x) p", specificity{0, 0, 1}},
+		{"li:nth-child(2 of .a)", specificity{0, 2, 1}},
+	}
+	for _, test := range tests {
+		list, ok := parseSelectorList(test.selector)
+		if !ok || len(list) != 1 {
+			t.Errorf("%v: not parsed", test.selector)
+			continue
+		}
+		if got := list[0].specificity(); got != test.want {
+			t.Errorf("specificity(%v) = %v, want %v", test.selector, got, test.want)
+		}
+	}
+}
+
+func TestCascade(t *testing.T) {
+	runComputedStyleTests(t, colorOf, []computedStyleTest{
+		{"specificity", "#e { color: red } p.a { color: blue } p { color: green }", `<p id="e" class="a">a</p>`, "red"},
+		{"source order", "p { color: red } p { color: blue }", `<p id="e">a</p>`, "blue"},
+		{"source order across style elements", "p { color: red } </style><style> p { color: blue }", `<p id="e">a</p>`, "blue"},
+		{"specificity before order", "p.a { color: red } p { color: blue }", `<p id="e" class="a">a</p>`, "red"},
+		{"selector list keeps its own specificity", "#e, p { color: red } p.a { color: blue }", `<p id="e" class="a">a</p>`, "red"},
+		{"important", "p { color: red !important } #e { color: blue }", `<p id="e">a</p>`, "red"},
+		{"important specificity", "#e { color: red !important } p { color: blue !important }", `<p id="e">a</p>`, "red"},
+		{"important source order", "p { color: red !important } p { color: blue !important }", `<p id="e">a</p>`, "blue"},
+		{"inherit", "div { color: red } p { color: blue } #e { color: inherit }", `<div><p id="e">a</p></div>`, "red"},
+		{"initial", "div { color: red } #e { color: initial }", `<div><p id="e">a</p></div>`, ""},
+		{"unset inherited", "div { color: red } #e { color: blue } #e { color: unset }", `<div><p id="e">a</p></div>`, "red"},
+		{"inherited below declared", "div { color: red } p { color: blue }", `<div><p id="e">a</p></div>`, "blue"},
+		{"invalid declaration ignored", "p { color: red } p { color: 12px }", `<p id="e">a</p>`, "red"},
+	})
+	runComputedStyleTests(t, func(s *TagStyle) string { return s.Margin.Left }, []computedStyleTest{
+		{"shorthand then longhand", "p { margin: 5px; margin-left: 7px }", `<p id="e">a</p>`, "7px"},
+		{"longhand then shorthand", "p { margin-left: 7px; margin: 5px }", `<p id="e">a</p>`, "5px"},
+		{"unset not inherited", "div { margin-left: 7px } #e { margin-left: 3px; margin-left: unset }", `<div><p id="e">a</p></div>`, ""},
+		{"inherit not inherited property", "div { margin-left: 7px } #e { margin-left: inherit }", `<div><p id="e">a</p></div>`, "7px"},
+	})
+}
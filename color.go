@@ -0,0 +1,290 @@
+package html2img
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// namedColors are the named colors of CSS Color Level 4.
+var namedColors = map[string]uint32{
+	"aliceblue": 0xf0f8ff, "antiquewhite": 0xfaebd7, "aqua": 0x00ffff, "aquamarine": 0x7fffd4,
+	"azure": 0xf0ffff, "beige": 0xf5f5dc, "bisque": 0xffe4c4, "black": 0x000000,
+	"blanchedalmond": 0xffebcd, "blue": 0x0000ff, "blueviolet": 0x8a2be2, "brown": 0xa52a2a,
+	"burlywood": 0xdeb887, "cadetblue": 0x5f9ea0, "chartreuse": 0x7fff00, "chocolate": 0xd2691e,
+	"coral": 0xff7f50, "cornflowerblue": 0x6495ed, "cornsilk": 0xfff8dc, "crimson": 0xdc143c,
+	"cyan": 0x00ffff, "darkblue": 0x00008b, "darkcyan": 0x008b8b, "darkgoldenrod": 0xb8860b,
+	"darkgray": 0xa9a9a9, "darkgreen": 0x006400, "darkgrey": 0xa9a9a9, "darkkhaki": 0xbdb76b,
+	"darkmagenta": 0x8b008b, "darkolivegreen": 0x556b2f, "darkorange": 0xff8c00, "darkorchid": 0x9932cc,
+	"darkred": 0x8b0000, "darksalmon": 0xe9967a, "darkseagreen": 0x8fbc8f, "darkslateblue": 0x483d8b,
+	"darkslategray": 0x2f4f4f, "darkslategrey": 0x2f4f4f, "darkturquoise": 0x00ced1, "darkviolet": 0x9400d3,
+	"deeppink": 0xff1493, "deepskyblue": 0x00bfff, "dimgray": 0x696969, "dimgrey": 0x696969,
+	"dodgerblue": 0x1e90ff, "firebrick": 0xb22222, "floralwhite": 0xfffaf0, "forestgreen": 0x228b22,
+	"fuchsia": 0xff00ff, "gainsboro": 0xdcdcdc, "ghostwhite": 0xf8f8ff, "gold": 0xffd700,
+	"goldenrod": 0xdaa520, "gray": 0x808080, "green": 0x008000, "greenyellow": 0xadff2f,
+	"grey": 0x808080, "honeydew": 0xf0fff0, "hotpink": 0xff69b4, "indianred": 0xcd5c5c,
+	"indigo": 0x4b0082, "ivory": 0xfffff0, "khaki": 0xf0e68c, "lavender": 0xe6e6fa,
+	"lavenderblush": 0xfff0f5, "lawngreen": 0x7cfc00, "lemonchiffon": 0xfffacd, "lightblue": 0xadd8e6,
+	"lightcoral": 0xf08080, "lightcyan": 0xe0ffff, "lightgoldenrodyellow": 0xfafad2, "lightgray": 0xd3d3d3,
+	"lightgreen": 0x90ee90, "lightgrey": 0xd3d3d3, "lightpink": 0xffb6c1, "lightsalmon": 0xffa07a,
+	"lightseagreen": 0x20b2aa, "lightskyblue": 0x87cefa, "lightslategray": 0x778899, "lightslategrey": 0x778899,
+	"lightsteelblue": 0xb0c4de, "lightyellow": 0xffffe0, "lime": 0x00ff00, "limegreen": 0x32cd32,
+	"linen": 0xfaf0e6, "magenta": 0xff00ff, "maroon": 0x800000, "mediumaquamarine": 0x66cdaa,
+	"mediumblue": 0x0000cd, "mediumorchid": 0xba55d3, "mediumpurple": 0x9370db, "mediumseagreen": 0x3cb371,
+	"mediumslateblue": 0x7b68ee, "mediumspringgreen": 0x00fa9a, "mediumturquoise": 0x48d1cc, "mediumvioletred": 0xc71585,
+	"midnightblue": 0x191970, "mintcream": 0xf5fffa, "mistyrose": 0xffe4e1, "moccasin": 0xffe4b5,
+	"navajowhite": 0xffdead, "navy": 0x000080, "oldlace": 0xfdf5e6, "olive": 0x808000,
+	"olivedrab": 0x6b8e23, "orange": 0xffa500, "orangered": 0xff4500, "orchid": 0xda70d6,
+	"palegoldenrod": 0xeee8aa, "palegreen": 0x98fb98, "paleturquoise": 0xafeeee, "palevioletred": 0xdb7093,
+	"papayawhip": 0xffefd5, "peachpuff": 0xffdab9, "peru": 0xcd853f, "pink": 0xffc0cb,
+	"plum": 0xdda0dd, "powderblue": 0xb0e0e6, "purple": 0x800080, "rebeccapurple": 0x663399,
+	"red": 0xff0000, "rosybrown": 0xbc8f8f, "royalblue": 0x4169e1, "saddlebrown": 0x8b4513,
+	"salmon": 0xfa8072, "sandybrown": 0xf4a460, "seagreen": 0x2e8b57, "seashell": 0xfff5ee,
+	"sienna": 0xa0522d, "silver": 0xc0c0c0, "skyblue": 0x87ceeb, "slateblue": 0x6a5acd,
+	"slategray": 0x708090, "slategrey": 0x708090, "snow": 0xfffafa, "springgreen": 0x00ff7f,
+	"steelblue": 0x4682b4, "tan": 0xd2b48c, "teal": 0x008080, "thistle": 0xd8bfd8,
+	"tomato": 0xff6347, "turquoise": 0x40e0d0, "violet": 0xee82ee, "wheat": 0xf5deb3,
+	"white": 0xffffff, "whitesmoke": 0xf5f5f5, "yellow": 0xffff00, "yellowgreen": 0x9acd32,
+}
+
+// getColor returns the color of a computed color value. Invalid values are
+// dropped by the cascade, getColor returns black for the ones that are left,
+// like the empty value.
+func getColor(colorStr string) color.Color {
+	col, ok := parseColor(colorStr)
+	if !ok {
+		return color.NRGBA{A: 0xff}
+	}
+	return col
+}
+
+// parseColor parses a hex color, a named color, transparent, or an rgb(),
+// rgba(), hsl(), hsla() or hwb() function with the comma or the space
+// separated syntax.
+func parseColor(value string) (color.NRGBA, bool) {
+	values := trimWhitespace(parseComponentValues(tokenizeCSS(value)))
+	if len(values) != 1 {
+		return color.NRGBA{}, false
+	}
+	v := &values[0]
+	switch v.token.kind {
+	case tokenHash:
+		return parseHexColor(v.token.value)
+	case tokenIdent:
+		name := strings.ToLower(v.token.value)
+		if name == "transparent" {
+			return color.NRGBA{}, true
+		}
+		rgb, ok := namedColors[name]
+		return color.NRGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}, ok
+	case tokenFunction:
+		args, ok := colorArgs(v.children)
+		if !ok {
+			return color.NRGBA{}, false
+		}
+		switch strings.ToLower(v.token.value) {
+		case "rgb", "rgba":
+			return rgbColor(args)
+		case "hsl", "hsla":
+			return hslColor(args)
+		case "hwb":
+			return hwbColor(args)
+		}
+	}
+	return color.NRGBA{}, false
+}
+
+// parseHexColor parses the digits of a #rgb, #rgba, #rrggbb or #rrggbbaa
+// color.
+func parseHexColor(hex string) (color.NRGBA, bool) {
+	if len(hex) == 3 || len(hex) == 4 {
+		long := make([]byte, 0, 8)
+		for i := 0; i < len(hex); i++ {
+			long = append(long, hex[i], hex[i])
+		}
+		hex = string(long)
+	}
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, false
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	if len(hex) == 6 {
+		n = n<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, true
+}
+
+// colorArgs returns the three channels of a color function followed by its
+// alpha, if it has one. The channels are separated by commas, or by spaces
+// with the alpha after a slash.
+func colorArgs(values []componentValue) ([]*cssToken, bool) {
+	var args []*cssToken
+	commas, slash := 0, false
+	for i := range values {
+		token := &values[i].token
+		switch {
+		case token.kind == tokenWhitespace:
+			continue
+		case token.kind == tokenComma:
+			commas++
+			if commas != len(args) {
+				return nil, false
+			}
+			continue
+		case token.kind == tokenDelim && token.value == "/":
+			if slash || len(args) != 3 {
+				return nil, false
+			}
+			slash = true
+			continue
+		case token.kind != tokenNumber && token.kind != tokenPercentage && token.kind != tokenDimension && token.kind != tokenIdent:
+			return nil, false
+		}
+		args = append(args, token)
+	}
+	if commas > 0 && (slash || commas != len(args)-1) {
+		return nil, false
+	}
+	if commas == 0 && (slash != (len(args) == 4)) {
+		return nil, false
+	}
+	return args, len(args) == 3 || len(args) == 4
+}
+
+// colorValue returns a number, or a percentage of max. none is 0.
+func colorValue(token *cssToken, max float64) (float64, bool) {
+	switch token.kind {
+	case tokenNumber:
+		return token.num, true
+	case tokenPercentage:
+		return token.num * max / 100, true
+	case tokenIdent:
+		return 0, strings.EqualFold(token.value, "none")
+	}
+	return 0, false
+}
+
+// alphaValue returns the alpha of the arguments of a color function, 1 when
+// it has none.
+func alphaValue(args []*cssToken) (uint8, bool) {
+	if len(args) < 4 {
+		return 255, true
+	}
+	alpha, ok := colorValue(args[3], 1)
+	return uint8(math.Round(clamp01(alpha) * 255)), ok
+}
+
+// hueValue returns a hue in degrees.
+func hueValue(token *cssToken) (float64, bool) {
+	if token.kind != tokenDimension {
+		return colorValue(token, 0)
+	}
+	switch strings.ToLower(token.value) {
+	case "deg":
+		return token.num, true
+	case "rad":
+		return token.num * 180 / math.Pi, true
+	case "grad":
+		return token.num * 0.9, true
+	case "turn":
+		return token.num * 360, true
+	}
+	return 0, false
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func channel(v float64) uint8 {
+	return uint8(math.Round(clamp01(v) * 255))
+}
+
+func rgbColor(args []*cssToken) (color.NRGBA, bool) {
+	var rgb [3]float64
+	for i := range rgb {
+		v, ok := colorValue(args[i], 255)
+		if !ok {
+			return color.NRGBA{}, false
+		}
+		rgb[i] = v / 255
+	}
+	a, ok := alphaValue(args)
+	return color.NRGBA{R: channel(rgb[0]), G: channel(rgb[1]), B: channel(rgb[2]), A: a}, ok
+}
+
+func hslColor(args []*cssToken) (color.NRGBA, bool) {
+	h, hOk := hueValue(args[0])
+	s, sOk := colorValue(args[1], 100)
+	l, lOk := colorValue(args[2], 100)
+	a, aOk := alphaValue(args)
+	if !hOk || !sOk || !lOk || !aOk {
+		return color.NRGBA{}, false
+	}
+	r, g, b := hslToRGB(h, clamp01(s/100), clamp01(l/100))
+	return color.NRGBA{R: channel(r), G: channel(g), B: channel(b), A: a}, true
+}
+
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	f := func(n float64) float64 {
+		k := math.Mod(n+h/30, 12)
+		a := s * math.Min(l, 1-l)
+		return l - a*math.Max(-1, math.Min(k-3, math.Min(9-k, 1)))
+	}
+	return f(0), f(8), f(4)
+}
+
+func hwbColor(args []*cssToken) (color.NRGBA, bool) {
+	h, hOk := hueValue(args[0])
+	w, wOk := colorValue(args[1], 100)
+	bl, bOk := colorValue(args[2], 100)
+	a, aOk := alphaValue(args)
+	if !hOk || !wOk || !bOk || !aOk {
+		return color.NRGBA{}, false
+	}
+	w, bl = clamp01(w/100), clamp01(bl/100)
+	if w+bl >= 1 {
+		gray := channel(w / (w + bl))
+		return color.NRGBA{R: gray, G: gray, B: gray, A: a}, true
+	}
+	r, g, b := hslToRGB(h, 1, 0.5)
+	mix := func(c float64) uint8 {
+		return channel(c*(1-w-bl) + w)
+	}
+	return color.NRGBA{R: mix(r), G: mix(g), B: mix(b), A: a}, true
+}
+
+func isCurrentColor(value string) bool {
+	return strings.EqualFold(value, "currentcolor")
+}
+
+// resolveCurrentColor replaces currentColor by the color of style, which for
+// color itself is the one of the parent.
+func resolveCurrentColor(style *TagStyle, pStyle *TagStyle) {
+	if isCurrentColor(style.Color) {
+		style.Color = ""
+		if pStyle != nil {
+			style.Color = pStyle.Color
+		}
+	}
+	current := style.Color
+	if current == "" {
+		current = "#000000"
+	}
+	for _, value := range []*string{
+		&style.BackgroundColor, &style.ColumnRuleColor,
+		&style.BorderColor.Top, &style.BorderColor.Right, &style.BorderColor.Bottom, &style.BorderColor.Left,
+	} {
+		if isCurrentColor(*value) {
+			*value = current
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package html2img
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value string
+		want  color.NRGBA
+		ok    bool
+	}{
+		{"#f00", color.NRGBA{255, 0, 0, 255}, true},
+		{"#F0A8", color.NRGBA{255, 0, 170, 136}, true},
+		{"#12ab34", color.NRGBA{0x12, 0xab, 0x34, 255}, true},
+		{"#12ab3480", color.NRGBA{0x12, 0xab, 0x34, 0x80}, true},
+		{"  #000  ", color.NRGBA{0, 0, 0, 255}, true},
+		{"#12345", color.NRGBA{}, false},
+		{"#1234567", color.NRGBA{}, false},
+		{"#ggg", color.NRGBA{}, false},
+		{"#", color.NRGBA{}, false},
+		{"red", color.NRGBA{255, 0, 0, 255}, true},
+		{"RebeccaPurple", color.NRGBA{0x66, 0x33, 0x99, 255}, true},
+		{"transparent", color.NRGBA{}, true},
+		{"notacolor", color.NRGBA{}, false},
+		{"currentcolor", color.NRGBA{}, false},
+		{"rgb(255, 0, 0)", color.NRGBA{255, 0, 0, 255}, true},
+		{"rgb(100%, 50%, 0%)", color.NRGBA{255, 128, 0, 255}, true},
+		{"rgb(300, -10, 0)", color.NRGBA{255, 0, 0, 255}, true},
+		{"rgba(0, 0, 255, 0.5)", color.NRGBA{0, 0, 255, 128}, true},
+		{"rgba(0, 0, 255, 50%)", color.NRGBA{0, 0, 255, 128}, true},
+		{"rgb(0, 0, 255, 2)", color.NRGBA{0, 0, 255, 255}, true},
+		{"RGB(1, 2, 3)", color.NRGBA{1, 2, 3, 255}, true},
+		{"rgb(1 2 3)", color.NRGBA{1, 2, 3, 255}, true},
+		{"rgb(1 2 3 / 0.2)", color.NRGBA{1, 2, 3, 51}, true},
+		{"rgb(none 2 3)", color.NRGBA{0, 2, 3, 255}, true},
+		{"rgb(1, 2)", color.NRGBA{}, false},
+		{"rgb(1, 2, 3, 4, 5)", color.NRGBA{}, false},
+		{"rgb(1, 2 3)", color.NRGBA{}, false},
+		{"rgb(1, 2, 3 / 0.5)", color.NRGBA{}, false},
+		{"rgb(1 2 3 0.5)", color.NRGBA{}, false},
+		{"rgb(1 2 / 3)", color.NRGBA{}, false},
+		{"rgb(1,, 2, 3)", color.NRGBA{}, false},
+		{"rgb(1px, 2, 3)", color.NRGBA{}, false},
+		{"rgb(a, b, c)", color.NRGBA{}, false},
+		{"rgb()", color.NRGBA{}, false},
+		{"rgb(1, 2, 3", color.NRGBA{1, 2, 3, 255}, true},
+		{"hsl(0, 100%, 50%)", color.NRGBA{255, 0, 0, 255}, true},
+		{"hsl(120deg 100% 25%)", color.NRGBA{0, 128, 0, 255}, true},
+		{"hsl(0.5turn, 100%, 50%)", color.NRGBA{0, 255, 255, 255}, true},
+		{"hsl(-120, 100%, 50%)", color.NRGBA{0, 0, 255, 255}, true},
+		{"hsla(240, 100%, 50%, 0.5)", color.NRGBA{0, 0, 255, 128}, true},
+		{"hsl(0, 0%, 100%)", color.NRGBA{255, 255, 255, 255}, true},
+		{"hsl(0px, 100%, 50%)", color.NRGBA{}, false},
+		{"hwb(0 0% 0%)", color.NRGBA{255, 0, 0, 255}, true},
+		{"hwb(0 60% 60%)", color.NRGBA{128, 128, 128, 255}, true},
+		{"lab(50% 0 0)", color.NRGBA{}, false},
+		{"red blue", color.NRGBA{}, false},
+		{"", color.NRGBA{}, false},
+		{"12px", color.NRGBA{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseColor(test.value)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("parseColor(%q) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestGetColor(t *testing.T) {
+	tests := []struct {
+		value string
+		want  color.Color
+	}{
+		{"", color.NRGBA{A: 255}},
+		{"garbage", color.NRGBA{A: 255}},
+		{"rgb(", color.NRGBA{A: 255}},
+		{"#", color.NRGBA{A: 255}},
+		{"hsl(,,,)", color.NRGBA{A: 255}},
+		{"blue", color.NRGBA{B: 255, A: 255}},
+	}
+	for _, test := range tests {
+		if got := getColor(test.value); got != test.want {
+			t.Errorf("getColor(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestCurrentColor(t *testing.T) {
+	runComputedStyleTests(t, func(s *TagStyle) string { return s.BackgroundColor }, []computedStyleTest{
+		{"own color", "p { color: red; background-color: currentcolor }", `<p id="e">a</p>`, "red"},
+		{"inherited color", "div { color: blue } p { background-color: currentColor }", `<div><p id="e">a</p></div>`, "blue"},
+		{"default color", "p { background-color: currentcolor }", `<p id="e">a</p>`, "#000000"},
+	})
+	runComputedStyleTests(t, colorOf, []computedStyleTest{
+		{"color of the parent", "div { color: green } p { color: currentcolor }", `<div><p id="e">a</p></div>`, "green"},
+		{"invalid color ignored", "p { color: red; color: #12345 }", `<p id="e">a</p>`, "red"},
+	})
+}
+
+func TestRenderColors(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"valid colors", styledDocument("div { color: hsl(120 50% 50% / 0.5); background-color: #abcd; border: 1px solid rgb(1 2 3) }", "<div>a</div>")},
+		{"invalid colors", styledDocument("div { color: rgb(; background-color: #; border: 1px solid hsl() }", "<div>a</div>")},
+		{"unknown colors", styledDocument("div { color: notacolor; background-color: notacolor; border: 1px solid notacolor; column-rule-color: notacolor; column-count: 2 }", "<div>a</div>")},
+		{"out of range colors", styledDocument("div { color: rgb(1e9, -1e9, NaN); background-color: hsl(1e30, 1e30%, -5%) }", "<div>a</div>")},
+	})
+}
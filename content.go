@@ -0,0 +1,274 @@
+package html2img
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	contentString = iota
+	contentAttr
+	contentCounter
+	contentCounters
+	contentURL
+	contentOpenQuote
+	contentCloseQuote
+	contentNoOpenQuote
+	contentNoCloseQuote
+)
+
+// contentItem is a piece of the value of the content property.
+type contentItem struct {
+	kind int
+	// Text of a string, name of an attribute or a counter, or url of an image
+	text      string
+	separator string
+	style     string
+}
+
+var quotes = [][2]string{{"“", "”"}, {"‘", "’"}}
+
+func (d *Dom) isPseudoElement() bool {
+	return d.TagName == "::before" || d.TagName == "::after"
+}
+
+// newPseudoElement returns the ::before or ::after box of parent, or nil when
+// the styles do not generate any content for it.
+func newPseudoElement(parent *Dom, name string, tagStyleList []*TagStyle) *Dom {
+	dom := &Dom{
+		DomType: DOM_TYPE_ELEMENT,
+		TagName: "::" + name,
+		parent:  parent,
+	}
+	setComputedStyle(dom, parent, tagStyleList)
+	content := dom.TagStyle.Content
+	if content == "" || content == "none" || content == "normal" || dom.TagStyle.Display == "none" {
+		return nil
+	}
+	if _, ok := parseContent(content); !ok {
+		// An invalid content is none
+		return nil
+	}
+	return dom
+}
+
+// parseContent parses the value of the content property: strings, attr(),
+// counter(), counters(), url() and quotes. It returns false when value is not
+// a content value.
+func parseContent(value string) ([]contentItem, bool) {
+	var items []contentItem
+	for rest := strings.TrimLeft(value, CUT_SET_LIST); rest != ""; rest = strings.TrimLeft(rest, CUT_SET_LIST) {
+		if rest[0] == '"' || rest[0] == '\'' {
+			text, n := parseCSSString(rest)
+			if n < 0 {
+				return nil, false
+			}
+			items = append(items, contentItem{kind: contentString, text: text})
+			rest = rest[n:]
+			continue
+		}
+		end := strings.IndexAny(rest, CUT_SET_LIST+"(")
+		if end < 0 {
+			end = len(rest)
+		}
+		name := rest[:end]
+		rest = rest[end:]
+		if !strings.HasPrefix(rest, "(") {
+			switch name {
+			case "open-quote":
+				items = append(items, contentItem{kind: contentOpenQuote})
+			case "close-quote":
+				items = append(items, contentItem{kind: contentCloseQuote})
+			case "no-open-quote":
+				items = append(items, contentItem{kind: contentNoOpenQuote})
+			case "no-close-quote":
+				items = append(items, contentItem{kind: contentNoCloseQuote})
+			default:
+				return nil, false
+			}
+			continue
+		}
+		args, n := parseFunctionArgs(rest)
+		if n < 0 {
+			return nil, false
+		}
+		rest = rest[n:]
+		if name != "url" && (len(args) == 0 || args[0] == "" || strings.ContainsAny(args[0], CUT_SET_LIST)) {
+			// Attributes and counters are named by an identifier
+			return nil, false
+		}
+		switch {
+		case name == "attr" && len(args) == 1:
+			items = append(items, contentItem{kind: contentAttr, text: args[0]})
+		case name == "url" && len(args) == 1:
+			items = append(items, contentItem{kind: contentURL, text: args[0]})
+		case name == "counter" && (len(args) == 1 || len(args) == 2):
+			item := contentItem{kind: contentCounter, text: args[0], style: "decimal"}
+			if len(args) == 2 {
+				item.style = args[1]
+			}
+			items = append(items, item)
+		case name == "counters" && (len(args) == 2 || len(args) == 3):
+			item := contentItem{kind: contentCounters, text: args[0], separator: args[1], style: "decimal"}
+			if len(args) == 3 {
+				item.style = args[2]
+			}
+			items = append(items, item)
+		default:
+			return nil, false
+		}
+		if last := items[len(items)-1]; last.style != "" && !listStyleTypes[last.style] {
+			return nil, false
+		}
+	}
+	return items, true
+}
+
+// parseCSSString returns the text of the quoted string s starts with and its
+// length in s, or -1 when it is not terminated.
+func parseCSSString(s string) (string, int) {
+	quote := s[0]
+	var text strings.Builder
+	for i := 1; i < len(s); {
+		c := s[i]
+		switch {
+		case c == quote:
+			return text.String(), i + 1
+		case c == '\\' && i+1 < len(s):
+			r, n := parseCSSEscape(s[i+1:])
+			if r >= 0 {
+				text.WriteRune(r)
+			}
+			i += 1 + n
+		default:
+			r, n := utf8.DecodeRuneInString(s[i:])
+			text.WriteRune(r)
+			i += n
+		}
+	}
+	return "", -1
+}
+
+// parseCSSEscape returns the character escaped by the text following a
+// backslash and the length of the escape, with a character of -1 for an
+// escaped newline.
+func parseCSSEscape(s string) (rune, int) {
+	n := 0
+	for n < len(s) && n < 6 && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+		n++
+	}
+	if n == 0 {
+		if s[0] == '\n' {
+			return -1, 1
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		return r, size
+	}
+	code, _ := strconv.ParseInt(s[:n], 16, 32)
+	if n < len(s) && (s[n] == ' ' || s[n] == '\t' || s[n] == '\n') {
+		// A white space ends the escape
+		n++
+	}
+	if code == 0 || code > utf8.MaxRune {
+		return utf8.RuneError, n
+	}
+	return rune(code), n
+}
+
+// parseFunctionArgs returns the comma separated arguments between the
+// parentheses s starts with, unquoted, and the length of the call in s, or -1
+// when the parenthesis is not closed.
+func parseFunctionArgs(s string) ([]string, int) {
+	var args []string
+	var arg strings.Builder
+	for i := 1; i < len(s); {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			text, n := parseCSSString(s[i:])
+			if n < 0 {
+				return nil, -1
+			}
+			arg.WriteString(text)
+			i += n
+			continue
+		case c == ',' || c == ')':
+			args = append(args, strings.Trim(arg.String(), CUT_SET_LIST))
+			arg.Reset()
+			if c == ')' {
+				return args, i + 1
+			}
+		default:
+			arg.WriteByte(c)
+		}
+		i++
+	}
+	return nil, -1
+}
+
+// generateContent creates the boxes of the content of the pseudo-element d,
+// with the counters and quotes in scope where it is.
+func (s *counterScope) generateContent(d *Dom) {
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			d.Children = append(d.Children, &Dom{
+				DomType:  DOM_TYPE_TEXT,
+				TagData:  text.String(),
+				TagStyle: getInheritStyle(d.TagStyle, nil),
+				parent:   d,
+			})
+			text.Reset()
+		}
+	}
+	d.Children = nil
+	items, _ := parseContent(d.TagStyle.Content)
+	for _, item := range items {
+		switch item.kind {
+		case contentString:
+			text.WriteString(item.text)
+		case contentAttr:
+			text.WriteString(d.parent.attr(item.text))
+		case contentCounter:
+			text.WriteString(counterText(item.style, s.value(item.text)))
+		case contentCounters:
+			var values []string
+			for _, c := range s.counters {
+				if c.name == item.text {
+					values = append(values, counterText(item.style, c.value))
+				}
+			}
+			if len(values) == 0 {
+				values = append(values, counterText(item.style, 0))
+			}
+			text.WriteString(strings.Join(values, item.separator))
+		case contentOpenQuote:
+			text.WriteString(quotes[minInt(s.quoteDepth, len(quotes)-1)][0])
+			s.quoteDepth++
+		case contentCloseQuote:
+			if s.quoteDepth > 0 {
+				s.quoteDepth--
+				text.WriteString(quotes[minInt(s.quoteDepth, len(quotes)-1)][1])
+			}
+		case contentNoOpenQuote:
+			s.quoteDepth++
+		case contentNoCloseQuote:
+			s.quoteDepth = maxInt(s.quoteDepth-1, 0)
+		case contentURL:
+			img, ok := d.loadImage(item.text)
+			if !ok {
+				// Images failing to load are left out
+				continue
+			}
+			flush()
+			d.Children = append(d.Children, &Dom{
+				DomType:  DOM_TYPE_ELEMENT,
+				TagName:  "img",
+				TagData:  img,
+				TagStyle: getInheritStyle(d.TagStyle, &TagStyle{Display: "inline"}),
+				parent:   d,
+			})
+		}
+	}
+	flush()
+}
@@ -0,0 +1,181 @@
+package html2img
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseContent(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+		kinds []int
+	}{
+		{`"a"`, true, []int{contentString}},
+		{`'a' "b"`, true, []int{contentString, contentString}},
+		{`attr(title) ": "`, true, []int{contentAttr, contentString}},
+		{`counter(item) counter(item, upper-roman)`, true, []int{contentCounter, contentCounter}},
+		{`counters(item, ".")`, true, []int{contentCounters}},
+		{`url(a.png)`, true, []int{contentURL}},
+		{`open-quote close-quote no-open-quote no-close-quote`, true, []int{contentOpenQuote, contentCloseQuote, contentNoOpenQuote, contentNoCloseQuote}},
+		{`"unterminated`, false, nil},
+		{`foo`, false, nil},
+		{`attr(a, b)`, false, nil},
+		{`counter()`, false, nil},
+		{`counter(item, foo)`, false, nil},
+		{`counters(item)`, false, nil},
+		{`attr(title`, false, nil},
+		{`bar(x)`, false, nil},
+	}
+	for _, test := range tests {
+		items, ok := parseContent(test.value)
+		if ok != test.ok {
+			t.Errorf("parseContent(%v) ok = %v, want %v", test.value, ok, test.ok)
+			continue
+		}
+		var kinds []int
+		for _, item := range items {
+			kinds = append(kinds, item.kind)
+		}
+		if len(kinds) != len(test.kinds) {
+			t.Errorf("parseContent(%v) = %v, want %v", test.value, kinds, test.kinds)
+			continue
+		}
+		for i := range kinds {
+			if kinds[i] != test.kinds[i] {
+				t.Errorf("parseContent(%v) = %v, want %v", test.value, kinds, test.kinds)
+				break
+			}
+		}
+	}
+}
+
+func TestParseCounters(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+		want  []counter
+	}{
+		{"none", true, nil},
+		{"a", true, []counter{{name: "a", value: 1}}},
+		{"a 5 b", true, []counter{{name: "a", value: 5}, {name: "b", value: 1}}},
+		{"a -2", true, []counter{{name: "a", value: -2}}},
+		{"5", false, nil},
+		{"5 a", false, nil},
+		{"a 1 2", false, nil},
+		{"a 1.5", false, nil},
+		{"a none", false, nil},
+		{"a #b", false, nil},
+	}
+	for _, test := range tests {
+		got, ok := parseCounters(test.value, 1)
+		if ok != test.ok || len(got) != len(test.want) {
+			t.Errorf("parseCounters(%v) = %v %v, want %v %v", test.value, got, ok, test.want, test.ok)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("parseCounters(%v) = %v, want %v", test.value, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+// pseudoText returns the text of the ::before or ::after of the element with
+// the id in the tree of body, and false when it has none.
+func pseudoText(body *Dom, id, name string) (string, bool) {
+	d := findDom(body, id)
+	if d == nil {
+		return "", false
+	}
+	var find func(parent *Dom) *Dom
+	find = func(parent *Dom) *Dom {
+		for _, ch := range parent.Children {
+			if ch.TagName == "::"+name && ch.parent != nil && ch.parent.node == d.node {
+				return ch
+			}
+			if found := find(ch); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	pseudo := find(d)
+	if pseudo == nil {
+		return "", false
+	}
+	var text strings.Builder
+	var collect func(d *Dom)
+	collect = func(d *Dom) {
+		if d.DomType == DOM_TYPE_TEXT {
+			text.WriteString(d.TagData.(string))
+		}
+		for _, ch := range d.Children {
+			collect(ch)
+		}
+	}
+	collect(pseudo)
+	return text.String(), true
+}
+
+func TestGeneratedContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		css     string
+		content string
+		id      string
+		pseudo  string
+		want    string
+		// The pseudo-element is generated
+		exist bool
+	}{
+		{"string", `p::before { content: "> " }`, `<p id="p">a</p>`, "p", "before", "> ", true},
+		{"after", `p::after { content: " <" }`, `<p id="p">a</p>`, "p", "after", " <", true},
+		{"single colon", `p:before { content: "x" }`, `<p id="p">a</p>`, "p", "before", "x", true},
+		{"attr", `a::after { content: " (" attr(href) ")" }`, `<a id="a" href="x.html">a</a>`, "a", "after", " (x.html)", true},
+		{"escape", `p::before { content: "\2022  " }`, `<p id="p">a</p>`, "p", "before", "• ", true},
+		{
+			"counter",
+			`body { counter-reset: h } h2 { counter-increment: h } h2::before { content: counter(h) ". " }`,
+			`<h2>a</h2><h2 id="h">b</h2>`, "h", "before", "2. ", true,
+		},
+		{
+			"counter style",
+			`body { counter-reset: h 3 } h2 { counter-increment: h } h2::before { content: counter(h, lower-roman) }`,
+			`<h2 id="h">a</h2>`, "h", "before", "iv", true,
+		},
+		{
+			"nested counters",
+			`ol { counter-reset: item; list-style: none } li { counter-increment: item } li::before { content: counters(item, ".") " " }`,
+			`<ol><li>a<ol><li>b</li><li id="li">c</li></ol></li></ol>`, "li", "before", "1.2 ", true,
+		},
+		{"quotes", `q::before { content: open-quote } q::after { content: close-quote }`, `<q id="q">a <q>b</q></q>`, "q", "after", "”", true},
+		{"none", `p::before { content: none }`, `<p id="p">a</p>`, "p", "before", "", false},
+		{"no content", `p::before { color: red }`, `<p id="p">a</p>`, "p", "before", "", false},
+		{"invalid", `p::before { content: "x" } p::before { content: foo(x) }`, `<p id="p">a</p>`, "p", "before", "x", true},
+		{"invalid alone", `p::before { content: counter(a, foo) }`, `<p id="p">a</p>`, "p", "before", "", false},
+		{"display none", `p::before { content: "x"; display: none }`, `<p id="p">a</p>`, "p", "before", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := layoutBody(t, test.css, test.content)
+			got, exist := pseudoText(body, test.id, test.pseudo)
+			if exist != test.exist || got != test.want {
+				t.Errorf("::%v = %q %v, want %q %v", test.pseudo, got, exist, test.want, test.exist)
+			}
+		})
+	}
+}
+
+func TestRenderGeneratedContent(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"invalid content", styledDocument(`p::before { content: attr( } p::after { content: "x" counter() }`, "<p>a</p>")},
+		{"invalid counters", styledDocument(`p { counter-reset: 5; counter-increment: 1 2 3; counter-set: a b c 4 }`, "<p>a</p>")},
+		{"broken image", styledDocument(`p::before { content: url(missing.png) "x" }`, "<p>a</p>")},
+		{"block pseudo-element", styledDocument(`p::before { content: "x"; display: block; height: 10px }`, "<p>a</p>")},
+		{"unknown functions", styledDocument(`p::before { content: foo(bar) } p::after { content: "unterminated }`, "<p>a</p>")},
+		{"unknown counter style", styledDocument(`p::before { content: counter(x, foo) counters(x, ".", bar) }`, "<p>a</p>")},
+		{"unbalanced quotes", styledDocument(`p::before { content: close-quote no-close-quote }`, "<p>a</p>")},
+	})
+}
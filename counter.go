@@ -0,0 +1,166 @@
+package html2img
+
+import (
+	"strconv"
+	"strings"
+)
+
+// counter is an instance of a CSS counter. Reversed counters are the ones of
+// reversed lists, whose items count down.
+type counter struct {
+	name     string
+	value    int
+	reversed bool
+}
+
+// counterScope holds the counters in scope while the dom tree is walked in
+// document order, the innermost instance of a name last.
+type counterScope struct {
+	counters []counter
+	// Nesting level of the quotes opened by generated content
+	quoteDepth int
+}
+
+// parseCounters parses the value of counter-reset, counter-increment or
+// counter-set: a list of counter names, each one optionally followed by an
+// integer replacing defaultValue. It returns false when value is not such a
+// list.
+func parseCounters(value string, defaultValue int) ([]counter, bool) {
+	var counters []counter
+	if value == "" || value == "none" {
+		return counters, true
+	}
+	named := false
+	for _, field := range strings.Fields(value) {
+		if n, err := strconv.Atoi(field); err == nil {
+			if !named {
+				return nil, false
+			}
+			counters[len(counters)-1].value = n
+			named = false
+			continue
+		}
+		tokens := tokenizeCSS(field)
+		if len(tokens) != 1 || tokens[0].kind != tokenIdent || field == "none" || cssWideKeywords[field] {
+			return nil, false
+		}
+		counters = append(counters, counter{name: field, value: defaultValue})
+		named = true
+	}
+	return counters, true
+}
+
+func hasCounter(counters []counter, name string) bool {
+	for _, c := range counters {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// walk applies the counter properties of d and of its descendants and adds
+// the markers of the list items. A counter created on an element is in scope
+// for its descendants and its following siblings.
+func (s *counterScope) walk(d *Dom) {
+	s.apply(d)
+	if d.isPseudoElement() {
+		s.generateContent(d)
+	}
+	if d.TagStyle.Display == "list-item" {
+		addMarker(d, s.value("list-item"))
+	}
+	mark := len(s.counters)
+	for _, child := range d.Children {
+		if child.DomType == DOM_TYPE_ELEMENT {
+			s.walk(child)
+		}
+	}
+	s.counters = s.counters[:mark]
+}
+
+// apply resets, then increments, then sets the counters of d. List elements
+// reset the list-item counter and list items increment it, as the html user
+// agent style does.
+func (s *counterScope) apply(d *Dom) {
+	style := d.TagStyle
+	resets, _ := parseCounters(style.CounterReset, 0)
+	if style.CounterReset == "" && (d.TagName == "ol" || d.TagName == "ul" || d.TagName == "menu") {
+		resets = append(resets, listReset(d))
+	}
+	s.counters = append(s.counters, resets...)
+
+	increments, _ := parseCounters(style.CounterIncrement, 1)
+	if style.Display == "list-item" && !hasCounter(increments, "list-item") {
+		step := 1
+		if c := s.find("list-item"); c != nil && c.reversed {
+			step = -1
+		}
+		increments = append(increments, counter{name: "list-item", value: step})
+	}
+	for _, c := range increments {
+		s.instance(c.name).value += c.value
+	}
+
+	sets, _ := parseCounters(style.CounterSet, 0)
+	if value, err := strconv.Atoi(d.attr("value")); err == nil && d.TagName == "li" && !hasCounter(sets, "list-item") {
+		sets = append(sets, counter{name: "list-item", value: value})
+	}
+	for _, c := range sets {
+		s.instance(c.name).value = c.value
+	}
+}
+
+// listReset returns the list-item counter of a list, so that its first item
+// is numbered by the start attribute. A reversed list counts down from the
+// number of its items by default.
+func listReset(list *Dom) counter {
+	reset := counter{name: "list-item"}
+	start, err := strconv.Atoi(list.attr("start"))
+	if list.TagName != "ol" || !list.hasAttr("reversed") {
+		if err == nil {
+			reset.value = start - 1
+		}
+		return reset
+	}
+	reset.reversed = true
+	if err != nil {
+		start = 0
+		for _, child := range list.Children {
+			if child.DomType == DOM_TYPE_ELEMENT && child.TagStyle.Display == "list-item" {
+				start++
+			}
+		}
+	}
+	reset.value = start + 1
+	return reset
+}
+
+// find returns the innermost counter named name, or nil when there is none.
+func (s *counterScope) find(name string) *counter {
+	for i := len(s.counters) - 1; i >= 0; i-- {
+		if s.counters[i].name == name {
+			return &s.counters[i]
+		}
+	}
+	return nil
+}
+
+// instance returns the innermost counter named name, creating it on the
+// current element when there is none.
+func (s *counterScope) instance(name string) *counter {
+	if c := s.find(name); c != nil {
+		return c
+	}
+	s.counters = append(s.counters, counter{name: name})
+	return &s.counters[len(s.counters)-1]
+}
+
+// value returns the value of the innermost counter named name, 0 when there
+// is none.
+func (s *counterScope) value(name string) int {
+	if c := s.find(name); c != nil {
+		return c.value
+	}
+	return 0
+}
@@ -0,0 +1,434 @@
+package html2img
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of the tokens of CSS Syntax Level 3.
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenFunction
+	tokenAtKeyword
+	tokenHash
+	tokenString
+	tokenBadString
+	tokenURL
+	tokenBadURL
+	tokenDelim
+	tokenNumber
+	tokenPercentage
+	tokenDimension
+	tokenWhitespace
+	tokenCDO
+	tokenCDC
+	tokenColon
+	tokenSemicolon
+	tokenComma
+	tokenOpenSquare
+	tokenCloseSquare
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenCurly
+	tokenCloseCurly
+)
+
+// Position is a line and a column of a stylesheet, both counted from 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+type cssToken struct {
+	kind int
+	// Name of an ident, function, at-keyword or hash, value of a string or an
+	// url, character of a delim, or unit of a dimension
+	value string
+	num   float64
+	// Set on the integer numbers and on the hashes that are valid ids
+	integer bool
+	id      bool
+	// Source text of the token
+	text string
+	pos  Position
+}
+
+// cssTokenizer splits a stylesheet into tokens, as described by CSS Syntax
+// Level 3. It never fails: invalid input gives bad-string, bad-url and delim
+// tokens.
+type cssTokenizer struct {
+	s    []rune
+	pos  int
+	line int
+	col  int
+}
+
+// tokenizeCSS returns the tokens of css, without the comments.
+func tokenizeCSS(css string) []cssToken {
+	// Preprocessing of the input stream
+	css = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\f", "\n", "\x00", "�").Replace(css)
+	t := &cssTokenizer{s: []rune(css), line: 1, col: 1}
+	var tokens []cssToken
+	for {
+		token := t.next()
+		if token.kind == tokenEOF {
+			return tokens
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+func (t *cssTokenizer) peekAt(i int) rune {
+	if t.pos+i < len(t.s) {
+		return t.s[t.pos+i]
+	}
+	return -1
+}
+
+func (t *cssTokenizer) advance(n int) {
+	for ; n > 0 && t.pos < len(t.s); n-- {
+		if t.s[t.pos] == '\n' {
+			t.line++
+			t.col = 1
+		} else {
+			t.col++
+		}
+		t.pos++
+	}
+}
+
+func isWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+func isHexDigit(r rune) bool {
+	return isDigit(r) || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F'
+}
+
+func isNameStart(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_' || r >= 0x80
+}
+
+func isName(r rune) bool {
+	return isNameStart(r) || isDigit(r) || r == '-'
+}
+
+// validEscape reports whether the two runes are a backslash starting an
+// escape.
+func validEscape(a, b rune) bool {
+	return a == '\\' && b != '\n' && b != -1
+}
+
+// startsIdent reports whether the three runes start an identifier.
+func startsIdent(a, b, c rune) bool {
+	switch {
+	case a == '-':
+		return isNameStart(b) || b == '-' || validEscape(b, c)
+	case isNameStart(a):
+		return true
+	}
+	return validEscape(a, b)
+}
+
+// startsNumber reports whether the three runes start a number.
+func startsNumber(a, b, c rune) bool {
+	switch {
+	case a == '+' || a == '-':
+		return isDigit(b) || b == '.' && isDigit(c)
+	case a == '.':
+		return isDigit(b)
+	}
+	return isDigit(a)
+}
+
+func (t *cssTokenizer) next() cssToken {
+	t.skipComments()
+	start, pos := t.pos, Position{Line: t.line, Column: t.col}
+	token := t.consume()
+	token.text = string(t.s[start:t.pos])
+	token.pos = pos
+	return token
+}
+
+func (t *cssTokenizer) skipComments() {
+	for t.peekAt(0) == '/' && t.peekAt(1) == '*' {
+		t.advance(2)
+		for t.pos < len(t.s) && !(t.peekAt(0) == '*' && t.peekAt(1) == '/') {
+			t.advance(1)
+		}
+		t.advance(2)
+	}
+}
+
+func (t *cssTokenizer) consume() cssToken {
+	c := t.peekAt(0)
+	switch {
+	case c == -1:
+		return cssToken{kind: tokenEOF}
+	case isWhitespace(c):
+		for isWhitespace(t.peekAt(0)) {
+			t.advance(1)
+		}
+		return cssToken{kind: tokenWhitespace}
+	case c == '"' || c == '\'':
+		return t.consumeString(c)
+	case c == '#':
+		if isName(t.peekAt(1)) || validEscape(t.peekAt(1), t.peekAt(2)) {
+			t.advance(1)
+			id := startsIdent(t.peekAt(0), t.peekAt(1), t.peekAt(2))
+			return cssToken{kind: tokenHash, value: t.consumeName(), id: id}
+		}
+	case c == '(':
+		t.advance(1)
+		return cssToken{kind: tokenOpenParen}
+	case c == ')':
+		t.advance(1)
+		return cssToken{kind: tokenCloseParen}
+	case c == '[':
+		t.advance(1)
+		return cssToken{kind: tokenOpenSquare}
+	case c == ']':
+		t.advance(1)
+		return cssToken{kind: tokenCloseSquare}
+	case c == '{':
+		t.advance(1)
+		return cssToken{kind: tokenOpenCurly}
+	case c == '}':
+		t.advance(1)
+		return cssToken{kind: tokenCloseCurly}
+	case c == ',':
+		t.advance(1)
+		return cssToken{kind: tokenComma}
+	case c == ':':
+		t.advance(1)
+		return cssToken{kind: tokenColon}
+	case c == ';':
+		t.advance(1)
+		return cssToken{kind: tokenSemicolon}
+	case c == '+' || c == '.':
+		if startsNumber(c, t.peekAt(1), t.peekAt(2)) {
+			return t.consumeNumeric()
+		}
+	case c == '-':
+		if startsNumber(c, t.peekAt(1), t.peekAt(2)) {
+			return t.consumeNumeric()
+		}
+		if t.peekAt(1) == '-' && t.peekAt(2) == '>' {
+			t.advance(3)
+			return cssToken{kind: tokenCDC}
+		}
+		if startsIdent(c, t.peekAt(1), t.peekAt(2)) {
+			return t.consumeIdentLike()
+		}
+	case c == '<':
+		if t.peekAt(1) == '!' && t.peekAt(2) == '-' && t.peekAt(3) == '-' {
+			t.advance(4)
+			return cssToken{kind: tokenCDO}
+		}
+	case c == '@':
+		if startsIdent(t.peekAt(1), t.peekAt(2), t.peekAt(3)) {
+			t.advance(1)
+			return cssToken{kind: tokenAtKeyword, value: t.consumeName()}
+		}
+	case c == '\\':
+		if validEscape(c, t.peekAt(1)) {
+			return t.consumeIdentLike()
+		}
+	case isDigit(c):
+		return t.consumeNumeric()
+	case isNameStart(c):
+		return t.consumeIdentLike()
+	}
+	t.advance(1)
+	return cssToken{kind: tokenDelim, value: string(c)}
+}
+
+// consumeEscape consumes an escape after its backslash.
+func (t *cssTokenizer) consumeEscape() rune {
+	if !isHexDigit(t.peekAt(0)) {
+		c := t.peekAt(0)
+		if c == -1 {
+			return utf8.RuneError
+		}
+		t.advance(1)
+		return c
+	}
+	n := 0
+	for n < 6 && isHexDigit(t.peekAt(n)) {
+		n++
+	}
+	code, _ := strconv.ParseInt(string(t.s[t.pos:t.pos+n]), 16, 32)
+	t.advance(n)
+	if isWhitespace(t.peekAt(0)) {
+		t.advance(1)
+	}
+	if code == 0 || code > utf8.MaxRune || 0xD800 <= code && code <= 0xDFFF {
+		return utf8.RuneError
+	}
+	return rune(code)
+}
+
+func (t *cssTokenizer) consumeName() string {
+	var name strings.Builder
+	for {
+		c := t.peekAt(0)
+		switch {
+		case isName(c):
+			name.WriteRune(c)
+			t.advance(1)
+		case validEscape(c, t.peekAt(1)):
+			t.advance(1)
+			name.WriteRune(t.consumeEscape())
+		default:
+			return name.String()
+		}
+	}
+}
+
+func (t *cssTokenizer) consumeString(quote rune) cssToken {
+	t.advance(1)
+	var value strings.Builder
+	for {
+		c := t.peekAt(0)
+		switch {
+		case c == -1 || c == quote:
+			t.advance(1)
+			return cssToken{kind: tokenString, value: value.String()}
+		case c == '\n':
+			// The newline is not part of the bad string
+			return cssToken{kind: tokenBadString}
+		case c == '\\':
+			switch t.peekAt(1) {
+			case -1:
+				t.advance(1)
+			case '\n':
+				t.advance(2)
+			default:
+				t.advance(1)
+				value.WriteRune(t.consumeEscape())
+			}
+		default:
+			value.WriteRune(c)
+			t.advance(1)
+		}
+	}
+}
+
+func (t *cssTokenizer) consumeNumeric() cssToken {
+	start := t.pos
+	integer := true
+	if c := t.peekAt(0); c == '+' || c == '-' {
+		t.advance(1)
+	}
+	for isDigit(t.peekAt(0)) {
+		t.advance(1)
+	}
+	if t.peekAt(0) == '.' && isDigit(t.peekAt(1)) {
+		integer = false
+		t.advance(1)
+		for isDigit(t.peekAt(0)) {
+			t.advance(1)
+		}
+	}
+	if c := t.peekAt(0); c == 'e' || c == 'E' {
+		n := 1
+		if s := t.peekAt(1); s == '+' || s == '-' {
+			n = 2
+		}
+		if isDigit(t.peekAt(n)) {
+			integer = false
+			t.advance(n)
+			for isDigit(t.peekAt(0)) {
+				t.advance(1)
+			}
+		}
+	}
+	num, _ := strconv.ParseFloat(string(t.s[start:t.pos]), 64)
+	switch {
+	case startsIdent(t.peekAt(0), t.peekAt(1), t.peekAt(2)):
+		return cssToken{kind: tokenDimension, num: num, integer: integer, value: t.consumeName()}
+	case t.peekAt(0) == '%':
+		t.advance(1)
+		return cssToken{kind: tokenPercentage, num: num}
+	}
+	return cssToken{kind: tokenNumber, num: num, integer: integer}
+}
+
+func (t *cssTokenizer) consumeIdentLike() cssToken {
+	name := t.consumeName()
+	if t.peekAt(0) != '(' {
+		return cssToken{kind: tokenIdent, value: name}
+	}
+	t.advance(1)
+	if !strings.EqualFold(name, "url") {
+		return cssToken{kind: tokenFunction, value: name}
+	}
+	n := 0
+	for isWhitespace(t.peekAt(n)) {
+		n++
+	}
+	if c := t.peekAt(n); c == '"' || c == '\'' {
+		// A quoted url is a function taking a string
+		return cssToken{kind: tokenFunction, value: name}
+	}
+	t.advance(n)
+	return t.consumeURL()
+}
+
+func (t *cssTokenizer) consumeURL() cssToken {
+	var value strings.Builder
+	for {
+		c := t.peekAt(0)
+		switch {
+		case c == ')' || c == -1:
+			t.advance(1)
+			return cssToken{kind: tokenURL, value: value.String()}
+		case isWhitespace(c):
+			for isWhitespace(t.peekAt(0)) {
+				t.advance(1)
+			}
+			if c := t.peekAt(0); c == ')' || c == -1 {
+				t.advance(1)
+				return cssToken{kind: tokenURL, value: value.String()}
+			}
+			t.consumeBadURL()
+			return cssToken{kind: tokenBadURL}
+		case c == '"' || c == '\'' || c == '(' || c < 0x20 && c != '\t' || c == 0x7F:
+			t.consumeBadURL()
+			return cssToken{kind: tokenBadURL}
+		case c == '\\':
+			if !validEscape(c, t.peekAt(1)) {
+				t.consumeBadURL()
+				return cssToken{kind: tokenBadURL}
+			}
+			t.advance(1)
+			value.WriteRune(t.consumeEscape())
+		default:
+			value.WriteRune(c)
+			t.advance(1)
+		}
+	}
+}
+
+// consumeBadURL consumes the remnants of a bad url up to its parenthesis.
+func (t *cssTokenizer) consumeBadURL() {
+	for {
+		c := t.peekAt(0)
+		switch {
+		case c == ')' || c == -1:
+			t.advance(1)
+			return
+		case validEscape(c, t.peekAt(1)):
+			t.advance(1)
+			t.consumeEscape()
+		default:
+			t.advance(1)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package html2img
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var tokenNames = map[int]string{
+	tokenIdent: "ident", tokenFunction: "function", tokenAtKeyword: "at", tokenHash: "hash",
+	tokenString: "string", tokenBadString: "bad-string", tokenURL: "url", tokenBadURL: "bad-url",
+	tokenDelim: "delim", tokenNumber: "number", tokenPercentage: "percentage", tokenDimension: "dimension",
+	tokenWhitespace: "ws", tokenCDO: "cdo", tokenCDC: "cdc", tokenColon: ":", tokenSemicolon: ";",
+	tokenComma: ",", tokenOpenSquare: "[", tokenCloseSquare: "]", tokenOpenParen: "(",
+	tokenCloseParen: ")", tokenOpenCurly: "{", tokenCloseCurly: "}",
+}
+
+// describeTokens returns the kinds of the tokens with their value or number.
+func describeTokens(tokens []cssToken) string {
+	var parts []string
+	for _, token := range tokens {
+		name := tokenNames[token.kind]
+		switch token.kind {
+		case tokenNumber, tokenPercentage:
+			name += fmt.Sprintf("(%v)", token.num)
+		case tokenDimension:
+			name += fmt.Sprintf("(%v%v)", token.num, token.value)
+		case tokenWhitespace, tokenCDO, tokenCDC, tokenBadURL:
+		default:
+			if len(name) > 1 {
+				name += "(" + token.value + ")"
+			}
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTokenizeCSS(t *testing.T) {
+	tests := []struct {
+		css  string
+		want string
+	}{
+		{"a{color:red}", "ident(a) { ident(color) : ident(red) }"},
+		{"  \n\t", "ws"},
+		{"/* comment */a/**/b", "ident(a) ident(b)"},
+		{"/* unterminated", ""},
+		{"-moz-x --custom _a \\31 x", "ident(-moz-x) ws ident(--custom) ws ident(_a) ws ident(1x)"},
+		{"rgb( 1 )", "function(rgb) ws number(1) ws )"},
+		{"@media @-x", "at(media) ws at(-x)"},
+		{"#id #1a", "hash(id) ws hash(1a)"},
+		{`"a\"b" 'c'`, `string(a"b) ws string(c)`},
+		{`"a\
+b"`, "string(ab)"},
+		{"\"abc\ndef", "bad-string() ws ident(def)"},
+		{`"unterminated`, "string(unterminated)"},
+		{"url(a.png) url( 'b.png' ) url(a b)", "url(a.png) ws function(url) ws string(b.png) ws ) ws bad-url"},
+		{"12 -3.5 +.5 1e3 10% 2px -1.5em", "number(12) ws number(-3.5) ws number(0.5) ws number(1000) ws percentage(10) ws dimension(2px) ws dimension(-1.5em)"},
+		{"1e", "dimension(1e)"},
+		{"<!-- -->", "cdo ws cdc"},
+		{"a > b + c ~ d", "ident(a) ws delim(>) ws ident(b) ws delim(+) ws ident(c) ws delim(~) ws ident(d)"},
+		{"[x=y];,", "[ ident(x) delim(=) ident(y) ] ; ,"},
+		{"!important", "delim(!) ident(important)"},
+		{"\\", "delim(\\)"},
+		{"é€", "ident(é€)"},
+	}
+	for _, test := range tests {
+		if got := describeTokens(tokenizeCSS(test.css)); got != test.want {
+			t.Errorf("tokenizeCSS(%q) = %v, want %v", test.css, got, test.want)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	tokens := tokenizeCSS("a {\n  color: red;\r\n}")
+	var got []string
+	for _, token := range tokens {
+		if token.kind != tokenWhitespace {
+			got = append(got, fmt.Sprintf("%v:%v", token.pos.Line, token.pos.Column))
+		}
+	}
+	want := "1:1 1:3 2:3 2:8 2:10 2:13 3:1"
+	if strings.Join(got, " ") != want {
+		t.Errorf("positions = %v, want %v", strings.Join(got, " "), want)
+	}
+}
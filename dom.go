@@ -1,16 +1,12 @@
 package html2img
 
 import (
-	"fmt"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
-	"net/http"
 	"sort"
-	"strings"
 
-	"github.com/nfnt/resize"
 	"golang.org/x/net/html"
 )
 
@@ -28,6 +24,12 @@ type ImageData struct {
 type EndOffset struct {
 	X2 int
 	Y2 int
+
+	// Margins of the first and last in-flow children that collapse with the
+	// parent's own margins instead of being placed inside it.
+	topMargin        marginStrut
+	bottomMargin     marginStrut
+	collapsedThrough bool
 }
 
 type Rectangle struct {
@@ -47,34 +49,147 @@ type Dom struct {
 	TagName  string
 	TagClass string
 	TagData  interface{}
+	attrs    []html.Attribute
+	// Element the dom is built from, which selectors match
+	node *html.Node
+	// Declarations of the style attribute
+	inlineStyle *TagStyle
+	// Environment of the document viewport units are of, set on the
+	// ancestors of body
+	media *mediaContext
+	// Loader of the images of the document, set with media
+	images *imageLoader
 
 	TagStyle *TagStyle
 
 	Children []*Dom
+	parent   *Dom
+
+	// Children built from the html. Layout replaces Children by the boxes and
+	// fragments it places, so the dom can be laid out again.
+	source  []*Dom
+	laidOut bool
+
+	// Absolutely positioned descendants waiting for this dom to be laid out
+	// as their containing block
+	absolutes []absoluteBox
+
+	// Distance from the top of the border box to the baseline of the last
+	// line, or of the text of a text fragment
+	baseline    int
+	hasBaseline bool
+
+	// Table wrapped by this anonymous box with its captions
+	table *Dom
+
+	// The height is a percentage of a containing block whose height depends
+	// on its content, which behaves as auto
+	indefiniteHeight bool
+
+	// Floats of the block formatting context this dom is the root of
+	floats *floatContext
+
+	// Line boxes of the inline content, where columns may break
+	lines []lineBox
+	// Rules painted between the columns of a multi-column container
+	columnRules []Rectangle
 }
 
+// sourceChildren returns the children of d before layout.
+func (d *Dom) sourceChildren() []*Dom {
+	if !d.laidOut {
+		d.source = d.Children
+		d.laidOut = true
+	}
+	return d.source
+}
+
+// isPositionAbsolute reports whether the dom is taken out of the flow by
+// position absolute or fixed.
 func (d *Dom) isPositionAbsolute() bool {
-	return d.TagStyle.Position == "absolute"
+	return d.TagStyle.Position == "absolute" || d.TagStyle.Position == "fixed"
+}
+
+// isInlineLevel reports whether the dom is laid out on lines with its siblings
+// instead of stacked as a block.
+func (d *Dom) isInlineLevel() bool {
+	if d.DomType == DOM_TYPE_TEXT {
+		return true
+	}
+	if d.isPositionAbsolute() || d.isFloat() {
+		return false
+	}
+	switch d.TagStyle.Display {
+	case "inline", "inline-block", "inline-flex", "inline-grid", "inline-table":
+		return true
+	}
+	return false
+}
+
+// isInlineBox reports whether the dom is an inline element whose content is
+// laid out on the lines of its block container.
+func (d *Dom) isInlineBox() bool {
+	return d.DomType == DOM_TYPE_ELEMENT && d.TagStyle.Display == "inline" && d.TagName != "img"
 }
 
 func (d *Dom) isAutoHeight() bool {
-	return d.TagStyle.Height == "auto" || d.TagStyle.Height == ""
+	return d.TagStyle.Height == "auto" || d.TagStyle.Height == "" || d.indefiniteHeight
+}
+
+// shift moves the dom and all of its descendants.
+func (d *Dom) shift(dx, dy int) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+	for _, rect := range []*Rectangle{&d.Outer, &d.Container, &d.Inwall, &d.Inner} {
+		rect.X1 += dx
+		rect.X2 += dx
+		rect.Y1 += dy
+		rect.Y2 += dy
+	}
+	for _, child := range d.Children {
+		child.shift(dx, dy)
+	}
 }
 
 func GetHtmlDom(htmlNode *html.Node, tagStyleList []*TagStyle) *Dom {
-	bodyDom := &Dom{}
-	setDomAttr(bodyDom, htmlNode)
-	domStyle := getDomStyle(bodyDom, tagStyleList)
+	return getHtmlDom(htmlNode, tagStyleList, defaultMedia, &imageLoader{loader: DefaultLoader})
+}
+
+func getHtmlDom(htmlNode *html.Node, tagStyleList []*TagStyle, media *mediaContext, images *imageLoader) *Dom {
+	// The ancestors of body are styled for body to inherit from them
+	var root *Dom
+	var ancestors []*html.Node
+	for n := htmlNode.Parent; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		ancestors = append([]*html.Node{n}, ancestors...)
+	}
+	for _, n := range ancestors {
+		ancestor := &Dom{media: media, images: images}
+		setDomAttr(ancestor, n)
+		setComputedStyle(ancestor, root, tagStyleList)
+		root = ancestor
+	}
+	bodyDom := buildDom(htmlNode, root, tagStyleList)
+	if bodyDom == nil {
+		// A body with display none is laid out empty, with nothing drawn
+		bodyDom = &Dom{DomType: DOM_TYPE_ELEMENT, TagName: "body", TagStyle: &TagStyle{}}
+	}
+	bodyDom.parent = nil
+	bodyDom.media, bodyDom.images = media, images
+	(&counterScope{}).walk(bodyDom)
+	domStyle := bodyDom.TagStyle
 	bodyDom.Container.X1 = 0
 	bodyDom.Container.Y1 = 0
 	bodyDom.Inner.X1 = 0
 	bodyDom.Inner.Y1 = 0
 	bodyWidth := getIntSize(domStyle.Width)
 	if bodyWidth == 0 {
-		panic("body with is required")
+		// A body without width, like the synthesized body of a fragment, is
+		// as wide as the viewport
+		bodyWidth = media.width
 	}
-	bodyDom.Container.X2 = bodyWidth
-	bodyDom.Inner.X2 = bodyWidth
+	bodyDom.Container.X2 = bodyWidth - 1
+	bodyDom.Inner.X2 = bodyWidth - 1
 
 	if domStyle.Padding.Left != "" {
 		bodyDom.Inner.X1 += getIntSize(domStyle.Padding.Left)
@@ -86,316 +201,674 @@ func GetHtmlDom(htmlNode *html.Node, tagStyleList []*TagStyle) *Dom {
 		bodyDom.Inner.X2 -= getIntSize(domStyle.Padding.Right)
 	}
 
-	bodyDom.TagStyle = domStyle
-	children, endOffset := getChildren(htmlNode, tagStyleList, []*Dom{bodyDom})
+	bodyDom.floats = &floatContext{}
+	children, endOffset := getChildren([]*Dom{bodyDom})
 	bodyDom.Children = children
+	endOffset.Y2 = maxInt(endOffset.Y2, bodyDom.floats.bottom()-1)
 	bodyDom.Inner.Y2 = endOffset.Y2
 	bodyDom.Container.Y2 = endOffset.Y2
 	if domStyle.Padding.Bottom != "" {
 		bodyDom.Inner.Y2 += getIntSize(domStyle.Padding.Bottom)
 	}
 	bodyDom.Outer = bodyDom.Container
+	bodyDom.layoutAbsolutes()
 	return bodyDom
 }
 
-func getChildren(htmlNode *html.Node, tagStyleList []*TagStyle, parents []*Dom) ([]*Dom, EndOffset) {
-	var children []*Dom
-	parent := parents[len(parents)-1]
-	pX1 := parent.Inner.X1
-	pY1 := parent.Inner.Y1
-	pX2 := parent.Inner.X2
-	pWidth := pX2 - pX1 + 1
-	var endOffset EndOffset
-CHILDREN:
-	for ch := htmlNode.FirstChild; ch != nil; {
+// buildDom creates the dom tree of htmlNode with the computed style of every
+// element. The boxes are placed later by getChildren.
+func buildDom(htmlNode *html.Node, parent *Dom, tagStyleList []*TagStyle) *Dom {
+	dom := &Dom{}
+	setDomAttr(dom, htmlNode)
+	setComputedStyle(dom, parent, tagStyleList)
+	if dom.TagStyle.Display == "none" {
+		return nil
+	}
+	if dom.TagName == "img" {
+		img, ok := dom.loadImage(getAttr(htmlNode, "src"))
+		if !ok {
+			// A broken image keeps its box, with nothing drawn in it
+			img = ImageData{Img: image.NewNRGBA(image.Rect(0, 0, 1, 1))}
+		}
+		dom.TagData = img
+	}
+	for ch := htmlNode.FirstChild; ch != nil; ch = ch.NextSibling {
 		if ch.Type != html.ElementNode && ch.Type != html.TextNode {
-			ch = ch.NextSibling
 			continue
 		}
 		// ignore empty text node
-		if ch.Type == html.TextNode {
-			textData := strings.Trim(ch.Data, CUT_SET_LIST)
-			if textData == "" {
-				ch = ch.NextSibling
-				continue
-			}
-		}
-		dom := &Dom{}
-		setDomAttr(dom, ch)
-		domStyle := getDomStyle(dom, tagStyleList)
-
-		calcStyle := getInheritStyle(parent.TagStyle, domStyle)
-		width := getIntPx(calcStyle.Width, pWidth)
-		height := getIntSize(calcStyle.Height)
-
-		dom.TagStyle = domStyle
-
-		dom.Outer.X1 = pX1
-		dom.Container.X1 = dom.Outer.X1
-		dom.Outer.Y1 = pY1
-		dom.Container.Y1 = pY1
-		if domStyle.Margin.Left != "" {
-			dom.Container.X1 += getIntSize(domStyle.Margin.Left)
+		if ch.Type == html.TextNode && ch.Data == "" {
+			continue
 		}
-		if domStyle.Margin.Top != "" {
-			dom.Container.Y1 += getIntSize(domStyle.Margin.Top)
+		if child := buildDom(ch, dom, tagStyleList); child != nil {
+			dom.Children = append(dom.Children, child)
 		}
-
-		dom.Inner.X1 = dom.Container.X1
-		dom.Inner.Y1 = dom.Container.Y1
-		if domStyle.Padding.Left != "" {
-			dom.Inner.X1 += getIntSize(domStyle.Padding.Left)
+	}
+	if dom.DomType == DOM_TYPE_ELEMENT && dom.TagName != "img" {
+		if before := newPseudoElement(dom, "before", tagStyleList); before != nil {
+			dom.Children = append([]*Dom{before}, dom.Children...)
 		}
-		if domStyle.Padding.Top != "" {
-			dom.Inner.Y1 += getIntSize(domStyle.Padding.Top)
+		if after := newPseudoElement(dom, "after", tagStyleList); after != nil {
+			dom.Children = append(dom.Children, after)
 		}
+	}
+	if dom.isFlexContainer() || dom.isGridContainer() {
+		dom.Children = anonymousItems(dom)
+	}
+	fixTableChildren(dom)
+	if dom.isTable() {
+		return wrapTable(dom)
+	}
+	return dom
+}
 
-		switch ch.Data {
-		case "img":
-			src := getAttr(ch, "src")
-			resp, err := http.Get(src)
-			if err != nil {
-				panic(fmt.Sprintf("http.GetImage err :%v", err))
-			}
-			img, fm, err := image.Decode(resp.Body)
-			resp.Body.Close()
-			if err != nil {
-				panic(fmt.Sprintf("image.Decode err :%v", err))
-			}
-
-			srcBounds := img.Bounds()
-			if height > 0 || width > 0 {
-				if height == 0 {
-					height = width * srcBounds.Dy() / srcBounds.Dx()
-				}
-				if width == 0 {
-					width = height * srcBounds.Dx() / srcBounds.Dy()
-				}
-				img = resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
-			}
+// setComputedStyle sets the style of dom from the styles selecting it and the
+// style of its parent.
+func setComputedStyle(dom *Dom, parent *Dom, tagStyleList []*TagStyle) {
+	if parent != nil {
+		dom.parent = parent
+	}
+	dom.TagStyle = getDomStyle(dom, tagStyleList)
+	if dom.TagStyle.ListStyleType == "" {
+		dom.TagStyle.ListStyleType = defaultListStyleType(dom.TagName)
+	}
+	var pStyle *TagStyle
+	if parent != nil {
+		pStyle = parent.TagStyle
+		getInheritStyle(pStyle, dom.TagStyle)
+	}
+	resolveKeywords(dom.TagStyle, pStyle)
+	resolveCurrentColor(dom.TagStyle, pStyle)
+	computeLengths(dom)
+	if dom.DomType == DOM_TYPE_ELEMENT && dom.TagStyle.Display == "" {
+		dom.TagStyle.Display = defaultDisplay(dom.TagName)
+	}
+	if (parent != nil && (parent.isFlexContainer() || parent.isGridContainer())) || dom.isFloat() {
+		dom.TagStyle.Display = blockify(dom.TagStyle.Display)
+	}
+}
 
-			dom.Inner.X2 = dom.Inner.X1 + width - 1
-			dom.Inner.Y2 = dom.Inner.Y1 + height - 1
-			if domStyle.Margin.Right != "" {
-				dom.Outer.X2 = dom.Inner.X2 + getIntSize(domStyle.Margin.Right)
-			}
-			if domStyle.Margin.Bottom != "" {
-				dom.Outer.Y2 = dom.Inner.Y2 + getIntSize(domStyle.Margin.Bottom)
-			}
+// loadImage loads the image at src, resolved against the base url of the
+// document of d. It returns false when the image fails to load or to decode.
+func (d *Dom) loadImage(src string) (ImageData, bool) {
+	root := d
+	for root.parent != nil && root.images == nil {
+		root = root.parent
+	}
+	images := root.images
+	if images == nil {
+		images = &imageLoader{loader: DefaultLoader}
+	}
+	return images.load(src)
+}
 
-			imgData := ImageData{
-				Fm:  fm,
-				Img: img,
-			}
-			dom.TagData = imgData
-
-			pX1 = parent.Inner.X1
-			endOffset.Y2 = dom.Inner.Y2
-
-			dom.Outer = dom.Inner
-			dom.Container = dom.Inner
-			pY1 = dom.Outer.Y2 + 1
-		case "span":
-			par := append(parents, dom)
-			var child []*Dom
-			child, endOffset = getChildren(ch, tagStyleList, par)
-			dom.Children = child
-			dom.Inner.Y2 = endOffset.Y2
-			dom.Inner.X2 = endOffset.X2
-			dom.Container.X2 = dom.Inner.X2
-			if domStyle.Padding.Right != "" {
-				dom.Container.X2 += getIntSize(domStyle.Padding.Right)
-			}
+// imageSize returns the content size of an img. When only one side is set the
+// other one keeps the aspect ratio of the source image.
+func (d *Dom) imageSize(pWidth int) (int, int) {
+	bounds := d.TagData.(ImageData).Img.Bounds()
+	width := getIntPx(d.TagStyle.Width, pWidth)
+	height := getIntSize(d.TagStyle.Height)
+	switch {
+	case width == 0 && height == 0:
+		return bounds.Dx(), bounds.Dy()
+	case height == 0:
+		height = width * bounds.Dy() / bounds.Dx()
+	case width == 0:
+		width = height * bounds.Dx() / bounds.Dy()
+	}
+	return width, height
+}
 
-			dom.Outer.X2 = dom.Container.X2
-			if domStyle.Margin.Right != "" {
-				dom.Outer.X2 += getIntSize(domStyle.Margin.Right)
-			}
+func getChildren(parents []*Dom) ([]*Dom, EndOffset) {
+	parent := parents[len(parents)-1]
+	pHeight := -1
+	if !parent.isAutoHeight() {
+		pHeight = parent.Inner.Y2 - parent.Inner.Y1 + 1
+	}
+	if parent.isFlexContainer() {
+		return layoutFlex(parents, pHeight)
+	}
+	if parent.isGridContainer() {
+		return layoutGrid(parents, pHeight)
+	}
+	if parent.table != nil {
+		return layoutTableWrapper(parents, pHeight)
+	}
+	if parent.isTable() {
+		return layoutTable(parents, pHeight)
+	}
+	if parent.isMultiColumn() {
+		return layoutColumns(parents, pHeight)
+	}
+	return layoutBlockFlow(parents, pHeight)
+}
 
-			dom.Container.Y2 = endOffset.Y2
-			if domStyle.Padding.Bottom != "" {
-				dom.Container.Y2 += getIntSize(domStyle.Padding.Bottom)
-			}
-			dom.Outer.Y2 = dom.Container.Y2
-			if domStyle.Margin.Bottom != "" {
-				dom.Outer.Y2 += getIntSize(domStyle.Margin.Bottom)
+// layoutBlockFlow stacks the block-level children of the block container at
+// the end of parents and lays out the runs of inline-level children in line
+// boxes.
+func layoutBlockFlow(parents []*Dom, pHeight int) ([]*Dom, EndOffset) {
+	var children []*Dom
+	parent := parents[len(parents)-1]
+	pX1 := parent.Inner.X1
+	pY1 := parent.Inner.Y1
+	pX2 := parent.Inner.X2
+	pWidth := pX2 - pX1 + 1
+	floats := floatContextOf(parents)
+	endOffset := EndOffset{Y2: pY1 - 1}
+	flow := blockFlow{
+		leading:     true,
+		collapseTop: len(parents) > 1 && parent.canCollapseMarginTop(),
+	}
+	parent.hasBaseline = false
+	parent.lines = nil
+	source := parent.sourceChildren()
+	for i := 0; i < len(source); i++ {
+		dom := source[i]
+		if dom.isInlineLevel() {
+			// Consecutive inline-level children are laid out in line boxes
+			end := i + 1
+			for end < len(source) && (source[end].isInlineLevel() || source[end].isPositionAbsolute() || source[end].isFloat()) {
+				end++
 			}
-			pX1 = dom.Outer.X2
-			endOffset.Y2 = dom.Outer.Y2
-		default:
-			if ch.Type == html.TextNode {
-				fontSize := getIntSize(domStyle.FontSize)
-				lineHeight := getIntSize(domStyle.LineHeight)
-				if fontSize > lineHeight {
-					lineHeight = fontSize
-				}
-				var bParent *Dom
-				for i := len(parents) - 1; i >= 0; i-- {
-					p := parents[i]
-					if p.Inner.X2 > 0 {
-						bParent = p
-						break
-					}
-				}
-				multiTexts := splitMultiLineText(ch.Data, float64(fontSize), dom.Inner.X1, bParent.Inner.X2, bParent.Inner.X1)
-				maxX2 := 0
-				maxY2 := dom.Inner.Y1
-				for idx, text := range multiTexts {
-					newDom := *dom
-					if idx > 0 {
-						newDom.Inner.X1 = bParent.Inner.X1
-					}
-					charWidth := calcCharacterPx(text, float64(fontSize))
-					newDom.Inner.X2 = newDom.Inner.X1 + int(charWidth)
-					newDom.TagData = text
-					newDom.Inner.Y1 = maxY2
-					newDom.Inner.Y2 = maxY2 + lineHeight
-					newDom.Container = newDom.Inner
-					newDom.Outer = newDom.Inner
-					if maxX2 < newDom.Outer.X2 {
-						maxX2 = newDom.Outer.X2
+			run := source[i:end]
+			i = end - 1
+			if !hasInlineContent(run) {
+				for _, d := range run {
+					switch {
+					case d.isPositionAbsolute():
+						deferAbsolute(d, parents, pX1, pY1+flow.strut.collapsed())
+						children = append(children, d)
+					case d.isFloat():
+						layoutFloat(d, parents, pY1+flow.strut.collapsed(), pHeight)
+						children = append(children, d)
 					}
-					maxY2 = newDom.Outer.Y2 + 1
-					children = append(children, &newDom)
-				}
-				pX1 = maxX2
-				endOffset.Y2 = maxY2
-				endOffset.X2 = maxX2
-				ch = ch.NextSibling
-				continue CHILDREN
-			} else {
-				if dom.isPositionAbsolute() {
-					left := getIntSize(domStyle.Offset.Left)
-					top := getIntSize(domStyle.Offset.Top)
-					width := getIntSize(domStyle.Width)
-					height := getIntSize(domStyle.Height)
-					dom.Outer.X1 = left
-					dom.Outer.X2 = left + width
-					dom.Outer.Y1 = top
-					dom.Outer.Y2 = top + height
-
-					dom.Container = dom.Outer
-					dom.Inner = dom.Outer
-					break
-				}
-				if width > 0 {
-					dom.Container.X2 = dom.Container.X1 + width
-					dom.Outer.X2 = dom.Container.X2
-				} else {
-					dom.Outer.X2 = pX2
-					dom.Container.X2 = pX2
-				}
-				if domStyle.Margin.Right != "" {
-					dom.Container.X2 = pX2 - getIntSize(domStyle.Margin.Right)
-				}
-				dom.Inner.X2 = dom.Container.X2
-				if domStyle.Padding.Right != "" {
-					dom.Inner.X2 -= getIntSize(domStyle.Padding.Right)
-				}
-				par := append(parents, dom)
-				var child []*Dom
-				child, endOffset = getChildren(ch, tagStyleList, par)
-				dom.Children = child
-				if len(child) != 0 {
-					dom.Inner.Y2 = endOffset.Y2
-					dom.Container.Y2 = endOffset.Y2
-				} else {
-					dom.Inner.Y2 = dom.Inner.Y1
-					if domStyle.Height != "" {
-						dom.Inner.Y2 += getIntSize(domStyle.Height) - 1
-					}
-					dom.Container.Y2 = dom.Inner.Y2
 				}
+				continue
+			}
+			pY1 += flow.resolve()
+			fragments, lines := layoutInline(run, parents, pY1, pHeight)
+			children = append(children, fragments...)
+			parent.lines = append(parent.lines, lines...)
+			if len(lines) > 0 {
+				lastLine := lines[len(lines)-1]
+				parent.baseline = lastLine.baseline - parent.Container.Y1
+				parent.hasBaseline = true
+				pY1 = lastLine.bottom + 1
+			}
+			endOffset.Y2 = pY1 - 1
+			continue
+		}
 
-				if domStyle.Padding.Bottom != "" {
-					dom.Container.Y2 += getIntSize(domStyle.Padding.Bottom)
-				}
-				dom.Outer.Y2 = dom.Container.Y2
-				if domStyle.Margin.Bottom != "" {
-					dom.Outer.Y2 += getIntSize(domStyle.Margin.Bottom)
-				}
+		domStyle := dom.TagStyle
+		if dom.isPositionAbsolute() {
+			deferAbsolute(dom, parents, pX1, pY1+flow.strut.collapsed())
+			children = append(children, dom)
+			continue
+		}
+		if dom.isFloat() {
+			layoutFloat(dom, parents, pY1+flow.strut.collapsed(), pHeight)
+			children = append(children, dom)
+			continue
+		}
 
-				endOffset.Y2 = dom.Outer.Y2
-				endOffset.X2 = dom.Outer.X2
-				pY1 = dom.Outer.Y2 + 1
+		// Block-level doms are stacked below each other
+		x := parent.Inner.X1
+		marginLeft, contentWidth := blockWidth(dom, pWidth)
+		if dom.establishesBFC() && len(floats.floats) > 0 {
+			// A block formatting context is placed beside the floats instead
+			// of flowing around them
+			left, right := floats.bounds(pX1, pX2, pY1+flow.strut.collapsed(), 1)
+			x = left
+			marginLeft, contentWidth = blockWidth(dom, right-left+1)
+		}
+		floatCount := len(floats.floats)
+		childEnd := layoutBox(dom, parents, x+marginLeft, pY1, contentWidth, pWidth, pHeight)
+		dom.Outer.X1 = parent.Inner.X1
+		dom.Outer.X2 = pX2
+
+		marginTop := getIntPx(domStyle.Margin.Top, pWidth)
+		marginBottom := getIntPx(domStyle.Margin.Bottom, pWidth)
+		var topStrut, bottomStrut marginStrut
+		topStrut.append(marginTop)
+		topStrut.join(childEnd.topMargin)
+		bottomStrut.append(marginBottom)
+		bottomStrut.join(childEnd.bottomMargin)
+		if childEnd.collapsedThrough && dom.canCollapseThrough() {
+			// An empty block lets its own margins collapse through it
+			flow.strut.join(topStrut)
+			flow.strut.join(bottomStrut)
+			dom.shift(0, flow.strut.collapsed())
+		} else {
+			flow.strut.join(topStrut)
+			dy := flow.resolve()
+			if dy != 0 && floatCount > 0 {
+				// The content flows around the floats at the final position
+				floats.floats = floats.floats[:floatCount]
+				layoutBox(dom, parents, dom.Container.X1, pY1+dy, contentWidth, pWidth, pHeight)
+			} else {
+				dom.shift(0, dy)
 			}
+			if clear := domStyle.Clear; clear != "" && clear != "none" {
+				dom.shift(0, floats.clearY(clear, dom.Container.Y1)-dom.Container.Y1)
+			}
+			flow.strut = bottomStrut
+			pY1 = dom.Container.Y2 + 1
+		}
+		dom.Outer.Y1 = dom.Container.Y1 - marginTop
+		dom.Outer.Y2 = dom.Container.Y2 + marginBottom
+
+		endOffset.Y2 = pY1 - 1
+		endOffset.X2 = dom.Outer.X2
+		if dom.hasBaseline {
+			parent.baseline = dom.Container.Y1 + dom.baseline - parent.Container.Y1
+			parent.hasBaseline = true
+		}
+		if dom.TagStyle.Position == "relative" {
+			dom.layoutAbsolutes()
+			dom.shift(relativeOffset(dom, pWidth, pHeight))
 		}
 		children = append(children, dom)
-		ch = ch.NextSibling
+	}
+	endOffset.topMargin = flow.topMargin
+	switch {
+	case flow.leading && flow.collapseTop:
+		endOffset.topMargin = flow.strut
+		endOffset.collapsedThrough = true
+	case len(parents) > 1 && parent.canCollapseMarginBottom():
+		endOffset.bottomMargin = flow.strut
+	default:
+		endOffset.Y2 += flow.strut.collapsed()
 	}
 	return children, endOffset
 }
 
-func getDomStyle(dom *Dom, tagStyleList []*TagStyle) *TagStyle {
-	var selectedStyle []*TagStyle
-	for _, style := range tagStyleList {
-		if style.selected(dom) {
-			selectedStyle = append(selectedStyle, style)
+// blockWidth returns the left margin and the content width of a block-level
+// dom in a containing block pWidth wide.
+func blockWidth(dom *Dom, pWidth int) (int, int) {
+	style := dom.TagStyle
+	width := getIntPx(style.Width, pWidth)
+	paddingWidth := getIntPx(style.Padding.Left, pWidth) + getIntPx(style.Padding.Right, pWidth)
+	if dom.TagName == "img" {
+		width, _ = dom.imageSize(pWidth)
+	}
+	marginLeft := getIntPx(style.Margin.Left, pWidth)
+	contentWidth := pWidth - marginLeft - getIntPx(style.Margin.Right, pWidth) - paddingWidth
+	if dom.isTable() {
+		// Tables shrink to fit their columns and never get narrower than them
+		minWidth, maxWidth := intrinsicContentWidth(dom)
+		if width <= 0 {
+			width = minInt(maxInt(minWidth, contentWidth), maxWidth)
 		}
+		width = maxInt(width, minWidth)
 	}
-	finalStyle := &TagStyle{}
-	if len(selectedStyle) > 0 {
-		// TODO Improved selector priority
-		sort.SliceStable(selectedStyle, func(i, j int) bool {
-			if len(selectedStyle[i].Selector) < len(selectedStyle[j].Selector) {
-				return true
-			}
-			return false
-		})
-		for _, style := range selectedStyle {
-			if style.Selector != "" {
-				finalStyle.Selector = style.Selector
-			}
-			if style.Color != "" {
-				finalStyle.Color = style.Color
-			}
-			if style.FontSize != "" {
-				finalStyle.FontSize = style.FontSize
-			}
-			if style.LineHeight != "" {
-				finalStyle.LineHeight = style.LineHeight
-			}
-			if style.FontFamily != "" {
-				finalStyle.FontFamily = style.FontFamily
-			}
-			if style.BackgroundColor != "" {
-				finalStyle.BackgroundColor = style.BackgroundColor
-			}
-			if style.BackgroundImage != "" {
-				finalStyle.BackgroundImage = style.BackgroundImage
-			}
-			if style.Width != "" {
-				finalStyle.Width = style.Width
-			}
-			if style.Height != "" {
-				finalStyle.Height = style.Height
-			}
-			if style.Display != "" {
-				finalStyle.Display = style.Display
-			}
-			if style.Position != "" {
-				finalStyle.Position = style.Position
+	if width > 0 {
+		contentWidth = width
+		marginLeft, _ = resolveAutoMargins(pWidth, paddingWidth+width, style.Margin.Left, style.Margin.Right)
+	}
+	return marginLeft, contentWidth
+}
+
+// layoutBox lays out the children of a block-level or inline-block element
+// whose border box starts at x, y and sets its height.
+func layoutBox(dom *Dom, parents []*Dom, x, y, contentWidth, cbWidth, cbHeight int) EndOffset {
+	style := dom.TagStyle
+	dom.Container.X1 = x
+	dom.Container.Y1 = y
+	dom.Inner.X1 = x + getIntPx(style.Padding.Left, cbWidth)
+	dom.Inner.Y1 = y + getIntPx(style.Padding.Top, cbWidth)
+	dom.Inner.X2 = dom.Inner.X1 + contentWidth - 1
+	dom.Container.X2 = dom.Inner.X2 + getIntPx(style.Padding.Right, cbWidth)
+
+	var endOffset EndOffset
+	if dom.TagName == "img" {
+		_, height := dom.imageSize(cbWidth)
+		dom.Inner.Y2 = dom.Inner.Y1 + height - 1
+	} else {
+		dom.indefiniteHeight = cbHeight < 0 && hasPercentage(style.Height)
+		if !dom.isAutoHeight() {
+			dom.Inner.Y2 = dom.Inner.Y1 + getIntPx(style.Height, cbHeight) - 1
+		}
+		if dom.establishesBFC() {
+			dom.floats = &floatContext{}
+		}
+		dom.Children, endOffset = getChildren(append(parents, dom))
+		if dom.isAutoHeight() {
+			dom.Inner.Y2 = endOffset.Y2
+			if dom.floats != nil {
+				// A block formatting context encloses its floats
+				dom.Inner.Y2 = maxInt(dom.Inner.Y2, dom.floats.bottom()-1)
 			}
+		}
+	}
+	dom.Container.Y2 = dom.Inner.Y2 + getIntPx(style.Padding.Bottom, cbWidth)
+	return endOffset
+}
+
+// resolveAutoMargins returns the start and end margins of a box with a definite
+// size inside avail, sharing the free space between "auto" margins. When the
+// box is over-constrained the end margin is ignored.
+func resolveAutoMargins(avail, size int, marginStart, marginEnd string) (int, int) {
+	free := avail - size
+	start := getIntPx(marginStart, avail)
+	end := getIntPx(marginEnd, avail)
+	switch {
+	case isAuto(marginStart) && isAuto(marginEnd):
+		if free < 0 {
+			return 0, free
+		}
+		return free / 2, free - free/2
+	case isAuto(marginStart):
+		return free - end, end
+	}
+	return start, free - start
+}
+
+// matchedRule is a rule selecting a dom, with the specificity it selects it
+// with.
+type matchedRule struct {
+	style       *TagStyle
+	specificity specificity
+}
 
-			finalStyle.Offset = getSelectedPos(finalStyle.Offset, style.Offset)
-			finalStyle.Margin = getSelectedPos(finalStyle.Margin, style.Margin)
-			finalStyle.Padding = getSelectedPos(finalStyle.Padding, style.Padding)
-			finalStyle.BorderRadius = getSelectedPos(finalStyle.BorderRadius, style.BorderRadius)
-			finalStyle.BorderWidth = getSelectedPos(finalStyle.BorderWidth, style.BorderWidth)
-			finalStyle.BorderColor = getSelectedPos(finalStyle.BorderColor, style.BorderColor)
-			finalStyle.BorderStyle = getSelectedPos(finalStyle.BorderStyle, style.BorderStyle)
+// getDomStyle cascades the declarations of the rules selecting dom and of its
+// style attribute. The normal declarations of the user agent rules come
+// first, then the author rules by specificity and source order, then the
+// style attribute, and the important declarations in the reverse order of
+// origins.
+func getDomStyle(dom *Dom, tagStyleList []*TagStyle) *TagStyle {
+	var matched []matchedRule
+	for _, style := range tagStyleList {
+		if spec, ok := style.selected(dom); ok {
+			matched = append(matched, matchedRule{style: style, specificity: spec})
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].style.userAgent != matched[j].style.userAgent {
+			return matched[i].style.userAgent
+		}
+		return matched[i].specificity.less(matched[j].specificity)
+	})
+	inlineStyle := dom.inlineStyle
+	if inlineStyle == nil {
+		inlineStyle = &TagStyle{}
+	}
+	var layers []*TagStyle
+	for _, rule := range matched {
+		layers = append(layers, rule.style)
+	}
+	layers = append(layers, inlineStyle)
+	for _, rule := range matched {
+		if !rule.style.userAgent && rule.style.important != nil {
+			layers = append(layers, rule.style.important)
+		}
+	}
+	if inlineStyle.important != nil {
+		layers = append(layers, inlineStyle.important)
+	}
+	for _, rule := range matched {
+		if rule.style.userAgent && rule.style.important != nil {
+			layers = append(layers, rule.style.important)
 		}
 	}
 
+	// Custom properties are computed first, for the var() of the other
+	// properties
+	declared := make(map[string]string)
+	for _, style := range layers {
+		for name, value := range style.CustomProperties {
+			declared[name] = value
+		}
+	}
+	var inherited map[string]string
+	if dom.parent != nil {
+		inherited = dom.parent.TagStyle.CustomProperties
+	}
+	finalStyle := &TagStyle{CustomProperties: resolveCustomProperties(declared, inherited)}
+	for _, style := range layers {
+		applyStyle(finalStyle, style)
+	}
 	return finalStyle
 }
 
+// applyStyle sets the declarations of style on finalStyle, substituting their
+// var() with the custom properties of finalStyle. A declaration whose var()
+// has no value or whose value is invalid once substituted is unset.
+func applyStyle(finalStyle *TagStyle, style *TagStyle) {
+	if !style.usesVar {
+		mergeStyle(finalStyle, style)
+		return
+	}
+	if style.Selector != "" {
+		finalStyle.Selector = style.Selector
+	}
+	for _, declaration := range style.declarations {
+		value, ok := substituteVars(declaration.value, finalStyle.CustomProperties)
+		if !ok || !setTagStyle(finalStyle, declaration.Name, value) {
+			// Invalid at computed-value time
+			setTagStyle(finalStyle, declaration.Name, "unset")
+		}
+	}
+}
+
+// mergeStyle sets the properties set by style on finalStyle.
+func mergeStyle(finalStyle *TagStyle, style *TagStyle) {
+	if style.Selector != "" {
+		finalStyle.Selector = style.Selector
+	}
+	if style.Color != "" {
+		finalStyle.Color = style.Color
+	}
+	if style.FontSize != "" {
+		finalStyle.FontSize = style.FontSize
+	}
+	if style.LineHeight != "" {
+		finalStyle.LineHeight = style.LineHeight
+	}
+	if style.FontFamily != "" {
+		finalStyle.FontFamily = style.FontFamily
+	}
+	if style.BackgroundColor != "" {
+		finalStyle.BackgroundColor = style.BackgroundColor
+	}
+	if style.BackgroundImage != "" {
+		finalStyle.BackgroundImage = style.BackgroundImage
+	}
+	if style.Width != "" {
+		finalStyle.Width = style.Width
+	}
+	if style.Height != "" {
+		finalStyle.Height = style.Height
+	}
+	if style.Display != "" {
+		finalStyle.Display = style.Display
+	}
+	if style.Visibility != "" {
+		finalStyle.Visibility = style.Visibility
+	}
+	if style.Position != "" {
+		finalStyle.Position = style.Position
+	}
+	if style.ZIndex != "" {
+		finalStyle.ZIndex = style.ZIndex
+	}
+	if style.Opacity != "" {
+		finalStyle.Opacity = style.Opacity
+	}
+	if style.Transform != "" {
+		finalStyle.Transform = style.Transform
+	}
+	if style.TransformOrigin != "" {
+		finalStyle.TransformOrigin = style.TransformOrigin
+	}
+	if style.TextAlign != "" {
+		finalStyle.TextAlign = style.TextAlign
+	}
+	if style.VerticalAlign != "" {
+		finalStyle.VerticalAlign = style.VerticalAlign
+	}
+	if style.FontWeight != "" {
+		finalStyle.FontWeight = style.FontWeight
+	}
+	if style.FontStyle != "" {
+		finalStyle.FontStyle = style.FontStyle
+	}
+	if style.TextDecoration != "" {
+		finalStyle.TextDecoration = style.TextDecoration
+	}
+	if style.WhiteSpace != "" {
+		finalStyle.WhiteSpace = style.WhiteSpace
+	}
+	if style.FlexDirection != "" {
+		finalStyle.FlexDirection = style.FlexDirection
+	}
+	if style.FlexWrap != "" {
+		finalStyle.FlexWrap = style.FlexWrap
+	}
+	if style.FlexGrow != "" {
+		finalStyle.FlexGrow = style.FlexGrow
+	}
+	if style.FlexShrink != "" {
+		finalStyle.FlexShrink = style.FlexShrink
+	}
+	if style.FlexBasis != "" {
+		finalStyle.FlexBasis = style.FlexBasis
+	}
+	if style.Order != "" {
+		finalStyle.Order = style.Order
+	}
+	if style.JustifyContent != "" {
+		finalStyle.JustifyContent = style.JustifyContent
+	}
+	if style.AlignItems != "" {
+		finalStyle.AlignItems = style.AlignItems
+	}
+	if style.AlignSelf != "" {
+		finalStyle.AlignSelf = style.AlignSelf
+	}
+	if style.AlignContent != "" {
+		finalStyle.AlignContent = style.AlignContent
+	}
+	if style.RowGap != "" {
+		finalStyle.RowGap = style.RowGap
+	}
+	if style.ColumnGap != "" {
+		finalStyle.ColumnGap = style.ColumnGap
+	}
+	if style.JustifyItems != "" {
+		finalStyle.JustifyItems = style.JustifyItems
+	}
+	if style.JustifySelf != "" {
+		finalStyle.JustifySelf = style.JustifySelf
+	}
+	if style.GridTemplateColumns != "" {
+		finalStyle.GridTemplateColumns = style.GridTemplateColumns
+	}
+	if style.GridTemplateRows != "" {
+		finalStyle.GridTemplateRows = style.GridTemplateRows
+	}
+	if style.GridTemplateAreas != "" {
+		finalStyle.GridTemplateAreas = style.GridTemplateAreas
+	}
+	if style.GridAutoColumns != "" {
+		finalStyle.GridAutoColumns = style.GridAutoColumns
+	}
+	if style.GridAutoRows != "" {
+		finalStyle.GridAutoRows = style.GridAutoRows
+	}
+	if style.GridAutoFlow != "" {
+		finalStyle.GridAutoFlow = style.GridAutoFlow
+	}
+	if style.GridRowStart != "" {
+		finalStyle.GridRowStart = style.GridRowStart
+	}
+	if style.GridRowEnd != "" {
+		finalStyle.GridRowEnd = style.GridRowEnd
+	}
+	if style.GridColumnStart != "" {
+		finalStyle.GridColumnStart = style.GridColumnStart
+	}
+	if style.GridColumnEnd != "" {
+		finalStyle.GridColumnEnd = style.GridColumnEnd
+	}
+	if style.TableLayout != "" {
+		finalStyle.TableLayout = style.TableLayout
+	}
+	if style.Float != "" {
+		finalStyle.Float = style.Float
+	}
+	if style.Clear != "" {
+		finalStyle.Clear = style.Clear
+	}
+	if style.Overflow != "" {
+		finalStyle.Overflow = style.Overflow
+	}
+	if style.BorderCollapse != "" {
+		finalStyle.BorderCollapse = style.BorderCollapse
+	}
+	if style.BorderSpacing != "" {
+		finalStyle.BorderSpacing = style.BorderSpacing
+	}
+	if style.CaptionSide != "" {
+		finalStyle.CaptionSide = style.CaptionSide
+	}
+	if style.ListStyleType != "" {
+		finalStyle.ListStyleType = style.ListStyleType
+	}
+	if style.ListStylePosition != "" {
+		finalStyle.ListStylePosition = style.ListStylePosition
+	}
+	if style.ListStyleImage != "" {
+		finalStyle.ListStyleImage = style.ListStyleImage
+	}
+	if style.ColumnCount != "" {
+		finalStyle.ColumnCount = style.ColumnCount
+	}
+	if style.ColumnWidth != "" {
+		finalStyle.ColumnWidth = style.ColumnWidth
+	}
+	if style.ColumnRuleWidth != "" {
+		finalStyle.ColumnRuleWidth = style.ColumnRuleWidth
+	}
+	if style.ColumnRuleStyle != "" {
+		finalStyle.ColumnRuleStyle = style.ColumnRuleStyle
+	}
+	if style.ColumnRuleColor != "" {
+		finalStyle.ColumnRuleColor = style.ColumnRuleColor
+	}
+	if style.Content != "" {
+		finalStyle.Content = style.Content
+	}
+	if style.CounterReset != "" {
+		finalStyle.CounterReset = style.CounterReset
+	}
+	if style.CounterIncrement != "" {
+		finalStyle.CounterIncrement = style.CounterIncrement
+	}
+	if style.CounterSet != "" {
+		finalStyle.CounterSet = style.CounterSet
+	}
+
+	finalStyle.Offset = getSelectedPos(finalStyle.Offset, style.Offset)
+	finalStyle.Margin = getSelectedPos(finalStyle.Margin, style.Margin)
+	finalStyle.Padding = getSelectedPos(finalStyle.Padding, style.Padding)
+	finalStyle.BorderRadius = getSelectedPos(finalStyle.BorderRadius, style.BorderRadius)
+	finalStyle.BorderWidth = getSelectedPos(finalStyle.BorderWidth, style.BorderWidth)
+	finalStyle.BorderColor = getSelectedPos(finalStyle.BorderColor, style.BorderColor)
+	finalStyle.BorderStyle = getSelectedPos(finalStyle.BorderStyle, style.BorderStyle)
+}
+
 func setDomAttr(dom *Dom, htmlNode *html.Node) {
 	dom.DomType = int8(htmlNode.Type)
 	if htmlNode.Type == html.ElementNode {
 		dom.DomType = DOM_TYPE_ELEMENT
 		dom.TagName = htmlNode.Data
 		dom.TagClass = getAttr(htmlNode, "class")
+		dom.attrs = htmlNode.Attr
+		dom.node = htmlNode
+		if style := getAttr(htmlNode, "style"); style != "" {
+			dom.inlineStyle = &TagStyle{}
+			setTagStyles(dom.inlineStyle, style)
+		}
 	} else if htmlNode.Type == html.TextNode {
 		dom.DomType = DOM_TYPE_TEXT
 		dom.TagData = htmlNode.Data
@@ -411,6 +884,24 @@ func getAttr(htmlNode *html.Node, attrKey string) string {
 	return ""
 }
 
+func (d *Dom) attr(key string) string {
+	for _, attr := range d.attrs {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func (d *Dom) hasAttr(key string) bool {
+	for _, attr := range d.attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
 func getSelectedPos(oldPos Pos, selectedPos Pos) Pos {
 	if selectedPos.Left != "" {
 		oldPos.Left = selectedPos.Left
@@ -426,3 +917,17 @@ func getSelectedPos(oldPos Pos, selectedPos Pos) Pos {
 	}
 	return oldPos
 }
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -7,23 +7,41 @@ import (
 	"image/draw"
 	"image/jpeg"
 	"math"
+	"strings"
 
-	"github.com/golang/freetype/truetype"
-	"github.com/wnote/html2img/conf"
+	"github.com/nfnt/resize"
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 )
 
-func bodyDom2Img(bodyDom *Dom) ([]byte, error) {
-	bodyWidth := getIntSize(bodyDom.TagStyle.Width)
-	bodyHeight := getIntSize(bodyDom.TagStyle.Height)
-	dst := image.NewRGBA(image.Rect(0, 0, bodyWidth, bodyHeight))
-	if bodyDom.TagStyle.BackgroundColor != "" {
-		col := getColor(bodyDom.TagStyle.BackgroundColor)
-		draw.Draw(dst, dst.Bounds(), &image.Uniform{C: col}, image.ZP, draw.Src)
+// setPixel paints c over the pixel at x, y of dst, blending translucent
+// colors with what is below them.
+func setPixel(dst *image.RGBA, x, y int, c color.Color) {
+	if !(image.Point{X: x, Y: y}).In(dst.Rect) {
+		return
+	}
+	r, g, b, a := c.RGBA()
+	switch a {
+	case 0:
+		return
+	case 0xffff:
+		dst.Set(x, y, c)
+		return
+	}
+	below := dst.RGBAAt(x, y)
+	blend := func(src uint32, dst uint8) uint8 {
+		return uint8((src + uint32(dst)*0x101*(0xffff-a)/0xffff) >> 8)
 	}
-	drawChildren(dst, bodyDom.TagStyle, bodyDom.Children)
+	dst.SetRGBA(x, y, color.RGBA{
+		R: blend(r, below.R),
+		G: blend(g, below.G),
+		B: blend(b, below.B),
+		A: blend(a, below.A),
+	})
+}
 
+func bodyDom2Img(bodyDom *Dom) ([]byte, error) {
+	dst := paintBody(bodyDom)
 	buf := &bytes.Buffer{}
 	err := jpeg.Encode(buf, dst, &jpeg.Options{
 		Quality: 100,
@@ -35,168 +53,260 @@ func bodyDom2Img(bodyDom *Dom) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func drawChildren(dst *image.RGBA, pStyle *TagStyle, children []*Dom) {
-	for _, d := range children {
-		calcStyle := getInheritStyle(pStyle, d.TagStyle)
+// paintBody paints the laid out body on an image of its size.
+func paintBody(bodyDom *Dom) *image.RGBA {
+	// The body is laid out as wide as its width, or as the viewport without one
+	bodyWidth := bodyDom.Container.X2 + 1
+	bodyHeight := getIntSize(bodyDom.TagStyle.Height)
+	if bodyHeight == 0 {
+		// The image of a body without height fits its content
+		bodyHeight = maxInt(bodyDom.Container.Y2, bodyDom.Inner.Y2) + 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, bodyWidth, bodyHeight))
+	if bodyDom.TagStyle.BackgroundColor != "" {
+		col := getColor(bodyDom.TagStyle.BackgroundColor)
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{C: col}, image.ZP, draw.Src)
+	}
+	drawStackingContext(dst, bodyDom)
+	return dst
+}
 
-		if d.DomType == DOM_TYPE_ELEMENT {
-			switch d.TagName {
-			case "img":
-				imgData := d.TagData.(ImageData)
-				draw.Draw(dst, dst.Bounds().Add(image.Pt(d.Inner.X1, d.Inner.Y1)), imgData.Img, image.ZP, draw.Over)
-				drawBoxRadius(dst, d.Container, calcStyle, pStyle)
-			default:
-				box := d.Container
-				if calcStyle.BackgroundColor != "" {
-					borderColor := getColor(calcStyle.BackgroundColor)
-					for y := box.Y1; y <= box.Y2; y++ {
-						for x := box.X1; x <= box.X2; x++ {
-							dst.Set(x, y, borderColor)
-						}
-					}
+// drawBox paints the background, border or image of an element.
+func drawBox(dst *image.RGBA, d *Dom) {
+	calcStyle := d.TagStyle
+	pStyle := d.parent.TagStyle
+	if isHidden(calcStyle) {
+		return
+	}
+	switch d.TagName {
+	case "img":
+		img := d.TagData.(ImageData).Img
+		width := d.Inner.X2 - d.Inner.X1 + 1
+		height := d.Inner.Y2 - d.Inner.Y1 + 1
+		if width != img.Bounds().Dx() || height != img.Bounds().Dy() {
+			img = resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
+		}
+		draw.Draw(dst, dst.Bounds().Add(image.Pt(d.Inner.X1, d.Inner.Y1)), img, img.Bounds().Min, draw.Over)
+		drawBoxRadius(dst, d.Container, calcStyle, pStyle)
+	default:
+		box := d.Container
+		if calcStyle.BackgroundColor != "" {
+			borderColor := getColor(calcStyle.BackgroundColor)
+			for y := box.Y1; y <= box.Y2; y++ {
+				for x := box.X1; x <= box.X2; x++ {
+					setPixel(dst, x, y, borderColor)
 				}
-				drawBoxRadius(dst, box, calcStyle, pStyle)
+			}
+		}
+		drawBoxRadius(dst, box, calcStyle, pStyle)
 
-				borderTopRadius := getIntSize(calcStyle.BorderRadius.Top)
-				borderRightRadius := getIntSize(calcStyle.BorderRadius.Right)
-				borderBottomRadius := getIntSize(calcStyle.BorderRadius.Bottom)
-				borderLeftRadius := getIntSize(calcStyle.BorderRadius.Left)
+		borderTopRadius := getIntSize(calcStyle.BorderRadius.Top)
+		borderRightRadius := getIntSize(calcStyle.BorderRadius.Right)
+		borderBottomRadius := getIntSize(calcStyle.BorderRadius.Bottom)
+		borderLeftRadius := getIntSize(calcStyle.BorderRadius.Left)
 
-				width := d.Container.X2 - d.Container.X1 + 1
-				height := d.Container.Y2 - d.Container.Y1 + 1
-				var halfSize int
-				if width > height {
-					halfSize = height / 2
-				} else {
-					halfSize = width / 2
-				}
-				if borderTopRadius > halfSize {
-					borderTopRadius = halfSize
-				}
-				if borderRightRadius > halfSize {
-					borderRightRadius = halfSize
-				}
-				if borderBottomRadius > halfSize {
-					borderBottomRadius = halfSize
-				}
-				if borderLeftRadius > halfSize {
-					borderLeftRadius = halfSize
+		width := d.Container.X2 - d.Container.X1 + 1
+		height := d.Container.Y2 - d.Container.Y1 + 1
+		var halfSize int
+		if width > height {
+			halfSize = height / 2
+		} else {
+			halfSize = width / 2
+		}
+		if borderTopRadius > halfSize {
+			borderTopRadius = halfSize
+		}
+		if borderRightRadius > halfSize {
+			borderRightRadius = halfSize
+		}
+		if borderBottomRadius > halfSize {
+			borderBottomRadius = halfSize
+		}
+		if borderLeftRadius > halfSize {
+			borderLeftRadius = halfSize
+		}
+		if calcStyle.BorderStyle.Top != "" && calcStyle.BorderWidth.Top != "" && calcStyle.BorderColor.Top != "" {
+			borderWidth := getIntSize(calcStyle.BorderWidth.Top)
+			borderColor := getColor(calcStyle.BorderColor.Top)
+			switch calcStyle.BorderStyle.Top {
+			case "none", "hidden":
+			default:
+				// The other styles are drawn solid
+				for width := borderWidth - 1; width >= 0; width-- {
+					r := borderTopRadius - width
+					for xxOffset := r; xxOffset >= 0; xxOffset-- {
+						yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
+						setPixel(dst, d.Container.X1+r-int(xxOffset), box.Y1+r-yyOffset, borderColor)
+						setPixel(dst, d.Container.X1+r-int(yyOffset), box.Y1+r-xxOffset, borderColor)
+					}
+					for x := box.X1 + borderTopRadius; x <= box.X2-borderRightRadius; x++ {
+						setPixel(dst, x, d.Container.Y1+width, borderColor)
+					}
 				}
-				if calcStyle.BorderStyle.Top != "" && calcStyle.BorderWidth.Top != "" && calcStyle.BorderColor.Top != "" {
-					borderWidth := getIntSize(calcStyle.BorderWidth.Top)
-					borderColor := getColor(calcStyle.BorderColor.Top)
-					switch calcStyle.BorderStyle.Top {
-					case "solid":
-						for width := borderWidth - 1; width >= 0; width-- {
-							r := borderTopRadius - width
-							for xxOffset := r; xxOffset >= 0; xxOffset-- {
-								yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
-								dst.Set(d.Container.X1+r-int(xxOffset), box.Y1+r-yyOffset, borderColor)
-								dst.Set(d.Container.X1+r-int(yyOffset), box.Y1+r-xxOffset, borderColor)
-							}
-							for x := box.X1 + borderTopRadius; x <= box.X2-borderRightRadius; x++ {
-								dst.Set(x, d.Container.Y1+width, borderColor)
-							}
-						}
-					default:
-						panic("border-style " + calcStyle.BorderStyle.Top + " not support")
-
+			}
+		}
+		if calcStyle.BorderStyle.Right != "" && calcStyle.BorderWidth.Right != "" && calcStyle.BorderColor.Right != "" {
+			borderWidth := getIntSize(calcStyle.BorderWidth.Right)
+			borderColor := getColor(calcStyle.BorderColor.Right)
+			switch calcStyle.BorderStyle.Right {
+			case "none", "hidden":
+			default:
+				// The other styles are drawn solid
+				for width := borderWidth - 1; width >= 0; width-- {
+					r := borderRightRadius - width
+					for xxOffset := r; xxOffset >= 0; xxOffset-- {
+						yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
+						setPixel(dst, d.Container.X2-r+int(xxOffset), box.Y1+r-yyOffset, borderColor)
+						setPixel(dst, d.Container.X2-r+int(yyOffset), box.Y1+r-xxOffset, borderColor)
+					}
+					for y := box.Y1 + borderRightRadius; y <= box.Y2-borderBottomRadius; y++ {
+						setPixel(dst, d.Container.X2-width, y, borderColor)
 					}
 				}
-				if calcStyle.BorderStyle.Right != "" && calcStyle.BorderWidth.Right != "" && calcStyle.BorderColor.Right != "" {
-					borderWidth := getIntSize(calcStyle.BorderWidth.Right)
-					borderColor := getColor(calcStyle.BorderColor.Right)
-					switch calcStyle.BorderStyle.Right {
-					case "solid":
-						for width := borderWidth - 1; width >= 0; width-- {
-							r := borderRightRadius - width
-							for xxOffset := r; xxOffset >= 0; xxOffset-- {
-								yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
-								dst.Set(d.Container.X2-r+int(xxOffset), box.Y1+r-yyOffset, borderColor)
-								dst.Set(d.Container.X2-r+int(yyOffset), box.Y1+r-xxOffset, borderColor)
-							}
-							for y := box.Y1 + borderRightRadius; y <= box.Y2-borderBottomRadius; y++ {
-								dst.Set(d.Container.X2-width, y, borderColor)
-							}
-						}
-					default:
-						panic("border-style " + calcStyle.BorderStyle.Top + " not support")
-
+			}
+		}
+		if calcStyle.BorderStyle.Bottom != "" && calcStyle.BorderWidth.Bottom != "" && calcStyle.BorderColor.Bottom != "" {
+			borderWidth := getIntSize(calcStyle.BorderWidth.Bottom)
+			borderColor := getColor(calcStyle.BorderColor.Bottom)
+			switch calcStyle.BorderStyle.Bottom {
+			case "none", "hidden":
+			default:
+				// The other styles are drawn solid
+				for width := borderWidth - 1; width >= 0; width-- {
+					r := borderBottomRadius - width
+					for xxOffset := r; xxOffset >= 0; xxOffset-- {
+						yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
+						setPixel(dst, d.Container.X2-r+int(xxOffset), box.Y2-r+yyOffset, borderColor)
+						setPixel(dst, d.Container.X2-r+int(yyOffset), box.Y2-r+xxOffset, borderColor)
+					}
+					for x := box.X1 + borderLeftRadius; x <= box.X2-borderBottomRadius; x++ {
+						setPixel(dst, x, d.Container.Y2-width, borderColor)
 					}
 				}
-				if calcStyle.BorderStyle.Bottom != "" && calcStyle.BorderWidth.Bottom != "" && calcStyle.BorderColor.Bottom != "" {
-					borderWidth := getIntSize(calcStyle.BorderWidth.Bottom)
-					borderColor := getColor(calcStyle.BorderColor.Bottom)
-					switch calcStyle.BorderStyle.Bottom {
-					case "solid":
-						for width := borderWidth - 1; width >= 0; width-- {
-							r := borderBottomRadius - width
-							for xxOffset := r; xxOffset >= 0; xxOffset-- {
-								yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
-								dst.Set(d.Container.X2-r+int(xxOffset), box.Y2-r+yyOffset, borderColor)
-								dst.Set(d.Container.X2-r+int(yyOffset), box.Y2-r+xxOffset, borderColor)
-							}
-							for x := box.X1 + borderLeftRadius; x <= box.X2-borderBottomRadius; x++ {
-								dst.Set(x, d.Container.Y2-width, borderColor)
-							}
-						}
-					default:
-						panic("border-style " + calcStyle.BorderStyle.Top + " not support")
+			}
+		}
 
+		if calcStyle.BorderStyle.Left != "" && calcStyle.BorderWidth.Left != "" && calcStyle.BorderColor.Left != "" {
+			borderWidth := getIntSize(calcStyle.BorderWidth.Left)
+			borderColor := getColor(calcStyle.BorderColor.Left)
+			switch calcStyle.BorderStyle.Left {
+			case "none", "hidden":
+			default:
+				// The other styles are drawn solid
+				for width := borderWidth - 1; width >= 0; width-- {
+					r := borderLeftRadius - width
+					for xxOffset := r; xxOffset >= 0; xxOffset-- {
+						yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
+						setPixel(dst, d.Container.X1+r-int(xxOffset), box.Y2-r+yyOffset, borderColor)
+						setPixel(dst, d.Container.X1+r-int(yyOffset), box.Y2-r+xxOffset, borderColor)
+					}
+					for y := box.Y1 + borderTopRadius; y <= box.Y2-borderLeftRadius; y++ {
+						setPixel(dst, d.Container.X1+width, y, borderColor)
 					}
 				}
+			}
+		}
+		drawColumnRules(dst, d)
+	}
+}
 
-				if calcStyle.BorderStyle.Left != "" && calcStyle.BorderWidth.Left != "" && calcStyle.BorderColor.Left != "" {
-					borderWidth := getIntSize(calcStyle.BorderWidth.Left)
-					borderColor := getColor(calcStyle.BorderColor.Left)
-					switch calcStyle.BorderStyle.Left {
-					case "solid":
-						for width := borderWidth - 1; width >= 0; width-- {
-							r := borderLeftRadius - width
-							for xxOffset := r; xxOffset >= 0; xxOffset-- {
-								yyOffset := int(math.Sqrt(float64(r*r - xxOffset*xxOffset)))
-								dst.Set(d.Container.X1+r-int(xxOffset), box.Y2-r+yyOffset, borderColor)
-								dst.Set(d.Container.X1+r-int(yyOffset), box.Y2-r+xxOffset, borderColor)
-							}
-							for y := box.Y1 + borderTopRadius; y <= box.Y2-borderLeftRadius; y++ {
-								dst.Set(d.Container.X1+width, y, borderColor)
-							}
-						}
-					default:
-						panic("border-style " + calcStyle.BorderStyle.Top + " not support")
+func drawText(dst *image.RGBA, d *Dom) {
+	calcStyle := d.TagStyle
+	if isHidden(calcStyle) {
+		return
+	}
+	face := getFontFace(calcStyle)
+	if face == nil {
+		panic("Font-Family " + calcStyle.FontFamily + " not exist")
+	}
+	col := calcStyle.Color
+	if col == "" {
+		col = "#000000"
+	}
+	fontColor := getColor(col)
+	text := d.TagData.(string)
+	x, y := d.Inner.X1, d.Container.Y1+d.baseline
+	_, fauxBold, fauxItalic := fontVariant(calcStyle)
+	if fauxItalic {
+		addObliqueText(face, dst, image.NewUniform(fontColor), text, x, y, fauxBold)
+	} else {
+		addText(face, dst, image.NewUniform(fontColor), text, x, y)
+		if fauxBold {
+			addText(face, dst, image.NewUniform(fontColor), text, x+1, y)
+		}
+	}
+	drawTextDecorations(dst, d)
+}
 
-					}
-				}
+// addObliqueText draws text slanted to the right, for the italic of a font
+// without italic glyphs.
+func addObliqueText(face font.Face, dst *image.RGBA, src *image.Uniform, text string, x int, y int, bold bool) {
+	metrics := face.Metrics()
+	ascent := metrics.Ascent.Ceil()
+	height := ascent + metrics.Descent.Ceil()
+	width := font.MeasureString(face, text).Ceil() + 2
+	mask := image.NewAlpha(image.Rect(0, 0, width, height))
+	fd := &font.Drawer{Dst: mask, Src: image.Opaque, Face: face}
+	fd.Dot = fixed.P(0, ascent)
+	fd.DrawString(text)
+	if bold {
+		fd.Dot = fixed.P(1, ascent)
+		fd.DrawString(text)
+	}
+	for row := 0; row < height; row++ {
+		dx := int(math.Round(float64(ascent-row) * obliqueSlant))
+		r := image.Rect(x+dx, y-ascent+row, x+dx+width, y-ascent+row+1)
+		draw.DrawMask(dst, r, src, image.ZP, mask, image.Pt(0, row), draw.Over)
+	}
+}
 
+// drawTextDecorations paints the lines of the text-decoration of the inline
+// elements and the block container a text is in, in the color of each of them.
+// Atomic inlines, floats and absolutely positioned boxes do not pass their
+// ancestors' decorations to their content.
+func drawTextDecorations(dst *image.RGBA, d *Dom) {
+	metrics := getFontMetrics(d.TagStyle)
+	thickness := maxInt(int(math.Round(getFontSize(d.TagStyle)/14)), 1)
+	baseline := d.Container.Y1 + d.baseline
+	for p := d.parent; p != nil; p = p.parent {
+		for _, line := range strings.Fields(p.TagStyle.TextDecoration) {
+			var y int
+			switch line {
+			case "underline":
+				y = baseline + maxInt(int(math.Round(metrics.descent/3)), 1)
+			case "overline":
+				y = baseline - int(math.Round(metrics.ascent))
+			case "line-through":
+				y = baseline - int(math.Round(metrics.xHeight/2))
+			default:
+				continue
 			}
-			drawChildren(dst, calcStyle, d.Children)
-		} else if d.DomType == DOM_TYPE_TEXT {
-			f, exist := fontMapping[calcStyle.FontFamily]
-			if !exist {
-				panic("Font-Family " + calcStyle.FontFamily + " not exist")
-			}
-			fontSize := getIntSize(calcStyle.FontSize)
-			col := calcStyle.Color
+			col := p.TagStyle.Color
 			if col == "" {
 				col = "#000000"
 			}
-			fontColor := getColor(col)
-			addText(f, float64(fontSize), dst, image.NewUniform(fontColor), d.TagData.(string), d.Inner.X1, d.Inner.Y1+11*fontSize/12)
-		} else {
-			// Comments or other document type
+			lineColor := getColor(col)
+			for ly := y; ly < y+thickness; ly++ {
+				for lx := d.Inner.X1; lx <= d.Inner.X2; lx++ {
+					setPixel(dst, lx, ly, lineColor)
+				}
+			}
+		}
+		if p.isFloat() || p.isPositionAbsolute() || (p.isInlineLevel() && !p.isInlineBox()) {
+			break
 		}
 	}
 }
 
-func addText(f *truetype.Font, size float64, dst *image.RGBA, src *image.Uniform, text string, x int, y int) {
+func isHidden(style *TagStyle) bool {
+	return style.Visibility == "hidden" || style.Visibility == "collapse"
+}
+
+func addText(face font.Face, dst *image.RGBA, src *image.Uniform, text string, x int, y int) {
 	fd := &font.Drawer{
-		Dst: dst,
-		Src: src,
-		Face: truetype.NewFace(f, &truetype.Options{
-			Size:    size,
-			DPI:     conf.DPI,
-			Hinting: font.HintingNone,
-		}),
+		Dst:  dst,
+		Src:  src,
+		Face: face,
 	}
 
 	fd.Dot = fixed.Point26_6{
@@ -240,21 +350,10 @@ func drawBoxRadius(dst *image.RGBA, box Rectangle, cStyle *TagStyle, pStyle *Tag
 		borderLeftRadius = halfSize
 	}
 
-	col := color.RGBA{
-		R: uint8(255),
-		G: uint8(255),
-		B: uint8(255),
-		A: uint8(255),
-	}
-
+	var col color.Color = color.White
 	if pStyle.BackgroundColor != "" {
-		pColor := getColor(pStyle.BackgroundColor)
-		r, g, b, a := pColor.RGBA()
-		col = color.RGBA{
-			R: uint8(r),
-			G: uint8(g),
-			B: uint8(b),
-			A: uint8(a),
+		if pColor, ok := parseColor(pStyle.BackgroundColor); ok && pColor.A > 0 {
+			col = pColor
 		}
 	}
 
@@ -263,7 +362,7 @@ func drawBoxRadius(dst *image.RGBA, box Rectangle, cStyle *TagStyle, pStyle *Tag
 			if outOfCircle(x, y, borderTopRadius) {
 				offsetX := borderTopRadius - x
 				offsetY := borderTopRadius - y
-				dst.Set(box.X1+offsetX, box.Y1+offsetY, col)
+				setPixel(dst, box.X1+offsetX, box.Y1+offsetY, col)
 			}
 		}
 	}
@@ -272,7 +371,7 @@ func drawBoxRadius(dst *image.RGBA, box Rectangle, cStyle *TagStyle, pStyle *Tag
 			if outOfCircle(x, y, borderRightRadius) {
 				offsetX := borderRightRadius - x
 				offsetY := borderRightRadius - y
-				dst.Set(box.X2-offsetX, box.Y1+offsetY, col)
+				setPixel(dst, box.X2-offsetX, box.Y1+offsetY, col)
 			}
 		}
 	}
@@ -282,7 +381,7 @@ func drawBoxRadius(dst *image.RGBA, box Rectangle, cStyle *TagStyle, pStyle *Tag
 				offsetX := borderBottomRadius - x
 				offsetY := borderBottomRadius - y
 
-				dst.Set(box.X2-offsetX, box.Y2-offsetY, col)
+				setPixel(dst, box.X2-offsetX, box.Y2-offsetY, col)
 			}
 		}
 	}
@@ -291,7 +390,7 @@ func drawBoxRadius(dst *image.RGBA, box Rectangle, cStyle *TagStyle, pStyle *Tag
 			if outOfCircle(x, y, borderLeftRadius) {
 				offsetX := borderLeftRadius - x
 				offsetY := borderLeftRadius - y
-				dst.Set(box.X1+offsetX, box.Y2-offsetY, col)
+				setPixel(dst, box.X1+offsetX, box.Y2-offsetY, col)
 			}
 		}
 	}
@@ -0,0 +1,121 @@
+package html2img
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestAutoMargins(t *testing.T) {
+	css := "body { margin: 0 } div { height: 10px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "centered",
+			css:     css,
+			content: `<div id="a" style="width: 100px; margin: 0 auto"></div>`,
+			want:    map[string]Rectangle{"a": {350, 0, 449, 9}},
+		},
+		{
+			name:    "left auto",
+			css:     css,
+			content: `<div id="a" style="width: 100px; margin-left: auto"></div>`,
+			want:    map[string]Rectangle{"a": {700, 0, 799, 9}},
+		},
+		{
+			name:    "right auto",
+			css:     css,
+			content: `<div id="a" style="width: 100px; margin-left: 20px; margin-right: auto"></div>`,
+			want:    map[string]Rectangle{"a": {20, 0, 119, 9}},
+		},
+		{
+			name:    "auto width",
+			css:     css,
+			content: `<div id="a" style="margin: 0 auto"></div><div id="b" style="margin: 0 30px"></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 799, 9}, "b": {30, 10, 769, 19}},
+		},
+		{
+			name:    "overconstrained",
+			css:     css,
+			content: `<div id="a" style="width: 900px; margin: 0 auto"></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 899, 9}},
+		},
+		{
+			name:    "padding",
+			css:     css,
+			content: `<div id="a" style="width: 100px; padding: 0 10px; margin: 0 auto"></div>`,
+			want:    map[string]Rectangle{"a": {340, 0, 459, 9}},
+		},
+		{
+			name:    "nested",
+			css:     css,
+			content: `<div id="p" style="width: 400px; height: auto; margin: 0 auto"><div id="c" style="width: 200px; margin: 0 auto"></div></div>`,
+			want:    map[string]Rectangle{"p": {200, 0, 599, 9}, "c": {300, 0, 499, 9}},
+		},
+		{
+			name:    "absolute",
+			css:     css,
+			content: `<div id="a" style="position: absolute; left: 0; right: 0; width: 100px; margin: 0 auto"></div>`,
+			want:    map[string]Rectangle{"a": {350, 0, 449, 9}},
+		},
+	})
+}
+
+func TestDisplay(t *testing.T) {
+	css := "body { margin: 0; line-height: 10px } div, span { height: 10px; width: 50px; vertical-align: top }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "none",
+			css:     css,
+			content: `<div style="display: none"></div><div id="b"></div>`,
+			want:    map[string]Rectangle{"b": {0, 0, 49, 9}},
+		},
+		{
+			name:    "block span",
+			css:     css,
+			content: `<span id="a" style="display: block"></span><span id="b" style="display: block"></span>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 9}, "b": {0, 10, 49, 19}},
+		},
+		{
+			name:    "inline-block divs",
+			css:     css,
+			content: `<div id="a" style="display: inline-block"></div><div id="b" style="display: inline-block; margin-left: 5px"></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 9}, "b": {55, 0, 104, 9}},
+		},
+		{
+			name:    "inline-block wraps",
+			css:     css,
+			content: `<div style="width: 120px; height: auto"><div id="a" style="display: inline-block"></div><div id="b" style="display: inline-block"></div><div id="c" style="display: inline-block"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 9}, "b": {50, 0, 99, 9}, "c": {0, 10, 49, 19}},
+		},
+		{
+			name:    "visibility hidden keeps its space",
+			css:     css,
+			content: `<div style="visibility: hidden"></div><div id="b"></div>`,
+			want:    map[string]Rectangle{"b": {0, 10, 49, 19}},
+		},
+	})
+}
+
+func TestVisibility(t *testing.T) {
+	css := "body { margin: 0; background-color: white } div { width: 50px; height: 50px; background-color: red }"
+	runPaintTests(t, []paintTest{
+		{
+			name:    "hidden",
+			css:     css,
+			content: `<div style="visibility: hidden"></div>`,
+			want:    map[image.Point]color.RGBA{{10, 10}: white},
+		},
+		{
+			name:    "visible child of hidden",
+			css:     css,
+			content: `<div style="visibility: hidden; height: auto"><div style="visibility: visible; background-color: blue"></div></div>`,
+			want:    map[image.Point]color.RGBA{{10, 10}: blue},
+		},
+		{
+			name:    "display none",
+			css:     css,
+			content: `<div style="display: none"></div><p style="margin: 0; height: 10px"></p>`,
+			want:    map[image.Point]color.RGBA{{0, 0}: white},
+		},
+	})
+}
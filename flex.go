@@ -0,0 +1,696 @@
+package html2img
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flexItem is an in-flow child of a flex container. Sizes are along the main
+// and cross axis of the container, main and cross are the content box sizes.
+type flexItem struct {
+	dom *Dom
+
+	marginMainStart  int
+	marginMainEnd    int
+	marginCrossStart int
+	marginCrossEnd   int
+	paddingMain      int
+	paddingCross     int
+
+	grow    float64
+	shrink  float64
+	basis   float64
+	minMain float64
+	target  float64
+	frozen  bool
+
+	main  int
+	cross int
+	// Distance from the cross start margin edge to the baseline
+	baseline int
+	// Offsets of the margin box in the container
+	mainPos  int
+	crossPos int
+}
+
+type flexLine struct {
+	items    []*flexItem
+	cross    int
+	baseline int
+	crossPos int
+}
+
+func (d *Dom) isFlexContainer() bool {
+	return d.TagStyle.Display == "flex" || d.TagStyle.Display == "inline-flex"
+}
+
+// blockify returns the display of a flex or grid item: its outer display is
+// always block-level.
+func blockify(display string) string {
+	switch display {
+	case "inline", "inline-block":
+		return "block"
+	case "inline-flex":
+		return "flex"
+	case "inline-grid":
+		return "grid"
+	}
+	return display
+}
+
+// anonymousItems wraps every run of texts directly inside a flex or grid
+// container in an anonymous block, which becomes an item of its own.
+func anonymousItems(container *Dom) []*Dom {
+	var children, run []*Dom
+	flush := func() {
+		if hasInlineContent(run) {
+			anonymous := &Dom{
+				DomType:  DOM_TYPE_ELEMENT,
+				TagStyle: getInheritStyle(container.TagStyle, &TagStyle{Display: "block"}),
+				parent:   container,
+				Children: run,
+			}
+			for _, text := range run {
+				text.parent = anonymous
+			}
+			children = append(children, anonymous)
+		}
+		run = nil
+	}
+	for _, child := range container.Children {
+		if child.DomType == DOM_TYPE_TEXT {
+			run = append(run, child)
+			continue
+		}
+		flush()
+		children = append(children, child)
+	}
+	flush()
+	return children
+}
+
+// setFlexStyle sets the flex grow, shrink and basis of the flex shorthand. It
+// returns false when cssValue is not a flex value.
+func setFlexStyle(tagStyle *TagStyle, cssValue string) bool {
+	switch cssValue {
+	case "none":
+		tagStyle.FlexGrow, tagStyle.FlexShrink, tagStyle.FlexBasis = "0", "0", "auto"
+		return true
+	case "auto":
+		tagStyle.FlexGrow, tagStyle.FlexShrink, tagStyle.FlexBasis = "1", "1", "auto"
+		return true
+	}
+	var factors []string
+	basis := ""
+	for _, attr := range splitValues(cssValue) {
+		if isNonNegativeNumber(attr) && basis == "" && len(factors) < 2 {
+			factors = append(factors, attr)
+			continue
+		}
+		if basis != "" || !valueValidators["flex-basis"](attr) {
+			return false
+		}
+		basis = attr
+	}
+	if len(factors) == 0 && basis == "" {
+		return false
+	}
+	tagStyle.FlexGrow, tagStyle.FlexShrink, tagStyle.FlexBasis = "1", "1", "0px"
+	if len(factors) > 0 {
+		tagStyle.FlexGrow = factors[0]
+	}
+	if len(factors) > 1 {
+		tagStyle.FlexShrink = factors[1]
+	}
+	if basis != "" {
+		tagStyle.FlexBasis = basis
+	}
+	return true
+}
+
+// getFlexFactor returns the flex grow or shrink factor of value, or
+// defaultValue when it has none.
+func getFlexFactor(value string, defaultValue float64) float64 {
+	factor, err := strconv.ParseFloat(value, 64)
+	if err != nil || factor < 0 {
+		return defaultValue
+	}
+	return factor
+}
+
+func getOrder(dom *Dom) int {
+	order, err := strconv.Atoi(strings.Trim(dom.TagStyle.Order, CUT_SET_LIST))
+	if err != nil {
+		return 0
+	}
+	return order
+}
+
+// alignSelf returns the cross axis alignment of a flex item.
+func alignSelf(item, container *Dom) string {
+	align := item.TagStyle.AlignSelf
+	if align == "" || align == "auto" {
+		align = container.TagStyle.AlignItems
+	}
+	switch align {
+	case "", "normal":
+		return "stretch"
+	case "start", "self-start":
+		return "flex-start"
+	case "end", "self-end":
+		return "flex-end"
+	}
+	return align
+}
+
+// layoutFlex lays out the children of the flex container at the end of
+// parents, following the flex layout algorithm of CSS Flexible Box Layout.
+func layoutFlex(parents []*Dom, cbHeight int) ([]*Dom, EndOffset) {
+	container := parents[len(parents)-1]
+	container.hasBaseline = false
+	style := container.TagStyle
+	row := !strings.HasPrefix(style.FlexDirection, "column")
+	reverse := strings.HasSuffix(style.FlexDirection, "-reverse")
+	wrap := style.FlexWrap == "wrap" || style.FlexWrap == "wrap-reverse"
+	innerWidth := container.Inner.X2 - container.Inner.X1 + 1
+	innerHeight := -1
+	if !container.isAutoHeight() {
+		innerHeight = container.Inner.Y2 - container.Inner.Y1 + 1
+	}
+	mainSize, crossSize := innerWidth, innerHeight
+	mainGap := getIntPx(style.ColumnGap, innerWidth)
+	crossGap := getIntPx(style.RowGap, maxInt(innerHeight, 0))
+	if !row {
+		mainSize, crossSize = innerHeight, innerWidth
+		mainGap, crossGap = crossGap, mainGap
+	}
+
+	var children []*Dom
+	var items []*flexItem
+	for _, dom := range container.sourceChildren() {
+		if dom.isPositionAbsolute() {
+			deferAbsolute(dom, parents, container.Inner.X1, container.Inner.Y1)
+			children = append(children, dom)
+			continue
+		}
+		items = append(items, newFlexItem(dom, parents, row, innerWidth, cbHeight))
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return getOrder(items[i].dom) < getOrder(items[j].dom)
+	})
+
+	// Collect the items into lines and resolve their main sizes
+	var lines []*flexLine
+	line := &flexLine{}
+	lineMain := 0.0
+	for _, item := range items {
+		outer := item.hypotheticalMain() + float64(item.outerMainExtra())
+		if wrap && mainSize >= 0 && len(line.items) > 0 && lineMain+float64(mainGap)+outer > float64(mainSize) {
+			lines = append(lines, line)
+			line = &flexLine{}
+			lineMain = 0
+		}
+		if len(line.items) > 0 {
+			lineMain += float64(mainGap)
+		}
+		lineMain += outer
+		line.items = append(line.items, item)
+	}
+	if len(line.items) > 0 {
+		lines = append(lines, line)
+	}
+	usedMain := 0
+	for _, line := range lines {
+		resolveFlexibleLengths(line.items, mainSize, mainGap)
+		// Round the edges rather than the sizes so that the items add up
+		lineMain, edge := 0, 0.0
+		for i, item := range line.items {
+			item.main = int(math.Round(edge+item.target)) - int(math.Round(edge))
+			edge += item.target
+			if i > 0 {
+				lineMain += mainGap
+			}
+			lineMain += item.main + item.outerMainExtra()
+		}
+		usedMain = maxInt(usedMain, lineMain)
+	}
+	if mainSize < 0 {
+		mainSize = usedMain
+	}
+
+	// Lay out the items at their main size to find their cross size
+	for _, line := range lines {
+		maxAbove, maxBelow := 0, 0
+		for _, item := range line.items {
+			item.layout(parents, row, innerWidth, cbHeight)
+			outer := item.cross + item.paddingCross + item.marginCrossStart + item.marginCrossEnd
+			line.cross = maxInt(line.cross, outer)
+			if row && alignSelf(item.dom, container) == "baseline" {
+				maxAbove = maxInt(maxAbove, item.baseline)
+				maxBelow = maxInt(maxBelow, outer-item.baseline)
+			}
+		}
+		line.cross = maxInt(line.cross, maxAbove+maxBelow)
+		line.baseline = maxAbove
+	}
+	if !wrap && len(lines) == 1 && crossSize >= 0 {
+		lines[0].cross = crossSize
+	}
+	usedCross := 0
+	for i, line := range lines {
+		if i > 0 {
+			usedCross += crossGap
+		}
+		usedCross += line.cross
+	}
+	if crossSize < 0 {
+		crossSize = usedCross
+	}
+
+	// Distribute the free cross space between the lines
+	crossFree := crossSize - usedCross
+	crossPos, crossBetween := 0, 0
+	switch style.AlignContent {
+	case "flex-start", "start":
+	case "flex-end", "end":
+		crossPos = crossFree
+	case "center":
+		crossPos = crossFree / 2
+	case "space-between":
+		if len(lines) > 1 && crossFree > 0 {
+			crossBetween = crossFree / (len(lines) - 1)
+		}
+	case "space-around":
+		if crossFree > 0 {
+			crossBetween = crossFree / len(lines)
+			crossPos = crossBetween / 2
+		}
+	case "space-evenly":
+		if crossFree > 0 {
+			crossBetween = crossFree / (len(lines) + 1)
+			crossPos = crossBetween
+		}
+	default:
+		if crossFree > 0 && len(lines) > 0 {
+			for _, line := range lines {
+				line.cross += crossFree / len(lines)
+			}
+		}
+	}
+	for _, line := range lines {
+		line.crossPos = crossPos
+		crossPos += line.cross + crossGap + crossBetween
+		if style.FlexWrap == "wrap-reverse" {
+			line.crossPos = crossSize - line.crossPos - line.cross
+		}
+		placeFlexLine(container, line, row, reverse, mainSize, mainGap, innerWidth, cbHeight)
+	}
+
+	for _, item := range items {
+		dom := item.dom
+		x, y := item.mainPos, item.crossPos
+		if !row {
+			x, y = y, x
+		}
+		dom.shift(container.Inner.X1+x-dom.Outer.X1, container.Inner.Y1+y-dom.Outer.Y1)
+		if dom.TagStyle.Position == "relative" {
+			dom.layoutAbsolutes()
+			dom.shift(relativeOffset(dom, innerWidth, maxInt(innerHeight, 0)))
+		}
+		if !container.hasBaseline && dom.hasBaseline {
+			container.baseline = dom.Container.Y1 + dom.baseline - container.Container.Y1
+			container.hasBaseline = true
+		}
+		children = append(children, dom)
+	}
+
+	endOffset := EndOffset{Y2: container.Inner.Y1 + crossSize - 1}
+	if !row {
+		endOffset.Y2 = container.Inner.Y1 + mainSize - 1
+	}
+	return children, endOffset
+}
+
+func newFlexItem(dom *Dom, parents []*Dom, row bool, cbWidth, cbHeight int) *flexItem {
+	style := dom.TagStyle
+	item := &flexItem{
+		dom:              dom,
+		marginMainStart:  getIntPx(style.Margin.Left, cbWidth),
+		marginMainEnd:    getIntPx(style.Margin.Right, cbWidth),
+		marginCrossStart: getIntPx(style.Margin.Top, cbWidth),
+		marginCrossEnd:   getIntPx(style.Margin.Bottom, cbWidth),
+		paddingMain:      getIntPx(style.Padding.Left, cbWidth) + getIntPx(style.Padding.Right, cbWidth),
+		paddingCross:     getIntPx(style.Padding.Top, cbWidth) + getIntPx(style.Padding.Bottom, cbWidth),
+		grow:             getFlexFactor(style.FlexGrow, 0),
+		shrink:           getFlexFactor(style.FlexShrink, 1),
+	}
+	if !row {
+		item.marginMainStart, item.marginCrossStart = item.marginCrossStart, item.marginMainStart
+		item.marginMainEnd, item.marginCrossEnd = item.marginCrossEnd, item.marginMainEnd
+		item.paddingMain, item.paddingCross = item.paddingCross, item.paddingMain
+	}
+
+	basis := style.FlexBasis
+	if basis == "" || basis == "auto" {
+		basis = style.Width
+		if !row {
+			basis = style.Height
+		}
+	}
+	mainCB := cbWidth
+	if !row {
+		mainCB = cbHeight
+	}
+	definite := basis != "" && basis != "auto" && basis != "content" && (!strings.HasSuffix(basis, "%") || mainCB > 0)
+	switch {
+	case row && dom.TagName == "img":
+		width, _ := dom.imageSize(cbWidth)
+		item.basis = float64(width)
+		item.minMain = item.basis
+	case row:
+		minWidth, maxWidth := intrinsicContentWidth(dom)
+		item.basis = float64(maxWidth)
+		if definite {
+			item.basis = float64(getIntPx(basis, mainCB))
+		}
+		item.minMain = math.Min(float64(minWidth), item.basis)
+	default:
+		// The content height of a column item depends on its width
+		item.layout(parents, row, cbWidth, cbHeight)
+		item.basis = float64(item.main)
+		item.minMain = item.basis
+		if definite {
+			item.basis = float64(getIntPx(basis, mainCB))
+			item.minMain = math.Min(item.minMain, item.basis)
+		}
+	}
+	if overflow := style.Overflow; overflow != "" && overflow != "visible" {
+		// The automatic minimum size of a scroll container is zero
+		item.minMain = 0
+	}
+	return item
+}
+
+func (item *flexItem) outerMainExtra() int {
+	return item.marginMainStart + item.marginMainEnd + item.paddingMain
+}
+
+func (item *flexItem) hypotheticalMain() float64 {
+	return math.Max(item.basis, item.minMain)
+}
+
+// layout lays out the item at the origin. A row item gets its main size as
+// width, a column item the width of the container when it stretches and its
+// fit-content width otherwise, then its resolved main size as height.
+func (item *flexItem) layout(parents []*Dom, row bool, cbWidth, cbHeight int) {
+	dom := item.dom
+	style := dom.TagStyle
+	container := parents[len(parents)-1]
+	marginLeft, marginTop := item.marginMainStart, item.marginCrossStart
+	if !row {
+		marginLeft, marginTop = marginTop, marginLeft
+	}
+	width := item.main
+	if !row {
+		width = getIntPx(style.Width, cbWidth)
+		paddingWidth := item.paddingCross
+		avail := cbWidth - item.marginCrossStart - item.marginCrossEnd - paddingWidth
+		switch {
+		case dom.TagName == "img":
+			width, _ = dom.imageSize(cbWidth)
+		case width > 0:
+		case alignSelf(dom, container) == "stretch" && !isAuto(style.Margin.Left) && !isAuto(style.Margin.Right):
+			width = avail
+		default:
+			minWidth, maxWidth := intrinsicContentWidth(dom)
+			width = minInt(maxInt(minWidth, avail), maxWidth)
+		}
+	}
+	layoutBox(dom, parents, marginLeft, marginTop, width, cbWidth, cbHeight)
+	if row {
+		item.cross = dom.Inner.Y2 - dom.Inner.Y1 + 1
+		item.baseline = dom.Container.Y2 - dom.Container.Y1 + 1
+		if dom.TagName != "img" && dom.hasBaseline {
+			item.baseline = dom.baseline
+		}
+		item.baseline += item.marginCrossStart
+	} else {
+		item.cross = width
+		if item.frozen {
+			setContentHeight(dom, item.main)
+		} else {
+			item.main = dom.Inner.Y2 - dom.Inner.Y1 + 1
+		}
+	}
+	dom.Outer = Rectangle{
+		X1: dom.Container.X1 - marginLeft,
+		Y1: dom.Container.Y1 - marginTop,
+		X2: dom.Container.X2 + getIntPx(style.Margin.Right, cbWidth),
+		Y2: dom.Container.Y2 + getIntPx(style.Margin.Bottom, cbWidth),
+	}
+}
+
+// setContentHeight sets the height of a laid out dom, as flex layout sizes it.
+func setContentHeight(dom *Dom, height int) {
+	dy := dom.Inner.Y1 + height - 1 - dom.Inner.Y2
+	dom.Inner.Y2 += dy
+	dom.Container.Y2 += dy
+	dom.Outer.Y2 += dy
+}
+
+// resolveFlexibleLengths sets the target main size of the items of a line,
+// growing or shrinking them to fill mainSize. Items shrinking below their
+// minimum size are frozen at it and the rest of the space is distributed
+// again.
+func resolveFlexibleLengths(items []*flexItem, mainSize, mainGap int) {
+	avail := float64(mainSize - mainGap*(len(items)-1))
+	used := 0.0
+	for _, item := range items {
+		used += item.hypotheticalMain() + float64(item.outerMainExtra())
+		item.target = item.hypotheticalMain()
+		item.frozen = false
+	}
+	if mainSize < 0 {
+		for _, item := range items {
+			item.frozen = true
+		}
+		return
+	}
+	grow := used < avail
+	for _, item := range items {
+		if (grow && item.grow == 0) || (!grow && item.shrink == 0) ||
+			(grow && item.basis > item.hypotheticalMain()) || (!grow && item.basis < item.hypotheticalMain()) {
+			item.frozen = true
+		}
+	}
+	for {
+		free := avail
+		factors := 0.0
+		unfrozen := 0
+		for _, item := range items {
+			free -= float64(item.outerMainExtra())
+			if item.frozen {
+				free -= item.target
+				continue
+			}
+			free -= item.basis
+			unfrozen++
+			if grow {
+				factors += item.grow
+			} else {
+				factors += item.shrink * item.basis
+			}
+		}
+		if unfrozen == 0 {
+			return
+		}
+		if grow && factors < 1 {
+			free *= factors
+		}
+		violation := 0.0
+		for _, item := range items {
+			if item.frozen {
+				continue
+			}
+			item.target = item.basis
+			if factors > 0 {
+				if grow {
+					item.target += free * item.grow / factors
+				} else {
+					item.target += free * item.shrink * item.basis / factors
+				}
+			}
+			if item.target < item.minMain {
+				violation += item.minMain - item.target
+				item.target = item.minMain
+			}
+		}
+		for _, item := range items {
+			if !item.frozen && (violation == 0 || item.target == item.minMain) {
+				item.frozen = true
+			}
+		}
+	}
+}
+
+// placeFlexLine positions the items of a line along the main axis by
+// justify-content and auto margins, and along the cross axis by align-self.
+func placeFlexLine(container *Dom, line *flexLine, row, reverse bool, mainSize, mainGap, cbWidth, cbHeight int) {
+	style := container.TagStyle
+	free := mainSize - mainGap*(len(line.items)-1)
+	autoMargins := 0
+	for _, item := range line.items {
+		free -= item.main + item.outerMainExtra()
+		for _, margin := range item.mainMargins(row) {
+			if isAuto(margin) {
+				autoMargins++
+			}
+		}
+	}
+	pos, between := 0, mainGap
+	autoMargin := 0
+	switch {
+	case autoMargins > 0:
+		if free > 0 {
+			autoMargin = free / autoMargins
+		}
+	case style.JustifyContent == "flex-end" || style.JustifyContent == "end" ||
+		(style.JustifyContent == "right" && row):
+		pos = free
+	case style.JustifyContent == "center":
+		pos = free / 2
+	case style.JustifyContent == "space-between":
+		if len(line.items) > 1 && free > 0 {
+			between += free / (len(line.items) - 1)
+		}
+	case style.JustifyContent == "space-around":
+		if free > 0 {
+			between += free / len(line.items)
+			pos = free / len(line.items) / 2
+		} else {
+			pos = free / 2
+		}
+	case style.JustifyContent == "space-evenly":
+		if free > 0 {
+			between += free / (len(line.items) + 1)
+			pos = free / (len(line.items) + 1)
+		} else {
+			pos = free / 2
+		}
+	}
+	if reverse && autoMargins == 0 {
+		// flex-start is the end of a reversed axis
+		switch style.JustifyContent {
+		case "start", "end", "left", "right":
+			pos = free - pos
+		}
+	}
+
+	for _, item := range line.items {
+		margins := item.mainMargins(row)
+		if isAuto(margins[0]) {
+			pos += autoMargin
+		}
+		outer := item.main + item.outerMainExtra()
+		item.mainPos = pos
+		if reverse {
+			item.mainPos = mainSize - pos - outer
+		}
+		pos += outer + between
+		if isAuto(margins[1]) {
+			pos += autoMargin
+		}
+		placeFlexItemCross(container, item, line, row, cbWidth)
+	}
+}
+
+func (item *flexItem) mainMargins(row bool) [2]string {
+	margin := item.dom.TagStyle.Margin
+	if row {
+		return [2]string{margin.Left, margin.Right}
+	}
+	return [2]string{margin.Top, margin.Bottom}
+}
+
+func (item *flexItem) crossMargins(row bool) [2]string {
+	margin := item.dom.TagStyle.Margin
+	if row {
+		return [2]string{margin.Top, margin.Bottom}
+	}
+	return [2]string{margin.Left, margin.Right}
+}
+
+// placeFlexItemCross aligns an item in the cross axis of its line, stretching
+// it when it has no definite cross size.
+func placeFlexItemCross(container *Dom, item *flexItem, line *flexLine, row bool, cbWidth int) {
+	dom := item.dom
+	style := dom.TagStyle
+	margins := item.crossMargins(row)
+	align := alignSelf(dom, container)
+	autoCross := style.Height == "" || isAuto(style.Height)
+	if !row {
+		autoCross = style.Width == "" || isAuto(style.Width)
+	}
+	if align == "stretch" && row && autoCross && dom.TagName != "img" && !isAuto(margins[0]) && !isAuto(margins[1]) {
+		item.cross = line.cross - item.marginCrossStart - item.marginCrossEnd - item.paddingCross
+		setContentHeight(dom, item.cross)
+	}
+	outer := item.cross + item.paddingCross + item.marginCrossStart + item.marginCrossEnd
+	free := line.cross - outer
+	offset := 0
+	switch {
+	case isAuto(margins[0]) && isAuto(margins[1]):
+		offset = maxInt(free, 0) / 2
+	case isAuto(margins[0]):
+		offset = maxInt(free, 0)
+	case isAuto(margins[1]):
+	case align == "flex-end":
+		offset = free
+	case align == "center":
+		offset = free / 2
+	case align == "baseline" && row:
+		offset = line.baseline - item.baseline
+	}
+	if container.TagStyle.FlexWrap == "wrap-reverse" {
+		offset = free - offset
+	}
+	item.crossPos = line.crossPos + offset
+}
+
+// intrinsicFlexWidth returns the min-content and max-content widths of the
+// content of a flex container.
+func intrinsicFlexWidth(dom *Dom) (int, int) {
+	style := dom.TagStyle
+	row := !strings.HasPrefix(style.FlexDirection, "column")
+	wrap := style.FlexWrap == "wrap" || style.FlexWrap == "wrap-reverse"
+	gap := getIntSize(style.ColumnGap)
+	var minWidth, maxWidth int
+	items := 0
+	for _, child := range dom.sourceChildren() {
+		if child.isPositionAbsolute() {
+			continue
+		}
+		childMin, childMax := intrinsicOuterWidth(child)
+		if !row {
+			minWidth = maxInt(minWidth, childMin)
+			maxWidth = maxInt(maxWidth, childMax)
+			continue
+		}
+		if items > 0 {
+			maxWidth += gap
+			if !wrap {
+				minWidth += gap
+			}
+		}
+		items++
+		maxWidth += childMax
+		if wrap {
+			minWidth = maxInt(minWidth, childMin)
+		} else {
+			minWidth += childMin
+		}
+	}
+	return minWidth, maxWidth
+}
@@ -0,0 +1,111 @@
+package html2img
+
+import "testing"
+
+func TestFlexLayout(t *testing.T) {
+	css := "body { margin: 0 } .flex { display: flex; width: 300px; height: 100px } .flex > div { width: 50px; height: 20px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "row",
+			css:     css,
+			content: `<div class="flex"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 19}, "b": {50, 0, 99, 19}},
+		},
+		{
+			name:    "grow",
+			css:     css,
+			content: `<div class="flex"><div id="a" style="flex-grow: 1"></div><div id="b" style="flex-grow: 3"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 299, 19}},
+		},
+		{
+			name:    "shrink",
+			css:     css,
+			content: `<div class="flex"><div id="a" style="width: 200px"></div><div id="b" style="width: 200px; flex-shrink: 3"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 174, 19}, "b": {175, 0, 299, 19}},
+		},
+		{
+			name:    "flex shorthand",
+			css:     css,
+			content: `<div class="flex"><div id="a" style="flex: 1"></div><div id="b" style="flex: 0 0 100px"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 199, 19}, "b": {200, 0, 299, 19}},
+		},
+		{
+			name:    "fractional sizes add up",
+			css:     css,
+			content: `<div class="flex" style="width: 400px"><div id="a" style="flex: 1"></div><div id="b" style="flex: 1"></div><div id="c" style="flex: 1"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 132, 19}, "b": {133, 0, 266, 19}, "c": {267, 0, 399, 19}},
+		},
+		{
+			name:    "fractional sizes with gaps add up",
+			css:     css,
+			content: `<div class="flex" style="width: 400px; gap: 10px"><div id="a" style="flex: 1"></div><div id="b" style="flex: 1"></div><div id="c" style="flex: 1"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 126, 19}, "b": {137, 0, 262, 19}, "c": {273, 0, 399, 19}},
+		},
+		{
+			name:    "column",
+			css:     css,
+			content: `<div class="flex" style="flex-direction: column"><div id="a"></div><div id="b" style="flex-grow: 1"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 19}, "b": {0, 20, 49, 99}},
+		},
+		{
+			name:    "row-reverse",
+			css:     css,
+			content: `<div class="flex" style="flex-direction: row-reverse"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {250, 0, 299, 19}, "b": {200, 0, 249, 19}},
+		},
+		{
+			name:    "wrap",
+			css:     css,
+			content: `<div class="flex" style="flex-wrap: wrap; align-content: flex-start"><div id="a" style="width: 200px"></div><div id="b" style="width: 200px"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 199, 19}, "b": {0, 20, 199, 39}},
+		},
+		{
+			name:    "gap",
+			css:     css,
+			content: `<div class="flex" style="gap: 10px"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"b": {60, 0, 109, 19}},
+		},
+		{
+			name:    "order",
+			css:     css,
+			content: `<div class="flex"><div id="a" style="order: 2"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {50, 0, 99, 19}, "b": {0, 0, 49, 19}},
+		},
+		{
+			name:    "justify-content center",
+			css:     css,
+			content: `<div class="flex" style="justify-content: center"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {100, 0, 149, 19}, "b": {150, 0, 199, 19}},
+		},
+		{
+			name:    "justify-content space-between",
+			css:     css,
+			content: `<div class="flex" style="justify-content: space-between"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 19}, "b": {250, 0, 299, 19}},
+		},
+		{
+			name:    "align-items",
+			css:     css,
+			content: `<div class="flex" style="align-items: center"><div id="a"></div><div id="b" style="align-self: flex-end"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 40, 49, 59}, "b": {50, 80, 99, 99}},
+		},
+		{
+			name:    "stretch",
+			css:     css,
+			content: `<div class="flex"><div id="a" style="height: auto"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 99}},
+		},
+		{
+			name:    "auto margin",
+			css:     css,
+			content: `<div class="flex"><div id="a"></div><div id="b" style="margin-left: auto"></div></div>`,
+			want:    map[string]Rectangle{"b": {250, 0, 299, 19}},
+		},
+		{
+			name:    "invalid values ignored",
+			css:     css,
+			content: `<div class="flex" style="flex-direction: sideways; gap: -5px"><div id="a" style="flex: foo; order: x"></div><div id="b" style="flex-grow: -1"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 19}, "b": {50, 0, 99, 19}},
+		},
+	})
+}
@@ -0,0 +1,167 @@
+package html2img
+
+import (
+	"image"
+)
+
+// floatContext holds the floats placed in a block formatting context. The line
+// boxes of the context are shortened to flow around them.
+type floatContext struct {
+	floats []*Dom
+}
+
+func (d *Dom) isFloat() bool {
+	if d.DomType != DOM_TYPE_ELEMENT || d.isPositionAbsolute() {
+		return false
+	}
+	if d.parent != nil && (d.parent.isFlexContainer() || d.parent.isGridContainer()) {
+		return false
+	}
+	return d.TagStyle.Float == "left" || d.TagStyle.Float == "right"
+}
+
+// establishesBFC reports whether d is the root of a block formatting context:
+// the floats inside it stay inside, and the floats outside do not flow into
+// it.
+func (d *Dom) establishesBFC() bool {
+	style := d.TagStyle
+	switch {
+	case d.parent == nil || d.isFloat() || d.isPositionAbsolute():
+		return true
+	case d.parent.isFlexContainer() || d.parent.isGridContainer():
+		return true
+	case style.Overflow != "" && style.Overflow != "visible":
+		return true
+	case d.isMultiColumn():
+		return true
+	}
+	switch style.Display {
+	case "flow-root", "inline-block", "table-cell", "table-caption",
+		"flex", "inline-flex", "grid", "inline-grid", "table", "inline-table":
+		return true
+	}
+	return false
+}
+
+// floatContextOf returns the floats of the block formatting context the
+// content of the last of parents belongs to.
+func floatContextOf(parents []*Dom) *floatContext {
+	i := len(parents) - 1
+	for i > 0 && !parents[i].establishesBFC() {
+		i--
+	}
+	if parents[i].floats == nil {
+		parents[i].floats = &floatContext{}
+	}
+	return parents[i].floats
+}
+
+// bounds returns the left and right edges of the room the floats leave between
+// y and y+height-1 in a block container spanning x1 to x2.
+func (c *floatContext) bounds(x1, x2, y, height int) (int, int) {
+	for _, f := range c.floats {
+		if f.Outer.Y2 < y || f.Outer.Y1 > y+height-1 {
+			continue
+		}
+		if f.TagStyle.Float == "left" {
+			x1 = maxInt(x1, f.Outer.X2+1)
+		} else {
+			x2 = minInt(x2, f.Outer.X1-1)
+		}
+	}
+	return x1, x2
+}
+
+// nextBottom returns the first y below the bottom of a float between y and
+// y+height-1, where the room beside the floats changes.
+func (c *floatContext) nextBottom(y, height int) (int, bool) {
+	next, found := 0, false
+	for _, f := range c.floats {
+		if f.Outer.Y2 < y || f.Outer.Y1 > y+height-1 {
+			continue
+		}
+		if !found || f.Outer.Y2+1 < next {
+			next, found = f.Outer.Y2+1, true
+		}
+	}
+	return next, found
+}
+
+// clearY returns the first y at or below y that is past the floats on the
+// sides cleared by clear.
+func (c *floatContext) clearY(clear string, y int) int {
+	for _, f := range c.floats {
+		if clear == "both" || clear == f.TagStyle.Float {
+			y = maxInt(y, f.Outer.Y2+1)
+		}
+	}
+	return y
+}
+
+// bottom returns the y below the lowest float.
+func (c *floatContext) bottom() int {
+	y := 0
+	for _, f := range c.floats {
+		y = maxInt(y, f.Outer.Y2+1)
+	}
+	return y
+}
+
+// place moves a float laid out at the origin to the highest position at or
+// below y where it fits beside the other floats, in a block container spanning
+// x1 to x2.
+func (c *floatContext) place(dom *Dom, x1, x2, y, cbWidth, cbHeight int) {
+	width := dom.Outer.X2 - dom.Outer.X1 + 1
+	height := maxInt(dom.Outer.Y2-dom.Outer.Y1+1, 1)
+	// A float is never higher than an earlier one
+	for _, f := range c.floats {
+		y = maxInt(y, f.Outer.Y1)
+	}
+	y = c.clearY(dom.TagStyle.Clear, y)
+	left, right := c.bounds(x1, x2, y, height)
+	for right-left+1 < width {
+		next, ok := c.nextBottom(y, height)
+		if !ok {
+			break
+		}
+		y = next
+		left, right = c.bounds(x1, x2, y, height)
+	}
+	x := left
+	if dom.TagStyle.Float == "right" {
+		x = right - width + 1
+	}
+	dom.shift(x-dom.Outer.X1, y-dom.Outer.Y1)
+	if dom.TagStyle.Position == "relative" {
+		dom.layoutAbsolutes()
+		dom.shift(relativeOffset(dom, cbWidth, cbHeight))
+	}
+	c.floats = append(c.floats, dom)
+}
+
+// layoutFloat lays out a float of the block container at the end of parents
+// and places it at y or below.
+func layoutFloat(dom *Dom, parents []*Dom, y, cbHeight int) {
+	container := parents[len(parents)-1]
+	cbWidth := container.Inner.X2 - container.Inner.X1 + 1
+	layoutAtomicInline(dom, parents, cbWidth, cbHeight)
+	floatContextOf(parents).place(dom, container.Inner.X1, container.Inner.X2, y, cbWidth, cbHeight)
+}
+
+// drawFloats paints the floats in the flow of d, each one as a whole after the
+// blocks and before the inline content.
+func drawFloats(dst *image.RGBA, d *Dom) {
+	for _, child := range d.Children {
+		if child.DomType != DOM_TYPE_ELEMENT || child.isPositioned() || child.isStackingContext() {
+			continue
+		}
+		if child.isFloat() {
+			drawBox(dst, child)
+			drawContent(dst, child)
+			continue
+		}
+		if !child.isInlineLevel() || child.isInlineBox() {
+			drawFloats(dst, child)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package html2img
+
+import "testing"
+
+func TestFloats(t *testing.T) {
+	css := "body { margin: 0 } div { height: 20px } .box { width: 50px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "left and right",
+			css:     css,
+			content: `<div id="l" class="box" style="float: left"></div><div id="r" class="box" style="float: right"></div>`,
+			want:    map[string]Rectangle{"l": {0, 0, 49, 19}, "r": {750, 0, 799, 19}},
+		},
+		{
+			name:    "side by side",
+			css:     css,
+			content: `<div id="a" class="box" style="float: left"></div><div id="b" class="box" style="float: left; margin-left: 5px"></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 19}, "b": {55, 0, 104, 19}},
+		},
+		{
+			name:    "wrap below",
+			css:     css,
+			content: `<div style="width: 120px; height: auto"><div id="a" class="box" style="float: left"></div><div id="b" class="box" style="float: left"></div><div id="c" class="box" style="float: left"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 19}, "b": {50, 0, 99, 19}, "c": {0, 20, 49, 39}},
+		},
+		{
+			name:    "clear",
+			css:     css,
+			content: `<div class="box" style="float: left; height: 40px"></div><div id="c" style="clear: left"></div>`,
+			want:    map[string]Rectangle{"c": {0, 40, 799, 59}},
+		},
+		{
+			name:    "clear right ignores left floats",
+			css:     css,
+			content: `<div class="box" style="float: left; height: 40px"></div><div id="c" style="clear: right"></div>`,
+			want:    map[string]Rectangle{"c": {0, 0, 799, 19}},
+		},
+		{
+			name:    "block formatting context beside float",
+			css:     css,
+			content: `<div class="box" style="float: left"></div><div id="b" style="overflow: hidden"></div>`,
+			want:    map[string]Rectangle{"b": {50, 0, 799, 19}},
+		},
+		{
+			name:    "line boxes shortened",
+			css:     css + " p { margin: 0 } .i { display: inline-block; width: 10px; height: 10px; vertical-align: top }",
+			content: `<div class="box" style="float: left"></div><p><span id="i" class="i"></span></p>`,
+			want:    map[string]Rectangle{"i": {50, 0, 59, 9}},
+		},
+		{
+			name:    "float contained by block formatting context",
+			css:     css,
+			content: `<div id="p" style="height: auto; overflow: hidden"><div class="box" style="float: left; height: 40px"></div></div>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 39}},
+		},
+		{
+			name:    "float pushed below by width",
+			css:     css,
+			content: `<div style="width: 100px; height: auto"><div id="a" style="float: left; width: 60px"></div><div id="b" style="float: right; width: 60px"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 59, 19}, "b": {40, 20, 99, 39}},
+		},
+	})
+}
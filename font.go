@@ -1,6 +1,224 @@
 package html2img
 
-import "github.com/wnote/html2img/conf"
+import (
+	"image"
+	"image/draw"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/wnote/html2img/conf"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+const DEFAULT_FONT_SIZE = 16
+
+type fontFaceKey struct {
+	family string
+	size   float64
+}
+
+var fontFaceMapping = make(map[fontFaceKey]font.Face)
+
+// fontMu guards fontMapping, fontFaceMapping and missingFonts, which the
+// renders of several goroutines share
+var fontMu sync.Mutex
+
+// Font files looked up for a bold or italic variant of a family and missing
+var missingFonts = make(map[string]bool)
+
+// Slant of the glyphs of a synthesized italic
+const obliqueSlant = 0.2
+
+// fontMetrics are the vertical metrics of a font at a size, in pixels.
+type fontMetrics struct {
+	ascent  float64
+	descent float64
+	xHeight float64
+}
+
+func getFontSize(style *TagStyle) float64 {
+	if size := getPx(style.FontSize, 0); size > 0 {
+		return size
+	}
+	return DEFAULT_FONT_SIZE
+}
+
+func isBold(style *TagStyle) bool {
+	switch style.FontWeight {
+	case "bold", "bolder":
+		return true
+	}
+	weight, err := strconv.Atoi(style.FontWeight)
+	return err == nil && weight >= 600
+}
+
+func isItalic(style *TagStyle) bool {
+	return style.FontStyle == "italic" || style.FontStyle == "oblique"
+}
+
+// fontVariant returns the font file of the family of style in its weight and
+// style: Go.ttf is bold in GoBold.ttf or Go-Bold.ttf. When the family has no
+// such file, the glyphs of the regular font are emboldened or slanted.
+func fontVariant(style *TagStyle) (family string, fauxBold bool, fauxItalic bool) {
+	family = style.FontFamily
+	bold, italic := isBold(style), isItalic(style)
+	if family == "" || (!bold && !italic) {
+		return family, false, false
+	}
+	var suffixes []string
+	switch {
+	case bold && italic:
+		suffixes = []string{"BoldItalic", "Bold"}
+	case bold:
+		suffixes = []string{"Bold"}
+	default:
+		suffixes = []string{"Italic", "Oblique"}
+	}
+	ext := filepath.Ext(family)
+	base := strings.TrimSuffix(family, ext)
+	for _, suffix := range suffixes {
+		for _, sep := range []string{"", "-"} {
+			if variant := base + sep + suffix + ext; loadFontVariant(variant) {
+				return variant, false, italic && !strings.Contains(suffix, "Italic")
+			}
+		}
+	}
+	return family, bold, italic
+}
+
+// loadFontVariant reports whether the font file is loaded, loading it from the
+// font path when it exists.
+func loadFontVariant(fontFile string) bool {
+	fontMu.Lock()
+	defer fontMu.Unlock()
+	if _, exist := fontMapping[fontFile]; exist {
+		return true
+	}
+	if missingFonts[fontFile] {
+		return false
+	}
+	f, err := getFontFromFile(conf.GConf["font_path"] + "/" + fontFile)
+	if err != nil {
+		missingFonts[fontFile] = true
+		return false
+	}
+	fontMapping[fontFile] = f
+	return true
+}
+
+// getFontFace returns the cached face of the font of style, or nil when no
+// font is loaded for it.
+func getFontFace(style *TagStyle) font.Face {
+	family, _, _ := fontVariant(style)
+	fontMu.Lock()
+	defer fontMu.Unlock()
+	f, exist := fontMapping[family]
+	if !exist {
+		return nil
+	}
+	key := fontFaceKey{family: family, size: getFontSize(style)}
+	face, exist := fontFaceMapping[key]
+	if !exist {
+		face = &lockedFace{face: truetype.NewFace(f, &truetype.Options{
+			Size:    key.size,
+			DPI:     conf.DPI,
+			Hinting: font.HintingNone,
+		})}
+		fontFaceMapping[key] = face
+	}
+	return face
+}
+
+// lockedFace is a face the renders of several goroutines share. The faces of
+// truetype are not safe for concurrent use, and return the mask of a glyph in a
+// buffer their next call overwrites, so the mask is copied.
+type lockedFace struct {
+	mu   sync.Mutex
+	face font.Face
+}
+
+func (f *lockedFace) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.Close()
+}
+
+func (f *lockedFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dr, mask, maskp, advance, ok = f.face.Glyph(dot, r)
+	if !ok || mask == nil {
+		return dr, mask, maskp, advance, ok
+	}
+	copied := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	draw.Draw(copied, copied.Bounds(), mask, maskp, draw.Src)
+	return dr, copied, image.Point{}, advance, ok
+}
+
+func (f *lockedFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.GlyphBounds(r)
+}
+
+func (f *lockedFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.GlyphAdvance(r)
+}
+
+func (f *lockedFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.Kern(r0, r1)
+}
+
+func (f *lockedFace) Metrics() font.Metrics {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.Metrics()
+}
+
+func getFontMetrics(style *TagStyle) fontMetrics {
+	face := getFontFace(style)
+	if face == nil {
+		size := getFontSize(style) * conf.DPI / 72
+		return fontMetrics{ascent: size * 11 / 12, descent: size / 4, xHeight: size / 2}
+	}
+	metrics := face.Metrics()
+	return fontMetrics{
+		ascent:  fixedToFloat(metrics.Ascent),
+		descent: fixedToFloat(metrics.Descent),
+		xHeight: getXHeight(face, metrics),
+	}
+}
+
+func getXHeight(face font.Face, metrics font.Metrics) float64 {
+	if metrics.XHeight > 0 {
+		return fixedToFloat(metrics.XHeight)
+	}
+	if bounds, _, ok := face.GlyphBounds('x'); ok {
+		return -fixedToFloat(bounds.Min.Y)
+	}
+	return fixedToFloat(metrics.Ascent) / 2
+}
+
+// measureText returns the advance width of text in the font of style.
+func measureText(style *TagStyle, text string) float64 {
+	face := getFontFace(style)
+	if face == nil {
+		return calcCharacterPx(text, getFontSize(style))
+	}
+	return fixedToFloat(font.MeasureString(face, text))
+}
+
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
 
 func calcCharacterPx(text string, fontSize float64) float64 {
 	return (float64(calCharacterLen(text)) * fontSize * conf.DPI / 72) / 3
@@ -19,28 +237,3 @@ func calCharacterLen(str string) float64 {
 	}
 	return sl
 }
-
-func splitMultiLineText(text string, size float64, domX1, parentX2, parentX1 int) []string {
-	firstLineWidth := float64(parentX2-domX1) - size
-	maxLineWidth := float64(parentX2-parentX1) - size
-
-	var multiTextGroupByLine []string
-	var tmpStr string
-	var tmpWidth float64
-	for idx, value := range text {
-		subStr := string(value)
-		strWidth := (float64(calCharacterLen(subStr)) * size * conf.DPI / 72) / 3
-		tmpWidth += strWidth
-		tmpStr += subStr
-		if (idx == 0 && tmpWidth > firstLineWidth) || (idx > 0 && tmpWidth > maxLineWidth) {
-			multiTextGroupByLine = append(multiTextGroupByLine, tmpStr)
-			tmpWidth = 0
-			tmpStr = ""
-		}
-	}
-	if tmpStr != "" {
-		multiTextGroupByLine = append(multiTextGroupByLine, tmpStr)
-	}
-
-	return multiTextGroupByLine
-}
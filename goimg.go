@@ -1,28 +1,233 @@
 package html2img
 
 import (
+	"bufio"
 	"bytes"
-	"log"
+	"fmt"
+	"io"
+	"strings"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
+// Renderer converts html documents to images. The zero value renders with the
+// default user agent stylesheet.
+type Renderer struct {
+	// UserAgentStyle replaces DefaultUserAgentStyle when it is not empty
+	UserAgentStyle string
+	// DisableUserAgentStyle renders with the styles of the document only
+	DisableUserAgentStyle bool
+
+	// ViewportWidth and ViewportHeight are the size in px media queries are
+	// evaluated against, 800x600 when they are 0
+	ViewportWidth  int
+	ViewportHeight int
+	// DevicePixelRatio is the resolution media queries are evaluated against,
+	// 1 when it is 0
+	DevicePixelRatio float64
+	// ColorScheme is the prefers-color-scheme of media queries, light or
+	// dark, light when it is empty
+	ColorScheme string
+
+	// Variables are custom properties set on the root element, above the
+	// values the stylesheets give it. The names may omit their --.
+	Variables map[string]string
+
+	// BaseURL resolves the relative urls of the documents, below their <base>
+	BaseURL string
+	// Loader fetches the linked and imported stylesheets and the images,
+	// DefaultLoader when it is nil
+	Loader ResourceLoader
+	// OnLoadError is called with the url of a stylesheet or an image that
+	// failed to load, which the rendering skips
+	OnLoadError func(url string, err error)
+
+	// PrependStyles and PrependStylesheets come before the stylesheets of
+	// the documents in the cascade, which override them. AppendStyles and
+	// AppendStylesheets come after them and override them.
+	PrependStyles      []string
+	PrependStylesheets []*Stylesheet
+	AppendStyles       []string
+	AppendStylesheets  []*Stylesheet
+
+	// Charset is the encoding of the documents, like gbk or big5, above the
+	// one their <meta> declares but below their byte order mark. The
+	// encoding is detected when it is empty.
+	Charset string
+
+	// Stylesheets loaded by the renderings
+	stylesheets stylesheetCache
+}
+
 func Html2Img(htmlBytes []byte) ([]byte, error) {
-	htmlIoReader := bytes.NewReader(htmlBytes)
+	return (&Renderer{}).Render(htmlBytes)
+}
+
+// declaresCharset reports whether a <meta> tag of prefix declares an encoding.
+func declaresCharset(prefix []byte) bool {
+	tokenizer := html.NewTokenizer(bytes.NewReader(prefix))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			if string(name) != "meta" {
+				continue
+			}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				if string(key) == "charset" ||
+					string(key) == "content" && strings.Contains(strings.ToLower(string(value)), "charset=") {
+					return true
+				}
+			}
+		}
+	}
+}
+
+// RenderFragment converts an html fragment, like the content of a body, to a
+// jpeg image. The css stylesheets come before the styles of the fragment.
+func RenderFragment(fragment []byte, css ...string) ([]byte, error) {
+	return (&Renderer{}).RenderFragment(fragment, css...)
+}
+
+// Html2ImgReader converts the html document read from reader to a jpeg
+// image.
+func Html2ImgReader(reader io.Reader) ([]byte, error) {
+	return (&Renderer{}).RenderReader(reader)
+}
+
+// Render converts an html document to a jpeg image.
+func (r *Renderer) Render(htmlBytes []byte) ([]byte, error) {
+	return r.RenderReader(bytes.NewReader(htmlBytes))
+}
+
+// RenderReader converts the html document read from reader to a jpeg image.
+func (r *Renderer) RenderReader(reader io.Reader) ([]byte, error) {
+	htmlIoReader, err := r.decode(reader)
+	if err != nil {
+		return nil, err
+	}
 	htmlNode, err := html.Parse(htmlIoReader)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return r.renderDocument(htmlNode, nil)
+}
 
-	body, styleList := GetBodyStyle(htmlNode)
+// decode returns reader decoded to UTF-8 from the encoding of its byte order
+// mark, r.Charset or the encoding its <meta charset> or <meta http-equiv>
+// declares. Documents without any of them are UTF-8.
+func (r *Renderer) decode(reader io.Reader) (io.Reader, error) {
+	contentType := "text/html"
+	if r.Charset != "" {
+		if encoding, _ := charset.Lookup(r.Charset); encoding == nil {
+			return nil, fmt.Errorf("unsupported charset %v", r.Charset)
+		}
+		contentType += "; charset=" + r.Charset
+	}
+	// The declarations are looked for in the first 1024 bytes
+	buffered := bufio.NewReaderSize(reader, 1024)
+	prefix, err := buffered.Peek(1024)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	encoding, _, certain := charset.DetermineEncoding(prefix, contentType)
+	if !certain && !declaresCharset(prefix) {
+		// Rather than the windows-1252 guessed from an ascii prefix
+		encoding = unicode.UTF8
+	}
+	// The byte order mark is removed
+	return transform.NewReader(buffered, unicode.BOMOverride(encoding.NewDecoder())), nil
+}
 
-	var styleString []string
-	for _, value := range styleList {
-		styleString = append(styleString, value.FirstChild.Data)
+// RenderFragment converts an html fragment to a jpeg image, in the body of a
+// document whose width is the viewport width. The css stylesheets come
+// before the styles of the fragment.
+func (r *Renderer) RenderFragment(fragment []byte, css ...string) ([]byte, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	fragmentReader, err := r.decode(bytes.NewReader(fragment))
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := html.ParseFragment(fragmentReader, body)
+	if err != nil {
+		return nil, err
 	}
-	tagStyleList := ParseStyle(styleString)
+	for _, node := range nodes {
+		body.AppendChild(node)
+	}
+	htmlNode := &html.Node{Type: html.ElementNode, Data: "html", DataAtom: atom.Html}
+	htmlNode.AppendChild(&html.Node{Type: html.ElementNode, Data: "head", DataAtom: atom.Head})
+	htmlNode.AppendChild(body)
+	document := &html.Node{Type: html.DocumentNode}
+	document.AppendChild(htmlNode)
 
-	parsedBodyDom := GetHtmlDom(body, tagStyleList)
+	var sheets []*Stylesheet
+	for _, style := range css {
+		sheets = append(sheets, ParseStylesheet(style))
+	}
+	return r.renderDocument(document, sheets)
+}
 
+// renderDocument renders a parsed document, the stylesheets of r and then
+// sheets coming before the ones of the document.
+func (r *Renderer) renderDocument(htmlNode *html.Node, sheets []*Stylesheet) ([]byte, error) {
+	parsedBodyDom, err := r.layoutDocument(htmlNode, sheets)
+	if err != nil {
+		return nil, err
+	}
 	return bodyDom2Img(parsedBodyDom)
 }
+
+// layoutDocument returns the laid out body of a parsed document, styled as
+// renderDocument styles it.
+func (r *Renderer) layoutDocument(htmlNode *html.Node, sheets []*Stylesheet) (*Dom, error) {
+	body, styleList := GetBodyStyle(htmlNode)
+	if body == nil {
+		// html.Parse creates a body but for frameset documents
+		return nil, fmt.Errorf("document without body")
+	}
+
+	media := r.media()
+	styles := r.styleLoader(media)
+	baseURL := documentBaseURL(htmlNode, r.BaseURL)
+	tagStyleList := r.userAgentStyles()
+	tagStyleList = tagStyleList[:len(tagStyleList):len(tagStyleList)]
+	for _, style := range r.PrependStyles {
+		tagStyleList = append(tagStyleList, styles.tagStyles(ParseStylesheet(style), baseURL)...)
+	}
+	for _, sheet := range append(r.PrependStylesheets[:len(r.PrependStylesheets):len(r.PrependStylesheets)], sheets...) {
+		tagStyleList = append(tagStyleList, styles.tagStyles(sheet, baseURL)...)
+	}
+	for _, value := range styleList {
+		if !media.matches(getAttr(value, "media")) {
+			continue
+		}
+		if value.Data == "link" {
+			tagStyleList = append(tagStyleList, styles.load(resolveURL(baseURL, getAttr(value, "href")))...)
+			continue
+		}
+		if value.FirstChild == nil {
+			continue
+		}
+		tagStyleList = append(tagStyleList, styles.tagStyles(ParseStylesheet(value.FirstChild.Data), baseURL)...)
+	}
+	for _, style := range r.AppendStyles {
+		tagStyleList = append(tagStyleList, styles.tagStyles(ParseStylesheet(style), baseURL)...)
+	}
+	for _, sheet := range r.AppendStylesheets {
+		tagStyleList = append(tagStyleList, styles.tagStyles(sheet, baseURL)...)
+	}
+	if len(r.Variables) > 0 {
+		tagStyleList = append(tagStyleList, variableStyle(r.Variables))
+	}
+
+	return getHtmlDom(body, tagStyleList, media, r.imageLoader(baseURL)), nil
+}
@@ -0,0 +1,379 @@
+package html2img
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wnote/html2img/conf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/net/html"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// The tests render with the Go fonts, written to a temporary font path.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "html2img")
+	if err != nil {
+		panic(err)
+	}
+	fonts := map[string][]byte{
+		"Go.ttf":       goregular.TTF,
+		"Go-Bold.ttf":  gobold.TTF,
+		"GoItalic.ttf": goitalic.TTF,
+	}
+	for name, data := range fonts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			panic(err)
+		}
+	}
+	conf.GConf["font_path"] = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testFont is the font family of the text of the test documents.
+const testFont = "body { font-family: Go.ttf }"
+
+// layoutHTML returns the laid out body of the document src rendered by r.
+func layoutHTML(t *testing.T, r *Renderer, src string) *Dom {
+	t.Helper()
+	htmlNode, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := r.layoutDocument(htmlNode, []*Stylesheet{ParseStylesheet(testFont)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// layoutBody returns the laid out body of a document whose body is content
+// and whose stylesheet is css.
+func layoutBody(t *testing.T, css, content string) *Dom {
+	t.Helper()
+	return layoutHTML(t, &Renderer{}, "<html><head><style>"+css+"</style></head><body>"+content+"</body></html>")
+}
+
+// findDom returns the dom of the element with the id in the tree of d.
+func findDom(d *Dom, id string) *Dom {
+	if d.node != nil && d.DomType == DOM_TYPE_ELEMENT && getAttr(d.node, "id") == id {
+		return d
+	}
+	for _, ch := range d.Children {
+		if found := findDom(ch, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// rect returns the border box of the element with the id in the tree of d.
+func rect(t *testing.T, d *Dom, id string) Rectangle {
+	t.Helper()
+	found := findDom(d, id)
+	if found == nil {
+		t.Fatalf("no element #%v", id)
+	}
+	return found.Container
+}
+
+// boxTest is a document whose elements have the border boxes of want, by
+// id.
+type boxTest struct {
+	name    string
+	css     string
+	content string
+	want    map[string]Rectangle
+}
+
+func runBoxTests(t *testing.T, tests []boxTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := layoutBody(t, test.css, test.content)
+			for id, want := range test.want {
+				if got := rect(t, body, id); got != want {
+					t.Errorf("#%v = %+v, want %+v", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+// renderTest is a document that renders without error.
+type renderTest struct {
+	name string
+	src  string
+}
+
+func runRenderTests(t *testing.T, r *Renderer, tests []renderTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := r.Render([]byte(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(img, []byte{0xff, 0xd8}) {
+				t.Errorf("not a jpeg image")
+			}
+		})
+	}
+}
+
+// styledDocument returns a document whose stylesheet is css and whose body
+// is content, in the test font.
+func styledDocument(css, content string) string {
+	return "<html><head><style>" + testFont + css + "</style></head><body>" + content + "</body></html>"
+}
+
+// imageSize returns the size of the jpeg image img.
+func imageSize(t *testing.T, img []byte) image.Point {
+	t.Helper()
+	config, format, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("not a jpeg image: %v", err)
+	}
+	return image.Pt(config.Width, config.Height)
+}
+
+func TestRender(t *testing.T) {
+	src := styledDocument("body { margin: 0 } div { height: 30px }", "<div>a</div>")
+	img, err := Html2Img([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := imageSize(t, img); size != image.Pt(800, 30) {
+		t.Errorf("size = %v, want (800,30)", size)
+	}
+	img, err = Html2ImgReader(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := imageSize(t, img); size != image.Pt(800, 30) {
+		t.Errorf("size of the read document = %v, want (800,30)", size)
+	}
+}
+
+func TestDocumentWithoutBody(t *testing.T) {
+	for _, src := range []string{
+		`<html><frameset><frame src="a.html"></frameset></html>`,
+		`<!DOCTYPE html><frameset cols="50%,50%"><frame><frame></frameset>`,
+	} {
+		if _, err := Html2Img([]byte(src)); err == nil || err.Error() != "document without body" {
+			t.Errorf("%v: error %v, want document without body", src, err)
+		}
+	}
+}
+
+func TestHiddenBody(t *testing.T) {
+	src := styledDocument("body { display: none; background-color: red; padding: 10px }", "<p>a</p>")
+	body := layoutHTML(t, &Renderer{}, src)
+	if len(body.Children) != 0 {
+		t.Errorf("hidden body has %v children, want 0", len(body.Children))
+	}
+	for _, render := range []func([]byte) ([]byte, error){(&Renderer{}).Render, Html2Img} {
+		if _, err := render([]byte(src)); err != nil {
+			t.Error(err)
+		}
+	}
+	if fragment, err := (&Renderer{}).RenderFragment([]byte("<p>a</p>"), testFont, "body { display: none }"); err != nil || len(fragment) == 0 {
+		t.Errorf("hidden fragment body: %v", err)
+	}
+}
+
+func TestRenderFragment(t *testing.T) {
+	tests := []struct {
+		name     string
+		r        *Renderer
+		fragment string
+		css      []string
+		want     image.Point
+	}{
+		{"fragment", &Renderer{}, `<div style="height: 40px"></div>`, []string{"body { margin: 0 }"}, image.Pt(800, 40)},
+		{"text", &Renderer{}, `<div>a</div>`, []string{testFont, "body { margin: 0; line-height: 20px }"}, image.Pt(800, 20)},
+		{"without stylesheets", &Renderer{}, `<div style="height: 40px"></div>`, nil, image.Pt(800, 40)},
+		{"several stylesheets", &Renderer{}, `<div></div>`, []string{"body { margin: 0 } div { height: 10px }", "div { height: 20px }"}, image.Pt(800, 20)},
+		{"fragment styles override", &Renderer{}, `<style>div { height: 50px }</style><div></div>`, []string{"body { margin: 0 } div { height: 100px }"}, image.Pt(800, 50)},
+		{"appended styles override", &Renderer{AppendStyles: []string{"div { height: 60px }"}}, `<style>div { height: 50px }</style><div></div>`, []string{"body { margin: 0 }"}, image.Pt(800, 60)},
+		{"viewport", &Renderer{ViewportWidth: 300}, `<div style="height: 10px"></div>`, []string{"body { margin: 0; width: 100vw }"}, image.Pt(300, 10)},
+		{"document elements", &Renderer{}, `<html><body><div style="height: 10px"></div></body></html>`, []string{"body { margin: 0 }"}, image.Pt(800, 10)},
+		{"empty", &Renderer{}, ``, nil, image.Pt(800, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := test.r.RenderFragment([]byte(test.fragment), test.css...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := imageSize(t, img); size != test.want {
+				t.Errorf("size = %v, want %v", size, test.want)
+			}
+		})
+	}
+	img, err := RenderFragment([]byte(`<p>a</p>`), testFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageSize(t, img)
+}
+
+func TestInjectedStyles(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *Renderer
+		want string
+	}{
+		{"prepended style", &Renderer{PrependStyles: []string{"p { color: red }"}}, "blue"},
+		{"prepended style with a higher specificity", &Renderer{PrependStyles: []string{"#e { color: red }"}}, "red"},
+		{"prepended stylesheet", &Renderer{PrependStylesheets: []*Stylesheet{ParseStylesheet("p { color: red }")}}, "blue"},
+		{"prepended stylesheet after prepended style", &Renderer{
+			PrependStyles:      []string{"#e { color: red }"},
+			PrependStylesheets: []*Stylesheet{ParseStylesheet("#e { color: green }")},
+		}, "green"},
+		{"appended style", &Renderer{AppendStyles: []string{"p { color: red }"}}, "red"},
+		{"appended stylesheet", &Renderer{AppendStylesheets: []*Stylesheet{ParseStylesheet("p { color: red }")}}, "red"},
+		{"appended stylesheet after appended style", &Renderer{
+			AppendStyles:      []string{"p { color: red }"},
+			AppendStylesheets: []*Stylesheet{ParseStylesheet("p { color: green }")},
+		}, "green"},
+		{"appended style below the style attribute", &Renderer{AppendStyles: []string{"#f { color: red }"}}, "blue"},
+		{"appended style with @media", &Renderer{ViewportWidth: 400, AppendStyles: []string{"@media (max-width: 500px) { p { color: red } }"}}, "red"},
+		{"appended style with variables", &Renderer{Variables: map[string]string{"c": "red"}, AppendStyles: []string{"p { color: var(--c) }"}}, "red"},
+		{"appended import", &Renderer{
+			Loader:       testLoader(map[string]string{"http://x.org/a.css": "p { color: red }"}, nil),
+			BaseURL:      "http://x.org/",
+			AppendStyles: []string{`@import "a.css";`},
+		}, "red"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := layoutHTML(t, test.r, `<html><head><style>p { color: blue }</style></head><body><p id="e">a</p><p id="f" style="color: blue">b</p></body></html>`)
+			id := "e"
+			if strings.Contains(test.name, "attribute") {
+				id = "f"
+			}
+			if got := findDom(body, id).TagStyle.Color; got != test.want {
+				t.Errorf("color = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRendererReuse(t *testing.T) {
+	r := &Renderer{AppendStyles: []string{"p { color: red }"}}
+	for i := 0; i < 2; i++ {
+		body := layoutHTML(t, r, `<html><body><p id="e">a</p></body></html>`)
+		if got := findDom(body, "e").TagStyle.Color; got != "red" {
+			t.Errorf("rendering %v: color = %q, want red", i, got)
+		}
+	}
+	if len(r.AppendStyles) != 1 || len(r.PrependStylesheets) != 0 {
+		t.Errorf("renderer changed by the rendering: %+v", r)
+	}
+}
+
+// encode returns text in the encoding e.
+func encode(t *testing.T, e encoding.Encoding, text string) []byte {
+	t.Helper()
+	encoded, err := e.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestDecode(t *testing.T) {
+	const text = "<p>汉字與中文</p>"
+	utf8BOM := []byte{0xef, 0xbb, 0xbf}
+	longHead := "<head><title>" + strings.Repeat("a", 1024) + "</title></head>"
+	tests := []struct {
+		name    string
+		charset string
+		src     []byte
+		want    string
+	}{
+		{"utf-8", "", []byte(`<meta charset="utf-8">` + text), `<meta charset="utf-8">` + text},
+		{"utf-8 without declaration", "", []byte(text), text},
+		{"utf-8 after a long ascii head", "", []byte(longHead + text), longHead + text},
+		{"windows-1252 meta charset", "", []byte("<meta charset=\"windows-1252\">caf\xe9"), `<meta charset="windows-1252">café`},
+		{"gbk meta charset", "", encode(t, simplifiedchinese.GBK, `<meta charset="gbk">`+text), `<meta charset="gbk">` + text},
+		{"gb2312 meta charset", "", encode(t, simplifiedchinese.GBK, `<meta charset="GB2312">`+text), `<meta charset="GB2312">` + text},
+		{"gb18030 meta charset", "", encode(t, simplifiedchinese.GB18030, `<meta charset="gb18030">`+text), `<meta charset="gb18030">` + text},
+		{"big5 meta charset", "", encode(t, traditionalchinese.Big5, `<meta charset="big5">`+text), `<meta charset="big5">` + text},
+		{"big5 http-equiv", "", encode(t, traditionalchinese.Big5, `<meta http-equiv="Content-Type" content="text/html; charset=big5">`+text), `<meta http-equiv="Content-Type" content="text/html; charset=big5">` + text},
+		{"gbk charset", "gbk", encode(t, simplifiedchinese.GBK, text), text},
+		{"big5 charset", "Big5", encode(t, traditionalchinese.Big5, text), text},
+		{"charset above meta", "big5", encode(t, traditionalchinese.Big5, `<meta charset="gbk">`+text), `<meta charset="gbk">` + text},
+		{"utf-8 bom above charset", "gbk", append(utf8BOM, []byte(text)...), text},
+		{"utf-8 bom above meta", "", append(utf8BOM, []byte(`<meta charset="gbk">`+text)...), `<meta charset="gbk">` + text},
+		{"utf-16 bom", "gbk", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), text), text},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Renderer{Charset: test.charset}
+			reader, err := r.decode(bytes.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(decoded) != test.want {
+				t.Errorf("decoded %q, want %q", decoded, test.want)
+			}
+		})
+	}
+}
+
+func TestUnsupportedCharset(t *testing.T) {
+	r := &Renderer{Charset: "no-such-charset"}
+	if _, err := r.Render([]byte("<p>a</p>")); err == nil {
+		t.Error("Render with an unsupported charset succeeds")
+	}
+	if _, err := r.RenderFragment([]byte("<p>a</p>")); err == nil {
+		t.Error("RenderFragment with an unsupported charset succeeds")
+	}
+}
+
+func TestRenderCharsets(t *testing.T) {
+	content := "<p>汉字與中文</p>"
+	gbk := encode(t, simplifiedchinese.GBK, styledDocument("", content))
+	big5 := encode(t, traditionalchinese.Big5, `<meta charset="big5">`+styledDocument("", content))
+	for _, test := range []struct {
+		name string
+		r    *Renderer
+		src  []byte
+	}{
+		{"gbk", &Renderer{Charset: "gbk"}, gbk},
+		{"big5", &Renderer{}, big5},
+		{"invalid bytes", &Renderer{Charset: "gbk"}, []byte(styledDocument("", "<p>\x81\x20\xff\xfe<p>\x81"))},
+		{"truncated gbk", &Renderer{Charset: "gbk"}, gbk[:len(gbk)-len("</p></body></html>")-1]},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := test.r.Render(test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imageSize(t, img)
+		})
+	}
+	img, err := (&Renderer{Charset: "gbk"}).RenderFragment(encode(t, simplifiedchinese.GBK, content), testFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageSize(t, img)
+}
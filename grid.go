@@ -0,0 +1,972 @@
+package html2img
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	trackFixed = iota
+	trackFlex
+	trackAuto
+	trackMinContent
+	trackMaxContent
+)
+
+// trackBreadth is one bound of a grid track size.
+type trackBreadth struct {
+	kind  int
+	value float64
+}
+
+// trackSize is the sizing function of a grid track: minmax(min, max).
+type trackSize struct {
+	min trackBreadth
+	max trackBreadth
+}
+
+// gridSpan is the tracks a grid item spans in one axis. start is -1 while the
+// item is not placed.
+type gridSpan struct {
+	start int
+	span  int
+}
+
+type gridItem struct {
+	dom    *Dom
+	row    gridSpan
+	column gridSpan
+}
+
+// gridArea is a named area of grid-template-areas.
+type gridArea struct {
+	row    gridSpan
+	column gridSpan
+}
+
+// gridContribution is the size an item spanning tracks needs in an axis.
+type gridContribution struct {
+	start int
+	span  int
+	min   float64
+	max   float64
+}
+
+// gridTemplate is the grid of a container: its explicit tracks and areas, and
+// the implicit tracks added by the placement of its items.
+type gridTemplate struct {
+	columns []trackSize
+	rows    []trackSize
+	areas   map[string]gridArea
+	// Number of explicit tracks
+	explicitColumns int
+	explicitRows    int
+}
+
+func (d *Dom) isGridContainer() bool {
+	return d.TagStyle.Display == "grid" || d.TagStyle.Display == "inline-grid"
+}
+
+func newGridTemplate(style *TagStyle, width, height, columnGap, rowGap int) *gridTemplate {
+	grid := &gridTemplate{areas: make(map[string]gridArea)}
+	grid.columns, _ = parseTrackList(style.GridTemplateColumns, width, columnGap)
+	grid.rows, _ = parseTrackList(style.GridTemplateRows, height, rowGap)
+	rows, columns := parseGridAreas(style.GridTemplateAreas, grid.areas)
+	autoColumn, _ := parseTrackSize(style.GridAutoColumns, width)
+	autoRow, _ := parseTrackSize(style.GridAutoRows, height)
+	for len(grid.columns) < columns {
+		grid.columns = append(grid.columns, autoColumn)
+	}
+	for len(grid.rows) < rows {
+		grid.rows = append(grid.rows, autoRow)
+	}
+	grid.explicitColumns = len(grid.columns)
+	grid.explicitRows = len(grid.rows)
+	return grid
+}
+
+// splitTrackList splits a value on the spaces outside of parentheses and
+// drops line names.
+func splitTrackList(value string) []string {
+	tokens := splitValues(value)
+	var result []string
+	inName := false
+	for _, token := range tokens {
+		switch {
+		case strings.HasPrefix(token, "["):
+			inName = !strings.HasSuffix(token, "]")
+		case inName:
+			inName = !strings.HasSuffix(token, "]")
+		default:
+			result = append(result, token)
+		}
+	}
+	return result
+}
+
+// parseTrackList parses grid-template-columns or grid-template-rows, expanding
+// repeat(). An auto-fill or auto-fit repetition is repeated as many times as
+// fits in avail. It returns false when value is not a track list.
+func parseTrackList(value string, avail, gap int) ([]trackSize, bool) {
+	var tracks []trackSize
+	if value == "" || value == "none" {
+		return tracks, true
+	}
+	for _, token := range splitTrackList(value) {
+		if !strings.HasPrefix(token, "repeat(") {
+			track, ok := parseTrackSize(token, avail)
+			if !ok {
+				return nil, false
+			}
+			tracks = append(tracks, track)
+			continue
+		}
+		args := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(token, "repeat("), ")"), ",", 2)
+		if len(args) != 2 || !strings.HasSuffix(token, ")") {
+			return nil, false
+		}
+		repeated, ok := parseTrackList(args[1], avail, gap)
+		if !ok || len(repeated) == 0 {
+			return nil, false
+		}
+		count := 1
+		switch countValue := strings.Trim(args[0], CUT_SET_LIST); countValue {
+		case "auto-fill", "auto-fit":
+			size := 0.0
+			for _, track := range repeated {
+				switch {
+				case track.max.kind == trackFixed:
+					size += track.max.value
+				case track.min.kind == trackFixed:
+					size += track.min.value
+				}
+			}
+			size += float64(gap * len(repeated))
+			if avail > 0 && size > 0 {
+				count = maxInt(1, int((float64(avail+gap))/size))
+			}
+		default:
+			var err error
+			count, err = strconv.Atoi(countValue)
+			if err != nil || count < 1 {
+				return nil, false
+			}
+		}
+		for i := 0; i < count; i++ {
+			tracks = append(tracks, repeated...)
+		}
+	}
+	return tracks, true
+}
+
+// parseTrackSize parses a track size: a breadth, minmax() or fit-content().
+// It returns false when value is not one.
+func parseTrackSize(value string, avail int) (trackSize, bool) {
+	value = strings.Trim(value, CUT_SET_LIST)
+	if strings.HasPrefix(value, "minmax(") && strings.HasSuffix(value, ")") {
+		args := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "minmax("), ")"), ",")
+		if len(args) != 2 {
+			return trackSize{}, false
+		}
+		min, minOk := parseTrackBreadth(args[0], avail)
+		max, maxOk := parseTrackBreadth(args[1], avail)
+		if !minOk || !maxOk || strings.Trim(args[0], CUT_SET_LIST) == "" || strings.Trim(args[1], CUT_SET_LIST) == "" {
+			return trackSize{}, false
+		}
+		size := trackSize{min: min, max: max}
+		if size.min.kind == trackFlex {
+			size.min = trackBreadth{kind: trackAuto}
+		}
+		return size, true
+	}
+	if strings.HasPrefix(value, "fit-content(") && strings.HasSuffix(value, ")") {
+		// As large as its content, up to the limit
+		limit, ok := parseTrackBreadth(strings.TrimSuffix(strings.TrimPrefix(value, "fit-content("), ")"), avail)
+		if !ok || limit.kind != trackFixed {
+			return trackSize{}, false
+		}
+		return trackSize{min: trackBreadth{kind: trackAuto}, max: limit}, true
+	}
+	breadth, ok := parseTrackBreadth(value, avail)
+	if !ok {
+		return trackSize{}, false
+	}
+	if breadth.kind == trackFlex {
+		return trackSize{min: trackBreadth{kind: trackAuto}, max: breadth}, true
+	}
+	return trackSize{min: breadth, max: breadth}, true
+}
+
+func parseTrackBreadth(value string, avail int) (trackBreadth, bool) {
+	value = strings.Trim(value, CUT_SET_LIST)
+	switch {
+	case value == "" || value == "auto":
+		return trackBreadth{kind: trackAuto}, true
+	case value == "min-content":
+		return trackBreadth{kind: trackMinContent}, true
+	case value == "max-content":
+		return trackBreadth{kind: trackMaxContent}, true
+	case strings.HasSuffix(value, "fr"):
+		flex, err := strconv.ParseFloat(strings.TrimSuffix(value, "fr"), 64)
+		if err != nil || flex < 0 {
+			return trackBreadth{}, false
+		}
+		return trackBreadth{kind: trackFlex, value: flex}, true
+	case !isLength(value, true, false):
+		return trackBreadth{}, false
+	case strings.HasSuffix(value, "%") && avail < 0:
+		// Percentages of an indefinite size behave as auto
+		return trackBreadth{kind: trackAuto}, true
+	}
+	return trackBreadth{kind: trackFixed, value: float64(getIntPx(value, avail))}, true
+}
+
+// parseGridAreas parses grid-template-areas into areas and returns the number
+// of rows and columns it defines.
+func parseGridAreas(value string, areas map[string]gridArea) (int, int) {
+	rows := gridAreaRows(value)
+	columns := 0
+	for r, cells := range rows {
+		columns = maxInt(columns, len(cells))
+		for c, name := range cells {
+			if strings.Trim(name, ".") == "" {
+				continue
+			}
+			area, exist := areas[name]
+			if !exist {
+				areas[name] = gridArea{row: gridSpan{start: r, span: 1}, column: gridSpan{start: c, span: 1}}
+				continue
+			}
+			area.row.span = maxInt(area.row.span, r-area.row.start+1)
+			area.column.span = maxInt(area.column.span, c-area.column.start+1)
+			areas[name] = area
+		}
+	}
+	return len(rows), columns
+}
+
+// gridAreaRows returns the names of the cells of the rows of
+// grid-template-areas, one row by string.
+func gridAreaRows(value string) [][]string {
+	var rows [][]string
+	for _, token := range tokenizeCSS(value) {
+		if cells := strings.Fields(token.value); token.kind == tokenString && len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+	}
+	return rows
+}
+
+// setGridLine sets the start and end lines of the grid-row, grid-column and
+// grid-area shorthands. It returns false when cssValue is not one or two
+// grid lines.
+func setGridLine(start, end *string, cssValue string) bool {
+	lines := strings.Split(cssValue, "/")
+	for i := range lines {
+		lines[i] = strings.Trim(lines[i], CUT_SET_LIST)
+		if !isGridLine(lines[i]) {
+			return false
+		}
+	}
+	if len(lines) > 2 {
+		return false
+	}
+	*start = lines[0]
+	*end = "auto"
+	if len(lines) > 1 {
+		*end = lines[1]
+	} else if !strings.HasPrefix(*start, "span") {
+		if _, err := strconv.Atoi(*start); err != nil && *start != "auto" {
+			// A single area name is both the start and the end
+			*end = *start
+		}
+	}
+	return true
+}
+
+// setGridArea sets the grid-area shorthand, false when cssValue is not one to
+// four grid lines.
+func setGridArea(tagStyle *TagStyle, cssValue string) bool {
+	lines := strings.Split(cssValue, "/")
+	for i := range lines {
+		lines[i] = strings.Trim(lines[i], CUT_SET_LIST)
+		if !isGridLine(lines[i]) {
+			return false
+		}
+	}
+	switch len(lines) {
+	case 1:
+		setGridLine(&tagStyle.GridRowStart, &tagStyle.GridRowEnd, lines[0])
+		setGridLine(&tagStyle.GridColumnStart, &tagStyle.GridColumnEnd, lines[0])
+	case 2, 3, 4:
+		tagStyle.GridRowStart = lines[0]
+		tagStyle.GridColumnStart = lines[1]
+		tagStyle.GridRowEnd, tagStyle.GridColumnEnd = "auto", "auto"
+		if len(lines) > 2 {
+			tagStyle.GridRowEnd = lines[2]
+		}
+		if len(lines) > 3 {
+			tagStyle.GridColumnEnd = lines[3]
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// isGridLine reports whether value is a grid line: auto, a line number, an
+// area name or a span.
+func isGridLine(value string) bool {
+	fields := strings.Fields(value)
+	span := len(fields) > 0 && fields[0] == "span"
+	if span {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return false
+	}
+	numbers, names := 0, 0
+	for _, field := range fields {
+		if n, err := strconv.Atoi(field); err == nil {
+			if n == 0 || (span && n < 0) {
+				return false
+			}
+			numbers++
+			continue
+		}
+		if field == "span" || (field == "auto" && (span || len(fields) > 1)) || !isGridName(field) {
+			return false
+		}
+		names++
+	}
+	return numbers <= 1 && names <= 1
+}
+
+// isGridName reports whether value is an identifier naming an area or a line.
+func isGridName(value string) bool {
+	tokens := tokenizeCSS(value)
+	return len(tokens) == 1 && tokens[0].kind == tokenIdent
+}
+
+// resolveGridSpan returns the tracks spanned by an item between the start and
+// end lines in an axis with explicit tracks.
+func resolveGridSpan(start, end string, explicit int, areas map[string]gridArea, row bool) gridSpan {
+	line := func(value string, isEnd bool) (int, int, bool) {
+		value = strings.Trim(value, CUT_SET_LIST)
+		switch {
+		case value == "" || value == "auto":
+			return 0, 0, false
+		case strings.HasPrefix(value, "span"):
+			span, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(value, "span"), CUT_SET_LIST))
+			if err != nil || span < 1 {
+				span = 1
+			}
+			return 0, span, false
+		}
+		if n, err := strconv.Atoi(value); err == nil {
+			if n < 0 {
+				n = explicit + 2 + n
+			}
+			return maxInt(n-1, 0), 0, true
+		}
+		area, exist := areas[value]
+		if !exist {
+			return 0, 0, false
+		}
+		axis := area.column
+		if row {
+			axis = area.row
+		}
+		if isEnd {
+			return axis.start + axis.span, 0, true
+		}
+		return axis.start, 0, true
+	}
+	startLine, startSpan, startDefinite := line(start, false)
+	endLine, endSpan, endDefinite := line(end, true)
+	switch {
+	case startDefinite && endDefinite:
+		if endLine < startLine {
+			startLine, endLine = endLine, startLine
+		}
+		return gridSpan{start: startLine, span: maxInt(endLine-startLine, 1)}
+	case startDefinite:
+		return gridSpan{start: startLine, span: maxInt(endSpan, 1)}
+	case endDefinite:
+		span := maxInt(startSpan, 1)
+		return gridSpan{start: maxInt(endLine-span, 0), span: span}
+	}
+	return gridSpan{start: -1, span: maxInt(startSpan, 1)}
+}
+
+// placeGridItems places the items in the grid by the auto-placement algorithm
+// and adds implicit tracks for the items outside of the explicit grid.
+func (grid *gridTemplate) placeGridItems(items []*gridItem, style *TagStyle) {
+	columnFlow := strings.Contains(style.GridAutoFlow, "column")
+	dense := strings.Contains(style.GridAutoFlow, "dense")
+	spans := func(item *gridItem) (*gridSpan, *gridSpan) {
+		if columnFlow {
+			return &item.column, &item.row
+		}
+		return &item.row, &item.column
+	}
+	minorCount := grid.explicitColumns
+	if columnFlow {
+		minorCount = grid.explicitRows
+	}
+	for _, item := range items {
+		_, minor := spans(item)
+		minorCount = maxInt(minorCount, maxInt(minor.start, 0)+minor.span)
+	}
+
+	occupied := make(map[[2]int]bool)
+	fits := func(major, minor, majorSpan, minorSpan int) bool {
+		if minor+minorSpan > minorCount {
+			return false
+		}
+		for i := major; i < major+majorSpan; i++ {
+			for j := minor; j < minor+minorSpan; j++ {
+				if occupied[[2]int{i, j}] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	occupy := func(item *gridItem) {
+		major, minor := spans(item)
+		for i := major.start; i < major.start+major.span; i++ {
+			for j := minor.start; j < minor.start+minor.span; j++ {
+				occupied[[2]int{i, j}] = true
+			}
+		}
+	}
+
+	// Items with a definite position go first, then the items locked to a
+	// row (or column with column flow), then the rest in order
+	for _, item := range items {
+		major, minor := spans(item)
+		if major.start >= 0 && minor.start >= 0 {
+			occupy(item)
+		}
+	}
+	for _, item := range items {
+		major, minor := spans(item)
+		if major.start >= 0 && minor.start < 0 {
+			minor.start = 0
+			for !fits(major.start, minor.start, major.span, minor.span) {
+				minor.start++
+				if minor.start+minor.span > minorCount {
+					minorCount++
+				}
+			}
+			occupy(item)
+		}
+	}
+	cursorMajor, cursorMinor := 0, 0
+	for _, item := range items {
+		major, minor := spans(item)
+		if major.start >= 0 {
+			continue
+		}
+		if dense {
+			cursorMajor, cursorMinor = 0, 0
+		}
+		if minor.start >= 0 {
+			if minor.start < cursorMinor {
+				cursorMajor++
+			}
+			for !fits(cursorMajor, minor.start, major.span, minor.span) {
+				cursorMajor++
+			}
+			cursorMinor = minor.start
+		} else {
+			for {
+				if cursorMinor+minor.span > minorCount {
+					cursorMajor++
+					cursorMinor = 0
+				}
+				if fits(cursorMajor, cursorMinor, major.span, minor.span) {
+					break
+				}
+				cursorMinor++
+			}
+			minor.start = cursorMinor
+			cursorMinor += minor.span
+		}
+		major.start = cursorMajor
+		occupy(item)
+	}
+
+	rows, columns := grid.explicitRows, grid.explicitColumns
+	for _, item := range items {
+		rows = maxInt(rows, item.row.start+item.row.span)
+		columns = maxInt(columns, item.column.start+item.column.span)
+	}
+	autoColumn, _ := parseTrackSize(style.GridAutoColumns, -1)
+	autoRow, _ := parseTrackSize(style.GridAutoRows, -1)
+	for len(grid.columns) < columns {
+		grid.columns = append(grid.columns, autoColumn)
+	}
+	for len(grid.rows) < rows {
+		grid.rows = append(grid.rows, autoRow)
+	}
+}
+
+// sizeGridTracks runs the track sizing algorithm of CSS Grid Layout in one
+// axis and returns the sizes of the tracks. avail is -1 when the grid
+// container has no definite size in the axis. Auto tracks share the remaining
+// space when stretch is set.
+func sizeGridTracks(tracks []trackSize, avail, gap int, contributions []gridContribution, stretch bool) []int {
+	n := len(tracks)
+	base := make([]float64, n)
+	limit := make([]float64, n)
+	flexMax := make([]float64, n)
+	for i, track := range tracks {
+		if track.min.kind == trackFixed {
+			base[i] = track.min.value
+		}
+		switch track.max.kind {
+		case trackFixed:
+			limit[i] = math.Max(track.max.value, base[i])
+		case trackFlex:
+			limit[i] = base[i]
+		default:
+			limit[i] = math.Inf(1)
+		}
+	}
+	isIntrinsicMin := func(i int) bool {
+		return tracks[i].min.kind != trackFixed
+	}
+	isIntrinsicMax := func(i int) bool {
+		kind := tracks[i].max.kind
+		return kind == trackAuto || kind == trackMinContent || kind == trackMaxContent
+	}
+
+	// Items spanning a single track first, then the ones spanning more
+	// tracks, which distribute what the tracks miss between them
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return contributions[i].span < contributions[j].span
+	})
+	for _, c := range contributions {
+		if c.span == 1 {
+			i := c.start
+			switch tracks[i].min.kind {
+			case trackAuto, trackMinContent:
+				base[i] = math.Max(base[i], c.min)
+			case trackMaxContent:
+				base[i] = math.Max(base[i], c.max)
+			}
+			switch tracks[i].max.kind {
+			case trackAuto, trackMaxContent:
+				if math.IsInf(limit[i], 1) {
+					limit[i] = c.max
+				}
+				limit[i] = math.Max(limit[i], c.max)
+			case trackMinContent:
+				if math.IsInf(limit[i], 1) {
+					limit[i] = c.min
+				}
+				limit[i] = math.Max(limit[i], c.min)
+			case trackFlex:
+				flexMax[i] = math.Max(flexMax[i], c.max)
+			}
+			continue
+		}
+		spansFlex := false
+		var intrinsicMin, intrinsicMax []int
+		baseSum, limitSum := float64(gap*(c.span-1)), float64(gap*(c.span-1))
+		for i := c.start; i < c.start+c.span; i++ {
+			if tracks[i].max.kind == trackFlex {
+				spansFlex = true
+			}
+			if isIntrinsicMin(i) {
+				intrinsicMin = append(intrinsicMin, i)
+			}
+			if isIntrinsicMax(i) {
+				intrinsicMax = append(intrinsicMax, i)
+			}
+			baseSum += base[i]
+			if math.IsInf(limit[i], 1) {
+				limitSum += base[i]
+			} else {
+				limitSum += limit[i]
+			}
+		}
+		if spansFlex {
+			continue
+		}
+		if extra := c.min - baseSum; extra > 0 && len(intrinsicMin) > 0 {
+			for _, i := range intrinsicMin {
+				base[i] += extra / float64(len(intrinsicMin))
+			}
+		}
+		if extra := c.max - limitSum; extra > 0 && len(intrinsicMax) > 0 {
+			for _, i := range intrinsicMax {
+				if math.IsInf(limit[i], 1) {
+					limit[i] = base[i]
+				}
+				limit[i] += extra / float64(len(intrinsicMax))
+			}
+		}
+	}
+	for i := range limit {
+		if math.IsInf(limit[i], 1) || limit[i] < base[i] {
+			limit[i] = base[i]
+		}
+	}
+
+	gaps := float64(gap * maxInt(n-1, 0))
+	freeSpace := func() float64 {
+		free := float64(avail) - gaps
+		for _, size := range base {
+			free -= size
+		}
+		return free
+	}
+	// Grow the tracks up to their limit
+	if avail >= 0 {
+		for free := freeSpace(); free > 0.5; free = freeSpace() {
+			var growing []int
+			for i := range base {
+				if limit[i] > base[i] {
+					growing = append(growing, i)
+				}
+			}
+			if len(growing) == 0 {
+				break
+			}
+			share := free / float64(len(growing))
+			for _, i := range growing {
+				base[i] = math.Min(limit[i], base[i]+share)
+			}
+		}
+	}
+
+	// Size the flexible tracks by the fr unit
+	flexSum := 0.0
+	for _, track := range tracks {
+		if track.max.kind == trackFlex {
+			flexSum += track.max.value
+		}
+	}
+	if flexSum > 0 {
+		fr := 0.0
+		if avail >= 0 {
+			inflexible := make(map[int]bool)
+			for {
+				leftover := float64(avail) - gaps
+				flex := 0.0
+				for i, track := range tracks {
+					if track.max.kind == trackFlex && !inflexible[i] {
+						flex += track.max.value
+						continue
+					}
+					leftover -= base[i]
+				}
+				fr = leftover / math.Max(flex, 1)
+				changed := false
+				for i, track := range tracks {
+					if track.max.kind == trackFlex && !inflexible[i] && base[i] > fr*track.max.value {
+						inflexible[i] = true
+						changed = true
+					}
+				}
+				if !changed {
+					break
+				}
+			}
+		} else {
+			for i, track := range tracks {
+				if track.max.kind == trackFlex && track.max.value > 0 {
+					fr = math.Max(fr, math.Max(base[i], flexMax[i])/math.Max(track.max.value, 1))
+				}
+			}
+		}
+		for i, track := range tracks {
+			if track.max.kind == trackFlex {
+				base[i] = math.Max(base[i], fr*track.max.value)
+			}
+		}
+	}
+
+	if avail >= 0 && stretch {
+		var autoTracks []int
+		for i, track := range tracks {
+			if track.max.kind == trackAuto {
+				autoTracks = append(autoTracks, i)
+			}
+		}
+		if free := freeSpace(); free > 0 && len(autoTracks) > 0 {
+			for _, i := range autoTracks {
+				base[i] += free / float64(len(autoTracks))
+			}
+		}
+	}
+
+	// Round the edges rather than the sizes so that the tracks add up
+	sizes := make([]int, n)
+	edge := 0.0
+	for i := range base {
+		sizes[i] = int(math.Round(edge+base[i])) - int(math.Round(edge))
+		edge += base[i]
+	}
+	return sizes
+}
+
+// trackPositions returns the offsets of the tracks in the container, aligned
+// by justify-content or align-content.
+func trackPositions(sizes []int, gap, avail int, align string) []int {
+	used := gap * maxInt(len(sizes)-1, 0)
+	for _, size := range sizes {
+		used += size
+	}
+	free := avail - used
+	pos, between := 0, 0
+	if avail >= 0 && len(sizes) > 0 {
+		switch align {
+		case "end", "flex-end", "right":
+			pos = free
+		case "center":
+			pos = free / 2
+		case "space-between":
+			if len(sizes) > 1 && free > 0 {
+				between = free / (len(sizes) - 1)
+			}
+		case "space-around":
+			if free > 0 {
+				between = free / len(sizes)
+				pos = between / 2
+			}
+		case "space-evenly":
+			if free > 0 {
+				between = free / (len(sizes) + 1)
+				pos = between
+			}
+		}
+	}
+	positions := make([]int, len(sizes)+1)
+	for i, size := range sizes {
+		positions[i] = pos
+		pos += size + gap + between
+	}
+	positions[len(sizes)] = pos - gap - between
+	return positions
+}
+
+// spanSize returns the size of the tracks a span covers, with the gaps
+// between them.
+func spanSize(positions []int, sizes []int, span gridSpan) int {
+	last := span.start + span.span - 1
+	return positions[last] + sizes[last] - positions[span.start]
+}
+
+func isStretchContent(align string) bool {
+	return align == "" || align == "normal" || align == "stretch"
+}
+
+// gridSelfAlign returns the alignment of a grid item in its area in an axis.
+func gridSelfAlign(self, items string, dom *Dom) string {
+	align := self
+	if align == "" || align == "auto" {
+		align = items
+	}
+	switch align {
+	case "", "normal":
+		if dom.TagName == "img" {
+			return "start"
+		}
+		return "stretch"
+	case "flex-start", "self-start", "left", "baseline", "first baseline":
+		return "start"
+	case "flex-end", "self-end", "right", "last baseline":
+		return "end"
+	}
+	return align
+}
+
+// newGridItems returns the grid items of a container in order-modified
+// document order, with their lines resolved against the explicit grid.
+func newGridItems(container *Dom, grid *gridTemplate) []*gridItem {
+	var items []*gridItem
+	for _, dom := range container.sourceChildren() {
+		if dom.isPositionAbsolute() {
+			continue
+		}
+		style := dom.TagStyle
+		items = append(items, &gridItem{
+			dom:    dom,
+			row:    resolveGridSpan(style.GridRowStart, style.GridRowEnd, grid.explicitRows, grid.areas, true),
+			column: resolveGridSpan(style.GridColumnStart, style.GridColumnEnd, grid.explicitColumns, grid.areas, false),
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return getOrder(items[i].dom) < getOrder(items[j].dom)
+	})
+	return items
+}
+
+// layoutGrid lays out the children of the grid container at the end of
+// parents in the areas of its grid.
+func layoutGrid(parents []*Dom, cbHeight int) ([]*Dom, EndOffset) {
+	container := parents[len(parents)-1]
+	container.hasBaseline = false
+	style := container.TagStyle
+	innerWidth := container.Inner.X2 - container.Inner.X1 + 1
+	innerHeight := -1
+	if !container.isAutoHeight() {
+		innerHeight = container.Inner.Y2 - container.Inner.Y1 + 1
+	}
+	columnGap := getIntPx(style.ColumnGap, innerWidth)
+	rowGap := getIntPx(style.RowGap, maxInt(innerHeight, 0))
+
+	var children []*Dom
+	for _, dom := range container.sourceChildren() {
+		if dom.isPositionAbsolute() {
+			deferAbsolute(dom, parents, container.Inner.X1, container.Inner.Y1)
+			children = append(children, dom)
+		}
+	}
+	grid := newGridTemplate(style, innerWidth, innerHeight, columnGap, rowGap)
+	items := newGridItems(container, grid)
+	grid.placeGridItems(items, style)
+
+	var contributions []gridContribution
+	for _, item := range items {
+		minWidth, maxWidth := intrinsicOuterWidth(item.dom)
+		contributions = append(contributions, gridContribution{
+			start: item.column.start,
+			span:  item.column.span,
+			min:   float64(minWidth),
+			max:   float64(maxWidth),
+		})
+	}
+	columnSizes := sizeGridTracks(grid.columns, innerWidth, columnGap, contributions, isStretchContent(style.JustifyContent))
+	columnPositions := trackPositions(columnSizes, columnGap, innerWidth, style.JustifyContent)
+
+	// The items are laid out in the width of their area to find the heights
+	// of the rows
+	contributions = contributions[:0]
+	for _, item := range items {
+		areaWidth := spanSize(columnPositions, columnSizes, item.column)
+		layoutGridItem(item, parents, areaWidth, cbHeight, gridSelfAlign(item.dom.TagStyle.JustifySelf, style.JustifyItems, item.dom))
+		height := float64(item.dom.Outer.Y2 - item.dom.Outer.Y1 + 1)
+		contributions = append(contributions, gridContribution{
+			start: item.row.start,
+			span:  item.row.span,
+			min:   height,
+			max:   height,
+		})
+	}
+	rowSizes := sizeGridTracks(grid.rows, innerHeight, rowGap, contributions, isStretchContent(style.AlignContent))
+	rowPositions := trackPositions(rowSizes, rowGap, innerHeight, style.AlignContent)
+
+	for _, item := range items {
+		dom := item.dom
+		itemStyle := dom.TagStyle
+		areaWidth := spanSize(columnPositions, columnSizes, item.column)
+		areaHeight := spanSize(rowPositions, rowSizes, item.row)
+		x := columnPositions[item.column.start] + alignInArea(
+			gridSelfAlign(itemStyle.JustifySelf, style.JustifyItems, dom),
+			areaWidth-(dom.Outer.X2-dom.Outer.X1+1), itemStyle.Margin.Left, itemStyle.Margin.Right)
+
+		align := gridSelfAlign(itemStyle.AlignSelf, style.AlignItems, dom)
+		if align == "stretch" && dom.isAutoHeight() && !isAuto(itemStyle.Margin.Top) && !isAuto(itemStyle.Margin.Bottom) {
+			setContentHeight(dom, dom.Inner.Y2-dom.Inner.Y1+1+areaHeight-(dom.Outer.Y2-dom.Outer.Y1+1))
+		}
+		y := rowPositions[item.row.start] + alignInArea(align, areaHeight-(dom.Outer.Y2-dom.Outer.Y1+1), itemStyle.Margin.Top, itemStyle.Margin.Bottom)
+
+		dom.shift(container.Inner.X1+x-dom.Outer.X1, container.Inner.Y1+y-dom.Outer.Y1)
+		if itemStyle.Position == "relative" {
+			dom.layoutAbsolutes()
+			dom.shift(relativeOffset(dom, areaWidth, areaHeight))
+		}
+		if !container.hasBaseline && dom.hasBaseline && item.row.start == 0 {
+			container.baseline = dom.Container.Y1 + dom.baseline - container.Container.Y1
+			container.hasBaseline = true
+		}
+		children = append(children, dom)
+	}
+
+	height := rowPositions[len(rowSizes)]
+	if innerHeight >= 0 {
+		height = innerHeight
+	}
+	return children, EndOffset{Y2: container.Inner.Y1 + height - 1}
+}
+
+// layoutGridItem lays out an item at the origin in the width of its area,
+// which is also its containing block.
+func layoutGridItem(item *gridItem, parents []*Dom, areaWidth, cbHeight int, justify string) {
+	dom := item.dom
+	style := dom.TagStyle
+	marginLeft := getIntPx(style.Margin.Left, areaWidth)
+	marginRight := getIntPx(style.Margin.Right, areaWidth)
+	marginTop := getIntPx(style.Margin.Top, areaWidth)
+	marginBottom := getIntPx(style.Margin.Bottom, areaWidth)
+	paddingWidth := getIntPx(style.Padding.Left, areaWidth) + getIntPx(style.Padding.Right, areaWidth)
+	avail := areaWidth - marginLeft - marginRight - paddingWidth
+	width := getIntPx(style.Width, areaWidth)
+	switch {
+	case dom.TagName == "img":
+		width, _ = dom.imageSize(areaWidth)
+	case width > 0:
+	case justify == "stretch" && !isAuto(style.Margin.Left) && !isAuto(style.Margin.Right):
+		width = avail
+	default:
+		minWidth, maxWidth := intrinsicContentWidth(dom)
+		width = minInt(maxInt(minWidth, avail), maxWidth)
+	}
+	layoutBox(dom, parents, marginLeft, marginTop, width, areaWidth, cbHeight)
+	dom.Outer = Rectangle{
+		X1: dom.Container.X1 - marginLeft,
+		Y1: dom.Container.Y1 - marginTop,
+		X2: dom.Container.X2 + marginRight,
+		Y2: dom.Container.Y2 + marginBottom,
+	}
+}
+
+// alignInArea returns the offset of a margin box in its grid area given the
+// free space around it.
+func alignInArea(align string, free int, marginStart, marginEnd string) int {
+	switch {
+	case isAuto(marginStart) && isAuto(marginEnd):
+		return maxInt(free, 0) / 2
+	case isAuto(marginStart):
+		return maxInt(free, 0)
+	case isAuto(marginEnd):
+		return 0
+	case align == "end":
+		return free
+	case align == "center":
+		return free / 2
+	}
+	return 0
+}
+
+// intrinsicGridWidth returns the min-content and max-content widths of the
+// content of a grid container.
+func intrinsicGridWidth(dom *Dom) (int, int) {
+	style := dom.TagStyle
+	gap := getIntSize(style.ColumnGap)
+	grid := newGridTemplate(style, -1, -1, gap, 0)
+	items := newGridItems(dom, grid)
+	grid.placeGridItems(items, style)
+	var minContributions, maxContributions []gridContribution
+	for _, item := range items {
+		minWidth, maxWidth := intrinsicOuterWidth(item.dom)
+		minContributions = append(minContributions, gridContribution{start: item.column.start, span: item.column.span, min: float64(minWidth), max: float64(minWidth)})
+		maxContributions = append(maxContributions, gridContribution{start: item.column.start, span: item.column.span, min: float64(minWidth), max: float64(maxWidth)})
+	}
+	sum := func(sizes []int) int {
+		total := gap * maxInt(len(sizes)-1, 0)
+		for _, size := range sizes {
+			total += size
+		}
+		return total
+	}
+	return sum(sizeGridTracks(grid.columns, -1, gap, minContributions, false)),
+		sum(sizeGridTracks(grid.columns, -1, gap, maxContributions, false))
+}
@@ -0,0 +1,102 @@
+package html2img
+
+import "testing"
+
+func TestGridLayout(t *testing.T) {
+	css := "body { margin: 0 } .grid { display: grid; width: 300px } .grid > div { height: 20px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "fixed and fr tracks",
+			css:     css,
+			content: `<div class="grid" style="grid-template-columns: 100px 1fr 2fr"><div id="a"></div><div id="b"></div><div id="c"></div><div id="d"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 166, 19}, "c": {167, 0, 299, 19}, "d": {0, 20, 99, 39}},
+		},
+		{
+			name:    "repeat and gap",
+			css:     css,
+			content: `<div class="grid" style="grid-template-columns: repeat(3, 1fr); gap: 10px 15px"><div id="a"></div><div id="b"></div><div id="c"></div><div id="d"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 89, 19}, "b": {105, 0, 194, 19}, "d": {0, 30, 89, 49}},
+		},
+		{
+			name:    "line placement",
+			css:     css,
+			content: `<div class="grid" style="grid-template-columns: 100px 100px 100px"><div id="a" style="grid-column: 2 / 4; grid-row: 2"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {100, 20, 299, 39}, "b": {0, 0, 99, 19}},
+		},
+		{
+			name:    "span",
+			css:     css,
+			content: `<div class="grid" style="grid-template-columns: 100px 100px 100px"><div id="a" style="grid-column: span 2"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 199, 19}, "b": {200, 0, 299, 19}},
+		},
+		{
+			name: "template areas",
+			css:  css,
+			content: `<div class="grid" style="grid-template-columns: 100px 200px; grid-template-areas: 'head head' 'side main'">` +
+				`<div id="m" style="grid-area: main"></div><div id="h" style="grid-area: head"></div><div id="s" style="grid-area: side"></div></div>`,
+			want: map[string]Rectangle{"h": {0, 0, 299, 19}, "s": {0, 20, 99, 39}, "m": {100, 20, 299, 39}},
+		},
+		{
+			name:    "row tracks",
+			css:     css,
+			content: `<div class="grid" style="grid-template-rows: 50px 30px"><div id="a"></div><div id="b" style="height: auto"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 299, 19}, "b": {0, 50, 299, 79}},
+		},
+		{
+			name:    "auto flow column",
+			css:     css,
+			content: `<div class="grid" style="grid-template-rows: 20px 20px; grid-auto-flow: column; grid-auto-columns: 50px"><div id="a"></div><div id="b"></div><div id="c"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 19}, "b": {0, 20, 49, 39}, "c": {50, 0, 99, 19}},
+		},
+		{
+			name:    "minmax",
+			css:     css,
+			content: `<div class="grid" style="grid-template-columns: minmax(50px, 100px) 1fr"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 299, 19}},
+		},
+	})
+}
+
+func TestInvalidGridDeclarations(t *testing.T) {
+	css := "body { margin: 0 } .grid { display: grid; width: 300px; grid-template-columns: 100px 200px } .grid > div { height: 20px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "invalid repeat",
+			css:     css,
+			content: `<div class="grid" style="grid-template-columns: repeat(x, 1fr)"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 299, 19}},
+		},
+		{
+			name:    "unknown track",
+			css:     css,
+			content: `<div class="grid" style="grid-template-columns: 1fr foo"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 299, 19}},
+		},
+		{
+			name:    "areas not rectangular",
+			css:     css,
+			content: `<div class="grid" style="grid-template-areas: 'a b' 'b a'"><div id="a" style="grid-area: a"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}},
+		},
+		{
+			name:    "invalid lines",
+			css:     css,
+			content: `<div class="grid"><div id="a" style="grid-column: 0; grid-row: span 0"></div><div id="b" style="grid-column: 1 / 2 / 3"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 299, 19}},
+		},
+		{
+			name:    "invalid auto flow",
+			css:     css,
+			content: `<div class="grid" style="grid-auto-flow: foo; grid-auto-rows: foo"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 299, 19}},
+		},
+	})
+}
+
+func TestRenderGrid(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"unknown line names", styledDocument(".g { display: grid; grid-template-columns: [a] 10px [b] 10px }", `<div class="g"><div style="grid-column: foo / bar">a</div><div style="grid-row: x 2 / span y">b</div></div>`)},
+		{"invalid tracks", styledDocument(".g { display: grid; grid-template-columns: repeat(x, 1fr); grid-template-rows: minmax(1fr, 10px) }", `<div class="g"><div>a</div></div>`)},
+		{"invalid placements", styledDocument(".g { display: grid } .g > div { grid-area: 1 / 2 / 3 / 4 / 5; grid-column: span; grid-row: 0 / 0 }", `<div class="g"><div>a</div></div>`)},
+	})
+}
@@ -0,0 +1,829 @@
+package html2img
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	itemText = iota
+	itemSpace
+	itemOpen
+	itemClose
+	itemAtomic
+	itemAbsolute
+	itemFloat
+	itemBreak
+)
+
+// inlineItem is a piece of the inline content of a block container: a word or
+// a collapsed space of a text, the start or the end of an inline element, an
+// atomic inline box, an absolutely positioned dom at its static position, a
+// float, or a forced line break.
+type inlineItem struct {
+	kind int
+	dom  *Dom
+	// Inline elements between the block container and dom
+	inlineParents []*Dom
+	text          string
+	width         float64
+	// A line may break before the item
+	breakBefore bool
+	// A space kept at the start and the end of a line
+	preserved bool
+	x         float64
+}
+
+type inlineItemBuilder struct {
+	items    []inlineItem
+	cbWidth  int
+	collapse bool
+	// The next item starts after a break opportunity
+	breakNext bool
+}
+
+// lineBox is a laid out line of a block container.
+type lineBox struct {
+	top      int
+	bottom   int
+	baseline int
+}
+
+// lineInlineBox is an inline box on a line: the root inline box of the block
+// container, an inline element or an atomic inline.
+type lineInlineBox struct {
+	parent *lineInlineBox
+	// The box the vertical position is relative to: the root inline box, or
+	// the nearest box aligned to the top or bottom of the line
+	root       *lineInlineBox
+	style      *TagStyle
+	metrics    fontMetrics
+	lineHeight float64
+	// Baseline relative to the baseline of root
+	base float64
+	// Extent of the boxes aligned with the box when it is a root
+	top    float64
+	bottom float64
+
+	baseline float64
+}
+
+// lineFrame is an inline element open on the line being placed.
+type lineFrame struct {
+	box  *lineInlineBox
+	frag *Dom
+	item int
+	// The text fragment that the next piece of the same text extends
+	text    *Dom
+	textSrc *Dom
+	textX1  float64
+	textX2  float64
+}
+
+type lineFragment struct {
+	dom *Dom
+	box *lineInlineBox
+	// Item of an atomic inline, -1 for the fragments of texts and inline
+	// elements
+	item int
+}
+
+type inlineLayout struct {
+	container *Dom
+	parents   []*Dom
+	items     []inlineItem
+	cbWidth   int
+	cbHeight  int
+
+	// Items of the inline elements continuing from the previous line
+	open      []int
+	fragments []*Dom
+	// Fragments of every inline element
+	domFragments map[*Dom][]*Dom
+
+	boxes []*lineInlineBox
+	roots []*lineInlineBox
+}
+
+// layoutInline lays out run, consecutive inline-level children of the block
+// container at the end of parents, in line boxes starting at y. It returns the
+// fragments replacing run in the children of the container.
+func layoutInline(run []*Dom, parents []*Dom, y, cbHeight int) ([]*Dom, []lineBox) {
+	container := parents[len(parents)-1]
+	cbWidth := container.Inner.X2 - container.Inner.X1 + 1
+	l := &inlineLayout{
+		container:    container,
+		parents:      parents,
+		cbWidth:      cbWidth,
+		cbHeight:     cbHeight,
+		domFragments: make(map[*Dom][]*Dom),
+	}
+	l.items = splitLongWords(collectInlineItems(run, cbWidth), float64(cbWidth))
+	for i := range l.items {
+		item := &l.items[i]
+		switch item.kind {
+		case itemAtomic:
+			item.width = layoutAtomicInline(item.dom, l.itemParents(item), cbWidth, cbHeight)
+		case itemFloat:
+			layoutAtomicInline(item.dom, l.itemParents(item), cbWidth, cbHeight)
+		}
+	}
+
+	floats := floatContextOf(parents)
+	x1, x2 := container.Inner.X1, container.Inner.X2
+	lineHeight := int(math.Ceil(getLineHeight(container.TagStyle, getFontMetrics(container.TagStyle))))
+	placed := make(map[int]bool)
+	var pending []int
+	placeFloat := func(i, y int) {
+		floats.place(l.items[i].dom, x1, x2, y, cbWidth, cbHeight)
+		placed[i] = true
+	}
+
+	var lines []lineBox
+	for start := 0; start < len(l.items); {
+		// Floats that did not fit beside the previous line go below it
+		for _, i := range pending {
+			placeFloat(i, y)
+		}
+		pending = nil
+
+		var left, right, end int
+		for {
+			left, right = floats.bounds(x1, x2, y, lineHeight)
+			avail := float64(right - left + 1)
+			end = breakLine(l.items, start, avail)
+			if lineWidth(l.items[start:end]) > avail && (left > x1 || right < x2) {
+				// Move below the floats when the line does not fit beside them
+				if next, ok := floats.nextBottom(y, lineHeight); ok {
+					y = next
+					continue
+				}
+			}
+			// A float goes beside the line when it fits, and below it
+			// otherwise
+			width, moved := 0.0, false
+			for i := start; i < end && !moved; i++ {
+				item := l.items[i]
+				if item.kind != itemFloat || placed[i] {
+					width += item.width
+					continue
+				}
+				if width == 0 || float64(item.dom.Outer.X2-item.dom.Outer.X1+1) <= avail-width {
+					placeFloat(i, y)
+					moved = true
+					continue
+				}
+				placed[i] = true
+				pending = append(pending, i)
+			}
+			if !moved {
+				break
+			}
+		}
+		last := end == len(l.items) || l.items[end-1].kind == itemBreak
+		line := l.placeLine(start, end, y, left, right, last)
+		lines = append(lines, line)
+		y = line.bottom + 1
+		start = end
+	}
+	for _, i := range pending {
+		placeFloat(i, y)
+	}
+	l.positionRelatives()
+	return l.fragments, lines
+}
+
+// lineWidth returns the width of the content of items without the trailing
+// spaces.
+func lineWidth(items []inlineItem) float64 {
+	width, contentWidth := 0.0, 0.0
+	for _, item := range items {
+		width += item.width
+		if item.kind != itemSpace {
+			contentWidth = width
+		}
+	}
+	return contentWidth
+}
+
+// hasInlineContent reports whether run creates line boxes. Runs of collapsible
+// spaces and out of flow doms take no room.
+func hasInlineContent(run []*Dom) bool {
+	for _, dom := range run {
+		switch {
+		case dom.DomType == DOM_TYPE_TEXT:
+			if strings.TrimLeft(dom.TagData.(string), CUT_SET_LIST+"\r\f") != "" {
+				return true
+			}
+		case dom.isPositionAbsolute() || dom.isFloat():
+		case dom.TagName == "br":
+			return true
+		case dom.isInlineBox():
+			start, end := inlineEdges(dom, 0)
+			if start != 0 || end != 0 || hasInlineContent(dom.Children) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func collectInlineItems(run []*Dom, cbWidth int) []inlineItem {
+	b := &inlineItemBuilder{cbWidth: cbWidth, collapse: true}
+	b.addDoms(run, nil)
+	return b.items
+}
+
+func (b *inlineItemBuilder) addDoms(doms []*Dom, inlineParents []*Dom) {
+	for _, dom := range doms {
+		switch {
+		case dom.DomType == DOM_TYPE_TEXT:
+			b.addText(dom, inlineParents)
+		case dom.isPositionAbsolute():
+			b.items = append(b.items, inlineItem{kind: itemAbsolute, dom: dom, inlineParents: inlineParents})
+		case dom.isFloat():
+			b.items = append(b.items, inlineItem{kind: itemFloat, dom: dom, inlineParents: inlineParents})
+		case dom.TagName == "br":
+			b.addBreak(dom, inlineParents)
+		case dom.isInlineBox():
+			start, end := inlineEdges(dom, b.cbWidth)
+			b.push(inlineItem{kind: itemOpen, dom: dom, inlineParents: inlineParents, width: start})
+			b.addDoms(dom.Children, append(inlineParents[:len(inlineParents):len(inlineParents)], dom))
+			b.items = append(b.items, inlineItem{kind: itemClose, dom: dom, inlineParents: inlineParents, width: end})
+		default:
+			// Images, inline blocks and blocks inside inline elements are
+			// placed on the line as a whole
+			b.breakNext = true
+			b.push(inlineItem{kind: itemAtomic, dom: dom, inlineParents: inlineParents})
+			b.breakNext = true
+			// An outside marker takes no room, the spaces after it are at
+			// the start of the line
+			b.collapse = dom.isOutsideMarker()
+		}
+	}
+}
+
+// addBreak adds a forced line break: the line ends after it.
+func (b *inlineItemBuilder) addBreak(dom *Dom, inlineParents []*Dom) {
+	b.items = append(b.items, inlineItem{kind: itemBreak, dom: dom, inlineParents: inlineParents})
+	b.breakNext = true
+	b.collapse = true
+}
+
+// addText splits a text into words, CJK characters and spaces. Unless
+// white-space preserves them, runs of white space collapse into a single
+// space, also across element boundaries, and newlines are spaces.
+func (b *inlineItemBuilder) addText(dom *Dom, inlineParents []*Dom) {
+	whiteSpace := dom.TagStyle.WhiteSpace
+	preserveSpaces := whiteSpace == "pre" || whiteSpace == "pre-wrap"
+	preserveNewlines := preserveSpaces || whiteSpace == "pre-line"
+	wrap := whiteSpace != "pre" && whiteSpace != "nowrap"
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			b.pushText(dom, inlineParents, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range dom.TagData.(string) {
+		switch {
+		case r == '\r' && preserveNewlines:
+		case r == '\n' && preserveNewlines:
+			flush()
+			b.addBreak(dom, inlineParents)
+		case isCollapsibleSpace(r) && preserveSpaces:
+			flush()
+			space := " "
+			if r == '\t' {
+				space = strings.Repeat(" ", 8)
+			}
+			b.push(inlineItem{
+				kind:          itemSpace,
+				dom:           dom,
+				inlineParents: inlineParents,
+				text:          space,
+				width:         measureText(dom.TagStyle, space),
+				preserved:     true,
+			})
+			b.breakNext = wrap
+			b.collapse = false
+		case isCollapsibleSpace(r):
+			flush()
+			if !b.collapse {
+				b.items = append(b.items, inlineItem{
+					kind:          itemSpace,
+					dom:           dom,
+					inlineParents: inlineParents,
+					text:          " ",
+					width:         measureText(dom.TagStyle, " "),
+				})
+				b.collapse = true
+			}
+			b.breakNext = wrap
+		case isCJK(r):
+			flush()
+			b.pushText(dom, inlineParents, string(r))
+			b.breakNext = wrap && !noBreakAfter(r)
+			b.collapse = false
+		default:
+			word.WriteRune(r)
+			b.collapse = false
+		}
+	}
+	flush()
+}
+
+func (b *inlineItemBuilder) pushText(dom *Dom, inlineParents []*Dom, text string) {
+	b.push(inlineItem{
+		kind:          itemText,
+		dom:           dom,
+		inlineParents: inlineParents,
+		text:          text,
+		width:         measureText(dom.TagStyle, text),
+	})
+}
+
+func (b *inlineItemBuilder) push(item inlineItem) {
+	item.breakBefore = b.breakNext
+	if item.kind == itemText {
+		r, _ := utf8.DecodeRuneInString(item.text)
+		if noBreakBefore(r) {
+			item.breakBefore = false
+		}
+	}
+	b.breakNext = false
+	b.items = append(b.items, item)
+}
+
+func isCollapsibleSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\f':
+		return true
+	}
+	return false
+}
+
+// isCJK reports whether a line may break before and after r without spaces.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+func noBreakBefore(r rune) bool {
+	return strings.ContainsRune(",.;:!?)]}%，。、；：？！）」』】》〉”’…～", r)
+}
+
+func noBreakAfter(r rune) bool {
+	return strings.ContainsRune("（「『【《〈“‘", r)
+}
+
+// inlineEdges returns the room taken by the margin and padding of an inline
+// element before its first and after its last fragment.
+func inlineEdges(dom *Dom, cbWidth int) (float64, float64) {
+	style := dom.TagStyle
+	start := getIntPx(style.Margin.Left, cbWidth) + getIntPx(style.Padding.Left, cbWidth)
+	end := getIntPx(style.Padding.Right, cbWidth) + getIntPx(style.Margin.Right, cbWidth)
+	return float64(start), float64(end)
+}
+
+// splitLongWords lets the words wider than a whole line break between any
+// two characters.
+func splitLongWords(items []inlineItem, avail float64) []inlineItem {
+	var result []inlineItem
+	for _, item := range items {
+		if item.kind != itemText || item.width <= avail || utf8.RuneCountInString(item.text) < 2 {
+			result = append(result, item)
+			continue
+		}
+		for i, r := range []rune(item.text) {
+			part := item
+			part.text = string(r)
+			part.width = measureText(item.dom.TagStyle, part.text)
+			part.breakBefore = item.breakBefore || i > 0
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// breakLine returns the end of the line starting at items[start]: the last
+// break opportunity before the content overflows avail. Trailing spaces never
+// overflow, and a line holds at least the content before its first break
+// opportunity.
+func breakLine(items []inlineItem, start int, avail float64) int {
+	width, contentWidth := 0.0, 0.0
+	lastBreak := start
+	for i := start; i < len(items); i++ {
+		item := items[i]
+		if i > start && item.breakBefore {
+			if contentWidth > avail {
+				if lastBreak > start {
+					return lastBreak
+				}
+				return i
+			}
+			lastBreak = i
+		}
+		width += item.width
+		if item.kind != itemSpace {
+			contentWidth = width
+		}
+		if item.kind == itemBreak {
+			if contentWidth > avail && lastBreak > start {
+				return lastBreak
+			}
+			return i + 1
+		}
+	}
+	if contentWidth > avail && lastBreak > start {
+		return lastBreak
+	}
+	return len(items)
+}
+
+// layoutAtomicInline lays out an image, inline block or block inside an
+// inline element at the origin, to be moved onto its line, and returns its
+// margin box width.
+func layoutAtomicInline(dom *Dom, parents []*Dom, cbWidth, cbHeight int) float64 {
+	style := dom.TagStyle
+	marginLeft := getIntPx(style.Margin.Left, cbWidth)
+	marginRight := getIntPx(style.Margin.Right, cbWidth)
+	marginTop := getIntPx(style.Margin.Top, cbWidth)
+	marginBottom := getIntPx(style.Margin.Bottom, cbWidth)
+	paddingWidth := getIntPx(style.Padding.Left, cbWidth) + getIntPx(style.Padding.Right, cbWidth)
+	contentWidth := getIntPx(style.Width, cbWidth)
+	switch {
+	case dom.TagName == "img":
+		contentWidth, _ = dom.imageSize(cbWidth)
+	case contentWidth > 0:
+	case !dom.isInlineLevel() && !dom.isFloat():
+		contentWidth = cbWidth - marginLeft - marginRight - paddingWidth
+	default:
+		minWidth, maxWidth := intrinsicContentWidth(dom)
+		contentWidth = minInt(maxInt(minWidth, cbWidth-marginLeft-marginRight-paddingWidth), maxWidth)
+	}
+	layoutBox(dom, parents, marginLeft, marginTop, contentWidth, cbWidth, cbHeight)
+	dom.Outer = Rectangle{
+		X1: dom.Container.X1 - marginLeft,
+		Y1: dom.Container.Y1 - marginTop,
+		X2: dom.Container.X2 + marginRight,
+		Y2: dom.Container.Y2 + marginBottom,
+	}
+	return float64(dom.Outer.X2 - dom.Outer.X1 + 1)
+}
+
+// outerBaseline returns the distance from the top of the margin box of an
+// atomic inline to its baseline: the baseline of its last line, or the bottom
+// margin edge when it has none.
+func (d *Dom) outerBaseline() float64 {
+	if d.TagName != "img" && d.hasBaseline {
+		return float64(d.Container.Y1 - d.Outer.Y1 + d.baseline)
+	}
+	return float64(d.Outer.Y2 - d.Outer.Y1 + 1)
+}
+
+func getLineHeight(style *TagStyle, metrics fontMetrics) float64 {
+	if factor, err := strconv.ParseFloat(style.LineHeight, 64); err == nil {
+		// A number is a factor of the font size
+		return factor * getFontSize(style)
+	}
+	if lineHeight := getPx(style.LineHeight, 0); lineHeight > 0 {
+		return lineHeight
+	}
+	return metrics.ascent + metrics.descent
+}
+
+func (l *inlineLayout) itemParents(item *inlineItem) []*Dom {
+	parents := append([]*Dom(nil), l.parents...)
+	return append(parents, item.inlineParents...)
+}
+
+// placeLine places items[start:end] on a line whose top is at y, between the
+// left and right edges of the room beside the floats.
+func (l *inlineLayout) placeLine(start, end, y, left, right int, last bool) lineBox {
+	items := l.items[start:end]
+	first, lastContent := -1, -1
+	for i, item := range items {
+		if item.kind == itemText || item.kind == itemAtomic {
+			if first < 0 {
+				first = i
+			}
+			lastContent = i
+		}
+	}
+	// Spaces at the start and the end of a line are removed, unless
+	// white-space preserves them
+	visible := func(i int) bool {
+		return items[i].kind != itemSpace || items[i].preserved || (i > first && i < lastContent)
+	}
+
+	contentWidth := 0.0
+	spaces := 0
+	for i, item := range items {
+		if visible(i) {
+			contentWidth += item.width
+			if item.kind == itemSpace {
+				spaces++
+			}
+		}
+	}
+	x := float64(left)
+	free := float64(right-left+1) - contentWidth
+	justify := 0.0
+	switch l.container.TagStyle.TextAlign {
+	case "right", "end":
+		x += math.Max(free, 0)
+	case "center":
+		x += math.Max(free, 0) / 2
+	case "justify":
+		if !last && spaces > 0 && free > 0 {
+			justify = free / float64(spaces)
+		}
+	}
+
+	l.boxes = nil
+	l.roots = nil
+	root := l.openBox(l.container.TagStyle, nil)
+	var fragments []lineFragment
+	stack := []*lineFrame{{box: root, item: -1}}
+	appendChild := func(dom *Dom) {
+		frame := stack[len(stack)-1]
+		frame.text = nil
+		if frame.frag == nil {
+			l.fragments = append(l.fragments, dom)
+		} else {
+			frame.frag.Children = append(frame.frag.Children, dom)
+		}
+	}
+	openFrame := func(idx int) {
+		dom := l.items[idx].dom
+		frag := newInlineFragment(dom)
+		frag.Outer.X1 = int(math.Round(x))
+		frag.Container.X1 = frag.Outer.X1
+		frag.Inner.X1 = frag.Outer.X1
+		appendChild(frag)
+		box := l.openBox(dom.TagStyle, stack[len(stack)-1].box)
+		stack = append(stack, &lineFrame{box: box, frag: frag, item: idx})
+		fragments = append(fragments, lineFragment{dom: frag, box: box, item: -1})
+		l.domFragments[dom] = append(l.domFragments[dom], frag)
+	}
+	closeFrame := func() {
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		frame.frag.Inner.X2 = int(math.Round(x)) - 1
+		frame.frag.Container.X2 = frame.frag.Inner.X2
+		frame.frag.Outer.X2 = frame.frag.Inner.X2
+	}
+
+	for _, idx := range l.open {
+		openFrame(idx)
+		trimInlineEdge(stack[len(stack)-1].frag, true)
+	}
+	for i := range items {
+		item := &items[i]
+		if !visible(i) {
+			continue
+		}
+		item.x = x
+		switch item.kind {
+		case itemText, itemSpace:
+			frame := stack[len(stack)-1]
+			if item.kind == itemSpace && justify > 0 {
+				x += item.width + justify
+				frame.text = nil
+				continue
+			}
+			if frame.text == nil || frame.textSrc != item.dom || frame.textX2 != x {
+				frag := newInlineFragment(item.dom)
+				frag.TagData = ""
+				appendChild(frag)
+				frame.text = frag
+				frame.textSrc = item.dom
+				frame.textX1 = x
+				fragments = append(fragments, lineFragment{dom: frag, box: frame.box, item: -1})
+			}
+			x += item.width
+			frame.textX2 = x
+			frame.text.TagData = frame.text.TagData.(string) + item.text
+			frame.text.Inner.X1 = int(math.Round(frame.textX1))
+			frame.text.Inner.X2 = int(math.Round(x)) - 1
+		case itemOpen:
+			openFrame(start + i)
+			frag := stack[len(stack)-1].frag
+			style := item.dom.TagStyle
+			frag.Container.X1 += getIntPx(style.Margin.Left, l.cbWidth)
+			frag.Inner.X1 = frag.Container.X1 + getIntPx(style.Padding.Left, l.cbWidth)
+			x += item.width
+		case itemClose:
+			closeFrame()
+			frag := l.domFragments[item.dom][len(l.domFragments[item.dom])-1]
+			style := item.dom.TagStyle
+			frag.Container.X2 += getIntPx(style.Padding.Right, l.cbWidth)
+			frag.Outer.X2 = frag.Container.X2 + getIntPx(style.Margin.Right, l.cbWidth)
+			x += item.width
+		case itemAtomic:
+			box := &lineInlineBox{parent: stack[len(stack)-1].box, style: item.dom.TagStyle}
+			height := float64(item.dom.Outer.Y2 - item.dom.Outer.Y1 + 1)
+			above := item.dom.outerBaseline()
+			box.lineHeight = height
+			l.alignBox(box, above, height-above)
+			appendChild(item.dom)
+			fragments = append(fragments, lineFragment{dom: item.dom, box: box, item: start + i})
+			x += item.width
+		case itemAbsolute:
+			deferAbsolute(item.dom, l.itemParents(item), int(math.Round(x)), y)
+			appendChild(item.dom)
+		case itemFloat:
+			appendChild(item.dom)
+		case itemBreak:
+		}
+	}
+	// Inline elements continuing on the next line
+	l.open = l.open[:0]
+	for _, frame := range stack[1:] {
+		l.open = append(l.open, frame.item)
+	}
+	for len(stack) > 1 {
+		trimInlineEdge(stack[len(stack)-1].frag, false)
+		closeFrame()
+	}
+
+	top, bottom := root.top, root.bottom
+	for _, r := range l.roots {
+		if r.bottom-r.top > bottom-top {
+			if r.style.VerticalAlign == "top" {
+				bottom = top + r.bottom - r.top
+			} else {
+				top = bottom - (r.bottom - r.top)
+			}
+		}
+	}
+	root.baseline = float64(y) - top
+	for _, r := range l.roots {
+		if r.style.VerticalAlign == "top" {
+			r.baseline = float64(y) - r.top
+		} else {
+			r.baseline = float64(y) + bottom - top - r.bottom
+		}
+	}
+	for _, box := range l.boxes {
+		box.baseline = box.root.baseline + box.base
+	}
+
+	for _, f := range fragments {
+		if f.item >= 0 {
+			dom := f.dom
+			dom.shift(int(math.Round(l.items[f.item].x))-dom.Outer.X1, int(math.Round(f.box.baseline-dom.outerBaseline()))-dom.Outer.Y1)
+			if dom.TagStyle.Position == "relative" {
+				dom.layoutAbsolutes()
+				dom.shift(relativeOffset(dom, l.cbWidth, l.cbHeight))
+			}
+			continue
+		}
+		l.placeFragment(f.dom, f.box)
+	}
+	return lineBox{
+		top:      y,
+		bottom:   y + int(math.Round(bottom-top)) - 1,
+		baseline: int(math.Round(root.baseline)),
+	}
+}
+
+// placeFragment sets the vertical position of the fragment of a text or an
+// inline element: its content area around the baseline of box.
+func (l *inlineLayout) placeFragment(frag *Dom, box *lineInlineBox) {
+	metrics := box.metrics
+	frag.Inner.Y1 = int(math.Round(box.baseline - metrics.ascent))
+	frag.Inner.Y2 = int(math.Round(box.baseline+metrics.descent)) - 1
+	frag.baseline = int(math.Round(box.baseline)) - frag.Inner.Y1
+	frag.hasBaseline = true
+	frag.Container.Y1 = frag.Inner.Y1
+	frag.Container.Y2 = frag.Inner.Y2
+	if frag.DomType == DOM_TYPE_TEXT {
+		frag.Container.X1 = frag.Inner.X1
+		frag.Container.X2 = frag.Inner.X2
+		frag.Outer = frag.Container
+		return
+	}
+	style := frag.TagStyle
+	frag.Container.Y1 -= getIntPx(style.Padding.Top, l.cbWidth)
+	frag.Container.Y2 += getIntPx(style.Padding.Bottom, l.cbWidth)
+	frag.baseline += frag.Inner.Y1 - frag.Container.Y1
+	frag.Outer.Y1 = frag.Container.Y1 - getIntPx(style.Margin.Top, l.cbWidth)
+	frag.Outer.Y2 = frag.Container.Y2 + getIntPx(style.Margin.Bottom, l.cbWidth)
+}
+
+// openBox creates the inline box of an element on the line, or the root
+// inline box when parent is nil.
+func (l *inlineLayout) openBox(style *TagStyle, parent *lineInlineBox) *lineInlineBox {
+	box := &lineInlineBox{parent: parent, style: style, metrics: getFontMetrics(style)}
+	box.lineHeight = getLineHeight(style, box.metrics)
+	halfLeading := (box.lineHeight - box.metrics.ascent - box.metrics.descent) / 2
+	l.alignBox(box, box.metrics.ascent+halfLeading, box.metrics.descent+halfLeading)
+	return box
+}
+
+// alignBox positions box, extending above and below its baseline, relative to
+// its parent according to vertical-align.
+func (l *inlineLayout) alignBox(box *lineInlineBox, above, below float64) {
+	l.boxes = append(l.boxes, box)
+	parent := box.parent
+	align := ""
+	if parent != nil {
+		align = box.style.VerticalAlign
+	}
+	switch align {
+	case "":
+		if parent == nil {
+			box.root = box
+			box.top, box.bottom = -above, below
+			return
+		}
+		box.base = parent.base
+	case "top", "bottom":
+		box.root = box
+		box.top, box.bottom = -above, below
+		l.roots = append(l.roots, box)
+		return
+	case "baseline":
+		box.base = parent.base
+	case "middle":
+		box.base = parent.base - parent.metrics.xHeight/2 - (below-above)/2
+	case "sub":
+		box.base = parent.base + getFontSize(parent.style)/5
+	case "super":
+		box.base = parent.base - getFontSize(parent.style)/3
+	case "text-top":
+		box.base = parent.base - parent.metrics.ascent + above
+	case "text-bottom":
+		box.base = parent.base + parent.metrics.descent - below
+	default:
+		box.base = parent.base - float64(getIntPx(align, int(box.lineHeight)))
+	}
+	box.root = parent.root
+	box.root.top = math.Min(box.root.top, box.base-above)
+	box.root.bottom = math.Max(box.root.bottom, box.base+below)
+}
+
+// positionRelatives moves the fragments of relatively positioned inline
+// elements and lays out the absolutely positioned doms they contain.
+func (l *inlineLayout) positionRelatives() {
+	for _, item := range l.items {
+		if item.kind != itemOpen || item.dom.TagStyle.Position != "relative" {
+			continue
+		}
+		dom := item.dom
+		frags := l.domFragments[dom]
+		dx, dy := relativeOffset(dom, l.cbWidth, l.cbHeight)
+		for i, frag := range frags {
+			frag.shift(dx, dy)
+			if i == 0 {
+				dom.Outer, dom.Container, dom.Inner = frag.Outer, frag.Container, frag.Inner
+				continue
+			}
+			dom.Outer = unionRect(dom.Outer, frag.Outer)
+			dom.Container = unionRect(dom.Container, frag.Container)
+			dom.Inner = unionRect(dom.Inner, frag.Inner)
+		}
+		dom.layoutAbsolutes()
+	}
+}
+
+// newInlineFragment returns the part of a text or an inline element placed on
+// one line.
+func newInlineFragment(dom *Dom) *Dom {
+	frag := *dom
+	frag.Children = nil
+	frag.absolutes = nil
+	return &frag
+}
+
+// trimInlineEdge removes the border and the rounded corners on the start or
+// end side of a fragment continuing on another line.
+func trimInlineEdge(frag *Dom, start bool) {
+	style := *frag.TagStyle
+	if start {
+		style.BorderWidth.Left = ""
+		style.BorderRadius.Top = ""
+		style.BorderRadius.Left = ""
+	} else {
+		style.BorderWidth.Right = ""
+		style.BorderRadius.Right = ""
+		style.BorderRadius.Bottom = ""
+	}
+	frag.TagStyle = &style
+}
+
+func unionRect(a, b Rectangle) Rectangle {
+	return Rectangle{
+		X1: minInt(a.X1, b.X1),
+		Y1: minInt(a.Y1, b.Y1),
+		X2: maxInt(a.X2, b.X2),
+		Y2: maxInt(a.Y2, b.Y2),
+	}
+}
@@ -0,0 +1,79 @@
+package html2img
+
+import "testing"
+
+func TestInlineLayout(t *testing.T) {
+	// In Go 16px, "aaaa " is 40px wide and a line of text 19px high with its
+	// baseline at 15px.
+	css := "body { margin: 0 } p { margin: 0 } .box { display: inline-block; width: 10px; height: 10px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "span in a paragraph",
+			css:     css,
+			content: `<p id="p">aaaa <span id="s">bbbb</span> cccc</p>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 18}, "s": {40, 0, 75, 18}},
+		},
+		{
+			name:    "mixed font sizes",
+			css:     css,
+			content: `<p id="p">aaaa <span id="s" style="font-size: 32px">bbbb</span> cccc</p>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 36}, "s": {40, 0, 110, 36}},
+		},
+		{
+			name:    "wraps across spans",
+			css:     css,
+			content: `<p id="p" style="width: 100px">aaaa <span id="s">bbbb cccc dddd</span> eeee</p>`,
+			want:    map[string]Rectangle{"p": {0, 0, 99, 56}, "s": {40, 0, 75, 18}},
+		},
+		{
+			name:    "line height",
+			css:     css,
+			content: `<p id="p" style="line-height: 30px">aaaa <span id="s">bbbb</span></p>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 29}, "s": {40, 6, 75, 23}},
+		},
+		{
+			name: "vertical-align",
+			css:  css,
+			content: `<p id="p">aaaa ` +
+				`<span id="top" class="box" style="height: 40px; vertical-align: top"></span>` +
+				`<span id="bottom" class="box" style="vertical-align: bottom"></span>` +
+				`<span id="middle" class="box" style="vertical-align: middle"></span>` +
+				`<span id="baseline" class="box"></span>` +
+				`<span id="length" class="box" style="vertical-align: 5px"></span>` +
+				`<span id="super" style="vertical-align: super">x</span>` +
+				`<span id="sub" style="vertical-align: sub">x</span></p>`,
+			want: map[string]Rectangle{
+				"p":        {0, 0, 799, 39},
+				"top":      {40, 0, 49, 39},
+				"bottom":   {50, 30, 59, 39},
+				"middle":   {60, 11, 69, 20},
+				"baseline": {70, 10, 79, 19},
+				"length":   {80, 5, 89, 14},
+				"super":    {90, 0, 97, 18},
+				"sub":      {98, 9, 105, 26},
+			},
+		},
+		{
+			name:    "inline image",
+			css:     css,
+			content: `<p id="p">aaaa <img id="i" src="data:," style="width: 20px; height: 30px"></p>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 32}, "i": {40, 0, 59, 29}},
+		},
+		{
+			name:    "text-align center",
+			css:     css,
+			content: `<p style="width: 100px; text-align: center"><span id="b" class="box"></span></p>`,
+			want:    map[string]Rectangle{"b": {45, 5, 54, 14}},
+		},
+	})
+}
+
+func TestRenderInline(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"text", styledDocument("", `<p>aaaa <span style="font-size: 32px">bbbb</span> cccc</p>`)},
+		{"bold and italic", styledDocument("", `<p><b>bold</b> <i>italic</i> <b><i>both</i></b></p>`)},
+		{"decorations", styledDocument("", `<p style="text-decoration: underline">aaaa <s>bbbb</s></p>`)},
+		{"pre", styledDocument("", "<pre>aaaa\n\tbbbb\n</pre>")},
+		{"br", styledDocument("", "<p>aaaa<br>bbbb<br></p>")},
+	})
+}
@@ -0,0 +1,99 @@
+package html2img
+
+import (
+	"math"
+	"strings"
+)
+
+// intrinsicContentWidth returns the min-content and max-content widths of the
+// content of dom: the narrowest it can be laid out without overflowing and
+// the width it takes without any line break.
+func intrinsicContentWidth(dom *Dom) (int, int) {
+	if dom.isFlexContainer() {
+		return intrinsicFlexWidth(dom)
+	}
+	if dom.isGridContainer() {
+		return intrinsicGridWidth(dom)
+	}
+	if dom.table != nil {
+		return intrinsicOuterWidth(dom.table)
+	}
+	if dom.isTable() {
+		return intrinsicTableWidth(dom)
+	}
+	var minWidth, maxWidth int
+	children := dom.sourceChildren()
+	for i := 0; i < len(children); i++ {
+		child := children[i]
+		if child.isPositionAbsolute() {
+			continue
+		}
+		if child.isInlineLevel() {
+			end := i + 1
+			for end < len(children) && (children[end].isInlineLevel() || children[end].isPositionAbsolute() || children[end].isFloat()) {
+				end++
+			}
+			runMin, runMax := intrinsicInlineWidth(children[i:end])
+			i = end - 1
+			minWidth = maxInt(minWidth, runMin)
+			maxWidth = maxInt(maxWidth, runMax)
+			continue
+		}
+		childMin, childMax := intrinsicOuterWidth(child)
+		minWidth = maxInt(minWidth, childMin)
+		maxWidth = maxInt(maxWidth, childMax)
+	}
+	if dom.isMultiColumn() {
+		return intrinsicColumnsWidth(dom, minWidth, maxWidth)
+	}
+	return minWidth, maxWidth
+}
+
+// intrinsicInlineWidth returns the widest unbreakable piece of the inline
+// content of run and its width on a single line.
+func intrinsicInlineWidth(run []*Dom) (int, int) {
+	var minWidth, maxWidth, word, line float64
+	for _, item := range collectInlineItems(run, 0) {
+		if item.breakBefore {
+			word = 0
+		}
+		switch item.kind {
+		case itemSpace:
+			line += item.width
+			word = 0
+			continue
+		case itemBreak:
+			line = 0
+			word = 0
+			continue
+		case itemAtomic, itemFloat:
+			atomicMin, atomicMax := intrinsicOuterWidth(item.dom)
+			word += float64(atomicMin)
+			line += float64(atomicMax)
+		default:
+			word += item.width
+			line += item.width
+		}
+		minWidth = math.Max(minWidth, word)
+		maxWidth = math.Max(maxWidth, line)
+	}
+	return int(math.Ceil(minWidth)), int(math.Ceil(maxWidth))
+}
+
+// intrinsicOuterWidth returns the intrinsic widths of dom including its
+// padding and margins.
+func intrinsicOuterWidth(dom *Dom) (int, int) {
+	style := dom.TagStyle
+	extra := getIntSize(style.Margin.Left) + getIntSize(style.Margin.Right) +
+		getIntSize(style.Padding.Left) + getIntSize(style.Padding.Right)
+	switch {
+	case dom.TagName == "img":
+		width, _ := dom.imageSize(0)
+		return width + extra, width + extra
+	case strings.HasSuffix(style.Width, "px"):
+		width := getIntSize(style.Width)
+		return width + extra, width + extra
+	}
+	minWidth, maxWidth := intrinsicContentWidth(dom)
+	return minWidth + extra, maxWidth + extra
+}
@@ -0,0 +1,445 @@
+package html2img
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// lengthUnits are the px in an absolute length unit.
+var lengthUnits = map[string]float64{
+	"px": 1, "cm": 96 / 2.54, "mm": 96 / 25.4, "q": 96 / 101.6,
+	"in": 96, "pt": 96.0 / 72, "pc": 16,
+}
+
+// fontSizeKeywords are the px of the absolute font-size keywords.
+var fontSizeKeywords = map[string]float64{
+	"xx-small": 9, "x-small": 10, "small": 13, "medium": 16,
+	"large": 18, "x-large": 24, "xx-large": 32, "xxx-large": 48,
+}
+
+// lengthContext resolves lengths to px.
+type lengthContext struct {
+	// px of 1em and of 1rem
+	fontSize     float64
+	rootFontSize float64
+	// Style measuring 1ch, the width of a 0
+	style *TagStyle
+	media *mediaContext
+	// px of 100%, negative when percentages are left to the layout
+	percent float64
+}
+
+// defaultLengthContext resolves the lengths of the layout, which are in px
+// but for the percentages of base.
+func defaultLengthContext(base float64) *lengthContext {
+	return &lengthContext{
+		fontSize:     DEFAULT_FONT_SIZE,
+		rootFontSize: DEFAULT_FONT_SIZE,
+		media:        defaultMedia,
+		percent:      base,
+	}
+}
+
+// unit returns the px in one unit, or false when unit is not a length unit.
+func (c *lengthContext) unit(unit string) (float64, bool) {
+	unit = strings.ToLower(unit)
+	if px, ok := lengthUnits[unit]; ok {
+		return px, true
+	}
+	width, height := float64(c.media.width), float64(c.media.height)
+	switch unit {
+	case "em":
+		return c.fontSize, true
+	case "rem":
+		return c.rootFontSize, true
+	case "ex":
+		return c.fontSize / 2, true
+	case "ch":
+		if c.style == nil {
+			return c.fontSize / 2, true
+		}
+		return measureText(c.style, "0"), true
+	case "vw":
+		return width / 100, true
+	case "vh":
+		return height / 100, true
+	case "vmin":
+		return math.Min(width, height) / 100, true
+	case "vmax":
+		return math.Max(width, height) / 100, true
+	}
+	return 0, false
+}
+
+func isMathFunction(v *componentValue) bool {
+	if !v.isFunction() {
+		return false
+	}
+	switch strings.ToLower(v.token.value) {
+	case "calc", "min", "max", "clamp":
+		return true
+	}
+	return false
+}
+
+// evalLength returns the px of a length, a percentage or a math function, or
+// false when values is not one.
+func (c *lengthContext) evalLength(values []componentValue) (float64, bool) {
+	values = trimWhitespace(values)
+	if len(values) != 1 {
+		return 0, false
+	}
+	p := &calcParser{c: c, values: values}
+	px, number, ok := p.value()
+	// 0 is the only length without unit
+	return px, ok && (!number || px == 0)
+}
+
+// calcParser evaluates the expressions of calc(), min(), max() and clamp().
+// Numbers and lengths are not mixed but by multiplication and division.
+type calcParser struct {
+	c      *lengthContext
+	values []componentValue
+	pos    int
+}
+
+func (p *calcParser) peek() *componentValue {
+	for p.pos < len(p.values) && p.values[p.pos].token.kind == tokenWhitespace {
+		p.pos++
+	}
+	if p.pos < len(p.values) {
+		return &p.values[p.pos]
+	}
+	return nil
+}
+
+func isDelim(v *componentValue, delim string) bool {
+	return v != nil && v.token.kind == tokenDelim && v.token.value == delim
+}
+
+// eval evaluates the whole expression of values.
+func (c *lengthContext) eval(values []componentValue) (float64, bool, bool) {
+	p := &calcParser{c: c, values: values}
+	result, number, ok := p.sum()
+	if p.peek() != nil {
+		return 0, false, false
+	}
+	return result, number, ok
+}
+
+func (p *calcParser) sum() (float64, bool, bool) {
+	result, number, ok := p.product()
+	for ok {
+		v := p.peek()
+		sign := 1.0
+		switch {
+		case isDelim(v, "+"):
+			p.pos++
+		case isDelim(v, "-"):
+			sign = -1
+			p.pos++
+		case v != nil && (v.token.kind == tokenNumber || v.token.kind == tokenDimension || v.token.kind == tokenPercentage) &&
+			(strings.HasPrefix(v.token.text, "+") || strings.HasPrefix(v.token.text, "-")):
+			// A signed operand without space after its operator
+		default:
+			return result, number, ok
+		}
+		operand, operandNumber, operandOk := p.product()
+		if !operandOk || operandNumber != number {
+			return 0, false, false
+		}
+		result += sign * operand
+	}
+	return result, number, ok
+}
+
+func (p *calcParser) product() (float64, bool, bool) {
+	result, number, ok := p.value()
+	for ok {
+		v := p.peek()
+		if !isDelim(v, "*") && !isDelim(v, "/") {
+			break
+		}
+		p.pos++
+		operand, operandNumber, operandOk := p.value()
+		switch {
+		case !operandOk:
+			return 0, false, false
+		case isDelim(v, "*") && (number || operandNumber):
+			result *= operand
+			number = number && operandNumber
+		case isDelim(v, "/") && operandNumber && operand != 0:
+			result /= operand
+		default:
+			return 0, false, false
+		}
+	}
+	return result, number, ok
+}
+
+// value evaluates a number, a length, a percentage, a parenthesized
+// expression or a math function, and reports whether it is a number.
+func (p *calcParser) value() (float64, bool, bool) {
+	v := p.peek()
+	if v == nil {
+		return 0, false, false
+	}
+	p.pos++
+	token := v.token
+	switch {
+	case token.kind == tokenNumber:
+		return token.num, true, true
+	case token.kind == tokenDimension:
+		px, ok := p.c.unit(token.value)
+		return token.num * px, false, ok
+	case token.kind == tokenPercentage:
+		if p.c.percent < 0 {
+			return 0, false, false
+		}
+		return token.num * p.c.percent / 100, false, true
+	case token.kind == tokenOpenParen:
+		return p.c.eval(v.children)
+	case isMathFunction(v):
+		return p.c.evalMath(v)
+	}
+	return 0, false, false
+}
+
+// evalMath evaluates calc(), min(), max() or clamp().
+func (c *lengthContext) evalMath(v *componentValue) (float64, bool, bool) {
+	var args [][]componentValue
+	start := 0
+	for i, arg := range v.children {
+		if arg.token.kind == tokenComma {
+			args = append(args, v.children[start:i])
+			start = i + 1
+		}
+	}
+	args = append(args, v.children[start:])
+	var results []float64
+	number := false
+	for i, arg := range args {
+		result, argNumber, ok := c.eval(arg)
+		if !ok || (i > 0 && argNumber != number) {
+			return 0, false, false
+		}
+		results = append(results, result)
+		number = argNumber
+	}
+	switch name := strings.ToLower(v.token.value); {
+	case name == "calc" && len(results) == 1:
+		return results[0], number, true
+	case name == "min":
+		return minFloat(results), number, true
+	case name == "max":
+		return maxFloat(results), number, true
+	case name == "clamp" && len(results) == 3:
+		return math.Max(results[0], math.Min(results[1], results[2])), number, true
+	}
+	return 0, false, false
+}
+
+func minFloat(values []float64) float64 {
+	result := values[0]
+	for _, v := range values[1:] {
+		result = math.Min(result, v)
+	}
+	return result
+}
+
+func maxFloat(values []float64) float64 {
+	result := values[0]
+	for _, v := range values[1:] {
+		result = math.Max(result, v)
+	}
+	return result
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// computeLength returns value with its lengths in px and its math functions
+// evaluated, but for the ones depending on percentages, which are left to the
+// layout.
+func (c *lengthContext) computeLength(value string) string {
+	if value == "" || isPx(value) {
+		return value
+	}
+	var text strings.Builder
+	c.writeComputed(&text, parseComponentValues(tokenizeCSS(value)))
+	return text.String()
+}
+
+func isPx(value string) bool {
+	if !strings.HasSuffix(value, "px") {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.TrimSuffix(value, "px"), 64)
+	return err == nil
+}
+
+func (c *lengthContext) writeComputed(text *strings.Builder, values []componentValue) {
+	for i := range values {
+		v := &values[i]
+		switch {
+		case v.token.kind == tokenDimension:
+			if px, ok := c.unit(v.token.value); ok {
+				text.WriteString(formatNumber(v.token.num*px) + "px")
+				continue
+			}
+		case v.token.kind == tokenPercentage && c.percent >= 0:
+			text.WriteString(formatNumber(v.token.num*c.percent/100) + "px")
+			continue
+		case isMathFunction(v):
+			if result, number, ok := c.evalMath(v); ok {
+				text.WriteString(formatNumber(result))
+				if !number {
+					text.WriteString("px")
+				}
+				continue
+			}
+			fallthrough
+		case v.isFunction() || v.isBlock():
+			text.WriteString(v.token.text)
+			c.writeComputed(text, v.children)
+			text.WriteString(closingTokens[v.token.kind])
+			continue
+		}
+		writeComponentValue(text, v)
+	}
+}
+
+// computeFontSize returns the px of a font-size, whose em and percentages
+// are the font size of the parent.
+func (c *lengthContext) computeFontSize(value string) string {
+	switch value {
+	case "":
+		return value
+	case "smaller":
+		return formatNumber(c.fontSize/1.2) + "px"
+	case "larger":
+		return formatNumber(c.fontSize*1.2) + "px"
+	}
+	if px, ok := fontSizeKeywords[value]; ok {
+		return formatNumber(px) + "px"
+	}
+	fc := *c
+	fc.percent = c.fontSize
+	px, ok := fc.evalLength(parseComponentValues(tokenizeCSS(value)))
+	if !ok || px < 0 {
+		// Invalid font sizes inherit the one of the parent
+		px = c.fontSize
+	}
+	return formatNumber(px) + "px"
+}
+
+// isNumber reports whether value is a number without unit, as the factors of
+// line-height are.
+func isNumber(value string) bool {
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// computeLengths converts the lengths of the style of dom to px. The font
+// size comes first, em being the font size of the parent for font-size and
+// the font size of dom for the other properties. Percentages are left to the
+// layout, but the ones of line-height, which are of the font size.
+func computeLengths(dom *Dom) {
+	style := dom.TagStyle
+	root := dom
+	for root.parent != nil {
+		root = root.parent
+	}
+	c := defaultLengthContext(-1)
+	if root.media != nil {
+		c.media = root.media
+	}
+	if root != dom {
+		c.rootFontSize = getFontSize(root.TagStyle)
+	}
+	if dom.parent != nil {
+		c.fontSize = getFontSize(dom.parent.TagStyle)
+	}
+	style.FontSize = c.computeFontSize(style.FontSize)
+	if root == dom {
+		c.rootFontSize = getFontSize(style)
+	}
+	c.fontSize = getFontSize(style)
+	c.style = style
+
+	if !isNumber(style.LineHeight) && style.LineHeight != "normal" {
+		lc := *c
+		lc.percent = c.fontSize
+		style.LineHeight = lc.computeLength(style.LineHeight)
+	}
+	for _, value := range []*string{
+		&style.Width, &style.Height, &style.VerticalAlign, &style.Transform, &style.TransformOrigin,
+		&style.FlexBasis, &style.RowGap, &style.ColumnGap,
+		&style.GridTemplateColumns, &style.GridTemplateRows, &style.GridAutoColumns, &style.GridAutoRows,
+		&style.BorderSpacing, &style.ColumnWidth, &style.ColumnRuleWidth,
+	} {
+		*value = c.computeLength(*value)
+	}
+	for _, pos := range []*Pos{&style.Offset, &style.Margin, &style.Padding, &style.BorderWidth, &style.BorderRadius} {
+		pos.Left = c.computeLength(pos.Left)
+		pos.Top = c.computeLength(pos.Top)
+		pos.Right = c.computeLength(pos.Right)
+		pos.Bottom = c.computeLength(pos.Bottom)
+	}
+}
+
+// splitValues splits a value on the spaces outside of parentheses, which
+// keeps the arguments of functions like calc() together.
+func splitValues(value string) []string {
+	var values []string
+	depth, start := 0, -1
+	for i, r := range value + " " {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case isCollapsibleSpace(r) && depth == 0:
+			if start >= 0 {
+				values = append(values, value[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	return values
+}
+
+// hasPercentage reports whether size is a percentage or a math function
+// with one.
+func hasPercentage(size string) bool {
+	for _, token := range tokenizeCSS(size) {
+		if token.kind == tokenPercentage {
+			return true
+		}
+	}
+	return false
+}
+
+// getPx returns the px of a length, of a percentage of base or of a math
+// function mixing them, or 0 when size is not a length. A percentage is 0
+// when base is negative, the size it is a percentage of being unknown.
+func getPx(size string, base float64) float64 {
+	if size == "" {
+		return 0
+	}
+	if isPx(size) {
+		px, _ := strconv.ParseFloat(strings.TrimSuffix(size, "px"), 64)
+		return px
+	}
+	px, ok := defaultLengthContext(base).evalLength(parseComponentValues(tokenizeCSS(size)))
+	if !ok {
+		return 0
+	}
+	return px
+}
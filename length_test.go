@@ -0,0 +1,194 @@
+package html2img
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGetPx(t *testing.T) {
+	tests := []struct {
+		size string
+		base float64
+		want float64
+	}{
+		{"", 100, 0},
+		{"10px", 100, 10},
+		{"-2.5px", 100, -2.5},
+		{"0", 100, 0},
+		{"1in", 0, 96},
+		{"72pt", 0, 96},
+		{"2.54cm", 0, 96},
+		{"1pc", 0, 16},
+		{"2em", 0, 32},
+		{"1rem", 0, 16},
+		{"50%", 200, 100},
+		{"50%", -1, 0},
+		{"calc(50% + 10px)", 200, 110},
+		{"calc(50% + 10px)", -1, 0},
+		{"calc(2 * (3px + 1px))", 0, 8},
+		{"calc(10px / 4)", 0, 2.5},
+		{"calc(10px / 0)", 0, 0},
+		{"calc(10px * 2px)", 0, 0},
+		{"calc(10px + 2)", 0, 0},
+		{"min(10px, 5px, 20px)", 0, 5},
+		{"max(10%, 30px)", 400, 40},
+		{"clamp(10px, 50%, 30px)", 100, 30},
+		{"clamp(10px, 50%, 30px)", 10, 10},
+		{"calc(min(10px, 20px) * 3)", 0, 30},
+		{"10", 0, 0},
+		{"auto", 100, 0},
+		{"10xp", 0, 0},
+		{"calc(", 0, 0},
+		{"calc(10px", 0, 10},
+		{"min()", 0, 0},
+	}
+	for _, test := range tests {
+		if got := getPx(test.size, test.base); math.Abs(got-test.want) > 0.001 {
+			t.Errorf("getPx(%q, %v) = %v, want %v", test.size, test.base, got, test.want)
+		}
+	}
+}
+
+func TestComputeLength(t *testing.T) {
+	c := &lengthContext{
+		fontSize:     20,
+		rootFontSize: 10,
+		media:        &mediaContext{width: 1000, height: 500},
+		percent:      -1,
+	}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"auto", "auto"},
+		{"12px", "12px"},
+		{"2em", "40px"},
+		{"2EM", "40px"},
+		{"1.5rem", "15px"},
+		{"1ex", "10px"},
+		{"2ch", "20px"},
+		{"10vw", "100px"},
+		{"10vh", "50px"},
+		{"10vmin", "50px"},
+		{"10vmax", "100px"},
+		{"50%", "50%"},
+		{"1em 2rem", "20px 20px"},
+		{"calc(1em + 1rem)", "30px"},
+		{"calc(50% + 1em)", "calc(50% + 20px)"},
+		{"repeat(2, 1em)", "repeat(2, 20px)"},
+		{"translate(1em, 2vw)", "translate(20px, 20px)"},
+		{"3foo", "3foo"},
+	}
+	for _, test := range tests {
+		if got := c.computeLength(test.value); got != test.want {
+			t.Errorf("computeLength(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestComputeFontSize(t *testing.T) {
+	c := &lengthContext{fontSize: 20, rootFontSize: 10, media: defaultMedia, percent: -1}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"12px", "12px"},
+		{"2em", "40px"},
+		{"50%", "10px"},
+		{"2rem", "20px"},
+		{"large", "18px"},
+		{"xx-small", "9px"},
+		{"smaller", "16.667px"},
+		{"larger", "24px"},
+		{"calc(1em + 50%)", "30px"},
+		{"calc(0px - 5px)", "20px"},
+		{"foo", "20px"},
+	}
+	for _, test := range tests {
+		if got := c.computeFontSize(test.value); got != test.want {
+			t.Errorf("computeFontSize(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestGetFontSize(t *testing.T) {
+	tests := []struct {
+		fontSize string
+		want     float64
+	}{
+		{"", DEFAULT_FONT_SIZE},
+		{"20px", 20},
+		{"0", DEFAULT_FONT_SIZE},
+		{"-3px", DEFAULT_FONT_SIZE},
+		{"garbage", DEFAULT_FONT_SIZE},
+	}
+	for _, test := range tests {
+		if got := getFontSize(&TagStyle{FontSize: test.fontSize}); got != test.want {
+			t.Errorf("getFontSize(%q) = %v, want %v", test.fontSize, got, test.want)
+		}
+	}
+}
+
+func TestComputedLengths(t *testing.T) {
+	runComputedStyleTests(t, func(s *TagStyle) string { return s.FontSize }, []computedStyleTest{
+		{"em of the parent", "div { font-size: 20px } p { font-size: 1.5em }", `<div><p id="e">a</p></div>`, "30px"},
+		{"percentage of the parent", "div { font-size: 20px } p { font-size: 50% }", `<div><p id="e">a</p></div>`, "10px"},
+		{"rem of the root", "html { font-size: 10px } div { font-size: 40px } p { font-size: 2rem }", `<div><p id="e">a</p></div>`, "20px"},
+		{"rem of the root font-size", "html { font-size: 2rem } p { font-size: 1rem }", `<p id="e">a</p>`, "32px"},
+		{"inherited computed value", "div { font-size: 2em } p { }", `<div><p id="e">a</p></div>`, "32px"},
+		{"nested em", "div { font-size: 2em } p { font-size: 2em }", `<div><p id="e">a</p></div>`, "64px"},
+		{"negative calc inherits", "div { font-size: 20px } p { font-size: calc(10px - 20px) }", `<div><p id="e">a</p></div>`, "20px"},
+		{"invalid keeps earlier", "p { font-size: 12px; font-size: -1px }", `<p id="e">a</p>`, "12px"},
+	})
+	runComputedStyleTests(t, func(s *TagStyle) string { return s.Width }, []computedStyleTest{
+		{"em of the element", "div { font-size: 20px } p { font-size: 10px; width: 2em }", `<div><p id="e">a</p></div>`, "20px"},
+		{"pt", "p { width: 12pt }", `<p id="e">a</p>`, "16px"},
+		{"vw", "p { width: 50vw }", `<p id="e">a</p>`, "400px"},
+		{"vh", "p { width: 10vh }", `<p id="e">a</p>`, "60px"},
+		{"calc", "p { font-size: 10px; width: calc(2em + 3px) }", `<p id="e">a</p>`, "23px"},
+		{"calc with percentage", "p { width: calc(100% - 2em) }", `<p id="e">a</p>`, "calc(100% - 32px)"},
+	})
+	runComputedStyleTests(t, func(s *TagStyle) string { return s.LineHeight }, []computedStyleTest{
+		{"number", "p { line-height: 1.5 }", `<p id="e">a</p>`, "1.5"},
+		{"percentage of the font size", "p { font-size: 20px; line-height: 150% }", `<p id="e">a</p>`, "30px"},
+		{"em", "p { font-size: 20px; line-height: 2em }", `<p id="e">a</p>`, "40px"},
+		{"inherited percentage", "div { font-size: 20px; line-height: 150% } p { font-size: 10px }", `<div><p id="e">a</p></div>`, "30px"},
+	})
+}
+
+func TestViewportUnits(t *testing.T) {
+	r := &Renderer{ViewportWidth: 400, ViewportHeight: 1000}
+	body := layoutHTML(t, r, `<html><body><p id="e" style="width: 50vw; height: 10vh; margin-left: 5vmin; margin-right: 1vmax"></p></body></html>`)
+	style := findDom(body, "e").TagStyle
+	got := []string{style.Width, style.Height, style.Margin.Left, style.Margin.Right}
+	want := []string{"200px", "100px", "20px", "10px"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("lengths = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestLengthLayout(t *testing.T) {
+	runBoxTests(t, []boxTest{
+		{"em width", "body { margin: 0 } div { font-size: 10px; width: 5em; height: 2em }", `<div id="a"></div>`,
+			map[string]Rectangle{"a": {X1: 0, Y1: 0, X2: 49, Y2: 19}}},
+		{"calc width", "body { margin: 0 } div { width: calc(50% - 100px); height: 10px }", `<div id="a"></div>`,
+			map[string]Rectangle{"a": {X1: 0, Y1: 0, X2: 299, Y2: 9}}},
+		{"percentage margin", "body { margin: 0 } div { margin-left: 10%; height: 10px }", `<div id="a"></div>`,
+			map[string]Rectangle{"a": {X1: 80, Y1: 0, X2: 799, Y2: 9}}},
+		{"min and max", "body { margin: 0 } div { width: max(10%, 100px); height: min(5px, 1em) }", `<div id="a"></div>`,
+			map[string]Rectangle{"a": {X1: 0, Y1: 0, X2: 99, Y2: 4}}},
+	})
+}
+
+func TestRenderInvalidLengths(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"unknown font size", styledDocument("p { font-size: huge } span { font-size: 50% }", "<p>a <span>b</span></p>")},
+		{"percentages of an unknown size", styledDocument("div { position: absolute } p { width: 50%; margin-left: -10%; font-size: 150% }", "<div><p>a</p></div>")},
+		{"negative sizes", styledDocument("p { font-size: calc(0px - 10px); line-height: calc(0px - 5px); width: calc(0px - 5px) }", "<p>a</p>")},
+	})
+}
@@ -0,0 +1,212 @@
+package html2img
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var listStyleTypes = map[string]bool{
+	"disc": true, "circle": true, "square": true, "decimal": true,
+	"lower-alpha": true, "upper-alpha": true, "lower-latin": true, "upper-latin": true,
+	"lower-roman": true, "upper-roman": true, "cjk-decimal": true, "none": true,
+}
+
+// setListStyle sets the list-style shorthand. The values it leaves out are
+// reset to their initial value.
+func setListStyle(tagStyle *TagStyle, value string) {
+	tagStyle.ListStyleType = "disc"
+	tagStyle.ListStylePosition = "outside"
+	tagStyle.ListStyleImage = "none"
+	for _, attr := range strings.Fields(value) {
+		switch {
+		case attr == "inside" || attr == "outside":
+			tagStyle.ListStylePosition = attr
+		case strings.HasPrefix(attr, "url("):
+			tagStyle.ListStyleImage = attr
+		case listStyleTypes[attr]:
+			tagStyle.ListStyleType = attr
+		default:
+			// Unsupported list style types are disc
+			tagStyle.ListStyleType = "disc"
+		}
+	}
+}
+
+// defaultListStyleType returns the list-style-type of an element without one,
+// or "" when it inherits the one of its parent.
+func defaultListStyleType(tagName string) string {
+	switch tagName {
+	case "ol":
+		return "decimal"
+	case "ul", "menu":
+		return "disc"
+	}
+	return ""
+}
+
+// counterText returns the representation of a counter value in a counter
+// style.
+func counterText(listStyleType string, value int) string {
+	switch listStyleType {
+	case "none":
+		return ""
+	case "", "disc":
+		return "•"
+	case "circle":
+		return "◦"
+	case "square":
+		return "▪"
+	case "lower-alpha", "lower-latin":
+		return alphabeticCounter(value, 'a')
+	case "upper-alpha", "upper-latin":
+		return alphabeticCounter(value, 'A')
+	case "lower-roman":
+		return strings.ToLower(romanCounter(value))
+	case "upper-roman":
+		return romanCounter(value)
+	case "cjk-decimal":
+		return cjkDecimalCounter(value)
+	}
+	return strconv.Itoa(value)
+}
+
+// markerText returns the text of the marker of a list item numbered value,
+// followed by the suffix separating it from the content.
+func markerText(listStyleType string, value int) string {
+	switch listStyleType {
+	case "none":
+		return ""
+	case "", "disc", "circle", "square":
+		return counterText(listStyleType, value) + " "
+	case "cjk-decimal":
+		return counterText(listStyleType, value) + "、"
+	}
+	return counterText(listStyleType, value) + ". "
+}
+
+// alphabeticCounter returns value in the bijective base 26 of the letters
+// starting at first: a, b, ..., z, aa, ab, ...
+func alphabeticCounter(value int, first rune) string {
+	if value < 1 {
+		return strconv.Itoa(value)
+	}
+	var letters []rune
+	for ; value > 0; value = (value - 1) / 26 {
+		letters = append([]rune{first + rune((value-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+func romanCounter(value int) string {
+	if value < 1 || value > 3999 {
+		return strconv.Itoa(value)
+	}
+	numerals := []struct {
+		value  int
+		symbol string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+		{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+	var roman strings.Builder
+	for _, numeral := range numerals {
+		for ; value >= numeral.value; value -= numeral.value {
+			roman.WriteString(numeral.symbol)
+		}
+	}
+	return roman.String()
+}
+
+func cjkDecimalCounter(value int) string {
+	digits := []rune("〇一二三四五六七八九")
+	var cjk strings.Builder
+	for _, r := range strconv.Itoa(value) {
+		if r >= '0' && r <= '9' {
+			cjk.WriteRune(digits[r-'0'])
+		} else {
+			cjk.WriteRune(r)
+		}
+	}
+	return cjk.String()
+}
+
+// addMarker inserts the marker of the list item d numbered value. The marker
+// is an inline-block on the first line of the item: inside the content when
+// list-style-position is inside, otherwise pulled out in front of it by a
+// negative margin.
+func addMarker(d *Dom, value int) {
+	style := d.TagStyle
+	marker := &Dom{
+		DomType:  DOM_TYPE_ELEMENT,
+		TagName:  "::marker",
+		TagStyle: getInheritStyle(style, &TagStyle{Display: "inline-block", TextAlign: "left"}),
+	}
+	var width float64
+	img, hasImage := ImageData{}, false
+	if src := cssURL(style.ListStyleImage); src != "" {
+		// The list-style-type is the marker when the image fails to load
+		img, hasImage = d.loadImage(src)
+	}
+	if hasImage {
+		image := &Dom{
+			DomType:  DOM_TYPE_ELEMENT,
+			TagName:  "img",
+			TagData:  img,
+			TagStyle: getInheritStyle(marker.TagStyle, &TagStyle{Display: "inline"}),
+			parent:   marker,
+		}
+		imageWidth, _ := image.imageSize(0)
+		width = float64(imageWidth) + measureText(marker.TagStyle, " ")
+		marker.Children = []*Dom{image}
+	} else {
+		text := markerText(style.ListStyleType, value)
+		if text == "" {
+			return
+		}
+		width = measureText(marker.TagStyle, text)
+		marker.Children = []*Dom{{
+			DomType:  DOM_TYPE_TEXT,
+			TagData:  strings.TrimRight(text, " "),
+			TagStyle: getInheritStyle(marker.TagStyle, nil),
+			parent:   marker,
+		}}
+	}
+	markerWidth := int(math.Ceil(width))
+	marker.TagStyle.Width = fmt.Sprintf("%dpx", markerWidth)
+
+	parent := d
+	if style.ListStylePosition != "inside" {
+		marker.TagStyle.Margin.Left = fmt.Sprintf("-%dpx", markerWidth)
+		parent = markerParent(d)
+	}
+	marker.parent = parent
+	parent.Children = append([]*Dom{marker}, parent.Children...)
+}
+
+// markerParent returns the box an outside marker of the list item d goes in:
+// the first block of the item holding its first line.
+func markerParent(d *Dom) *Dom {
+	for {
+		var first *Dom
+		for _, child := range d.Children {
+			if child.isPositionAbsolute() || child.isFloat() {
+				continue
+			}
+			if child.DomType == DOM_TYPE_TEXT && strings.Trim(child.TagData.(string), CUT_SET_LIST) == "" {
+				continue
+			}
+			first = child
+			break
+		}
+		if first == nil || first.DomType != DOM_TYPE_ELEMENT || first.TagStyle.Display != "block" || first.establishesBFC() {
+			return d
+		}
+		d = first
+	}
+}
+
+func (d *Dom) isOutsideMarker() bool {
+	return d.TagName == "::marker" && d.TagStyle.ListStylePosition != "inside"
+}
@@ -0,0 +1,150 @@
+package html2img
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestCounterText(t *testing.T) {
+	tests := []struct {
+		listStyleType string
+		value         int
+		want          string
+	}{
+		{"decimal", 7, "7"},
+		{"disc", 7, "•"},
+		{"circle", 1, "◦"},
+		{"square", 1, "▪"},
+		{"none", 1, ""},
+		{"lower-alpha", 1, "a"},
+		{"lower-alpha", 26, "z"},
+		{"lower-alpha", 27, "aa"},
+		{"upper-latin", 28, "AB"},
+		{"lower-alpha", 0, "0"},
+		{"upper-roman", 1994, "MCMXCIV"},
+		{"lower-roman", 4, "iv"},
+		{"upper-roman", 4000, "4000"},
+		{"cjk-decimal", 105, "一〇五"},
+	}
+	for _, test := range tests {
+		if got := counterText(test.listStyleType, test.value); got != test.want {
+			t.Errorf("counterText(%q, %v) = %q, want %q", test.listStyleType, test.value, got, test.want)
+		}
+	}
+}
+
+func TestSetListStyle(t *testing.T) {
+	tests := []struct {
+		value                        string
+		wantType, wantPos, wantImage string
+	}{
+		{"square", "square", "outside", "none"},
+		{"inside upper-roman", "upper-roman", "inside", "none"},
+		{"url(a.png) inside", "disc", "inside", "url(a.png)"},
+		{"hebrew", "disc", "outside", "none"},
+		{"none", "none", "outside", "none"},
+	}
+	for _, test := range tests {
+		style := &TagStyle{ListStyleType: "decimal"}
+		setListStyle(style, test.value)
+		if style.ListStyleType != test.wantType || style.ListStylePosition != test.wantPos || style.ListStyleImage != test.wantImage {
+			t.Errorf("list-style: %v = %q %q %q, want %q %q %q", test.value,
+				style.ListStyleType, style.ListStylePosition, style.ListStyleImage, test.wantType, test.wantPos, test.wantImage)
+		}
+	}
+}
+
+// findMarker returns the marker in the tree of d.
+func findMarker(d *Dom) *Dom {
+	if d.TagName == "::marker" {
+		return d
+	}
+	for _, ch := range d.Children {
+		if found := findMarker(ch); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// markerContent returns the text of a marker, or "img" for an image.
+func markerContent(marker *Dom) string {
+	for _, ch := range marker.Children {
+		if ch.DomType == DOM_TYPE_TEXT {
+			return ch.TagData.(string)
+		}
+		if ch.TagName == "img" {
+			return "img"
+		}
+	}
+	return ""
+}
+
+func TestListMarkers(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	loader := ResourceLoaderFunc(func(url string) ([]byte, error) {
+		if strings.HasSuffix(url, "dot.png") {
+			return pngData.Bytes(), nil
+		}
+		return nil, errors.New("not found")
+	})
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		// The marker is outside of the item box
+		outside bool
+		// Url of the image that fails to load
+		failed string
+	}{
+		{"ul", `<ul><li id="li">a</li></ul>`, "•", true, ""},
+		{"ol", `<ol><li>a</li><li id="li">b</li></ol>`, "2.", true, ""},
+		{"start", `<ol start="5"><li id="li">a</li></ol>`, "5.", true, ""},
+		{"value", `<ol><li value="9" id="li">a</li></ol>`, "9.", true, ""},
+		{"reversed", `<ol reversed><li id="li">a</li><li>b</li></ol>`, "2.", true, ""},
+		{"type", `<ol style="list-style-type: upper-roman"><li>a</li><li>b</li><li id="li">c</li></ol>`, "III.", true, ""},
+		{"inside", `<ul style="list-style-position: inside"><li id="li">a</li></ul>`, "•", false, ""},
+		{"unknown type", `<ol style="list-style: hebrew"><li id="li">a</li></ol>`, "•", true, ""},
+		{"image", `<ul style="list-style-image: url(dot.png)"><li id="li">a</li></ul>`, "img", true, ""},
+		{"missing image", `<ul style="list-style-image: url(missing.png)"><li id="li">a</li></ul>`, "•", true, "missing.png"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var failed []string
+			r := &Renderer{Loader: loader, OnLoadError: func(url string, err error) {
+				failed = append(failed, url)
+			}}
+			body := layoutHTML(t, r, "<body>"+test.content+"</body>")
+			li := findDom(body, "li")
+			marker := findMarker(li)
+			if marker == nil {
+				t.Fatal("no marker")
+			}
+			if got := markerContent(marker); got != test.want {
+				t.Errorf("marker = %q, want %q", got, test.want)
+			}
+			if outside := marker.Container.X2 < li.Inner.X1; outside != test.outside {
+				t.Errorf("marker %+v outside of %+v = %v, want %v", marker.Container, li.Inner, outside, test.outside)
+			}
+			if strings.Join(failed, " ") != test.failed {
+				t.Errorf("failed to load %q, want %q", failed, test.failed)
+			}
+		})
+	}
+}
+
+func TestRenderLists(t *testing.T) {
+	runRenderTests(t, &Renderer{Loader: ResourceLoaderFunc(func(string) ([]byte, error) {
+		return []byte("not an image"), nil
+	})}, []renderTest{
+		{"nested", styledDocument("", "<ul><li>a<ol><li>b</li></ol></li></ul>")},
+		{"undecodable image", styledDocument("", `<ul style="list-style-image: url(a.png)"><li>a</li></ul>`)},
+		{"invalid types", styledDocument("", `<ol style="list-style-type: foo; list-style: url("><li>a</li></ol>`)},
+		{"empty items", styledDocument("", "<ol><li></li><li><div></div></li></ol>")},
+	})
+}
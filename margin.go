@@ -0,0 +1,86 @@
+package html2img
+
+// marginStrut collects adjoining vertical margins. They collapse into the
+// largest positive margin plus the most negative one.
+type marginStrut struct {
+	positive int
+	negative int
+}
+
+func (m *marginStrut) append(margin int) {
+	if margin > m.positive {
+		m.positive = margin
+	}
+	if margin < m.negative {
+		m.negative = margin
+	}
+}
+
+func (m *marginStrut) join(other marginStrut) {
+	m.append(other.positive)
+	m.append(other.negative)
+}
+
+func (m marginStrut) collapsed() int {
+	return m.positive + m.negative
+}
+
+// blockFlow holds the margins that are still pending between block boxes
+// stacked in a parent.
+type blockFlow struct {
+	strut marginStrut
+
+	// Nothing has been placed in the flow yet
+	leading bool
+	// Leading margins collapse with the parent's top margin
+	collapseTop bool
+	topMargin   marginStrut
+}
+
+// resolve places the pending margins in front of the next in-flow box and
+// returns the distance it has to move down.
+func (f *blockFlow) resolve() int {
+	offset := 0
+	if f.leading && f.collapseTop {
+		f.topMargin = f.strut
+	} else {
+		offset = f.strut.collapsed()
+	}
+	f.strut = marginStrut{}
+	f.leading = false
+	return offset
+}
+
+func (d *Dom) canCollapseMarginTop() bool {
+	style := d.TagStyle
+	if (style.Display != "block" && style.Display != "list-item") || d.establishesBFC() {
+		return false
+	}
+	return getIntSize(style.Padding.Top) == 0 && !hasBorder(style.BorderStyle.Top, style.BorderWidth.Top)
+}
+
+func (d *Dom) canCollapseMarginBottom() bool {
+	return d.isAutoHeight() && d.hasAdjoiningBottom()
+}
+
+// canCollapseThrough reports whether the top and bottom margins of d collapse
+// together when it has no in-flow content: its height is zero or auto.
+func (d *Dom) canCollapseThrough() bool {
+	height := d.TagStyle.Height
+	zeroHeight := d.isAutoHeight() || (isLength(height, false, false) && getIntSize(height) == 0)
+	return zeroHeight && d.hasAdjoiningBottom()
+}
+
+// hasAdjoiningBottom reports whether the bottom margin of d adjoins the
+// bottom margin of its last child, but for its height.
+func (d *Dom) hasAdjoiningBottom() bool {
+	style := d.TagStyle
+	if (style.Display != "block" && style.Display != "list-item") || d.establishesBFC() {
+		return false
+	}
+	return getIntSize(style.Padding.Bottom) == 0 && !hasBorder(style.BorderStyle.Bottom, style.BorderWidth.Bottom)
+}
+
+func hasBorder(borderStyle, borderWidth string) bool {
+	return borderStyle != "" && borderStyle != "none" && getIntSize(borderWidth) > 0
+}
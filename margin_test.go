@@ -0,0 +1,75 @@
+package html2img
+
+import "testing"
+
+func TestMarginCollapsing(t *testing.T) {
+	css := "body { margin: 0 } div { height: 10px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "siblings",
+			css:     css,
+			content: `<div id="a" style="margin-bottom: 20px"></div><div id="b" style="margin-top: 10px"></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 799, 9}, "b": {0, 30, 799, 39}},
+		},
+		{
+			name:    "negative",
+			css:     css,
+			content: `<div id="a" style="margin-bottom: 20px"></div><div id="b" style="margin-top: -5px"></div>`,
+			want:    map[string]Rectangle{"b": {0, 25, 799, 34}},
+		},
+		{
+			name:    "both negative",
+			css:     css,
+			content: `<div id="a" style="margin-bottom: -5px"></div><div id="b" style="margin-top: -8px"></div>`,
+			want:    map[string]Rectangle{"b": {0, 2, 799, 11}},
+		},
+		{
+			name:    "parent and first child",
+			css:     css,
+			content: `<div id="p" style="height: auto; margin-top: 10px"><div id="c" style="margin-top: 30px"></div></div>`,
+			want:    map[string]Rectangle{"p": {0, 30, 799, 39}, "c": {0, 30, 799, 39}},
+		},
+		{
+			name:    "padding separates",
+			css:     css,
+			content: `<div id="p" style="height: auto; margin-top: 10px; padding-top: 1px"><div id="c" style="margin-top: 30px"></div></div>`,
+			want:    map[string]Rectangle{"p": {0, 10, 799, 50}, "c": {0, 41, 799, 50}},
+		},
+		{
+			name:    "parent and last child",
+			css:     css,
+			content: `<div id="p" style="height: auto"><div id="c" style="margin-bottom: 30px"></div></div><div id="b" style="margin-top: 10px"></div>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 9}, "b": {0, 40, 799, 49}},
+		},
+		{
+			name:    "fixed height parent",
+			css:     css,
+			content: `<div id="p" style="height: 20px"><div style="margin-bottom: 30px"></div></div><div id="b"></div>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 19}, "b": {0, 20, 799, 29}},
+		},
+		{
+			name:    "empty block",
+			css:     css,
+			content: `<div id="a"></div><div style="height: auto; margin: 10px 0 20px"></div><div id="b" style="margin-top: 5px"></div>`,
+			want:    map[string]Rectangle{"b": {0, 30, 799, 39}},
+		},
+		{
+			name:    "zero height block",
+			css:     css,
+			content: `<div style="height: 0; margin: 10px 0 20px"></div><div id="b"></div>`,
+			want:    map[string]Rectangle{"b": {0, 20, 799, 29}},
+		},
+		{
+			name:    "block formatting context",
+			css:     css,
+			content: `<div id="p" style="height: auto; overflow: hidden"><div id="c" style="margin-top: 30px"></div></div>`,
+			want:    map[string]Rectangle{"p": {0, 0, 799, 39}, "c": {0, 30, 799, 39}},
+		},
+		{
+			name:    "inline-block",
+			css:     css,
+			content: `<div id="a" style="margin-bottom: 20px"></div><div id="b" style="display: inline-block; width: 50px; margin-top: 10px"></div>`,
+			want:    map[string]Rectangle{"b": {0, 40, 49, 49}},
+		},
+	})
+}
@@ -0,0 +1,362 @@
+package html2img
+
+import (
+	"strings"
+)
+
+// mediaContext is the environment media queries are evaluated against.
+type mediaContext struct {
+	// Size of the viewport in px
+	width  int
+	height int
+	dpr    float64
+	// light or dark
+	colorScheme string
+}
+
+var defaultMedia = &mediaContext{width: 800, height: 600, dpr: 1, colorScheme: "light"}
+
+// media returns the environment of the media queries of the documents r
+// renders.
+func (r *Renderer) media() *mediaContext {
+	media := *defaultMedia
+	if r.ViewportWidth > 0 {
+		media.width = r.ViewportWidth
+	}
+	if r.ViewportHeight > 0 {
+		media.height = r.ViewportHeight
+	}
+	if r.DevicePixelRatio > 0 {
+		media.dpr = r.DevicePixelRatio
+	}
+	if r.ColorScheme != "" {
+		media.colorScheme = r.ColorScheme
+	}
+	return &media
+}
+
+// matches reports whether the media query list of a media attribute matches.
+func (m *mediaContext) matches(query string) bool {
+	return m.matchQueryList(parseComponentValues(tokenizeCSS(query)))
+}
+
+// matchQueryList reports whether a comma separated list of media queries
+// matches, an empty list matching every environment.
+func (m *mediaContext) matchQueryList(values []componentValue) bool {
+	if len(trimWhitespace(values)) == 0 {
+		return true
+	}
+	start := 0
+	for i := 0; i <= len(values); i++ {
+		if i < len(values) && values[i].token.kind != tokenComma {
+			continue
+		}
+		if m.matchQuery(withoutWhitespace(values[start:i])) {
+			return true
+		}
+		start = i + 1
+	}
+	return false
+}
+
+func withoutWhitespace(values []componentValue) []componentValue {
+	var result []componentValue
+	for _, v := range values {
+		if v.token.kind != tokenWhitespace {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func isIdent(v componentValue, name string) bool {
+	return v.token.kind == tokenIdent && strings.EqualFold(v.token.value, name)
+}
+
+// matchQuery evaluates a media query: a media type with an optional not or
+// only and an optional condition after and, or a condition alone. Invalid
+// queries do not match.
+func (m *mediaContext) matchQuery(values []componentValue) bool {
+	if len(values) == 0 || values[0].token.kind != tokenIdent {
+		return m.matchCondition(values, true)
+	}
+	negate := false
+	if isIdent(values[0], "not") || isIdent(values[0], "only") {
+		negate = isIdent(values[0], "not")
+		values = values[1:]
+		if len(values) == 0 {
+			return false
+		}
+		if negate && values[0].token.kind == tokenOpenParen {
+			// not followed by a condition
+			return !m.matchCondition(values, true) && validCondition(values)
+		}
+		if values[0].token.kind != tokenIdent {
+			return false
+		}
+	}
+	matched := false
+	switch strings.ToLower(values[0].token.value) {
+	case "all", "screen":
+		matched = true
+	case "print", "speech":
+	case "and", "or", "not", "only", "layer":
+		// Reserved words are not media types
+		return false
+	}
+	if len(values) > 1 {
+		if len(values) < 3 || !isIdent(values[1], "and") {
+			return false
+		}
+		if !validCondition(values[2:]) {
+			return false
+		}
+		matched = matched && m.matchCondition(values[2:], false)
+	}
+	return matched != negate
+}
+
+// validCondition reports whether values is a condition made of parenthesized
+// conditions and features joined by and or or.
+func validCondition(values []componentValue) bool {
+	if len(values) == 2 && isIdent(values[0], "not") {
+		return values[1].token.kind == tokenOpenParen
+	}
+	for i, v := range values {
+		if i%2 == 0 && v.token.kind != tokenOpenParen {
+			return false
+		}
+		if i%2 == 1 && !isIdent(v, "and") && !isIdent(v, "or") {
+			return false
+		}
+	}
+	return len(values)%2 == 1
+}
+
+// matchCondition evaluates a media condition. Conditions after a media type
+// may not use or.
+func (m *mediaContext) matchCondition(values []componentValue, allowOr bool) bool {
+	if !validCondition(values) {
+		return false
+	}
+	if isIdent(values[0], "not") {
+		return !m.matchInParens(values[1])
+	}
+	result := m.matchInParens(values[0])
+	for i := 1; i+1 < len(values); i += 2 {
+		if isIdent(values[i], "or") != isIdent(values[1], "or") || (!allowOr && isIdent(values[i], "or")) {
+			// and and or may not be mixed without parentheses
+			return false
+		}
+		if isIdent(values[i], "or") {
+			result = result || m.matchInParens(values[i+1])
+		} else {
+			result = result && m.matchInParens(values[i+1])
+		}
+	}
+	return result
+}
+
+// matchInParens evaluates a parenthesized condition or media feature.
+func (m *mediaContext) matchInParens(v componentValue) bool {
+	values := withoutWhitespace(v.children)
+	if len(values) == 0 {
+		return false
+	}
+	if values[0].token.kind == tokenOpenParen || isIdent(values[0], "not") {
+		return m.matchCondition(values, true)
+	}
+	return m.matchFeature(values)
+}
+
+// matchFeature evaluates a media feature: a boolean feature, a feature with
+// a value and optional min- or max- prefix, or a range.
+func (m *mediaContext) matchFeature(values []componentValue) bool {
+	if len(values) == 1 {
+		if values[0].token.kind != tokenIdent {
+			return false
+		}
+		value, _, ok := m.feature(strings.ToLower(values[0].token.value))
+		return ok && value != 0
+	}
+	if values[0].token.kind == tokenIdent && values[1].token.kind == tokenColon {
+		name := strings.ToLower(values[0].token.value)
+		op := "="
+		for _, prefix := range []string{"min-", "max-"} {
+			vendor := ""
+			if strings.HasPrefix(name, "-webkit-") {
+				vendor = "-webkit-"
+			}
+			if strings.HasPrefix(name, vendor+prefix) {
+				name = vendor + strings.TrimPrefix(name, vendor+prefix)
+				op = map[string]string{"min-": ">=", "max-": "<="}[prefix]
+			}
+		}
+		return m.compareFeature(name, op, values[2:], false)
+	}
+	// A range: name op value, value op name or value op name op value
+	for i, v := range values {
+		if v.token.kind != tokenIdent {
+			continue
+		}
+		name := strings.ToLower(v.token.value)
+		if _, _, ok := m.feature(name); !ok {
+			continue
+		}
+		before, after := values[:i], values[i+1:]
+		matched := true
+		if len(before) > 0 {
+			op, value := splitComparison(before, true)
+			matched = op != "" && m.compareFeature(name, op, value, true)
+		}
+		if len(after) > 0 {
+			op, value := splitComparison(after, false)
+			matched = matched && op != "" && m.compareFeature(name, op, value, false)
+		}
+		return matched && (len(before) > 0 || len(after) > 0)
+	}
+	return false
+}
+
+// splitComparison splits the comparison operator from the value it compares
+// a feature with, the value coming first when it is before the feature.
+func splitComparison(values []componentValue, valueFirst bool) (string, []componentValue) {
+	var op string
+	var delims []componentValue
+	if valueFirst {
+		for len(values) > 0 && values[len(values)-1].token.kind == tokenDelim {
+			delims = append([]componentValue{values[len(values)-1]}, delims...)
+			values = values[:len(values)-1]
+		}
+	} else {
+		for len(values) > 0 && values[0].token.kind == tokenDelim && values[0].token.value != "/" {
+			delims = append(delims, values[0])
+			values = values[1:]
+		}
+	}
+	for _, d := range delims {
+		op += d.token.value
+	}
+	switch op {
+	case "<", "<=", ">", ">=", "=":
+		return op, values
+	}
+	return "", nil
+}
+
+// compareFeature compares the value of the feature name with value, which is
+// on the left of op when reversed.
+func (m *mediaContext) compareFeature(name, op string, values []componentValue, reversed bool) bool {
+	actual, kind, ok := m.feature(name)
+	if !ok {
+		return false
+	}
+	if kind == "keyword" {
+		return op == "=" && len(values) == 1 && values[0].token.kind == tokenIdent &&
+			strings.EqualFold(values[0].token.value, m.keyword(name))
+	}
+	expected, ok := mediaValue(values, kind)
+	if !ok {
+		return false
+	}
+	left, right := actual, expected
+	if reversed {
+		left, right = expected, actual
+	}
+	switch op {
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	}
+	return left == right
+}
+
+// feature returns the value of a media feature and the kind of values it is
+// compared with.
+func (m *mediaContext) feature(name string) (float64, string, bool) {
+	switch name {
+	case "width":
+		return float64(m.width), "length", true
+	case "height":
+		return float64(m.height), "length", true
+	case "aspect-ratio":
+		return float64(m.width) / float64(maxInt(m.height, 1)), "ratio", true
+	case "resolution":
+		return m.dpr, "resolution", true
+	case "-webkit-device-pixel-ratio":
+		return m.dpr, "number", true
+	case "orientation", "prefers-color-scheme":
+		return 1, "keyword", true
+	case "color":
+		// Bits per color component
+		return 8, "number", true
+	}
+	return 0, "", false
+}
+
+func (m *mediaContext) keyword(name string) string {
+	if name == "orientation" {
+		if m.height >= m.width {
+			return "portrait"
+		}
+		return "landscape"
+	}
+	return m.colorScheme
+}
+
+// mediaLengthUnits are the px in a unit of the lengths of media features,
+// whose em is the 16px initial font size.
+var mediaLengthUnits = map[string]float64{
+	"px": 1, "em": 16, "rem": 16, "in": 96, "cm": 96 / 2.54, "mm": 96 / 25.4,
+	"q": 96 / 101.6, "pt": 96.0 / 72, "pc": 16,
+}
+
+// mediaValue parses the value a feature of the kind is compared with.
+func mediaValue(values []componentValue, kind string) (float64, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+	token := values[0].token
+	switch kind {
+	case "length":
+		if token.kind == tokenNumber && token.num == 0 && len(values) == 1 {
+			return 0, true
+		}
+		if unit, ok := mediaLengthUnits[strings.ToLower(token.value)]; ok && token.kind == tokenDimension && len(values) == 1 {
+			return token.num * unit, true
+		}
+	case "resolution":
+		if token.kind != tokenDimension || len(values) != 1 {
+			return 0, false
+		}
+		switch strings.ToLower(token.value) {
+		case "dppx", "x":
+			return token.num, true
+		case "dpi":
+			return token.num / 96, true
+		case "dpcm":
+			return token.num * 2.54 / 96, true
+		}
+	case "number":
+		if token.kind == tokenNumber && len(values) == 1 {
+			return token.num, true
+		}
+	case "ratio":
+		if token.kind != tokenNumber {
+			return 0, false
+		}
+		if len(values) == 1 {
+			return token.num, true
+		}
+		if len(values) == 3 && values[1].token.kind == tokenDelim && values[1].token.value == "/" &&
+			values[2].token.kind == tokenNumber && values[2].token.num != 0 {
+			return token.num / values[2].token.num, true
+		}
+	}
+	return 0, false
+}
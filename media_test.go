@@ -0,0 +1,142 @@
+package html2img
+
+import "testing"
+
+func TestMediaQueries(t *testing.T) {
+	media := &mediaContext{width: 800, height: 600, dpr: 2, colorScheme: "dark"}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"all", true},
+		{"screen", true},
+		{"SCREEN", true},
+		{"print", false},
+		{"tv", false},
+		{"only screen", true},
+		{"not print", true},
+		{"not screen", false},
+		{"print, screen", true},
+		{"print, tv", false},
+		{"(min-width: 800px)", true},
+		{"(min-width: 801px)", false},
+		{"(max-width: 50em)", true},
+		{"(max-width: 49em)", false},
+		{"(width: 800px)", true},
+		{"(width > 799px)", true},
+		{"(width < 800px)", false},
+		{"(600px <= width <= 800px)", true},
+		{"(800px < width)", false},
+		{"(height: 600px)", true},
+		{"(min-height: 0)", true},
+		{"(width)", true},
+		{"(orientation: landscape)", true},
+		{"(orientation: portrait)", false},
+		{"(aspect-ratio: 4/3)", true},
+		{"(min-aspect-ratio: 16/9)", false},
+		{"(resolution: 2dppx)", true},
+		{"(min-resolution: 192dpi)", true},
+		{"(min-resolution: 3x)", false},
+		{"(-webkit-min-device-pixel-ratio: 2)", true},
+		{"(prefers-color-scheme: dark)", true},
+		{"(prefers-color-scheme: light)", false},
+		{"(color)", true},
+		{"screen and (min-width: 600px)", true},
+		{"screen and (min-width: 600px) and (max-width: 700px)", false},
+		{"print and (min-width: 600px)", false},
+		{"not screen and (max-width: 700px)", true},
+		{"(max-width: 700px) or (orientation: landscape)", true},
+		{"not (max-width: 700px)", true},
+		{"((min-width: 600px) and (max-width: 900px))", true},
+		{"screen and (max-width: 700px) or (orientation: landscape)", false},
+		{"(max-width: 700px) and (color) or (width)", false},
+		{"(unknown-feature)", false},
+		{"(min-width: 10)", false},
+		{"(min-width)", false},
+		{"screen and", false},
+		{"and", false},
+		{"not", false},
+		{"only (color)", false},
+		{"garbage, screen", true},
+		{"{}", false},
+	}
+	for _, test := range tests {
+		if got := media.matches(test.query); got != test.want {
+			t.Errorf("%q matches %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestRendererMedia(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *Renderer
+		want *mediaContext
+	}{
+		{"default", &Renderer{}, defaultMedia},
+		{"viewport", &Renderer{ViewportWidth: 400, ViewportHeight: 900}, &mediaContext{width: 400, height: 900, dpr: 1, colorScheme: "light"}},
+		{"resolution and scheme", &Renderer{DevicePixelRatio: 3, ColorScheme: "dark"}, &mediaContext{width: 800, height: 600, dpr: 3, colorScheme: "dark"}},
+		{"negative values", &Renderer{ViewportWidth: -1, DevicePixelRatio: -2}, defaultMedia},
+	}
+	for _, test := range tests {
+		if got := test.r.media(); *got != *test.want {
+			t.Errorf("%v: media = %+v, want %+v", test.name, *got, *test.want)
+		}
+	}
+}
+
+func TestMediaRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       *Renderer
+		head    string
+		content string
+		want    string
+	}{
+		{"matching @media", &Renderer{}, "<style>@media screen { p { color: red } }</style>", `<p id="e">a</p>`, "red"},
+		{"not matching @media", &Renderer{}, "<style>@media print { p { color: red } }</style>", `<p id="e">a</p>`, ""},
+		{"nested @media", &Renderer{}, "<style>@media screen { @media (min-width: 500px) { p { color: red } } }</style>", `<p id="e">a</p>`, "red"},
+		{"viewport width", &Renderer{ViewportWidth: 400}, "<style>p { color: red } @media (max-width: 500px) { p { color: blue } }</style>", `<p id="e">a</p>`, "blue"},
+		{"wide viewport", &Renderer{ViewportWidth: 1000}, "<style>p { color: red } @media (max-width: 500px) { p { color: blue } }</style>", `<p id="e">a</p>`, "red"},
+		{"color scheme", &Renderer{ColorScheme: "dark"}, "<style>@media (prefers-color-scheme: dark) { p { color: white } }</style>", `<p id="e">a</p>`, "white"},
+		{"light color scheme", &Renderer{}, "<style>@media (prefers-color-scheme: dark) { p { color: white } }</style>", `<p id="e">a</p>`, ""},
+		{"device pixel ratio", &Renderer{DevicePixelRatio: 2}, "<style>@media (min-resolution: 2dppx) { p { color: red } }</style>", `<p id="e">a</p>`, "red"},
+		{"style media attribute", &Renderer{}, `<style media="print">p { color: red }</style>`, `<p id="e">a</p>`, ""},
+		{"matching style media attribute", &Renderer{}, `<style media="screen and (min-width: 100px)">p { color: red }</style>`, `<p id="e">a</p>`, "red"},
+		{"invalid @media", &Renderer{}, "<style>@media (min-width: foo) { p { color: red } } p { color: blue }</style>", `<p id="e">a</p>`, "blue"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := layoutHTML(t, test.r, "<html><head>"+test.head+"</head><body>"+test.content+"</body></html>")
+			if got := findDom(body, "e").TagStyle.Color; got != test.want {
+				t.Errorf("color = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLinkMedia(t *testing.T) {
+	r := &Renderer{
+		ViewportWidth: 400,
+		Loader: ResourceLoaderFunc(func(url string) ([]byte, error) {
+			return []byte("p { color: red }"), nil
+		}),
+	}
+	tests := []struct {
+		media string
+		want  string
+	}{
+		{"", "red"},
+		{"screen", "red"},
+		{"print", ""},
+		{"(max-width: 500px)", "red"},
+		{"(min-width: 500px)", ""},
+	}
+	for _, test := range tests {
+		body := layoutHTML(t, r, `<html><head><link rel="stylesheet" href="a.css" media="`+test.media+`"></head><body><p id="e">a</p></body></html>`)
+		if got := findDom(body, "e").TagStyle.Color; got != test.want {
+			t.Errorf("media %q: color = %q, want %q", test.media, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package html2img
+
+import (
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isMultiColumn reports whether the content of d is laid out in columns.
+func (d *Dom) isMultiColumn() bool {
+	if d.DomType != DOM_TYPE_ELEMENT || d.isFlexContainer() || d.isGridContainer() || d.isTable() || d.table != nil {
+		return false
+	}
+	return columnCount(d.TagStyle) > 0 || getIntSize(d.TagStyle.ColumnWidth) > 0
+}
+
+// columnCount returns the column-count of style, 0 when it is auto.
+func columnCount(style *TagStyle) int {
+	count, err := strconv.Atoi(strings.Trim(style.ColumnCount, CUT_SET_LIST))
+	if err != nil || count < 1 {
+		return 0
+	}
+	return count
+}
+
+// columnGap returns the gap between the columns of a multi-column container,
+// 1em when it is normal.
+func columnGap(style *TagStyle, avail int) int {
+	if style.ColumnGap == "" || style.ColumnGap == "normal" {
+		return int(getFontSize(style))
+	}
+	return getIntPx(style.ColumnGap, avail)
+}
+
+// columnBox returns the number and the width of the columns of a multi-column
+// container whose content box is avail wide, and the gap between them.
+func columnBox(style *TagStyle, avail int) (int, int, int) {
+	gap := columnGap(style, avail)
+	count := columnCount(style)
+	if minWidth := getIntSize(style.ColumnWidth); minWidth > 0 {
+		// As many columns of at least column-width as fit, at most
+		// column-count of them
+		fit := maxInt((avail+gap)/(minWidth+gap), 1)
+		if count == 0 || fit < count {
+			count = fit
+		}
+	}
+	width := maxInt((avail-(count-1)*gap)/count, 1)
+	return count, width, gap
+}
+
+// setColumns sets the columns shorthand: a column-width and a column-count in
+// any order. Invalid values are auto.
+func setColumns(tagStyle *TagStyle, value string) {
+	tagStyle.ColumnCount = "auto"
+	tagStyle.ColumnWidth = "auto"
+	for _, attr := range splitValues(value) {
+		if count, err := strconv.Atoi(attr); err == nil {
+			if count > 0 {
+				tagStyle.ColumnCount = attr
+			}
+			continue
+		}
+		if isLength(attr, false, false) {
+			tagStyle.ColumnWidth = attr
+		}
+	}
+}
+
+// setColumnRule sets the column-rule shorthand: a width, a style and a color
+// in any order, as the ones of a border. It returns false when value is not
+// a column rule.
+func setColumnRule(tagStyle *TagStyle, value string) bool {
+	width, style, color, ok := parseBorder(value)
+	if !ok {
+		return false
+	}
+	tagStyle.ColumnRuleWidth, tagStyle.ColumnRuleStyle, tagStyle.ColumnRuleColor = width, style, color
+	return true
+}
+
+// isFragmentable reports whether the content of a block in a column may be
+// split between columns.
+func (d *Dom) isFragmentable() bool {
+	display := d.TagStyle.Display
+	return d.DomType == DOM_TYPE_ELEMENT && (display == "block" || display == "list-item") &&
+		!d.establishesBFC() && d.TagName != "img"
+}
+
+func (d *Dom) isInFlowBlock() bool {
+	return d.DomType == DOM_TYPE_ELEMENT && !d.isInlineLevel() && !d.isFloat() && !d.isPositionAbsolute()
+}
+
+// columnBreaks returns the positions in the content of d where a column may
+// start: between its line boxes and in-flow blocks, and inside the blocks.
+func columnBreaks(d *Dom, breaks []int) []int {
+	var tops []int
+	for _, line := range d.lines {
+		tops = append(tops, line.top)
+	}
+	for _, child := range d.Children {
+		if !child.isInFlowBlock() {
+			continue
+		}
+		tops = append(tops, child.Container.Y1)
+		if child.isFragmentable() {
+			breaks = columnBreaks(child, breaks)
+		}
+	}
+	// There is no break before the first box
+	sort.Ints(tops)
+	if len(tops) > 0 {
+		breaks = append(breaks, tops[1:]...)
+	}
+	return breaks
+}
+
+// fillColumns returns the tops of the columns that content from top to bottom
+// fills when every column is height high, breaking it at breaks only.
+func fillColumns(breaks []int, top, bottom, height int) []int {
+	starts := []int{top}
+	for start := top; bottom >= start+height; {
+		next := -1
+		for _, b := range breaks {
+			if b > start && b <= start+height {
+				next = b
+			}
+		}
+		if next < 0 {
+			// Nothing fits: the column overflows to the next break
+			for _, b := range breaks {
+				if b > start {
+					next = b
+					break
+				}
+			}
+		}
+		if next < 0 {
+			break
+		}
+		starts = append(starts, next)
+		start = next
+	}
+	return starts
+}
+
+// balanceColumns returns the tops of count columns as short as the breaks
+// allow them to be.
+func balanceColumns(breaks []int, top, bottom, count int) []int {
+	total := bottom - top + 1
+	low, high := maxInt((total+count-1)/count, 1), maxInt(total, 1)
+	for low < high {
+		mid := (low + high) / 2
+		if len(fillColumns(breaks, top, bottom, mid)) <= count {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return fillColumns(breaks, top, bottom, low)
+}
+
+// columnLayout moves the boxes laid out in a single column into the columns
+// starting at starts.
+type columnLayout struct {
+	starts []int
+	top    int
+	step   int
+}
+
+// column returns the column the content at y is in.
+func (c *columnLayout) column(y int) int {
+	return sort.Search(len(c.starts), func(i int) bool { return c.starts[i] > y }) - 1
+}
+
+func (c *columnLayout) offset(column int) (int, int) {
+	return column * c.step, c.top - c.starts[column]
+}
+
+// distribute moves doms into their columns and returns the boxes in every
+// column. A block crossing a column break is split into a fragment in each of
+// the columns it is in.
+func (c *columnLayout) distribute(doms []*Dom) [][]*Dom {
+	columns := make([][]*Dom, len(c.starts))
+	for _, dom := range doms {
+		y := dom.Container.Y1
+		if dom.isInlineLevel() {
+			y = (dom.Container.Y1 + dom.Container.Y2) / 2
+		}
+		first := maxInt(c.column(y), 0)
+		last := maxInt(c.column(dom.Container.Y2), first)
+		if first == last || !dom.isFragmentable() {
+			dom.shift(c.offset(first))
+			columns[first] = append(columns[first], dom)
+			continue
+		}
+		pieces := c.distribute(dom.Children)
+		for column := first; column <= last; column++ {
+			frag := *dom
+			frag.Children = nil
+			for _, rect := range []*Rectangle{&frag.Outer, &frag.Container, &frag.Inwall, &frag.Inner} {
+				if column > first {
+					rect.Y1 = maxInt(rect.Y1, c.starts[column])
+				}
+				if column < last {
+					rect.Y2 = minInt(rect.Y2, c.starts[column+1]-1)
+				}
+			}
+			frag.shift(c.offset(column))
+			frag.Children = pieces[column]
+			columns[column] = append(columns[column], &frag)
+		}
+	}
+	return columns
+}
+
+// layoutColumns lays out the content of the multi-column container at the end
+// of parents in a single column, then splits it between columns of balanced
+// heights, or of the height of the container when it has one.
+func layoutColumns(parents []*Dom, cbHeight int) ([]*Dom, EndOffset) {
+	container := parents[len(parents)-1]
+	style := container.TagStyle
+	inner := container.Inner
+	count, width, gap := columnBox(style, inner.X2-inner.X1+1)
+	container.Inner.X2 = inner.X1 + width - 1
+	children, endOffset := layoutBlockFlow(parents, cbHeight)
+	container.Inner.X2 = inner.X2
+	container.Children = children
+
+	top := inner.Y1
+	bottom := endOffset.Y2
+	if container.floats != nil {
+		bottom = maxInt(bottom, container.floats.bottom()-1)
+	}
+	breaks := columnBreaks(container, nil)
+	var starts []int
+	if container.isAutoHeight() {
+		starts = balanceColumns(breaks, top, bottom, count)
+	} else {
+		starts = fillColumns(breaks, top, bottom, inner.Y2-inner.Y1+1)
+	}
+	layout := &columnLayout{starts: starts, top: top, step: width + gap}
+	columns := layout.distribute(children)
+
+	height := 0
+	children = nil
+	for i, column := range columns {
+		end := bottom + 1
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		height = maxInt(height, end-starts[i])
+		children = append(children, column...)
+	}
+
+	container.columnRules = nil
+	ruleWidth := getIntSize(style.ColumnRuleWidth)
+	if style.ColumnRuleStyle == "solid" && ruleWidth > 0 {
+		for i := 1; i < len(columns); i++ {
+			x := inner.X1 + i*(width+gap) - (gap+ruleWidth)/2
+			container.columnRules = append(container.columnRules, Rectangle{
+				X1: x, Y1: top, X2: x + ruleWidth - 1, Y2: top + height - 1,
+			})
+		}
+	}
+	return children, EndOffset{Y2: top + height - 1}
+}
+
+// drawColumnRules paints the rules between the columns of d.
+func drawColumnRules(dst *image.RGBA, d *Dom) {
+	if len(d.columnRules) == 0 {
+		return
+	}
+	ruleColor := getColor(d.TagStyle.ColumnRuleColor)
+	for _, rule := range d.columnRules {
+		for y := rule.Y1; y <= rule.Y2; y++ {
+			for x := rule.X1; x <= rule.X2; x++ {
+				setPixel(dst, x, y, ruleColor)
+			}
+		}
+	}
+}
+
+// intrinsicColumnsWidth returns the intrinsic widths of a multi-column
+// container from the ones of its content in a single column.
+func intrinsicColumnsWidth(dom *Dom, minWidth, maxWidth int) (int, int) {
+	style := dom.TagStyle
+	count := maxInt(columnCount(style), 1)
+	if columnWidth := getIntSize(style.ColumnWidth); columnWidth > 0 {
+		minWidth = maxInt(minWidth, columnWidth)
+		maxWidth = maxInt(maxWidth, columnWidth)
+	}
+	gaps := (count - 1) * columnGap(style, 0)
+	return count*minWidth + gaps, count*maxWidth + gaps
+}
@@ -0,0 +1,114 @@
+package html2img
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMultiColumnLayout(t *testing.T) {
+	css := "body { margin: 0 } .m { width: 300px } .m > div { height: 20px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "column-count",
+			css:     css,
+			content: `<div id="m" class="m" style="column-count: 2; column-gap: 20px"><div id="a"></div><div id="b"></div><div id="c"></div><div id="d"></div></div>`,
+			want:    map[string]Rectangle{"m": {0, 0, 299, 39}, "a": {0, 0, 139, 19}, "b": {0, 20, 139, 39}, "c": {160, 0, 299, 19}, "d": {160, 20, 299, 39}},
+		},
+		{
+			name:    "column-width",
+			css:     css,
+			content: `<div id="m" class="m" style="columns: 100px; column-gap: 0"><div id="a"></div><div id="b"></div><div id="c"></div></div>`,
+			want:    map[string]Rectangle{"m": {0, 0, 299, 19}, "a": {0, 0, 99, 19}, "b": {100, 0, 199, 19}, "c": {200, 0, 299, 19}},
+		},
+		{
+			name:    "fixed height",
+			css:     css,
+			content: `<div id="m" class="m" style="column-count: 2; column-gap: 0; height: 40px"><div id="a"></div><div id="b"></div><div id="c"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 149, 19}, "b": {0, 20, 149, 39}, "c": {150, 0, 299, 19}},
+		},
+		{
+			name:    "invalid values are auto",
+			css:     css,
+			content: `<div id="m" class="m" style="column-count: foo; column-width: -5px"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 299, 19}, "b": {0, 20, 299, 39}},
+		},
+		{
+			name:    "zero column count is auto",
+			css:     css,
+			content: `<div id="m" class="m" style="column-count: 0"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 299, 19}, "b": {0, 20, 299, 39}},
+		},
+		{
+			name:    "invalid shorthand parts are auto",
+			css:     css,
+			content: `<div id="m" class="m" style="columns: 0 foo; column-gap: 0"><div id="a"></div><div id="b"></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 299, 19}, "b": {0, 20, 299, 39}},
+		},
+	})
+}
+
+func TestSetColumns(t *testing.T) {
+	tests := []struct {
+		value                string
+		wantCount, wantWidth string
+	}{
+		{"3", "3", "auto"},
+		{"100px", "auto", "100px"},
+		{"100px 3", "3", "100px"},
+		{"3 100px", "3", "100px"},
+		{"auto", "auto", "auto"},
+		{"0", "auto", "auto"},
+		{"-2 -10px", "auto", "auto"},
+		{"foo", "auto", "auto"},
+	}
+	for _, test := range tests {
+		style := &TagStyle{}
+		setColumns(style, test.value)
+		if style.ColumnCount != test.wantCount || style.ColumnWidth != test.wantWidth {
+			t.Errorf("columns: %v = %q %q, want %q %q", test.value, style.ColumnCount, style.ColumnWidth, test.wantCount, test.wantWidth)
+		}
+	}
+}
+
+func TestSetColumnRule(t *testing.T) {
+	tests := []struct {
+		value                           string
+		ok                              bool
+		wantWidth, wantStyle, wantColor string
+	}{
+		{"1px solid red", true, "1px", "solid", "red"},
+		{"red dashed", true, "3px", "dashed", "red"},
+		{"thick", true, "5px", "none", "currentcolor"},
+		{"solid solid", false, "", "", ""},
+		{"1px solid red 2px", false, "", "", ""},
+		{"wavy", false, "", "", ""},
+	}
+	for _, test := range tests {
+		style := &TagStyle{}
+		ok := setTagStyle(style, "column-rule", test.value)
+		if ok != test.ok || style.ColumnRuleWidth != test.wantWidth || style.ColumnRuleStyle != test.wantStyle || style.ColumnRuleColor != test.wantColor {
+			t.Errorf("column-rule: %v = %v %q %q %q, want %v %q %q %q", test.value, ok,
+				style.ColumnRuleWidth, style.ColumnRuleStyle, style.ColumnRuleColor,
+				test.ok, test.wantWidth, test.wantStyle, test.wantColor)
+		}
+	}
+}
+
+func TestColumnRule(t *testing.T) {
+	css := "body { margin: 0; background-color: white } .m { width: 300px; column-count: 2; column-gap: 20px } .m > div { height: 20px }"
+	runPaintTests(t, []paintTest{
+		{
+			name:    "solid",
+			css:     css,
+			content: `<div class="m" style="column-rule: 2px solid blue"><div></div><div></div></div>`,
+			want:    map[image.Point]color.RGBA{{149, 10}: blue, {150, 10}: blue, {145, 10}: white},
+		},
+		{
+			name:    "none",
+			css:     css,
+			content: `<div class="m" style="column-rule: 2px none blue"><div></div><div></div></div>`,
+			want:    map[image.Point]color.RGBA{{149, 10}: white},
+		},
+	})
+}
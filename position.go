@@ -0,0 +1,195 @@
+package html2img
+
+// absoluteBox is an absolutely positioned dom together with the ancestors it
+// is laid out in.
+type absoluteBox struct {
+	dom     *Dom
+	parents []*Dom
+}
+
+func (d *Dom) isPositioned() bool {
+	switch d.TagStyle.Position {
+	case "relative", "absolute", "fixed":
+		return true
+	}
+	return false
+}
+
+// containingBlock returns the dom an absolutely positioned dom is placed in:
+// the nearest positioned ancestor, or the body for position fixed and when
+// there is none.
+func containingBlock(dom *Dom, parents []*Dom) *Dom {
+	if dom.TagStyle.Position != "fixed" {
+		for i := len(parents) - 1; i > 0; i-- {
+			if parents[i].isPositioned() {
+				return parents[i]
+			}
+		}
+	}
+	return parents[0]
+}
+
+// deferAbsolute records the static position of dom, where it would have been
+// in the flow, and leaves its layout to the containing block.
+func deferAbsolute(dom *Dom, parents []*Dom, staticX, staticY int) {
+	dom.Outer = Rectangle{X1: staticX, Y1: staticY, X2: staticX, Y2: staticY}
+	dom.Container = dom.Outer
+	dom.Inner = dom.Outer
+	cb := containingBlock(dom, parents)
+	box := absoluteBox{
+		dom:     dom,
+		parents: append([]*Dom(nil), parents...),
+	}
+	for i := range cb.absolutes {
+		if cb.absolutes[i].dom == dom {
+			// The dom is laid out again, as a flex item is measured
+			cb.absolutes[i] = box
+			return
+		}
+	}
+	cb.absolutes = append(cb.absolutes, box)
+}
+
+// layoutAbsolutes lays out the absolutely positioned doms waiting for d once
+// the size of d is known.
+func (d *Dom) layoutAbsolutes() {
+	cb := d.Container
+	if d.TagName == "body" {
+		// The initial containing block is the page, as wide as the body
+		// even when it has no width
+		cb = Rectangle{X2: d.Container.X2, Y2: d.Container.Y2}
+		if !d.isAutoHeight() {
+			cb.Y2 = getIntSize(d.TagStyle.Height) - 1
+		}
+	}
+	for len(d.absolutes) > 0 {
+		box := d.absolutes[0]
+		d.absolutes = d.absolutes[1:]
+		layoutAbsolute(box.dom, box.parents, cb)
+	}
+}
+
+func layoutAbsolute(dom *Dom, parents []*Dom, cb Rectangle) {
+	style := dom.TagStyle
+	cbWidth := cb.X2 - cb.X1 + 1
+	cbHeight := cb.Y2 - cb.Y1 + 1
+	staticX, staticY := dom.Outer.X1, dom.Outer.Y1
+
+	hasLeft, hasRight := hasOffset(style.Offset.Left), hasOffset(style.Offset.Right)
+	hasTop, hasBottom := hasOffset(style.Offset.Top), hasOffset(style.Offset.Bottom)
+	left := getIntPx(style.Offset.Left, cbWidth)
+	right := getIntPx(style.Offset.Right, cbWidth)
+	top := getIntPx(style.Offset.Top, cbHeight)
+	bottom := getIntPx(style.Offset.Bottom, cbHeight)
+
+	marginLeft := getIntPx(style.Margin.Left, cbWidth)
+	marginRight := getIntPx(style.Margin.Right, cbWidth)
+	marginTop := getIntPx(style.Margin.Top, cbWidth)
+	marginBottom := getIntPx(style.Margin.Bottom, cbWidth)
+	paddingLeft := getIntPx(style.Padding.Left, cbWidth)
+	paddingRight := getIntPx(style.Padding.Right, cbWidth)
+	paddingTop := getIntPx(style.Padding.Top, cbWidth)
+	paddingBottom := getIntPx(style.Padding.Bottom, cbWidth)
+
+	definiteWidth := style.Width != "" && !isAuto(style.Width)
+	var width int
+	switch {
+	case dom.TagName == "img":
+		width, _ = dom.imageSize(cbWidth)
+		definiteWidth = true
+	case definiteWidth:
+		width = getIntPx(style.Width, cbWidth)
+	case hasLeft && hasRight:
+		width = cbWidth - left - right - marginLeft - marginRight - paddingLeft - paddingRight
+	default:
+		// Shrink to fit the available space
+		available := cbWidth - marginLeft - marginRight - paddingLeft - paddingRight
+		switch {
+		case hasLeft:
+			available -= left
+		case hasRight:
+			available -= right
+		default:
+			available -= staticX - cb.X1
+		}
+		minWidth, maxWidth := intrinsicContentWidth(dom)
+		width = minInt(maxInt(minWidth, available), maxWidth)
+	}
+
+	x := staticX + marginLeft
+	switch {
+	case hasLeft && hasRight && definiteWidth:
+		marginLeft, _ = resolveAutoMargins(cbWidth-left-right, paddingLeft+width+paddingRight, style.Margin.Left, style.Margin.Right)
+		x = cb.X1 + left + marginLeft
+	case hasLeft:
+		x = cb.X1 + left + marginLeft
+	case hasRight:
+		x = cb.X2 - right - marginRight - paddingRight - width - paddingLeft + 1
+	}
+	y := staticY + marginTop
+	if hasTop {
+		y = cb.Y1 + top + marginTop
+	}
+
+	dom.Container.X1 = x
+	dom.Container.X2 = x + paddingLeft + width + paddingRight - 1
+	dom.Container.Y1 = y
+	dom.Inner.X1 = x + paddingLeft
+	dom.Inner.X2 = dom.Inner.X1 + width - 1
+	dom.Inner.Y1 = y + paddingTop
+
+	definiteHeight := style.Height != "" && !isAuto(style.Height)
+	var height int
+	switch {
+	case dom.TagName == "img":
+		_, height = dom.imageSize(cbWidth)
+		definiteHeight = true
+	case definiteHeight:
+		height = getIntPx(style.Height, cbHeight)
+	case hasTop && hasBottom:
+		height = cbHeight - top - bottom - marginTop - marginBottom - paddingTop - paddingBottom
+	}
+	dom.Inner.Y2 = dom.Inner.Y1 + height - 1
+	if dom.TagName != "img" {
+		children, endOffset := getChildren(append(parents, dom))
+		dom.Children = children
+		if !definiteHeight && !(hasTop && hasBottom) {
+			dom.Inner.Y2 = endOffset.Y2
+			height = dom.Inner.Y2 - dom.Inner.Y1 + 1
+		}
+	}
+	dom.Container.Y2 = dom.Inner.Y2 + paddingBottom
+	dom.Outer = Rectangle{
+		X1: dom.Container.X1 - marginLeft,
+		Y1: dom.Container.Y1 - marginTop,
+		X2: dom.Container.X2 + marginRight,
+		Y2: dom.Container.Y2 + marginBottom,
+	}
+
+	switch {
+	case hasTop && hasBottom && definiteHeight:
+		marginTop, _ = resolveAutoMargins(cbHeight-top-bottom, paddingTop+height+paddingBottom, style.Margin.Top, style.Margin.Bottom)
+		dom.shift(0, cb.Y1+top+marginTop-dom.Container.Y1)
+	case !hasTop && hasBottom:
+		dom.shift(0, cb.Y2-bottom-marginBottom-dom.Container.Y2)
+	}
+	dom.layoutAbsolutes()
+}
+
+// relativeOffset returns how far a relatively positioned dom moves from its
+// place in the flow.
+func relativeOffset(dom *Dom, cbWidth, cbHeight int) (int, int) {
+	style := dom.TagStyle
+	var dx, dy int
+	if hasOffset(style.Offset.Left) {
+		dx = getIntPx(style.Offset.Left, cbWidth)
+	} else if hasOffset(style.Offset.Right) {
+		dx = -getIntPx(style.Offset.Right, cbWidth)
+	}
+	if hasOffset(style.Offset.Top) {
+		dy = getIntPx(style.Offset.Top, cbHeight)
+	} else if hasOffset(style.Offset.Bottom) {
+		dy = -getIntPx(style.Offset.Bottom, cbHeight)
+	}
+	return dx, dy
+}
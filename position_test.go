@@ -0,0 +1,84 @@
+package html2img
+
+import "testing"
+
+func TestPositioning(t *testing.T) {
+	css := "body { margin: 0 } div { height: 10px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "relative",
+			css:     css,
+			content: `<div id="a" style="position: relative; left: 10px; top: 5px"></div><div id="b"></div>`,
+			want:    map[string]Rectangle{"a": {10, 5, 809, 14}, "b": {0, 10, 799, 19}},
+		},
+		{
+			name:    "relative right bottom",
+			css:     css,
+			content: `<div id="a" style="position: relative; width: 100px; right: 10px; bottom: 5px"></div>`,
+			want:    map[string]Rectangle{"a": {-10, -5, 89, 4}},
+		},
+		{
+			name:    "relative moves descendants",
+			css:     css,
+			content: `<div style="position: relative; left: 10px; height: auto"><div id="c" style="width: 20px"></div></div>`,
+			want:    map[string]Rectangle{"c": {10, 0, 29, 9}},
+		},
+		{
+			name: "absolute in positioned ancestor",
+			css:  css,
+			content: `<div style="height: 50px"></div>` +
+				`<div id="p" style="position: relative; width: 200px; height: 100px; margin-left: 100px">` +
+				`<div id="a" style="position: absolute; left: 10px; top: 20px; width: 30px"></div></div>`,
+			want: map[string]Rectangle{"p": {100, 50, 299, 149}, "a": {110, 70, 139, 79}},
+		},
+		{
+			name: "absolute right bottom",
+			css:  css,
+			content: `<div id="p" style="position: relative; width: 200px; height: 100px">` +
+				`<div id="a" style="position: absolute; right: 10px; bottom: 20px; width: 30px"></div></div>`,
+			want: map[string]Rectangle{"a": {160, 70, 189, 79}},
+		},
+		{
+			name: "absolute stretched",
+			css:  css,
+			content: `<div id="p" style="position: relative; width: 200px; height: 100px">` +
+				`<div id="a" style="position: absolute; left: 10px; right: 20px; top: 0; bottom: 50px; height: auto"></div></div>`,
+			want: map[string]Rectangle{"a": {10, 0, 179, 49}},
+		},
+		{
+			name: "absolute percentages",
+			css:  css,
+			content: `<div id="p" style="position: relative; width: 200px; height: 100px">` +
+				`<div id="a" style="position: absolute; left: 50%; top: 10%; width: 25%; height: 50%"></div></div>`,
+			want: map[string]Rectangle{"a": {100, 10, 149, 59}},
+		},
+		{
+			name: "static position",
+			css:  css,
+			content: `<div id="p" style="position: relative; width: 200px; height: auto; padding: 5px">` +
+				`<div></div><div id="a" style="position: absolute; width: 30px"></div></div>`,
+			want: map[string]Rectangle{"a": {5, 15, 34, 24}},
+		},
+		{
+			name: "absolute out of flow",
+			css:  css,
+			content: `<div style="position: relative; height: auto">` +
+				`<div style="position: absolute; top: 0"></div><div id="b"></div></div>`,
+			want: map[string]Rectangle{"b": {0, 0, 799, 9}},
+		},
+		{
+			name: "initial containing block",
+			css:  css,
+			content: `<div style="margin-left: 100px; height: auto">` +
+				`<div id="a" style="position: absolute; right: 10px; top: 5px; width: 20px"></div></div>`,
+			want: map[string]Rectangle{"a": {770, 5, 789, 14}},
+		},
+		{
+			name: "fixed ignores positioned ancestors",
+			css:  css,
+			content: `<div style="position: relative; margin-left: 100px; width: 200px; height: 100px">` +
+				`<div id="a" style="position: fixed; left: 10px; top: 5px; width: 20px"></div></div>`,
+			want: map[string]Rectangle{"a": {10, 5, 29, 14}},
+		},
+	})
+}
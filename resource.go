@@ -0,0 +1,318 @@
+package html2img
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// ResourceLoader fetches the resources a document references, its linked and
+// imported stylesheets and its images.
+type ResourceLoader interface {
+	// Load returns the content at the absolute url
+	Load(url string) ([]byte, error)
+}
+
+// ResourceLoaderFunc is a function used as a ResourceLoader.
+type ResourceLoaderFunc func(url string) ([]byte, error)
+
+func (f ResourceLoaderFunc) Load(url string) ([]byte, error) {
+	return f(url)
+}
+
+// DefaultLoader fetches http and https urls. The files of the local file
+// system are only read by a FileLoader.
+var DefaultLoader ResourceLoader = ResourceLoaderFunc(loadResource)
+
+func loadResource(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme %v", rawURL)
+	}
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("load %v: %v", rawURL, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// FileLoader returns a loader reading the file urls and the urls without
+// scheme from the directory root, the urls without scheme being relative to
+// it. The files outside of root are not read. The http and https urls are
+// fetched as DefaultLoader does.
+func FileLoader(root string) ResourceLoader {
+	return ResourceLoaderFunc(func(rawURL string) ([]byte, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		name := u.Path
+		switch u.Scheme {
+		case "file":
+		case "":
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(root, name)
+			}
+		default:
+			return loadResource(rawURL)
+		}
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		name, err = filepath.Abs(name)
+		if err != nil {
+			return nil, err
+		}
+		if rel, err := filepath.Rel(absRoot, name); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("load %v: outside of %v", rawURL, root)
+		}
+		return ioutil.ReadFile(name)
+	})
+}
+
+// resolveURL resolves ref against base, ref being returned as it is when
+// base is empty.
+func resolveURL(base, ref string) string {
+	if base == "" {
+		return ref
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	resolved := baseURL.ResolveReference(refURL)
+	if !baseURL.IsAbs() && baseURL.Host == "" && !strings.HasPrefix(baseURL.Path, "/") &&
+		!refURL.IsAbs() && refURL.Host == "" && !strings.HasPrefix(refURL.Path, "/") {
+		// The path of a relative base, like the url of a stylesheet loaded
+		// without BaseURL, stays relative
+		resolved.Path = strings.TrimPrefix(resolved.Path, "/")
+	}
+	return resolved.String()
+}
+
+// documentBaseURL returns the url the relative urls of a document are
+// resolved against: the href of its first <base> resolved against base, or
+// base.
+func documentBaseURL(htmlNode *html.Node, base string) string {
+	if baseNode := findBase(htmlNode); baseNode != nil {
+		return resolveURL(base, getAttr(baseNode, "href"))
+	}
+	return base
+}
+
+func findBase(htmlNode *html.Node) *html.Node {
+	if htmlNode.Type == html.ElementNode && htmlNode.Data == "base" && getAttr(htmlNode, "href") != "" {
+		return htmlNode
+	}
+	for ch := htmlNode.FirstChild; ch != nil; ch = ch.NextSibling {
+		if found := findBase(ch); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// isStylesheetLink reports whether htmlNode is a <link rel=stylesheet>.
+func isStylesheetLink(htmlNode *html.Node) bool {
+	if htmlNode.Data != "link" || getAttr(htmlNode, "href") == "" {
+		return false
+	}
+	rel := strings.Fields(strings.ToLower(getAttr(htmlNode, "rel")))
+	return containsString(rel, "stylesheet") && !containsString(rel, "alternate")
+}
+
+// cachedStylesheet is a stylesheet parsed from text.
+type cachedStylesheet struct {
+	text  string
+	sheet *Stylesheet
+}
+
+// stylesheetCache keeps the stylesheets loaded by a Renderer by url, so a
+// stylesheet is parsed again only when its content changes.
+type stylesheetCache struct {
+	mu     sync.Mutex
+	sheets map[string]*cachedStylesheet
+}
+
+func (c *stylesheetCache) parse(url, text string) *Stylesheet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached := c.sheets[url]; cached != nil && cached.text == text {
+		return cached.sheet
+	}
+	if c.sheets == nil {
+		c.sheets = make(map[string]*cachedStylesheet)
+	}
+	sheet := ParseStylesheet(text)
+	c.sheets[url] = &cachedStylesheet{text: text, sheet: sheet}
+	return sheet
+}
+
+// styleLoader turns the stylesheets of a document into rules, loading the
+// stylesheets they import.
+type styleLoader struct {
+	media  *mediaContext
+	loader ResourceLoader
+	cache  *stylesheetCache
+	// Urls of the stylesheets being imported, whose import again is a cycle
+	importing map[string]bool
+	// Called when a stylesheet fails to load
+	onError func(url string, err error)
+}
+
+// styleLoader returns the loader of the stylesheets of the documents r
+// renders.
+func (r *Renderer) styleLoader(media *mediaContext) *styleLoader {
+	loader := r.Loader
+	if loader == nil {
+		loader = DefaultLoader
+	}
+	return &styleLoader{media: media, loader: loader, cache: &r.stylesheets, importing: map[string]bool{}, onError: r.OnLoadError}
+}
+
+// load returns the rules of the stylesheet at the absolute url, nil when it
+// is already being imported or fails to load.
+func (l *styleLoader) load(url string) []*TagStyle {
+	if l.importing[url] {
+		return nil
+	}
+	data, err := l.loader.Load(url)
+	if err != nil {
+		if l.onError != nil {
+			l.onError(url, err)
+		}
+		return nil
+	}
+	l.importing[url] = true
+	defer delete(l.importing, url)
+	return l.tagStyles(l.cache.parse(url, string(data)), url)
+}
+
+// tagStyles returns the style rules of sheet that apply to the media, with a
+// rule for each selector of a selector list. The urls of its imports are
+// resolved against baseURL.
+func (l *styleLoader) tagStyles(sheet *Stylesheet, baseURL string) []*TagStyle {
+	return l.appendTagStyles(nil, sheet.Rules, baseURL, true)
+}
+
+func (l *styleLoader) appendTagStyles(tagStyleList []*TagStyle, rules []*Rule, baseURL string, topLevel bool) []*TagStyle {
+	importAllowed := topLevel
+	for _, rule := range rules {
+		switch rule.AtKeyword {
+		case "import":
+			if importAllowed {
+				tagStyleList = append(tagStyleList, l.importRule(rule, baseURL)...)
+			}
+			continue
+		case "charset", "layer":
+			continue
+		case "media":
+			if l.media.matchQueryList(rule.prelude) {
+				tagStyleList = l.appendTagStyles(tagStyleList, rule.Rules, baseURL, false)
+			}
+		case "":
+			selectors, ok := parseSelectorList(rule.Prelude)
+			if !ok {
+				// Rules with an invalid selector are dropped
+				break
+			}
+			declarations := &TagStyle{}
+			setDeclarations(declarations, rule.Declarations)
+			for _, sel := range selectors {
+				tagStyle := *declarations
+				tagStyle.Selector = sel.text
+				tagStyle.selectors = []*selector{sel}
+				tagStyleList = append(tagStyleList, &tagStyle)
+			}
+		default:
+			// Unsupported at-rules are ignored
+		}
+		// @import must come before the other rules
+		importAllowed = false
+	}
+	return tagStyleList
+}
+
+// importRule returns the rules of the stylesheet an @import imports when its
+// media query list matches.
+func (l *styleLoader) importRule(rule *Rule, baseURL string) []*TagStyle {
+	if l.loader == nil {
+		// Stylesheets parsed without a Renderer do not import
+		return nil
+	}
+	prelude := rule.prelude
+	if len(prelude) == 0 {
+		return nil
+	}
+	var ref string
+	switch v := prelude[0]; {
+	case v.token.kind == tokenString, v.token.kind == tokenURL:
+		ref = v.token.value
+	case v.isFunction() && strings.EqualFold(v.token.value, "url"):
+		args := trimWhitespace(v.children)
+		if len(args) != 1 || args[0].token.kind != tokenString {
+			return nil
+		}
+		ref = args[0].token.value
+	default:
+		return nil
+	}
+	if !l.media.matchQueryList(prelude[1:]) {
+		return nil
+	}
+	return l.load(resolveURL(baseURL, ref))
+}
+
+// imageLoader loads the images of a document.
+type imageLoader struct {
+	loader  ResourceLoader
+	baseURL string
+	onError func(url string, err error)
+}
+
+// imageLoader returns the loader of the images of a document whose relative
+// urls are resolved against baseURL.
+func (r *Renderer) imageLoader(baseURL string) *imageLoader {
+	loader := r.Loader
+	if loader == nil {
+		loader = DefaultLoader
+	}
+	return &imageLoader{loader: loader, baseURL: baseURL, onError: r.OnLoadError}
+}
+
+// load returns the image at src, false when it fails to load or to decode.
+func (l *imageLoader) load(src string) (ImageData, bool) {
+	url := resolveURL(l.baseURL, src)
+	data, err := l.loader.Load(url)
+	if err == nil {
+		var img image.Image
+		var fm string
+		if img, fm, err = image.Decode(bytes.NewReader(data)); err == nil {
+			return ImageData{Fm: fm, Img: img}, true
+		}
+	}
+	if l.onError != nil {
+		l.onError(url, err)
+	}
+	return ImageData{}, false
+}
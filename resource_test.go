@@ -0,0 +1,181 @@
+package html2img
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		base string
+		ref  string
+		want string
+	}{
+		{"", "a.css", "a.css"},
+		{"http://x.org/dir/page.html", "a.css", "http://x.org/dir/a.css"},
+		{"http://x.org/dir/page.html", "../a.css", "http://x.org/a.css"},
+		{"http://x.org/dir/page.html", "/a.css", "http://x.org/a.css"},
+		{"http://x.org/dir/", "http://y.org/a.css", "http://y.org/a.css"},
+		{"file:///tmp/site/index.html", "css/a.css", "file:///tmp/site/css/a.css"},
+		{"a.css", "b.css", "b.css"},
+		{"css/a.css", "b.css", "css/b.css"},
+		{"css/a.css", "/b.css", "/b.css"},
+		{"/site/css/a.css", "b.css", "/site/css/b.css"},
+	}
+	for _, test := range tests {
+		if got := resolveURL(test.base, test.ref); got != test.want {
+			t.Errorf("resolveURL(%q, %q) = %q, want %q", test.base, test.ref, got, test.want)
+		}
+	}
+}
+
+func TestFileLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "html2img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "site")
+	for name, text := range map[string]string{"site/css/a.css": "a", "secret.txt": "b"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		url  string
+		want string
+		ok   bool
+	}{
+		{"css/a.css", "a", true},
+		{"file://" + filepath.ToSlash(root) + "/css/a.css", "a", true},
+		{filepath.Join(root, "css", "a.css"), "a", true},
+		{"css/../css/a.css", "a", true},
+		{"css/b.css", "", false},
+		{"../secret.txt", "", false},
+		{"file://" + filepath.ToSlash(dir) + "/secret.txt", "", false},
+		{filepath.Join(dir, "secret.txt"), "", false},
+		{"ftp://x.org/a.css", "", false},
+	}
+	loader := FileLoader(root)
+	for _, test := range tests {
+		data, err := loader.Load(test.url)
+		if (err == nil) != test.ok || string(data) != test.want {
+			t.Errorf("Load(%q) = %q, %v, want %q", test.url, data, err, test.want)
+		}
+		if _, err := DefaultLoader.Load(test.url); err == nil {
+			t.Errorf("DefaultLoader reads %q", test.url)
+		}
+	}
+}
+
+// testLoader returns a loader of files by url, which fails for the urls it
+// does not have and counts the loads.
+func testLoader(files map[string]string, loads map[string]int) ResourceLoader {
+	return ResourceLoaderFunc(func(url string) ([]byte, error) {
+		if loads != nil {
+			loads[url]++
+		}
+		text, ok := files[url]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(text), nil
+	})
+}
+
+func TestStylesheetLoading(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		baseURL string
+		head    string
+		want    string
+		errors  []string
+	}{
+		{"link", map[string]string{"a.css": "p { color: red }"}, "", `<link rel="stylesheet" href="a.css">`, "red", nil},
+		{"link rel list", map[string]string{"a.css": "p { color: red }"}, "", `<link rel="preload Stylesheet" href="a.css">`, "red", nil},
+		{"alternate link", map[string]string{"a.css": "p { color: red }"}, "", `<link rel="alternate stylesheet" href="a.css">`, "", nil},
+		{"link without rel", map[string]string{"a.css": "p { color: red }"}, "", `<link href="a.css">`, "", nil},
+		{"failed link", nil, "", `<link rel="stylesheet" href="a.css"><style>p { color: blue }</style>`, "blue", []string{"a.css"}},
+		{"link order", map[string]string{"a.css": "p { color: red }"}, "", `<style>p { color: blue }</style><link rel="stylesheet" href="a.css">`, "red", nil},
+		{"base url", map[string]string{"http://x.org/css/a.css": "p { color: red }"}, "http://x.org/page.html", `<link rel="stylesheet" href="css/a.css">`, "red", nil},
+		{"base element", map[string]string{"http://y.org/s/a.css": "p { color: red }"}, "http://x.org/", `<base href="http://y.org/s/"><link rel="stylesheet" href="a.css">`, "red", nil},
+		{"import", map[string]string{"a.css": "p { color: red }"}, "", `<style>@import "a.css";</style>`, "red", nil},
+		{"import url", map[string]string{"a.css": "p { color: red }"}, "", `<style>@import url(a.css);</style>`, "red", nil},
+		{"import url string", map[string]string{"a.css": "p { color: red }"}, "", `<style>@import url("a.css");</style>`, "red", nil},
+		{"import before the importing rules", map[string]string{"a.css": "p { color: red }"}, "", `<style>@import "a.css"; p { color: blue }</style>`, "blue", nil},
+		{"import after rules", map[string]string{"a.css": "p { color: red }"}, "", `<style>p { color: blue } @import "a.css";</style>`, "blue", nil},
+		{"import after charset and layer", map[string]string{"a.css": "p { color: red }"}, "", `<style>@charset "utf-8"; @layer x; @import "a.css";</style>`, "red", nil},
+		{"import in @media", map[string]string{"a.css": "p { color: red }"}, "", `<style>@media screen { @import "a.css"; }</style>`, "", nil},
+		{"import relative to the sheet", map[string]string{"http://x.org/css/a.css": `@import "b.css";`, "http://x.org/css/b.css": "p { color: red }"}, "http://x.org/", `<link rel="stylesheet" href="css/a.css">`, "red", nil},
+		{"nested imports", map[string]string{"a.css": `@import "b.css"; p { color: blue }`, "b.css": "p { color: red }"}, "", `<style>@import "a.css";</style>`, "blue", nil},
+		{"import cycle", map[string]string{"a.css": `@import "b.css"; p { color: red }`, "b.css": `@import "a.css"; p { color: blue }`}, "", `<style>@import "a.css";</style>`, "red", nil},
+		{"self import", map[string]string{"a.css": `@import "a.css"; p { color: red }`}, "", `<link rel="stylesheet" href="a.css">`, "red", nil},
+		{"failed import", nil, "", `<style>@import "a.css"; p { color: blue }</style>`, "blue", []string{"a.css"}},
+		{"import media", map[string]string{"a.css": "p { color: red }"}, "", `<style>@import "a.css" print;</style>`, "", nil},
+		{"import matching media", map[string]string{"a.css": "p { color: red }"}, "", `<style>@import "a.css" screen and (min-width: 100px);</style>`, "red", nil},
+		{"import without url", nil, "", `<style>@import; @import 12px; p { color: blue }</style>`, "blue", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var failed []string
+			r := &Renderer{
+				Loader:  testLoader(test.files, nil),
+				BaseURL: test.baseURL,
+				OnLoadError: func(url string, err error) {
+					failed = append(failed, url)
+				},
+			}
+			body := layoutHTML(t, r, "<html><head>"+test.head+`</head><body><p id="e">a</p></body></html>`)
+			if got := findDom(body, "e").TagStyle.Color; got != test.want {
+				t.Errorf("color = %q, want %q", got, test.want)
+			}
+			if strings.Join(failed, " ") != strings.Join(test.errors, " ") {
+				t.Errorf("failed loads = %v, want %v", failed, test.errors)
+			}
+		})
+	}
+}
+
+func TestStylesheetCache(t *testing.T) {
+	files := map[string]string{"a.css": "p { color: red }"}
+	loads := make(map[string]int)
+	r := &Renderer{Loader: testLoader(files, loads)}
+	src := `<html><head><link rel="stylesheet" href="a.css"></head><body><p id="e">a</p></body></html>`
+	for _, want := range []string{"red", "red"} {
+		if got := findDom(layoutHTML(t, r, src), "e").TagStyle.Color; got != want {
+			t.Errorf("color = %q, want %q", got, want)
+		}
+	}
+	files["a.css"] = "p { color: blue }"
+	if got := findDom(layoutHTML(t, r, src), "e").TagStyle.Color; got != "blue" {
+		t.Errorf("color of the changed stylesheet = %q, want blue", got)
+	}
+	if loads["a.css"] != 3 {
+		t.Errorf("a.css loaded %v times, want 3", loads["a.css"])
+	}
+}
+
+func TestImages(t *testing.T) {
+	var failed []string
+	r := &Renderer{
+		Loader: testLoader(map[string]string{"bad.png": "not an image"}, nil),
+		OnLoadError: func(url string, err error) {
+			failed = append(failed, url)
+		},
+	}
+	runRenderTests(t, r, []renderTest{
+		{"failed images", styledDocument("", `<img src="missing.png"><img src="bad.png" width="10" height="10">`)},
+	})
+	if strings.Join(failed, " ") != "missing.png bad.png" {
+		t.Errorf("failed loads = %v", failed)
+	}
+}
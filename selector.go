@@ -0,0 +1,645 @@
+package html2img
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a complex selector: compound selectors joined by combinators,
+// matched from the last one, which selects the element.
+type selector struct {
+	text      string
+	compounds []compoundSelector
+	// combinators[i] joins compounds[i] and compounds[i+1]: ' ', '>', '+' or '~'
+	combinators []byte
+	// before or after for the selectors of a pseudo-element
+	pseudoElement string
+}
+
+type compoundSelector struct {
+	// Tag name, empty for any element
+	tag           string
+	ids           []string
+	classes       []string
+	attrs         []attrSelector
+	pseudoClasses []pseudoClass
+}
+
+type attrSelector struct {
+	name string
+	// Empty when the attribute only has to be present
+	op         string
+	value      string
+	ignoreCase bool
+}
+
+// pseudoClass is a pseudo-class with the an+b of the :nth-* ones and the
+// selector list of :not(), :is(), :where() and :nth-child(an+b of S).
+type pseudoClass struct {
+	name      string
+	a, b      int
+	selectors []*selector
+}
+
+// dynamicPseudoClasses depend on the interaction with the page, which never
+// happens on an image.
+var dynamicPseudoClasses = map[string]bool{
+	"hover": true, "active": true, "focus": true, "focus-within": true,
+	"focus-visible": true, "visited": true, "target": true,
+}
+
+// specificity is the weight of a selector in the cascade: its number of ids,
+// of classes, attributes and pseudo-classes, and of types.
+type specificity [3]int
+
+func (s specificity) less(o specificity) bool {
+	for i := range s {
+		if s[i] != o[i] {
+			return s[i] < o[i]
+		}
+	}
+	return false
+}
+
+func (s specificity) add(o specificity) specificity {
+	return specificity{s[0] + o[0], s[1] + o[1], s[2] + o[2]}
+}
+
+func (s *selector) specificity() specificity {
+	var spec specificity
+	for i := range s.compounds {
+		spec = spec.add(s.compounds[i].specificity())
+	}
+	if s.pseudoElement != "" {
+		spec[2]++
+	}
+	return spec
+}
+
+func (c *compoundSelector) specificity() specificity {
+	spec := specificity{len(c.ids), len(c.classes) + len(c.attrs), 0}
+	if c.tag != "" {
+		spec[2]++
+	}
+	for _, pseudo := range c.pseudoClasses {
+		switch pseudo.name {
+		case "where":
+		case "not", "is", "matches":
+			// The weight of the most specific selector of the list
+			spec = spec.add(maxSpecificity(pseudo.selectors))
+		case "nth-child", "nth-last-child":
+			spec[1]++
+			spec = spec.add(maxSpecificity(pseudo.selectors))
+		default:
+			spec[1]++
+		}
+	}
+	return spec
+}
+
+func maxSpecificity(list []*selector) specificity {
+	var max specificity
+	for _, sel := range list {
+		if spec := sel.specificity(); max.less(spec) {
+			max = spec
+		}
+	}
+	return max
+}
+
+// parseSelectorList parses a comma separated list of selectors. It returns
+// false when a selector of the list is invalid or unsupported, which makes
+// the whole rule invalid.
+func parseSelectorList(text string) (list []*selector, ok bool) {
+	p := &selectorParser{s: text}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, invalid := r.(selectorError); !invalid {
+				panic(r)
+			}
+			list, ok = nil, false
+		}
+	}()
+	list = p.list()
+	if p.pos < len(p.s) {
+		p.fail()
+	}
+	return list, true
+}
+
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+// selectorError stops the parsing of an invalid selector.
+type selectorError string
+
+func (p *selectorParser) fail() {
+	panic(selectorError(fmt.Sprintf("unsupported selector %v", p.s)))
+}
+
+func (p *selectorParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n\r\f", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// list parses selectors up to the end of the text or a closing parenthesis.
+func (p *selectorParser) list() []*selector {
+	var list []*selector
+	for {
+		p.skipSpace()
+		list = append(list, p.complex())
+		if p.peek() != ',' {
+			return list
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) complex() *selector {
+	start := p.pos
+	sel := &selector{}
+	for {
+		compound, pseudoElement := p.compound()
+		sel.compounds = append(sel.compounds, compound)
+		if pseudoElement != "" {
+			sel.pseudoElement = pseudoElement
+			p.skipSpace()
+			if c := p.peek(); c != 0 && c != ',' && c != ')' {
+				// A pseudo-element ends the selector
+				p.fail()
+			}
+			break
+		}
+		space := p.skipSpace()
+		c := p.peek()
+		if c == 0 || c == ',' || c == ')' {
+			break
+		}
+		if c == '>' || c == '+' || c == '~' {
+			p.pos++
+			p.skipSpace()
+		} else if space {
+			c = ' '
+		} else {
+			p.fail()
+		}
+		sel.combinators = append(sel.combinators, c)
+	}
+	sel.text = strings.Trim(p.s[start:p.pos], CUT_SET_LIST)
+	return sel
+}
+
+// compound parses a compound selector and the pseudo-element it ends with.
+func (p *selectorParser) compound() (compoundSelector, string) {
+	var compound compoundSelector
+	empty := true
+	if p.peek() == '*' {
+		p.pos++
+		empty = false
+	} else if name := p.ident(); name != "" {
+		compound.tag = strings.ToLower(name)
+		empty = false
+	}
+	for {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			compound.ids = append(compound.ids, p.requireIdent())
+		case '.':
+			p.pos++
+			compound.classes = append(compound.classes, p.requireIdent())
+		case '[':
+			p.pos++
+			compound.attrs = append(compound.attrs, p.attr())
+		case ':':
+			p.pos++
+			if p.peek() == ':' {
+				p.pos++
+				return compound, p.pseudoElement(p.requireIdent())
+			}
+			name := strings.ToLower(p.requireIdent())
+			if name == "before" || name == "after" {
+				// Pseudo-elements of CSS 2 take a single colon
+				return compound, name
+			}
+			compound.pseudoClasses = append(compound.pseudoClasses, p.pseudoClass(name))
+		default:
+			if empty {
+				p.fail()
+			}
+			return compound, ""
+		}
+		empty = false
+	}
+}
+
+func (p *selectorParser) pseudoElement(name string) string {
+	name = strings.ToLower(name)
+	if name != "before" && name != "after" {
+		p.fail()
+	}
+	return name
+}
+
+// ident parses an identifier, with its escapes, or returns an empty string.
+func (p *selectorParser) ident() string {
+	var name strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.s):
+			r, n := parseCSSEscape(p.s[p.pos+1:])
+			name.WriteRune(r)
+			p.pos += 1 + n
+		case c == '-' || c == '_' || c >= 0x80 ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9':
+			name.WriteByte(c)
+			p.pos++
+		default:
+			return name.String()
+		}
+	}
+	return name.String()
+}
+
+func (p *selectorParser) requireIdent() string {
+	name := p.ident()
+	if name == "" {
+		p.fail()
+	}
+	return name
+}
+
+// attr parses an attribute selector after its opening bracket.
+func (p *selectorParser) attr() attrSelector {
+	p.skipSpace()
+	attr := attrSelector{name: strings.ToLower(p.requireIdent())}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return attr
+	}
+	if strings.IndexByte("~|^$*", p.peek()) >= 0 {
+		attr.op = p.s[p.pos : p.pos+1]
+		p.pos++
+	}
+	if p.peek() != '=' {
+		p.fail()
+	}
+	p.pos++
+	attr.op += "="
+	p.skipSpace()
+	if c := p.peek(); c == '"' || c == '\'' {
+		value, n := parseCSSString(p.s[p.pos:])
+		if n < 0 {
+			p.fail()
+		}
+		attr.value = value
+		p.pos += n
+	} else {
+		attr.value = p.requireIdent()
+	}
+	p.skipSpace()
+	if c := p.peek(); c == 'i' || c == 'I' || c == 's' || c == 'S' {
+		attr.ignoreCase = c == 'i' || c == 'I'
+		p.pos++
+		p.skipSpace()
+	}
+	if p.peek() != ']' {
+		p.fail()
+	}
+	p.pos++
+	return attr
+}
+
+// pseudoClass parses the pseudo-class named name and its arguments.
+func (p *selectorParser) pseudoClass(name string) pseudoClass {
+	pseudo := pseudoClass{name: name}
+	switch name {
+	case "first-child", "last-child", "only-child", "first-of-type", "last-of-type", "only-of-type",
+		"root", "empty", "link", "any-link":
+		return pseudo
+	case "not", "is", "where", "matches", "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+	default:
+		if dynamicPseudoClasses[name] {
+			return pseudo
+		}
+		p.fail()
+	}
+	if p.peek() != '(' {
+		p.fail()
+	}
+	p.pos++
+	p.skipSpace()
+	if strings.HasPrefix(name, "nth-") {
+		end := strings.IndexByte(p.s[p.pos:], ')')
+		if end < 0 {
+			p.fail()
+		}
+		arg := p.s[p.pos : p.pos+end]
+		if of := strings.Index(arg, " of "); of >= 0 && strings.HasSuffix(name, "-child") {
+			arg = arg[:of]
+			p.pos += of + len(" of ")
+			pseudo.selectors = p.list()
+		} else {
+			p.pos += end
+		}
+		var ok bool
+		if pseudo.a, pseudo.b, ok = parseNth(arg); !ok {
+			p.fail()
+		}
+	} else {
+		pseudo.selectors = p.list()
+	}
+	for _, sel := range pseudo.selectors {
+		if sel.pseudoElement != "" {
+			p.fail()
+		}
+	}
+	p.skipSpace()
+	if p.peek() != ')' {
+		p.fail()
+	}
+	p.pos++
+	return pseudo
+}
+
+// parseNth parses the an+b argument of the :nth-* pseudo-classes.
+func parseNth(arg string) (int, int, bool) {
+	arg = strings.ToLower(strings.Join(strings.Fields(arg), ""))
+	switch arg {
+	case "odd":
+		return 2, 1, true
+	case "even":
+		return 2, 0, true
+	}
+	n := strings.IndexByte(arg, 'n')
+	if n < 0 {
+		b, err := strconv.Atoi(arg)
+		return 0, b, err == nil
+	}
+	a := 0
+	switch coefficient := arg[:n]; coefficient {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(coefficient); err != nil {
+			return 0, 0, false
+		}
+	}
+	b := 0
+	if offset := arg[n+1:]; offset != "" {
+		if offset[0] != '+' && offset[0] != '-' {
+			return 0, 0, false
+		}
+		var err error
+		if b, err = strconv.Atoi(offset); err != nil {
+			return 0, 0, false
+		}
+	}
+	return a, b, true
+}
+
+// matchesNth reports whether the index-th element, counting from 1, is an
+// element of the an+b sequence.
+func matchesNth(a, b, index int) bool {
+	if a == 0 {
+		return index == b
+	}
+	return (index-b)/a >= 0 && (index-b)%a == 0
+}
+
+// Selectors are matched against the parsed html rather than the doms: the
+// style of a dom is computed before its following siblings are built.
+
+func parentElement(n *html.Node) *html.Node {
+	if n.Parent != nil && n.Parent.Type == html.ElementNode {
+		return n.Parent
+	}
+	return nil
+}
+
+func prevElement(n *html.Node) *html.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func nextElement(n *html.Node) *html.Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func nodeAttr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func matchesAny(list []*selector, n *html.Node) bool {
+	for _, sel := range list {
+		if sel.matches(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the element n is selected by s, ignoring its
+// pseudo-element.
+func (s *selector) matches(n *html.Node) bool {
+	return s.matchesFrom(len(s.compounds)-1, n)
+}
+
+// matchesFrom reports whether n matches the compound selector i and the ones
+// before it match the elements the combinators lead to.
+func (s *selector) matchesFrom(i int, n *html.Node) bool {
+	if !s.compounds[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch s.combinators[i-1] {
+	case ' ':
+		for p := parentElement(n); p != nil; p = parentElement(p) {
+			if s.matchesFrom(i-1, p) {
+				return true
+			}
+		}
+	case '>':
+		p := parentElement(n)
+		return p != nil && s.matchesFrom(i-1, p)
+	case '+':
+		p := prevElement(n)
+		return p != nil && s.matchesFrom(i-1, p)
+	case '~':
+		for p := prevElement(n); p != nil; p = prevElement(p) {
+			if s.matchesFrom(i-1, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *compoundSelector) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode || (c.tag != "" && c.tag != n.Data) {
+		return false
+	}
+	for _, id := range c.ids {
+		if value, _ := nodeAttr(n, "id"); value != id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		value, _ := nodeAttr(n, "class")
+		classes := strings.Fields(value)
+		for _, class := range c.classes {
+			if !containsString(classes, class) {
+				return false
+			}
+		}
+	}
+	for _, attr := range c.attrs {
+		if !attr.matches(n) {
+			return false
+		}
+	}
+	for _, pseudo := range c.pseudoClasses {
+		if !pseudo.matches(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *attrSelector) matches(n *html.Node) bool {
+	value, exist := nodeAttr(n, a.name)
+	if !exist {
+		return false
+	}
+	want := a.value
+	if a.ignoreCase {
+		value, want = strings.ToLower(value), strings.ToLower(want)
+	}
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return value == want
+	case "~=":
+		return containsString(strings.Fields(value), want)
+	case "|=":
+		return value == want || strings.HasPrefix(value, want+"-")
+	case "^=":
+		return want != "" && strings.HasPrefix(value, want)
+	case "$=":
+		return want != "" && strings.HasSuffix(value, want)
+	case "*=":
+		return want != "" && strings.Contains(value, want)
+	}
+	return false
+}
+
+func (p *pseudoClass) matches(n *html.Node) bool {
+	switch p.name {
+	case "first-child":
+		return prevElement(n) == nil
+	case "last-child":
+		return nextElement(n) == nil
+	case "only-child":
+		return prevElement(n) == nil && nextElement(n) == nil
+	case "first-of-type":
+		return p.index(n, prevElement, true) == 1
+	case "last-of-type":
+		return p.index(n, nextElement, true) == 1
+	case "only-of-type":
+		return p.index(n, prevElement, true) == 1 && p.index(n, nextElement, true) == 1
+	case "nth-child":
+		return (p.selectors == nil || matchesAny(p.selectors, n)) && matchesNth(p.a, p.b, p.index(n, prevElement, false))
+	case "nth-last-child":
+		return (p.selectors == nil || matchesAny(p.selectors, n)) && matchesNth(p.a, p.b, p.index(n, nextElement, false))
+	case "nth-of-type":
+		return matchesNth(p.a, p.b, p.index(n, prevElement, true))
+	case "nth-last-of-type":
+		return matchesNth(p.a, p.b, p.index(n, nextElement, true))
+	case "not":
+		return !matchesAny(p.selectors, n)
+	case "is", "where", "matches":
+		return matchesAny(p.selectors, n)
+	case "root":
+		return parentElement(n) == nil
+	case "empty":
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.Type == html.ElementNode || (ch.Type == html.TextNode && ch.Data != "") {
+				return false
+			}
+		}
+		return true
+	case "link", "any-link":
+		_, href := nodeAttr(n, "href")
+		return href && (n.Data == "a" || n.Data == "area")
+	}
+	// Dynamic pseudo-classes
+	return false
+}
+
+// index returns the position of n, counting from 1, among its siblings in the
+// direction of next: the ones of its type only, or the ones matching the
+// selectors of an :nth-child(an+b of S).
+func (p *pseudoClass) index(n *html.Node, next func(*html.Node) *html.Node, ofType bool) int {
+	index := 1
+	for s := next(n); s != nil; s = next(s) {
+		switch {
+		case ofType:
+			if s.Data == n.Data {
+				index++
+			}
+		case p.selectors != nil:
+			if matchesAny(p.selectors, s) {
+				index++
+			}
+		default:
+			index++
+		}
+	}
+	return index
+}
@@ -0,0 +1,146 @@
+package html2img
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const selectorDocument = `<html><body>
+<div id="d1" class="box main" lang="en-US">
+	<p id="p1" class="first">a</p>
+	<p id="p2" title="hello world">b</p>
+	<span id="s1"></span>
+	<p id="p3"><a id="a1" href="x.html">c</a></p>
+</div>
+<div id="d2" data-x="abc">
+	<ul id="u1"><li id="l1"></li><li id="l2" class="odd"></li><li id="l3"></li><li id="l4"></li></ul>
+</div>
+</body></html>`
+
+// matchingIds returns the ids of the elements of the tree of n matching the
+// selector list.
+func matchingIds(list []*selector, n *html.Node) []string {
+	var ids []string
+	if n.Type == html.ElementNode && matchesAny(list, n) {
+		if id, ok := nodeAttr(n, "id"); ok {
+			ids = append(ids, id)
+		}
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		ids = append(ids, matchingIds(list, ch)...)
+	}
+	return ids
+}
+
+func TestSelectorMatching(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(selectorDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"p", "p1 p2 p3"},
+		{"*", "d1 p1 p2 s1 p3 a1 d2 u1 l1 l2 l3 l4"},
+		{"#p2", "p2"},
+		{".box", "d1"},
+		{".box.main", "d1"},
+		{"div.main", "d1"},
+		{".box.other", ""},
+		{"div p", "p1 p2 p3"},
+		{"body a", "a1"},
+		{"div > a", ""},
+		{"p > a", "a1"},
+		{"p + p", "p2"},
+		{"p + span", "s1"},
+		{"p ~ p", "p2 p3"},
+		{"#p1 ~ *", "p2 s1 p3"},
+		{"div, li.odd", "d1 d2 l2"},
+		{"[title]", "p2"},
+		{`[title="hello world"]`, "p2"},
+		{"[title~=world]", "p2"},
+		{"[lang|=en]", "d1"},
+		{"[data-x^=ab]", "d2"},
+		{"[data-x$=bc]", "d2"},
+		{"[data-x*=b]", "d2"},
+		{"[data-x=ABC i]", "d2"},
+		{"[data-x=ABC]", ""},
+		{"li:first-child", "l1"},
+		{"li:last-child", "l4"},
+		{"p:first-child", "p1"},
+		{"span:only-of-type", "s1"},
+		{"p:first-of-type", "p1"},
+		{"p:last-of-type", "p3"},
+		{"li:nth-child(2)", "l2"},
+		{"li:nth-child(odd)", "l1 l3"},
+		{"li:nth-child(even)", "l2 l4"},
+		{"li:nth-child(2n+1)", "l1 l3"},
+		{"li:nth-child(-n+2)", "l1 l2"},
+		{"li:nth-last-child(1)", "l4"},
+		{"div :nth-of-type(2)", "p2 l2"},
+		{"li:nth-child(1 of .odd)", "l2"},
+		{"p:not(.first)", "p2 p3"},
+		{"p:not(#p2, .first)", "p3"},
+		{":is(#p1, #s1)", "p1 s1"},
+		{":where(ul) li:nth-child(3)", "l3"},
+		{"span:empty", "s1"},
+		{"a:link", "a1"},
+		{"a:hover", ""},
+		{"DIV > P#P1", ""},
+	}
+	for _, test := range tests {
+		list, ok := parseSelectorList(test.selector)
+		if !ok {
+			t.Errorf("%v: not parsed", test.selector)
+			continue
+		}
+		if got := strings.Join(matchingIds(list, doc), " "); got != test.want {
+			t.Errorf("%v matches %q, want %q", test.selector, got, test.want)
+		}
+	}
+}
+
+func TestInvalidSelectors(t *testing.T) {
+	for _, selector := range []string{
+		"",
+		"p,",
+		", p",
+		"p >",
+		"> p",
+		"p + + p",
+		"#",
+		".",
+		"[",
+		"[title",
+		"[title=]",
+		"[title=a b]",
+		":foo",
+		"::foo",
+		"p::before span",
+		":nth-child(x)",
+		":nth-child(2n+)",
+		":nth-child(1",
+		":not(p",
+		":not(::before)",
+		"p!",
+		"p {",
+	} {
+		if _, ok := parseSelectorList(selector); ok {
+			t.Errorf("%q is parsed", selector)
+		}
+	}
+}
+
+func TestSelectorRules(t *testing.T) {
+	runComputedStyleTests(t, colorOf, []computedStyleTest{
+		{"descendant", "div p { color: red }", `<div><section><p id="e">a</p></section></div>`, "red"},
+		{"child", "div > p { color: red }", `<div><section><p id="e">a</p></section></div>`, ""},
+		{"multiple classes", ".a.b { color: red }", `<p id="e" class="b  a">a</p>`, "red"},
+		{"class with whitespace", ".b { color: red }", "<p id=\"e\" class=\"a\tb\">a</p>", "red"},
+		{"invalid rule dropped", "p { color: red } p:foo, p { color: blue }", `<p id="e">a</p>`, "red"},
+		{"selector list", "h1, p { color: red }", `<p id="e">a</p>`, "red"},
+	})
+}
@@ -0,0 +1,196 @@
+package html2img
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// isStackingContext reports whether the dom paints itself and its descendants
+// as one layer ordered by its z-index.
+func (d *Dom) isStackingContext() bool {
+	style := d.TagStyle
+	switch {
+	case d.parent == nil:
+		return true
+	case style.Position == "fixed":
+		return true
+	case (d.isPositioned() || d.parent.isFlexContainer() || d.parent.isGridContainer()) && style.ZIndex != "" && !isAuto(style.ZIndex):
+		return true
+	case getOpacity(style.Opacity) < 1:
+		return true
+	case style.Transform != "" && style.Transform != "none":
+		return true
+	}
+	return false
+}
+
+func (d *Dom) zIndex() int {
+	z, err := strconv.Atoi(strings.Trim(d.TagStyle.ZIndex, CUT_SET_LIST))
+	if err != nil {
+		return 0
+	}
+	return z
+}
+
+func getOpacity(opacity string) float64 {
+	opacity = strings.Trim(opacity, CUT_SET_LIST)
+	if opacity == "" {
+		return 1
+	}
+	var value float64
+	var err error
+	if strings.HasSuffix(opacity, "%") {
+		value, err = strconv.ParseFloat(strings.TrimSuffix(opacity, "%"), 64)
+		value /= 100
+	} else {
+		value, err = strconv.ParseFloat(opacity, 64)
+	}
+	if err != nil || value > 1 {
+		return 1
+	}
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+// drawStackingContext paints a stacking context in the order of CSS 2.1
+// Appendix E. Translucent and transformed contexts are painted on a layer of
+// their own first, which is then composited onto dst.
+func drawStackingContext(dst *image.RGBA, d *Dom) {
+	opacity := getOpacity(d.TagStyle.Opacity)
+	transform := d.TagStyle.Transform
+	if d.parent == nil || (opacity == 1 && (transform == "" || transform == "none")) {
+		drawStackingLayers(dst, d)
+		return
+	}
+	layer := image.NewRGBA(dst.Bounds())
+	drawStackingLayers(layer, d)
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity*255 + 0.5)})
+	if transform == "" || transform == "none" {
+		draw.DrawMask(dst, dst.Bounds(), layer, layer.Bounds().Min, mask, image.ZP, draw.Over)
+		return
+	}
+	matrix := getTransform(d.TagStyle, d.Container)
+	xdraw.BiLinear.Transform(dst, matrix, layer, layer.Bounds(), xdraw.Over, &xdraw.Options{SrcMask: mask})
+}
+
+// drawStackingLayers paints the box of d, its child stacking contexts with a
+// negative z-index, the blocks and then the inline content in the flow, the
+// positioned descendants and the child stacking contexts with z-index 0, and
+// last the ones with a positive z-index.
+func drawStackingLayers(dst *image.RGBA, d *Dom) {
+	var negative, zero, positive []*Dom
+	collectStacking(d, &negative, &zero, &positive)
+	sort.SliceStable(negative, func(i, j int) bool {
+		return negative[i].zIndex() < negative[j].zIndex()
+	})
+	sort.SliceStable(positive, func(i, j int) bool {
+		return positive[i].zIndex() < positive[j].zIndex()
+	})
+
+	if d.parent != nil {
+		// The background of the root element is the canvas
+		drawBox(dst, d)
+	}
+	for _, child := range negative {
+		drawStackingContext(dst, child)
+	}
+	drawContent(dst, d)
+	for _, child := range zero {
+		if child.isStackingContext() {
+			drawStackingContext(dst, child)
+			continue
+		}
+		drawBox(dst, child)
+		drawContent(dst, child)
+	}
+	for _, child := range positive {
+		drawStackingContext(dst, child)
+	}
+}
+
+// collectStacking gathers in tree order the descendants of d that are not
+// painted with the flow: child stacking contexts by the sign of their z-index,
+// and positioned descendants with z-index auto, whose own positioned
+// descendants belong to d as well.
+func collectStacking(d *Dom, negative, zero, positive *[]*Dom) {
+	for _, child := range d.Children {
+		if child.DomType != DOM_TYPE_ELEMENT {
+			continue
+		}
+		if child.isStackingContext() {
+			switch z := child.zIndex(); {
+			case z < 0:
+				*negative = append(*negative, child)
+			case z > 0:
+				*positive = append(*positive, child)
+			default:
+				*zero = append(*zero, child)
+			}
+			continue
+		}
+		if child.isPositioned() {
+			*zero = append(*zero, child)
+		}
+		collectStacking(child, negative, zero, positive)
+	}
+}
+
+// drawContent paints the flow of d: the blocks, the floats and then the
+// inline content.
+func drawContent(dst *image.RGBA, d *Dom) {
+	drawFlow(dst, d, false)
+	drawFloats(dst, d)
+	drawFlow(dst, d, true)
+}
+
+// drawFlow paints the descendants of d that are in the flow of its stacking
+// context: either the backgrounds of the blocks or the inline content.
+func drawFlow(dst *image.RGBA, d *Dom, inline bool) {
+	for _, child := range d.Children {
+		if child.DomType == DOM_TYPE_ELEMENT && (child.isPositioned() || child.isStackingContext() || child.isFloat()) {
+			continue
+		}
+		if child.isInlineLevel() {
+			if inline {
+				drawInline(dst, child)
+			}
+			continue
+		}
+		if !inline {
+			drawBox(dst, child)
+		}
+		drawFlow(dst, child, inline)
+	}
+}
+
+func drawInline(dst *image.RGBA, d *Dom) {
+	if d.DomType == DOM_TYPE_TEXT {
+		drawText(dst, d)
+		return
+	}
+	drawBox(dst, d)
+	if d.TagStyle.Display != "inline" {
+		// Inline blocks are painted as a whole
+		drawContent(dst, d)
+		return
+	}
+	for _, child := range d.Children {
+		if child.DomType == DOM_TYPE_ELEMENT && (child.isPositioned() || child.isStackingContext() || child.isFloat()) {
+			continue
+		}
+		if child.isInlineLevel() {
+			drawInline(dst, child)
+			continue
+		}
+		drawBox(dst, child)
+		drawContent(dst, child)
+	}
+}
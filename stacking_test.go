@@ -0,0 +1,98 @@
+package html2img
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// paintTest is a document whose painted body has the colors of want at their
+// points.
+type paintTest struct {
+	name    string
+	css     string
+	content string
+	want    map[image.Point]color.RGBA
+}
+
+func runPaintTests(t *testing.T, tests []paintTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := paintBody(layoutBody(t, test.css, test.content))
+			for p, want := range test.want {
+				if got := img.RGBAAt(p.X, p.Y); got != want {
+					t.Errorf("%v = %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+var (
+	white = color.RGBA{255, 255, 255, 255}
+	red   = color.RGBA{255, 0, 0, 255}
+	green = color.RGBA{0, 128, 0, 255}
+	blue  = color.RGBA{0, 0, 255, 255}
+)
+
+func TestStackingOrder(t *testing.T) {
+	css := "body { margin: 0; background-color: white; height: 100px } div { width: 50px; height: 50px }" +
+		".red { background-color: red } .green { background-color: green } .blue { background-color: blue }"
+	runPaintTests(t, []paintTest{
+		{
+			name:    "tree order",
+			css:     css,
+			content: `<div class="red"></div><div class="blue" style="margin-top: -25px"></div>`,
+			want:    map[image.Point]color.RGBA{{10, 10}: red, {10, 30}: blue},
+		},
+		{
+			name:    "positioned above flow",
+			css:     css,
+			content: `<div class="red" style="position: relative"></div><div class="blue" style="margin-top: -25px"></div>`,
+			want:    map[image.Point]color.RGBA{{10, 30}: red, {10, 60}: blue},
+		},
+		{
+			name: "z-index",
+			css:  css,
+			content: `<div class="red" style="position: absolute; z-index: 2"></div>` +
+				`<div class="blue" style="position: absolute; z-index: 1; top: 25px"></div>`,
+			want: map[image.Point]color.RGBA{{10, 30}: red, {10, 60}: blue},
+		},
+		{
+			name: "negative z-index below flow",
+			css:  css,
+			content: `<div class="red" style="position: absolute; z-index: -1; top: 25px"></div>` +
+				`<div class="blue"></div>`,
+			want: map[image.Point]color.RGBA{{10, 30}: blue, {10, 60}: red},
+		},
+		{
+			name: "stacking context contains its children",
+			css:  css,
+			content: `<div class="green" style="position: absolute; z-index: 1">` +
+				`<div class="red" style="position: absolute; z-index: 100; width: 20px; height: 20px"></div></div>` +
+				`<div class="blue" style="position: absolute; z-index: 2; left: 10px; width: 20px; height: 20px"></div>`,
+			want: map[image.Point]color.RGBA{{5, 5}: red, {15, 5}: blue, {40, 40}: green},
+		},
+		{
+			name: "z-index of static boxes ignored",
+			css:  css,
+			content: `<div class="red" style="position: absolute; top: 25px"></div>` +
+				`<div class="blue" style="z-index: 10"></div>`,
+			want: map[image.Point]color.RGBA{{10, 30}: red},
+		},
+		{
+			name: "flex items stack by z-index",
+			css:  css,
+			content: `<div style="display: flex; width: 100px">` +
+				`<div class="red" style="z-index: 1; margin-right: -25px"></div><div class="blue"></div></div>`,
+			want: map[image.Point]color.RGBA{{30, 10}: red, {60, 10}: blue},
+		},
+		{
+			name:    "opacity",
+			css:     css,
+			content: `<div class="blue" style="opacity: 0"></div>`,
+			want:    map[image.Point]color.RGBA{{10, 10}: white},
+		},
+	})
+}
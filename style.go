@@ -1,9 +1,7 @@
 package html2img
 
 import (
-	"fmt"
 	"io/ioutil"
-	"regexp"
 	"strings"
 
 	"github.com/golang/freetype/truetype"
@@ -31,6 +29,19 @@ type TagStyle struct {
 	FontSize   string
 	LineHeight string
 	FontFamily string
+	Visibility string
+	TextAlign  string
+	FontWeight string
+	FontStyle  string
+	WhiteSpace string
+	// Inheritable table styles
+	BorderCollapse string
+	BorderSpacing  string
+	CaptionSide    string
+	// Inheritable list styles
+	ListStyleType     string
+	ListStylePosition string
+	ListStyleImage    string
 
 	// Not Inheritable
 	BackgroundColor string
@@ -39,6 +50,56 @@ type TagStyle struct {
 	Height          string
 	Display         string
 	Position        string
+	ZIndex          string
+	Opacity         string
+	Transform       string
+	TransformOrigin string
+	VerticalAlign   string
+	TextDecoration  string
+	FlexDirection   string
+	FlexWrap        string
+	FlexGrow        string
+	FlexShrink      string
+	FlexBasis       string
+	Order           string
+	JustifyContent  string
+	AlignItems      string
+	AlignSelf       string
+	AlignContent    string
+	RowGap          string
+	ColumnGap       string
+	JustifyItems    string
+	JustifySelf     string
+
+	GridTemplateColumns string
+	GridTemplateRows    string
+	GridTemplateAreas   string
+	GridAutoColumns     string
+	GridAutoRows        string
+	GridAutoFlow        string
+	GridRowStart        string
+	GridRowEnd          string
+	GridColumnStart     string
+	GridColumnEnd       string
+
+	TableLayout string
+	Float       string
+	Clear       string
+	Overflow    string
+
+	ColumnCount     string
+	ColumnWidth     string
+	ColumnRuleWidth string
+	ColumnRuleStyle string
+	ColumnRuleColor string
+
+	Content          string
+	CounterReset     string
+	CounterIncrement string
+	CounterSet       string
+
+	// Custom properties, which are all inheritable, by name with their --
+	CustomProperties map[string]string
 
 	BorderRadius Pos
 	Offset       Pos
@@ -47,54 +108,81 @@ type TagStyle struct {
 	BorderWidth  Pos
 	BorderColor  Pos
 	BorderStyle  Pos
+
+	// Set on the rules of the user agent stylesheet, which come before the
+	// author rules in the cascade
+	userAgent bool
+	// Parsed Selector
+	selectors []*selector
+	// Declarations marked !important
+	important *TagStyle
+	// Declarations of the rule, replayed by the cascade when one of them
+	// uses var()
+	declarations []*Declaration
+	usesVar      bool
 }
 
-// 暂时不考虑优先级问题
+// ParseStyle parses stylesheets into their rules in source order, with a rule
+// for each selector of a selector list. Media queries are evaluated against
+// the default viewport of a Renderer.
 func ParseStyle(styleList []string) []*TagStyle {
-	tagStyleMap := make(map[string]*TagStyle)
-	for _, style := range styleList {
-		subList := strings.Split(style, "}")
-		for _, subTag := range subList {
-			tag := strings.Split(subTag, "{")
-			if len(tag) > 1 {
-				selector := strings.Trim(tag[0], CUT_SET_LIST)
-				re := regexp.MustCompile("/\\s+/")
-				selector = re.ReplaceAllString(selector, " ")
-				classStyle := strings.Trim(tag[1], CUT_SET_LIST)
-				classStyleList := strings.Split(classStyle, ";")
-				tagStyle := &TagStyle{}
-				if oldStyle, exist := tagStyleMap[selector]; exist {
-					tagStyle = oldStyle
-				}
-				for _, cStyle := range classStyleList {
-					setTagStyle(tagStyle, cStyle)
-				}
-				tagStyleMap[selector] = tagStyle
-			}
-		}
-	}
-
 	var tagStyleList []*TagStyle
-	for selector, tagStyle := range tagStyleMap {
-		tagStyle.Selector = strings.Trim(selector, " ")
-		tagStyleList = append(tagStyleList, tagStyle)
+	for _, style := range styleList {
+		tagStyleList = append(tagStyleList, ParseStylesheet(style).tagStyles(defaultMedia)...)
 	}
 	return tagStyleList
 }
 
-func setTagStyle(tagStyle *TagStyle, cStyle string) {
-	cStyle = strings.Trim(cStyle, CUT_SET_LIST)
-	if cStyle == "" {
-		return
+// setTagStyles sets the declarations of a style attribute.
+func setTagStyles(tagStyle *TagStyle, declarations string) {
+	setDeclarations(tagStyle, parseDeclarations(declarations))
+}
+
+// setDeclarations sets declarations on tagStyle, the important ones on the
+// style of its important declarations, which come last in the cascade.
+func setDeclarations(tagStyle *TagStyle, declarations []*Declaration) {
+	for _, declaration := range declarations {
+		target := tagStyle
+		if declaration.Important {
+			if tagStyle.important == nil {
+				tagStyle.important = &TagStyle{}
+			}
+			target = tagStyle.important
+		}
+		if strings.HasPrefix(declaration.Name, "--") {
+			if target.CustomProperties == nil {
+				target.CustomProperties = make(map[string]string)
+			}
+			target.CustomProperties[declaration.Name] = declaration.Value
+			continue
+		}
+		if hasVar(declaration.value) {
+			if !validVars(declaration.value) {
+				// Invalid at parse time
+				continue
+			}
+			// Substituted when the style of an element is computed
+			target.declarations = append(target.declarations, declaration)
+			target.usesVar = true
+			continue
+		}
+		if setTagStyle(target, declaration.Name, declaration.Value) {
+			target.declarations = append(target.declarations, declaration)
+		}
 	}
-	css := strings.Split(cStyle, ":")
-	if len(css) != 2 {
-		panic(fmt.Sprintf("unsupported style %v", cStyle))
+}
+
+// setTagStyle sets a declaration on tagStyle. It returns false, leaving
+// tagStyle unchanged, when the property is unknown or the value is invalid.
+func setTagStyle(tagStyle *TagStyle, cssKey string, cssValue string) bool {
+	if cssValue == "" || !isValidValue(cssKey, cssValue) {
+		return false
 	}
-	cssKey := strings.Trim(css[0], CUT_SET_LIST)
-	cssValue := strings.Trim(css[1], CUT_SET_LIST)
-	if cssValue == "" {
-		return
+	if longhands, exist := keywordShorthands[cssKey]; exist && cssWideKeywords[cssValue] {
+		for _, longhand := range longhands {
+			setTagStyle(tagStyle, longhand, cssValue)
+		}
+		return true
 	}
 
 	switch cssKey {
@@ -136,158 +224,256 @@ func setTagStyle(tagStyle *TagStyle, cStyle string) {
 		tagStyle.Padding.Bottom = cssValue
 	case "display":
 		tagStyle.Display = cssValue
+	case "visibility":
+		tagStyle.Visibility = cssValue
 	case "line-height":
 		tagStyle.LineHeight = cssValue
+	case "text-align":
+		tagStyle.TextAlign = cssValue
+	case "vertical-align":
+		tagStyle.VerticalAlign = cssValue
+	case "font-weight":
+		tagStyle.FontWeight = cssValue
+	case "font-style":
+		tagStyle.FontStyle = cssValue
+	case "text-decoration", "text-decoration-line":
+		tagStyle.TextDecoration = cssValue
+	case "white-space":
+		tagStyle.WhiteSpace = cssValue
 	case "font-family":
-		cssValue = strings.Trim(cssValue, "'\"")
+		if !cssWideKeywords[cssValue] {
+			cssValue = loadFontFamily(cssValue)
+		}
 		if cssValue == "" {
-			return
+			// None of the families has a font
+			return false
 		}
-		initFontMap(cssValue)
 		tagStyle.FontFamily = cssValue
 	case "position":
 		tagStyle.Position = cssValue
-	case "padding":
-		attrList := strings.Split(cssValue, " ")
-		switch len(attrList) {
-		case 1:
-			tagStyle.Padding.Top = attrList[0]
-			tagStyle.Padding.Bottom = attrList[0]
-			tagStyle.Padding.Left = attrList[0]
-			tagStyle.Padding.Right = attrList[0]
-		case 2:
-			tagStyle.Padding.Top = attrList[0]
-			tagStyle.Padding.Bottom = attrList[0]
-			tagStyle.Padding.Left = attrList[1]
-			tagStyle.Padding.Right = attrList[1]
-		case 3:
-			tagStyle.Padding.Top = attrList[0]
-			tagStyle.Padding.Left = attrList[1]
-			tagStyle.Padding.Right = attrList[1]
-			tagStyle.Padding.Bottom = attrList[2]
-		case 4:
-			tagStyle.Padding.Top = attrList[0]
-			tagStyle.Padding.Right = attrList[1]
-			tagStyle.Padding.Bottom = attrList[2]
-			tagStyle.Padding.Left = attrList[3]
-		default:
-			panic(fmt.Sprintf("unsupported padding value %v", cStyle))
+	case "z-index":
+		tagStyle.ZIndex = cssValue
+	case "opacity":
+		tagStyle.Opacity = cssValue
+	case "transform":
+		tagStyle.Transform = cssValue
+	case "transform-origin":
+		tagStyle.TransformOrigin = cssValue
+	case "flex-direction":
+		tagStyle.FlexDirection = cssValue
+	case "flex-wrap":
+		tagStyle.FlexWrap = cssValue
+	case "flex-grow":
+		tagStyle.FlexGrow = cssValue
+	case "flex-shrink":
+		tagStyle.FlexShrink = cssValue
+	case "flex-basis":
+		tagStyle.FlexBasis = cssValue
+	case "order":
+		tagStyle.Order = cssValue
+	case "justify-content":
+		tagStyle.JustifyContent = cssValue
+	case "align-items":
+		tagStyle.AlignItems = cssValue
+	case "align-self":
+		tagStyle.AlignSelf = cssValue
+	case "align-content":
+		tagStyle.AlignContent = cssValue
+	case "row-gap":
+		tagStyle.RowGap = cssValue
+	case "column-gap":
+		tagStyle.ColumnGap = cssValue
+	case "gap":
+		attrList := splitValues(cssValue)
+		if len(attrList) == 1 {
+			attrList = append(attrList, attrList[0])
 		}
-	case "margin":
-		attrList := strings.Split(cssValue, " ")
-		switch len(attrList) {
-		case 1:
-			tagStyle.Margin.Top = attrList[0]
-			tagStyle.Margin.Bottom = attrList[0]
-			tagStyle.Margin.Left = attrList[0]
-			tagStyle.Margin.Right = attrList[0]
-		case 2:
-			tagStyle.Margin.Top = attrList[0]
-			tagStyle.Margin.Bottom = attrList[0]
-			tagStyle.Margin.Left = attrList[1]
-			tagStyle.Margin.Right = attrList[1]
-		case 3:
-			tagStyle.Margin.Top = attrList[0]
-			tagStyle.Margin.Left = attrList[1]
-			tagStyle.Margin.Right = attrList[1]
-			tagStyle.Margin.Bottom = attrList[2]
-		case 4:
-			tagStyle.Margin.Top = attrList[0]
-			tagStyle.Margin.Right = attrList[1]
-			tagStyle.Margin.Bottom = attrList[2]
-			tagStyle.Margin.Left = attrList[3]
-		default:
-			panic(fmt.Sprintf("unsupported margin value %v", cStyle))
+		if len(attrList) != 2 || !isValidValue("row-gap", attrList[0]) || !isValidValue("column-gap", attrList[1]) {
+			return false
 		}
+		tagStyle.RowGap = attrList[0]
+		tagStyle.ColumnGap = attrList[1]
+	case "flex-flow":
+		direction, wrap := "", ""
+		for _, attr := range strings.Fields(cssValue) {
+			switch {
+			case direction == "" && valueValidators["flex-direction"](attr):
+				direction = attr
+			case wrap == "" && valueValidators["flex-wrap"](attr):
+				wrap = attr
+			default:
+				return false
+			}
+		}
+		if direction == "" {
+			direction = "row"
+		}
+		if wrap == "" {
+			wrap = "nowrap"
+		}
+		tagStyle.FlexDirection = direction
+		tagStyle.FlexWrap = wrap
+	case "flex":
+		return setFlexStyle(tagStyle, cssValue)
+	case "justify-items":
+		tagStyle.JustifyItems = cssValue
+	case "justify-self":
+		tagStyle.JustifySelf = cssValue
+	case "grid-template-columns":
+		tagStyle.GridTemplateColumns = cssValue
+	case "grid-template-rows":
+		tagStyle.GridTemplateRows = cssValue
+	case "grid-template-areas":
+		tagStyle.GridTemplateAreas = cssValue
+	case "grid-template":
+		attrList := strings.Split(cssValue, "/")
+		if len(attrList) != 2 || !isValidValue("grid-template-rows", attrList[0]) || !isValidValue("grid-template-columns", attrList[1]) {
+			return false
+		}
+		tagStyle.GridTemplateRows = strings.Trim(attrList[0], CUT_SET_LIST)
+		tagStyle.GridTemplateColumns = strings.Trim(attrList[1], CUT_SET_LIST)
+	case "grid-auto-columns":
+		tagStyle.GridAutoColumns = cssValue
+	case "grid-auto-rows":
+		tagStyle.GridAutoRows = cssValue
+	case "grid-auto-flow":
+		tagStyle.GridAutoFlow = cssValue
+	case "grid-row-start":
+		tagStyle.GridRowStart = cssValue
+	case "grid-row-end":
+		tagStyle.GridRowEnd = cssValue
+	case "grid-column-start":
+		tagStyle.GridColumnStart = cssValue
+	case "grid-column-end":
+		tagStyle.GridColumnEnd = cssValue
+	case "grid-row":
+		return setGridLine(&tagStyle.GridRowStart, &tagStyle.GridRowEnd, cssValue)
+	case "grid-column":
+		return setGridLine(&tagStyle.GridColumnStart, &tagStyle.GridColumnEnd, cssValue)
+	case "grid-area":
+		return setGridArea(tagStyle, cssValue)
+	case "float":
+		tagStyle.Float = cssValue
+	case "clear":
+		tagStyle.Clear = cssValue
+	case "overflow":
+		tagStyle.Overflow = cssValue
+	case "table-layout":
+		tagStyle.TableLayout = cssValue
+	case "border-collapse":
+		tagStyle.BorderCollapse = cssValue
+	case "border-spacing":
+		tagStyle.BorderSpacing = cssValue
+	case "caption-side":
+		tagStyle.CaptionSide = cssValue
+	case "column-count":
+		tagStyle.ColumnCount = cssValue
+	case "column-width":
+		tagStyle.ColumnWidth = cssValue
+	case "columns":
+		setColumns(tagStyle, cssValue)
+	case "column-rule-width":
+		if px, keyword := borderWidthKeywords[cssValue]; keyword {
+			cssValue = px
+		}
+		tagStyle.ColumnRuleWidth = cssValue
+	case "column-rule-style":
+		tagStyle.ColumnRuleStyle = cssValue
+	case "column-rule-color":
+		tagStyle.ColumnRuleColor = cssValue
+	case "column-rule":
+		return setColumnRule(tagStyle, cssValue)
+	case "list-style-type":
+		tagStyle.ListStyleType = cssValue
+	case "list-style-position":
+		tagStyle.ListStylePosition = cssValue
+	case "list-style-image":
+		tagStyle.ListStyleImage = cssValue
+	case "list-style":
+		setListStyle(tagStyle, cssValue)
+	case "content":
+		tagStyle.Content = cssValue
+	case "counter-reset":
+		tagStyle.CounterReset = cssValue
+	case "counter-increment":
+		tagStyle.CounterIncrement = cssValue
+	case "counter-set":
+		tagStyle.CounterSet = cssValue
+	case "padding":
+		return setPos(&tagStyle.Padding, cssValue, func(value string) bool { return isValidValue("padding-top", value) })
+	case "margin":
+		return setPos(&tagStyle.Margin, cssValue, func(value string) bool { return isValidValue("margin-top", value) })
 	case "border":
-		attrList := strings.Split(cssValue, " ")
-		if len(attrList) == 3 {
-			tagStyle.BorderWidth.Left = attrList[0]
-			tagStyle.BorderStyle.Left = attrList[1]
-			tagStyle.BorderColor.Left = attrList[2]
-
-			tagStyle.BorderWidth.Right = attrList[0]
-			tagStyle.BorderStyle.Right = attrList[1]
-			tagStyle.BorderColor.Right = attrList[2]
-
-			tagStyle.BorderWidth.Top = attrList[0]
-			tagStyle.BorderStyle.Top = attrList[1]
-			tagStyle.BorderColor.Top = attrList[2]
-
-			tagStyle.BorderWidth.Bottom = attrList[0]
-			tagStyle.BorderStyle.Bottom = attrList[1]
-			tagStyle.BorderColor.Bottom = attrList[2]
-		} else {
-			panic(fmt.Sprintf("unsupported border value %v", cStyle))
+		width, style, color, ok := parseBorder(cssValue)
+		if !ok {
+			return false
 		}
+		tagStyle.BorderWidth = Pos{Left: width, Top: width, Right: width, Bottom: width}
+		tagStyle.BorderStyle = Pos{Left: style, Top: style, Right: style, Bottom: style}
+		tagStyle.BorderColor = Pos{Left: color, Top: color, Right: color, Bottom: color}
 	case "border-left":
-		attrList := strings.Split(cssValue, " ")
-		if len(attrList) == 3 {
-			tagStyle.BorderWidth.Left = attrList[0]
-			tagStyle.BorderStyle.Left = attrList[1]
-			tagStyle.BorderColor.Left = attrList[2]
-		} else {
-			panic(fmt.Sprintf("unsupported border-left value %v", cStyle))
+		width, style, color, ok := parseBorder(cssValue)
+		if !ok {
+			return false
 		}
+		tagStyle.BorderWidth.Left, tagStyle.BorderStyle.Left, tagStyle.BorderColor.Left = width, style, color
 	case "border-right":
-		attrList := strings.Split(cssValue, " ")
-		if len(attrList) == 3 {
-			tagStyle.BorderWidth.Right = attrList[0]
-			tagStyle.BorderStyle.Right = attrList[1]
-			tagStyle.BorderColor.Right = attrList[2]
-		} else {
-			panic(fmt.Sprintf("unsupported border-right value %v", cStyle))
+		width, style, color, ok := parseBorder(cssValue)
+		if !ok {
+			return false
 		}
+		tagStyle.BorderWidth.Right, tagStyle.BorderStyle.Right, tagStyle.BorderColor.Right = width, style, color
 	case "border-top":
-		attrList := strings.Split(cssValue, " ")
-		if len(attrList) == 3 {
-			tagStyle.BorderWidth.Top = attrList[0]
-			tagStyle.BorderStyle.Top = attrList[1]
-			tagStyle.BorderColor.Top = attrList[2]
-		} else {
-			panic(fmt.Sprintf("unsupported border-top value %v", cStyle))
+		width, style, color, ok := parseBorder(cssValue)
+		if !ok {
+			return false
 		}
+		tagStyle.BorderWidth.Top, tagStyle.BorderStyle.Top, tagStyle.BorderColor.Top = width, style, color
 	case "border-bottom":
-		attrList := strings.Split(cssValue, " ")
-		if len(attrList) == 3 {
-			tagStyle.BorderWidth.Bottom = attrList[0]
-			tagStyle.BorderStyle.Bottom = attrList[1]
-			tagStyle.BorderColor.Bottom = attrList[2]
-		} else {
-			panic(fmt.Sprintf("unsupported border-bottom value %v", cStyle))
+		width, style, color, ok := parseBorder(cssValue)
+		if !ok {
+			return false
 		}
+		tagStyle.BorderWidth.Bottom, tagStyle.BorderStyle.Bottom, tagStyle.BorderColor.Bottom = width, style, color
 	case "border-radius":
-		attrList := strings.Split(cssValue, " ")
-		switch len(attrList) {
-		case 1:
-			tagStyle.BorderRadius.Top = attrList[0]
-			tagStyle.BorderRadius.Bottom = attrList[0]
-			tagStyle.BorderRadius.Left = attrList[0]
-			tagStyle.BorderRadius.Right = attrList[0]
-		case 2:
-			tagStyle.BorderRadius.Top = attrList[0]
-			tagStyle.BorderRadius.Bottom = attrList[0]
-			tagStyle.BorderRadius.Left = attrList[1]
-			tagStyle.BorderRadius.Right = attrList[1]
-		case 3:
-			tagStyle.BorderRadius.Top = attrList[0]
-			tagStyle.BorderRadius.Left = attrList[1]
-			tagStyle.BorderRadius.Right = attrList[1]
-			tagStyle.BorderRadius.Bottom = attrList[2]
-		case 4:
-			tagStyle.BorderRadius.Top = attrList[0]
-			tagStyle.BorderRadius.Right = attrList[1]
-			tagStyle.BorderRadius.Bottom = attrList[2]
-			tagStyle.BorderRadius.Left = attrList[3]
-		default:
-			panic(fmt.Sprintf("unsupported border-radius value %v", cStyle))
-		}
+		return setPos(&tagStyle.BorderRadius, cssValue, lengthOrKeyword(true, false))
 	default:
-		panic(fmt.Sprintf("unsupported %v", cStyle))
+		// Unknown properties are ignored
+		return false
+	}
+	return true
+}
 
+// setPos sets the 1 to 4 values of a shorthand like margin on the sides of
+// pos, the sides left out taking the value of the opposite side. It returns
+// false when a value is not valid.
+func setPos(pos *Pos, cssValue string, valid func(string) bool) bool {
+	attrList := splitValues(cssValue)
+	if len(attrList) < 1 || len(attrList) > 4 {
+		return false
 	}
+	for _, attr := range attrList {
+		if !valid(attr) {
+			return false
+		}
+	}
+	// Top, right, bottom and left
+	sides := append(attrList, make([]string, 4-len(attrList))...)
+	if sides[1] == "" {
+		sides[1] = sides[0]
+	}
+	if sides[2] == "" {
+		sides[2] = sides[0]
+	}
+	if sides[3] == "" {
+		sides[3] = sides[1]
+	}
+	*pos = Pos{Top: sides[0], Right: sides[1], Bottom: sides[2], Left: sides[3]}
+	return true
 }
 
+// GetBodyStyle returns the body of a document with its <style> and
+// <link rel=stylesheet> elements, in document order.
 func GetBodyStyle(htmlNode *html.Node) (body *html.Node, styleList []*html.Node) {
 	for ch := htmlNode.FirstChild; ch != nil; {
 		switch ch.Data {
@@ -299,6 +485,10 @@ func GetBodyStyle(htmlNode *html.Node) (body *html.Node, styleList []*html.Node)
 			}
 		case "style":
 			styleList = append(styleList, ch)
+		case "link":
+			if isStylesheetLink(ch) {
+				styleList = append(styleList, ch)
+			}
 		default:
 			tmpBody, tmpStyle := GetBodyStyle(ch)
 			if tmpBody != nil {
@@ -313,51 +503,60 @@ func GetBodyStyle(htmlNode *html.Node) (body *html.Node, styleList []*html.Node)
 	return
 }
 
-// 暂时不考虑多个选择器问题
-func (p *TagStyle) selected(currentDom *Dom) bool {
-	selectors := strings.Split(p.Selector, " ")
-	// ignore parents
-	if len(selectors) > 1 {
-		panic(fmt.Sprintf("multiple selector will be supported later  %v", p.Selector))
+// selected reports whether the rule selects currentDom, and the specificity
+// of its most specific selector doing so. The rules of the ::before and
+// ::after pseudo-elements select the ones of their originating element.
+func (p *TagStyle) selected(currentDom *Dom) (specificity, bool) {
+	var spec specificity
+	target, pseudo := currentDom, ""
+	if currentDom.isPseudoElement() {
+		target, pseudo = currentDom.parent, strings.TrimPrefix(currentDom.TagName, "::")
 	}
-
-	subSels := strings.Split(selectors[0], ".")
-	if subSels[0] != "" {
-		if subSels[0] != currentDom.TagName {
-			return false
-		}
+	if target == nil || target.node == nil {
+		return spec, false
 	}
-	classList := subSels[1:]
-	if len(classList) == 0 {
-		return true
+	selectors := p.selectors
+	if selectors == nil {
+		// An invalid selector selects nothing
+		selectors, _ = parseSelectorList(p.Selector)
 	}
-	re := regexp.MustCompile("/\\s+/")
-	domClasses := re.Split(currentDom.TagClass, -1)
-	domClassMap := make(map[string]bool)
-	for _, class := range domClasses {
-		if class != "" {
-			domClassMap[class] = true
+	matched := false
+	for _, sel := range selectors {
+		if sel.pseudoElement == pseudo && sel.matches(target.node) {
+			if s := sel.specificity(); !matched || spec.less(s) {
+				spec = s
+			}
+			matched = true
 		}
 	}
-	matched := true
-	for _, class := range classList {
-		if _, exist := domClassMap[class]; !exist {
-			matched = false
+	return spec, matched
+}
+
+// loadFontFamily returns the first family of the comma separated families
+// whose font file loads, empty when none does.
+func loadFontFamily(families string) string {
+	for _, family := range strings.Split(families, ",") {
+		family = strings.Trim(strings.TrimSpace(family), "'\"")
+		if family != "" && initFontMap(family) == nil {
+			return family
 		}
 	}
-	return matched
+	return ""
 }
 
-func initFontMap(fontFamily string) {
+func initFontMap(fontFamily string) error {
+	fontMu.Lock()
+	defer fontMu.Unlock()
 	if _, exist := fontMapping[fontFamily]; exist {
-		return
+		return nil
 	}
 	fontPath := conf.GConf["font_path"]
 	f, err := getFontFromFile(fontPath + "/" + fontFamily)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	fontMapping[fontFamily] = f
+	return nil
 }
 
 func getFontFromFile(fontfile string) (*truetype.Font, error) {
@@ -391,5 +590,71 @@ func getInheritStyle(pStyle *TagStyle, curStyle *TagStyle) *TagStyle {
 	if curStyle.FontFamily == "" && pStyle.FontFamily != "" {
 		curStyle.FontFamily = pStyle.FontFamily
 	}
+	if curStyle.Visibility == "" && pStyle.Visibility != "" {
+		curStyle.Visibility = pStyle.Visibility
+	}
+	if curStyle.TextAlign == "" && pStyle.TextAlign != "" {
+		curStyle.TextAlign = pStyle.TextAlign
+	}
+	if curStyle.FontWeight == "" && pStyle.FontWeight != "" {
+		curStyle.FontWeight = pStyle.FontWeight
+	}
+	if curStyle.FontStyle == "" && pStyle.FontStyle != "" {
+		curStyle.FontStyle = pStyle.FontStyle
+	}
+	if curStyle.WhiteSpace == "" && pStyle.WhiteSpace != "" {
+		curStyle.WhiteSpace = pStyle.WhiteSpace
+	}
+	if curStyle.BorderCollapse == "" && pStyle.BorderCollapse != "" {
+		curStyle.BorderCollapse = pStyle.BorderCollapse
+	}
+	if curStyle.BorderSpacing == "" && pStyle.BorderSpacing != "" {
+		curStyle.BorderSpacing = pStyle.BorderSpacing
+	}
+	if curStyle.CaptionSide == "" && pStyle.CaptionSide != "" {
+		curStyle.CaptionSide = pStyle.CaptionSide
+	}
+	if curStyle.ListStyleType == "" && pStyle.ListStyleType != "" {
+		curStyle.ListStyleType = pStyle.ListStyleType
+	}
+	if curStyle.ListStylePosition == "" && pStyle.ListStylePosition != "" {
+		curStyle.ListStylePosition = pStyle.ListStylePosition
+	}
+	if curStyle.ListStyleImage == "" && pStyle.ListStyleImage != "" {
+		curStyle.ListStyleImage = pStyle.ListStyleImage
+	}
 	return curStyle
 }
+
+var inlineTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "big": true,
+	"br": true, "cite": true, "code": true, "data": true, "dfn": true, "em": true,
+	"font": true, "i": true, "img": true, "kbd": true, "label": true, "mark": true,
+	"q": true, "s": true, "samp": true, "small": true, "span": true, "strike": true,
+	"strong": true, "sub": true, "sup": true, "time": true, "tt": true, "u": true,
+	"var": true,
+}
+
+var hiddenTags = map[string]bool{
+	"head": true, "link": true, "meta": true, "script": true, "style": true,
+	"template": true, "title": true,
+}
+
+// defaultDisplay returns the display of an element without a display style.
+func defaultDisplay(tagName string) string {
+	switch {
+	case hiddenTags[tagName]:
+		return "none"
+	case inlineTags[tagName]:
+		return "inline"
+	case tableDisplays[tagName] != "":
+		return tableDisplays[tagName]
+	case tagName == "li":
+		return "list-item"
+	case strings.HasPrefix(tagName, "::"):
+		return "inline"
+	case tagName == "button" || tagName == "input" || tagName == "select" || tagName == "textarea":
+		return "inline-block"
+	}
+	return "block"
+}
@@ -0,0 +1,73 @@
+package html2img
+
+import "testing"
+
+// computedStyleTest is a document whose element with the id e has the value
+// want for a property of its computed style.
+type computedStyleTest struct {
+	name    string
+	css     string
+	content string
+	want    string
+}
+
+func runComputedStyleTests(t *testing.T, property func(*TagStyle) string, tests []computedStyleTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := findDom(layoutBody(t, test.css, test.content), "e")
+			if d == nil {
+				t.Fatal("no element #e")
+			}
+			if got := property(d.TagStyle); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func colorOf(style *TagStyle) string {
+	return style.Color
+}
+
+func TestInlineStyleAttribute(t *testing.T) {
+	runComputedStyleTests(t, colorOf, []computedStyleTest{
+		{"applied", "", `<p id="e" style="color: red">a</p>`, "red"},
+		{"overrides rules", "#e { color: blue }", `<p id="e" style="color: red">a</p>`, "red"},
+		{"important rule wins", "p { color: blue !important }", `<p id="e" style="color: red">a</p>`, "blue"},
+		{"important inline wins", "p { color: blue !important }", `<p id="e" style="color: red !important">a</p>`, "red"},
+		{"last declaration wins", "", `<p id="e" style="color: red; color: green">a</p>`, "green"},
+		{"invalid ignored", "", `<p id="e" style="color: red; color: nonsense">a</p>`, "red"},
+		{"without spaces", "", `<p id="e" style="color:red;">a</p>`, "red"},
+		{"upper case property", "", `<p id="e" style="COLOR: red">a</p>`, "red"},
+		{"comments", "", `<p id="e" style="/* x */ color: /* y */ red">a</p>`, "red"},
+		{"inherited", "", `<div style="color: red"><p id="e">a</p></div>`, "red"},
+		{"garbage", "p { color: blue }", `<p id="e" style=";;: ; {color: red} ;color:">a</p>`, "blue"},
+	})
+}
+
+func TestRenderInlineStyleAttribute(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"invalid values", styledDocument("", `<div style="width: 10xp; margin: a b c d e; border: 1px 2px 3px 4px; padding: -1px; display: foo">a</div>`)},
+		{"unterminated", styledDocument("", `<div style="color: 'red; width: (10px">a</div>`)},
+		{"unknown properties", styledDocument("", `<div style="foo: bar; --x: 1; -webkit-thing: 2">a</div>`)},
+	})
+}
+
+func TestFontFamily(t *testing.T) {
+	runComputedStyleTests(t, func(s *TagStyle) string { return s.FontFamily }, []computedStyleTest{
+		{"font file", "p { font-family: Go-Bold.ttf }", `<p id="e">a</p>`, "Go-Bold.ttf"},
+		{"quoted", `p { font-family: "Go-Bold.ttf" }`, `<p id="e">a</p>`, "Go-Bold.ttf"},
+		{"first family with a font", "p { font-family: Arial, 'Missing', GoItalic.ttf, Go-Bold.ttf }", `<p id="e">a</p>`, "GoItalic.ttf"},
+		{"missing font inherits", "p { font-family: Arial, sans-serif }", `<p id="e">a</p>`, "Go.ttf"},
+		{"missing font keeps earlier", "p { font-family: Go-Bold.ttf; font-family: Missing }", `<p id="e">a</p>`, "Go-Bold.ttf"},
+		{"missing font of a variable", ":root { --f: Missing } p { font-family: var(--f) }", `<p id="e">a</p>`, "Go.ttf"},
+		{"font of a variable", ":root { --f: Missing, GoItalic.ttf } p { font-family: var(--f) }", `<p id="e">a</p>`, "GoItalic.ttf"},
+	})
+}
+
+func TestRenderMissingFonts(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"missing fonts", styledDocument("p { font-family: Arial, sans-serif } span { font-family: Missing }", "<p>a <span>b</span></p>")},
+	})
+}
@@ -0,0 +1,277 @@
+package html2img
+
+import (
+	"strings"
+)
+
+// Stylesheet is a parsed stylesheet.
+type Stylesheet struct {
+	Rules []*Rule
+}
+
+// Rule is a style rule or an at-rule.
+type Rule struct {
+	// Name of an at-rule without its @, empty for a style rule
+	AtKeyword string
+	// Selector list of a style rule, or text between the name of an at-rule
+	// and its block
+	Prelude string
+	// Declarations of a style rule or of an at-rule like @font-face
+	Declarations []*Declaration
+	// Rules nested in an at-rule like @media
+	Rules []*Rule
+	// Whether the at-rule has a block rather than ending with a semicolon
+	HasBlock bool
+	Pos      Position
+
+	prelude []componentValue
+}
+
+// Declaration is a property and its value.
+type Declaration struct {
+	// Lower case name of the property, with the case of custom properties kept
+	Name      string
+	Value     string
+	Important bool
+	Pos       Position
+
+	value []componentValue
+}
+
+// componentValue is a token, a function with its arguments or a block with
+// its content.
+type componentValue struct {
+	// The token, the function token of a function, or the opening token of a
+	// block
+	token    cssToken
+	children []componentValue
+}
+
+func (v *componentValue) isFunction() bool {
+	return v.token.kind == tokenFunction
+}
+
+func (v *componentValue) isBlock() bool {
+	kind := v.token.kind
+	return kind == tokenOpenCurly || kind == tokenOpenSquare || kind == tokenOpenParen
+}
+
+// ruleListAtRules are the at-rules whose block holds rules rather than
+// declarations.
+var ruleListAtRules = map[string]bool{
+	"media": true, "supports": true, "document": true, "-moz-document": true,
+	"layer": true, "container": true,
+}
+
+// ParseStylesheet parses css. Invalid rules and declarations are dropped as
+// the error handling of CSS Syntax Level 3 does.
+func ParseStylesheet(css string) *Stylesheet {
+	return &Stylesheet{Rules: parseRuleList(parseComponentValues(tokenizeCSS(css)), true)}
+}
+
+// parseDeclarations parses the content of a style attribute.
+func parseDeclarations(css string) []*Declaration {
+	declarations, _ := parseDeclarationList(parseComponentValues(tokenizeCSS(css)))
+	return declarations
+}
+
+// parseComponentValues groups tokens into functions and blocks.
+func parseComponentValues(tokens []cssToken) []componentValue {
+	values, _ := consumeComponentValues(tokens, -1)
+	return values
+}
+
+// consumeComponentValues consumes component values up to the closing token
+// of kind end, and returns them with the number of tokens consumed.
+func consumeComponentValues(tokens []cssToken, end int) ([]componentValue, int) {
+	var values []componentValue
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		var closing int
+		switch token.kind {
+		case end:
+			return values, i + 1
+		case tokenFunction, tokenOpenParen:
+			closing = tokenCloseParen
+		case tokenOpenSquare:
+			closing = tokenCloseSquare
+		case tokenOpenCurly:
+			closing = tokenCloseCurly
+		default:
+			values = append(values, componentValue{token: token})
+			continue
+		}
+		children, n := consumeComponentValues(tokens[i+1:], closing)
+		values = append(values, componentValue{token: token, children: children})
+		i += n
+	}
+	return values, len(tokens)
+}
+
+// parseRuleList parses the rules of a stylesheet or of the block of an
+// at-rule like @media.
+func parseRuleList(values []componentValue, topLevel bool) []*Rule {
+	var rules []*Rule
+	for i := 0; i < len(values); {
+		switch values[i].token.kind {
+		case tokenWhitespace:
+			i++
+		case tokenCDO, tokenCDC:
+			if topLevel {
+				i++
+				continue
+			}
+			fallthrough
+		default:
+			rule, n := consumeRule(values[i:])
+			if rule != nil {
+				rules = append(rules, rule)
+			}
+			i += n
+		}
+	}
+	return rules
+}
+
+// consumeRule consumes an at-rule or a style rule, returning a nil rule when
+// the style rule has no block.
+func consumeRule(values []componentValue) (*Rule, int) {
+	rule := &Rule{Pos: values[0].token.pos}
+	i := 0
+	if values[0].token.kind == tokenAtKeyword {
+		rule.AtKeyword = strings.ToLower(values[0].token.value)
+		i++
+	}
+	for ; i < len(values); i++ {
+		v := values[i]
+		if v.token.kind == tokenSemicolon && rule.AtKeyword != "" {
+			rule.setPrelude(values[1:i])
+			return rule, i + 1
+		}
+		if v.token.kind == tokenOpenCurly {
+			start := 0
+			if rule.AtKeyword != "" {
+				start = 1
+			}
+			rule.setPrelude(values[start:i])
+			rule.HasBlock = true
+			if ruleListAtRules[rule.AtKeyword] {
+				rule.Rules = parseRuleList(v.children, false)
+			} else {
+				rule.Declarations, rule.Rules = parseDeclarationList(v.children)
+			}
+			return rule, i + 1
+		}
+	}
+	if rule.AtKeyword == "" {
+		return nil, i
+	}
+	rule.setPrelude(values[1:])
+	return rule, i
+}
+
+func (r *Rule) setPrelude(prelude []componentValue) {
+	r.prelude = trimWhitespace(prelude)
+	r.Prelude = serializeComponentValues(r.prelude)
+}
+
+// parseDeclarationList parses the content of the block of a style rule, with
+// the at-rules nested in it.
+func parseDeclarationList(values []componentValue) ([]*Declaration, []*Rule) {
+	var declarations []*Declaration
+	var rules []*Rule
+	for i := 0; i < len(values); {
+		switch values[i].token.kind {
+		case tokenWhitespace, tokenSemicolon:
+			i++
+		case tokenAtKeyword:
+			rule, n := consumeRule(values[i:])
+			rules = append(rules, rule)
+			i += n
+		default:
+			end := i
+			for end < len(values) && values[end].token.kind != tokenSemicolon {
+				end++
+			}
+			if declaration := consumeDeclaration(values[i:end]); declaration != nil {
+				declarations = append(declarations, declaration)
+			}
+			i = end
+		}
+	}
+	return declarations, rules
+}
+
+// consumeDeclaration parses a declaration, returning nil when it is invalid.
+func consumeDeclaration(values []componentValue) *Declaration {
+	if values[0].token.kind != tokenIdent {
+		return nil
+	}
+	declaration := &Declaration{Name: values[0].token.value, Pos: values[0].token.pos}
+	if !strings.HasPrefix(declaration.Name, "--") {
+		declaration.Name = strings.ToLower(declaration.Name)
+	}
+	rest := trimWhitespace(values[1:])
+	if len(rest) == 0 || rest[0].token.kind != tokenColon {
+		return nil
+	}
+	value := trimWhitespace(rest[1:])
+	if n := len(value); n >= 2 && value[n-1].token.kind == tokenIdent && strings.EqualFold(value[n-1].token.value, "important") {
+		if bang := trimWhitespace(value[:n-1]); len(bang) > 0 {
+			if last := bang[len(bang)-1].token; last.kind == tokenDelim && last.value == "!" {
+				declaration.Important = true
+				value = trimWhitespace(bang[:len(bang)-1])
+			}
+		}
+	}
+	declaration.value = value
+	declaration.Value = serializeComponentValues(value)
+	return declaration
+}
+
+func trimWhitespace(values []componentValue) []componentValue {
+	for len(values) > 0 && values[0].token.kind == tokenWhitespace {
+		values = values[1:]
+	}
+	for len(values) > 0 && values[len(values)-1].token.kind == tokenWhitespace {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+var closingTokens = map[int]string{
+	tokenFunction:   ")",
+	tokenOpenParen:  ")",
+	tokenOpenSquare: "]",
+	tokenOpenCurly:  "}",
+}
+
+// serializeComponentValues returns the source text of values, with a single
+// space for each run of white space and without the comments.
+func serializeComponentValues(values []componentValue) string {
+	var text strings.Builder
+	for i := range values {
+		writeComponentValue(&text, &values[i])
+	}
+	return text.String()
+}
+
+func writeComponentValue(text *strings.Builder, v *componentValue) {
+	if v.token.kind == tokenWhitespace {
+		text.WriteByte(' ')
+		return
+	}
+	text.WriteString(v.token.text)
+	if v.isFunction() || v.isBlock() {
+		for i := range v.children {
+			writeComponentValue(text, &v.children[i])
+		}
+		text.WriteString(closingTokens[v.token.kind])
+	}
+}
+
+// tagStyles returns the style rules of the stylesheet that apply to media,
+// with a rule for each selector of a selector list.
+func (s *Stylesheet) tagStyles(media *mediaContext) []*TagStyle {
+	return (&styleLoader{media: media}).tagStyles(s, "")
+}
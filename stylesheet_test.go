@@ -0,0 +1,79 @@
+package html2img
+
+import (
+	"strings"
+	"testing"
+)
+
+// describeRules returns the rules with their prelude, declarations and
+// nested rules.
+func describeRules(rules []*Rule) string {
+	var parts []string
+	for _, rule := range rules {
+		var text strings.Builder
+		if rule.AtKeyword != "" {
+			text.WriteString("@" + rule.AtKeyword + " ")
+		}
+		text.WriteString(rule.Prelude)
+		if rule.HasBlock || rule.AtKeyword == "" {
+			text.WriteString("{")
+			var declarations []string
+			for _, d := range rule.Declarations {
+				declaration := d.Name + ":" + d.Value
+				if d.Important {
+					declaration += "!"
+				}
+				declarations = append(declarations, declaration)
+			}
+			text.WriteString(strings.Join(declarations, ";"))
+			text.WriteString(describeRules(rule.Rules))
+			text.WriteString("}")
+		}
+		parts = append(parts, text.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParseStylesheet(t *testing.T) {
+	tests := []struct {
+		css  string
+		want string
+	}{
+		{"p { color: red }", "p{color:red}"},
+		{"p{color:red;;margin:0 auto;}", "p{color:red;margin:0 auto}"},
+		{"div  >  p , a { COLOR : Red }", "div > p , a{color:Red}"},
+		{"p { color: red !important; margin: 0 ! IMPORTANT }", "p{color:red!;margin:0!}"},
+		{"p { --Brand: { a } }", "p{--Brand:{ a }}"},
+		{"p { color red; margin: 0 }", "p{margin:0}"},
+		{"p { 12: red; margin: 0 }", "p{margin:0}"},
+		{"p { color: red } garbage", "p{color:red}"},
+		{"} p { color: red } a { }", "} p{color:red} a{}"},
+		{"p { color: red", "p{color:red}"},
+		{"p { width: calc(1px + (2px * 3)); }", "p{width:calc(1px + (2px * 3))}"},
+		{"p { content: \"a;b}\" }", "p{content:\"a;b}\"}"},
+		{"p { background-image: url(a;b.png) }", "p{background-image:url(a;b.png)}"},
+		{"<!-- p { color: red } -->", "p{color:red}"},
+		{"@media screen { p { color: red } } a { color: blue }", "@media screen{p{color:red}} a{color:blue}"},
+		{"@import url(a.css) screen; p { }", "@import url(a.css) screen p{}"},
+		{"@font-face { font-family: x }", "@font-face {font-family:x}"},
+		{"@unknown foo { bar } p { color: red }", "@unknown foo{} p{color:red}"},
+		{"@media screen { p { color: red }", "@media screen{p{color:red}}"},
+		{"p { color: red; @media print { color: blue } }", "p{color:red@media print{}}"},
+	}
+	for _, test := range tests {
+		if got := describeRules(ParseStylesheet(test.css).Rules); got != test.want {
+			t.Errorf("ParseStylesheet(%q) = %v, want %v", test.css, got, test.want)
+		}
+	}
+}
+
+func TestRuleErrorRecovery(t *testing.T) {
+	runComputedStyleTests(t, colorOf, []computedStyleTest{
+		{"invalid declaration", "p { color: ; color: red; color: }", `<p id="e">a</p>`, "red"},
+		{"invalid selector", "p { color: red } p::foo, p { color: blue }", `<p id="e">a</p>`, "red"},
+		{"unclosed block", "p { color: red } p { color: blue", `<p id="e">a</p>`, "blue"},
+		{"stray braces", "}} p { color: blue } p { color: red }", `<p id="e">a</p>`, "red"},
+		{"unknown at-rule", "@foo { p { color: blue } } p { color: red }", `<p id="e">a</p>`, "red"},
+		{"html comments", "<!-- p { color: red } -->", `<p id="e">a</p>`, "red"},
+	})
+}
@@ -0,0 +1,764 @@
+package html2img
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tableCell is a cell in the slots of the table grid.
+type tableCell struct {
+	dom     *Dom
+	row     int
+	column  int
+	rowSpan int
+	colSpan int
+}
+
+// tableRow is a row of the table grid with the cells that start in it.
+type tableRow struct {
+	dom   *Dom
+	cells []*tableCell
+}
+
+type tableGrid struct {
+	// Row groups and rows directly in the table, the header first and the
+	// footer last
+	groups  []*Dom
+	rows    []*tableRow
+	cells   []*tableCell
+	columns int
+	// Widths set on col and colgroup elements
+	columnWidths []string
+}
+
+var tableDisplays = map[string]string{
+	"table":    "table",
+	"caption":  "table-caption",
+	"colgroup": "table-column-group",
+	"col":      "table-column",
+	"thead":    "table-header-group",
+	"tbody":    "table-row-group",
+	"tfoot":    "table-footer-group",
+	"tr":       "table-row",
+	"td":       "table-cell",
+	"th":       "table-cell",
+}
+
+func (d *Dom) isTable() bool {
+	return d.TagStyle.Display == "table" || d.TagStyle.Display == "inline-table"
+}
+
+func isTableRowGroup(display string) bool {
+	return display == "table-row-group" || display == "table-header-group" || display == "table-footer-group"
+}
+
+// fixTableChildren drops the white space between the parts of a table and
+// wraps the children that do not belong in a table, row group or row in
+// anonymous rows and cells.
+func fixTableChildren(dom *Dom) {
+	display := dom.TagStyle.Display
+	var belongs func(child *Dom) bool
+	var wrapper string
+	switch {
+	case dom.isTable():
+		belongs = func(child *Dom) bool {
+			switch child.TagStyle.Display {
+			case "table-caption", "table-column-group", "table-column", "table-row":
+				return true
+			}
+			return isTableRowGroup(child.TagStyle.Display)
+		}
+		wrapper = "table-row"
+	case isTableRowGroup(display):
+		belongs = func(child *Dom) bool {
+			return child.TagStyle.Display == "table-row"
+		}
+		wrapper = "table-row"
+	case display == "table-row":
+		belongs = func(child *Dom) bool {
+			return child.TagStyle.Display == "table-cell"
+		}
+		wrapper = "table-cell"
+	case display == "table-column-group":
+		var children []*Dom
+		for _, child := range dom.Children {
+			if child.TagStyle.Display == "table-column" {
+				children = append(children, child)
+			}
+		}
+		dom.Children = children
+		return
+	default:
+		return
+	}
+
+	var children, run []*Dom
+	flush := func() {
+		if len(run) > 0 {
+			anonymous := &Dom{
+				DomType:  DOM_TYPE_ELEMENT,
+				TagStyle: getInheritStyle(dom.TagStyle, &TagStyle{Display: wrapper}),
+				parent:   dom,
+				Children: run,
+			}
+			for _, child := range run {
+				child.parent = anonymous
+			}
+			fixTableChildren(anonymous)
+			children = append(children, anonymous)
+		}
+		run = nil
+	}
+	for _, child := range dom.Children {
+		if child.DomType == DOM_TYPE_TEXT && strings.Trim(child.TagData.(string), CUT_SET_LIST) == "" {
+			continue
+		}
+		if belongs(child) {
+			flush()
+			children = append(children, child)
+			continue
+		}
+		run = append(run, child)
+	}
+	flush()
+	dom.Children = children
+}
+
+// wrapTable returns the anonymous box holding a table with its captions, or
+// the table itself when it has none.
+func wrapTable(table *Dom) *Dom {
+	var captions, children []*Dom
+	for _, child := range table.Children {
+		if child.TagStyle.Display == "table-caption" {
+			captions = append(captions, child)
+			continue
+		}
+		children = append(children, child)
+	}
+	if len(captions) == 0 {
+		return table
+	}
+	display := "block"
+	if table.TagStyle.Display == "inline-table" {
+		display = "inline-block"
+	}
+	var pStyle *TagStyle
+	if table.parent != nil {
+		pStyle = table.parent.TagStyle
+	}
+	wrapper := &Dom{
+		DomType:  DOM_TYPE_ELEMENT,
+		TagStyle: getInheritStyle(pStyle, &TagStyle{Display: display}),
+		parent:   table.parent,
+		Children: append(captions, table),
+		table:    table,
+	}
+	for _, child := range wrapper.Children {
+		child.parent = wrapper
+	}
+	table.Children = children
+	return wrapper
+}
+
+// layoutTableWrapper lays out a table with its captions above or below it, as
+// wide as the table.
+func layoutTableWrapper(parents []*Dom, cbHeight int) ([]*Dom, EndOffset) {
+	wrapper := parents[len(parents)-1]
+	table := wrapper.table
+	style := table.TagStyle
+	pWidth := wrapper.Inner.X2 - wrapper.Inner.X1 + 1
+	marginLeft, contentWidth := blockWidth(table, pWidth)
+	x := wrapper.Inner.X1 + marginLeft
+	width := getIntPx(style.Padding.Left, pWidth) + contentWidth + getIntPx(style.Padding.Right, pWidth)
+	y := wrapper.Inner.Y1
+
+	var children []*Dom
+	layoutCaptions := func(side string) {
+		for _, caption := range wrapper.sourceChildren() {
+			if caption == table || (caption.TagStyle.CaptionSide == "bottom") != (side == "bottom") {
+				continue
+			}
+			captionStyle := caption.TagStyle
+			captionMarginLeft := getIntPx(captionStyle.Margin.Left, width)
+			captionMarginRight := getIntPx(captionStyle.Margin.Right, width)
+			captionMarginTop := getIntPx(captionStyle.Margin.Top, width)
+			captionWidth := width - captionMarginLeft - captionMarginRight -
+				getIntPx(captionStyle.Padding.Left, width) - getIntPx(captionStyle.Padding.Right, width)
+			layoutBox(caption, parents, x+captionMarginLeft, y+captionMarginTop, captionWidth, width, cbHeight)
+			caption.Outer = Rectangle{
+				X1: x,
+				Y1: y,
+				X2: x + width - 1,
+				Y2: caption.Container.Y2 + getIntPx(captionStyle.Margin.Bottom, width),
+			}
+			y = caption.Outer.Y2 + 1
+			children = append(children, caption)
+		}
+	}
+
+	layoutCaptions("top")
+	marginTop := getIntPx(style.Margin.Top, pWidth)
+	layoutBox(table, parents, x, y+marginTop, contentWidth, pWidth, cbHeight)
+	table.Outer = Rectangle{
+		X1: wrapper.Inner.X1,
+		Y1: y,
+		X2: wrapper.Inner.X2,
+		Y2: table.Container.Y2 + getIntPx(style.Margin.Bottom, pWidth),
+	}
+	y = table.Outer.Y2 + 1
+	if table.hasBaseline {
+		wrapper.baseline = table.Container.Y1 + table.baseline - wrapper.Container.Y1
+		wrapper.hasBaseline = true
+	}
+	if style.Position == "relative" {
+		table.layoutAbsolutes()
+		table.shift(relativeOffset(table, pWidth, cbHeight))
+	}
+	children = append(children, table)
+	layoutCaptions("bottom")
+	return children, EndOffset{Y2: y - 1}
+}
+
+func newTableGrid(table *Dom) *tableGrid {
+	grid := &tableGrid{}
+	addColumns := func(dom *Dom, width string) {
+		for i := 0; i < getSpanAttr(dom, "span", 1); i++ {
+			grid.columnWidths = append(grid.columnWidths, width)
+		}
+	}
+	var header, body, footer []*Dom
+	for _, child := range table.sourceChildren() {
+		switch child.TagStyle.Display {
+		case "table-column-group":
+			cols := child.sourceChildren()
+			if len(cols) == 0 {
+				addColumns(child, child.TagStyle.Width)
+			}
+			for _, col := range cols {
+				width := col.TagStyle.Width
+				if width == "" {
+					width = child.TagStyle.Width
+				}
+				addColumns(col, width)
+			}
+		case "table-column":
+			addColumns(child, child.TagStyle.Width)
+		case "table-header-group":
+			if header == nil {
+				header = append(header, child)
+			} else {
+				body = append(body, child)
+			}
+		case "table-footer-group":
+			if footer == nil {
+				footer = append(footer, child)
+			} else {
+				body = append(body, child)
+			}
+		case "table-row", "table-row-group":
+			body = append(body, child)
+		}
+	}
+	grid.groups = append(append(header, body...), footer...)
+
+	occupied := make(map[[2]int]bool)
+	for _, group := range grid.groups {
+		rows := []*Dom{group}
+		if group.TagStyle.Display != "table-row" {
+			rows = group.sourceChildren()
+		}
+		groupEnd := len(grid.rows) + len(rows)
+		for _, rowDom := range rows {
+			r := len(grid.rows)
+			row := &tableRow{dom: rowDom}
+			c := 0
+			for _, cellDom := range rowDom.sourceChildren() {
+				for occupied[[2]int{r, c}] {
+					c++
+				}
+				cell := &tableCell{
+					dom:     cellDom,
+					row:     r,
+					column:  c,
+					rowSpan: getSpanAttr(cellDom, "rowspan", 1),
+					colSpan: maxInt(getSpanAttr(cellDom, "colspan", 1), 1),
+				}
+				// A row span of zero and the ones past the group end at the
+				// last row of the group
+				if cell.rowSpan == 0 || r+cell.rowSpan > groupEnd {
+					cell.rowSpan = groupEnd - r
+				}
+				for i := r; i < r+cell.rowSpan; i++ {
+					for j := c; j < c+cell.colSpan; j++ {
+						occupied[[2]int{i, j}] = true
+					}
+				}
+				row.cells = append(row.cells, cell)
+				grid.cells = append(grid.cells, cell)
+				c += cell.colSpan
+				grid.columns = maxInt(grid.columns, c)
+			}
+			grid.rows = append(grid.rows, row)
+		}
+	}
+	grid.columns = maxInt(grid.columns, len(grid.columnWidths))
+	return grid
+}
+
+// getSpanAttr returns the span, colspan or rowspan attribute of a dom.
+func getSpanAttr(dom *Dom, key string, defaultValue int) int {
+	span, err := strconv.Atoi(strings.Trim(dom.attr(key), CUT_SET_LIST))
+	if err != nil || span < 0 {
+		return defaultValue
+	}
+	return minInt(span, 1000)
+}
+
+// tableSpacing returns the space around the cells of a table and between
+// them, horizontally and vertically. Collapsed borders are shared by the
+// cells next to each other, which overlap by the widest border.
+func tableSpacing(table *Dom, grid *tableGrid) (int, int, int, int) {
+	style := table.TagStyle
+	if style.BorderCollapse == "collapse" {
+		borderX, borderY := 0, 0
+		width := func(borderStyle, borderWidth string) int {
+			if borderStyle == "" || borderStyle == "none" {
+				return 0
+			}
+			return getIntSize(borderWidth)
+		}
+		for _, dom := range append([]*Dom{table}, cellDoms(grid)...) {
+			s := dom.TagStyle
+			borderX = maxInt(borderX, maxInt(width(s.BorderStyle.Left, s.BorderWidth.Left), width(s.BorderStyle.Right, s.BorderWidth.Right)))
+			borderY = maxInt(borderY, maxInt(width(s.BorderStyle.Top, s.BorderWidth.Top), width(s.BorderStyle.Bottom, s.BorderWidth.Bottom)))
+		}
+		return 0, -borderX, 0, -borderY
+	}
+	spacing := strings.Fields(style.BorderSpacing)
+	switch len(spacing) {
+	case 0:
+		return 0, 0, 0, 0
+	case 1:
+		spacingX := getIntSize(spacing[0])
+		return spacingX, spacingX, spacingX, spacingX
+	}
+	spacingX, spacingY := getIntSize(spacing[0]), getIntSize(spacing[1])
+	return spacingX, spacingX, spacingY, spacingY
+}
+
+func cellDoms(grid *tableGrid) []*Dom {
+	var doms []*Dom
+	for _, cell := range grid.cells {
+		doms = append(doms, cell.dom)
+	}
+	return doms
+}
+
+// specifiedWidth returns a width set in px, or in percent of the table when
+// its width is known.
+func specifiedWidth(width string, tableWidth int) (int, bool) {
+	switch {
+	case strings.HasSuffix(width, "px"):
+		return getIntSize(width), true
+	case strings.HasSuffix(width, "%") && tableWidth >= 0:
+		return getIntPx(width, tableWidth), true
+	}
+	return 0, false
+}
+
+// cellWidths returns the min-content and max-content widths of the border box
+// of a cell, and whether its width is set.
+func cellWidths(cell *Dom, tableWidth int) (int, int, bool) {
+	style := cell.TagStyle
+	padding := getIntSize(style.Padding.Left) + getIntSize(style.Padding.Right)
+	minWidth, maxWidth := intrinsicContentWidth(cell)
+	width, fixed := specifiedWidth(style.Width, tableWidth)
+	if fixed {
+		minWidth = maxInt(minWidth, width)
+		maxWidth = minWidth
+	}
+	return minWidth + padding, maxWidth + padding, fixed
+}
+
+// columnBounds returns the min-content and max-content widths of the columns
+// by the automatic table layout, and whether their width is set.
+func (grid *tableGrid) columnBounds(tableWidth, between int) ([]int, []int, []bool) {
+	n := grid.columns
+	minWidths, maxWidths := make([]int, n), make([]int, n)
+	fixedWidths, fixed := make([]int, n), make([]bool, n)
+	for i, width := range grid.columnWidths {
+		if w, ok := specifiedWidth(width, tableWidth); ok {
+			fixedWidths[i] = w
+			fixed[i] = true
+		}
+	}
+	cells := append([]*tableCell(nil), grid.cells...)
+	sort.SliceStable(cells, func(i, j int) bool {
+		return cells[i].colSpan < cells[j].colSpan
+	})
+	for _, cell := range cells {
+		cellMin, cellMax, cellFixed := cellWidths(cell.dom, tableWidth)
+		if cell.colSpan == 1 {
+			i := cell.column
+			minWidths[i] = maxInt(minWidths[i], cellMin)
+			maxWidths[i] = maxInt(maxWidths[i], cellMax)
+			if cellFixed {
+				fixedWidths[i] = maxInt(fixedWidths[i], cellMax)
+				fixed[i] = true
+			}
+			continue
+		}
+		// A cell spanning columns widens them by what they miss, in
+		// proportion to their max-content width
+		spanned := make([]int, cell.colSpan)
+		copy(spanned, maxWidths[cell.column:cell.column+cell.colSpan])
+		growColumns(minWidths[cell.column:cell.column+cell.colSpan], spanned, cellMin-between*(cell.colSpan-1))
+		growColumns(maxWidths[cell.column:cell.column+cell.colSpan], spanned, cellMax-between*(cell.colSpan-1))
+	}
+	for i := range maxWidths {
+		minWidths[i] = maxInt(minWidths[i], 0)
+		if fixed[i] {
+			minWidths[i] = maxInt(minWidths[i], fixedWidths[i])
+			maxWidths[i] = minWidths[i]
+		}
+		maxWidths[i] = maxInt(maxWidths[i], minWidths[i])
+	}
+	return minWidths, maxWidths, fixed
+}
+
+// growColumns widens columns so that together they are at least need wide,
+// sharing the extra space in proportion to weights.
+func growColumns(widths, weights []int, need int) {
+	extra := need
+	for _, width := range widths {
+		extra -= width
+	}
+	if extra > 0 {
+		distribute(widths, weights, extra)
+	}
+}
+
+// distribute adds extra to sizes in proportion to weights, or evenly when
+// they are all zero.
+func distribute(sizes, weights []int, extra int) {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	given := 0
+	for i := range sizes {
+		share := extra * (i + 1) / len(sizes)
+		if total > 0 {
+			weight := 0
+			for _, w := range weights[:i+1] {
+				weight += w
+			}
+			share = extra * weight / total
+		}
+		sizes[i] += share - given
+		given = share
+	}
+}
+
+// autoColumnWidths sizes the columns by the automatic table layout to fill
+// avail, between their min-content and max-content widths when it is too
+// narrow for all of them.
+func autoColumnWidths(minWidths, maxWidths []int, fixed []bool, avail int) []int {
+	widths := make([]int, len(minWidths))
+	sumMin, sumMax := 0, 0
+	for i := range widths {
+		sumMin += minWidths[i]
+		sumMax += maxWidths[i]
+	}
+	switch {
+	case avail >= sumMax:
+		copy(widths, maxWidths)
+		// Columns with a set width only grow when all of them have one
+		weights := make([]int, len(widths))
+		var growing []int
+		for i := range widths {
+			if !fixed[i] {
+				growing = append(growing, i)
+			}
+		}
+		if len(growing) == 0 {
+			for i := range widths {
+				growing = append(growing, i)
+			}
+		}
+		grown := make([]int, len(growing))
+		for j, i := range growing {
+			grown[j] = widths[i]
+			weights[j] = maxWidths[i]
+		}
+		distribute(grown, weights[:len(growing)], avail-sumMax)
+		for j, i := range growing {
+			widths[i] = grown[j]
+		}
+	case avail > sumMin:
+		copy(widths, minWidths)
+		weights := make([]int, len(widths))
+		for i := range widths {
+			weights[i] = maxWidths[i] - minWidths[i]
+		}
+		distribute(widths, weights, avail-sumMin)
+	default:
+		copy(widths, minWidths)
+	}
+	return widths
+}
+
+// fixedColumnWidths sizes the columns by the fixed table layout: from the col
+// elements and the cells of the first row, the other columns sharing what is
+// left of avail.
+func (grid *tableGrid) fixedColumnWidths(tableWidth, between, avail int) []int {
+	n := grid.columns
+	widths := make([]int, n)
+	set := make([]bool, n)
+	for i, width := range grid.columnWidths {
+		if w, ok := specifiedWidth(width, tableWidth); ok {
+			widths[i], set[i] = w, true
+		}
+	}
+	if len(grid.rows) > 0 {
+		for _, cell := range grid.rows[0].cells {
+			style := cell.dom.TagStyle
+			w, ok := specifiedWidth(style.Width, tableWidth)
+			if !ok || set[cell.column] {
+				continue
+			}
+			w += getIntSize(style.Padding.Left) + getIntSize(style.Padding.Right)
+			share := (w - between*(cell.colSpan-1)) / cell.colSpan
+			for i := cell.column; i < cell.column+cell.colSpan; i++ {
+				widths[i], set[i] = share, true
+			}
+		}
+	}
+	free := avail
+	var unset []int
+	for i := range widths {
+		free -= widths[i]
+		if !set[i] {
+			unset = append(unset, i)
+		}
+	}
+	if free <= 0 {
+		return widths
+	}
+	if len(unset) == 0 {
+		distribute(widths, widths, free)
+		return widths
+	}
+	grown := make([]int, len(unset))
+	distribute(grown, make([]int, len(unset)), free)
+	for j, i := range unset {
+		widths[i] = grown[j]
+	}
+	return widths
+}
+
+// firstBaseline returns the distance from the top of the border box of a laid
+// out dom to the baseline of its first line.
+func firstBaseline(d *Dom) (int, bool) {
+	for _, child := range d.Children {
+		if child.isPositionAbsolute() {
+			continue
+		}
+		if child.DomType == DOM_TYPE_TEXT {
+			if child.hasBaseline {
+				return child.Container.Y1 + child.baseline - d.Container.Y1, true
+			}
+			continue
+		}
+		if baseline, ok := firstBaseline(child); ok {
+			return child.Container.Y1 + baseline - d.Container.Y1, true
+		}
+	}
+	return 0, false
+}
+
+// layoutTable lays out the rows and cells of the table at the end of parents
+// in its content box.
+func layoutTable(parents []*Dom, cbHeight int) ([]*Dom, EndOffset) {
+	table := parents[len(parents)-1]
+	table.hasBaseline = false
+	style := table.TagStyle
+	grid := newTableGrid(table)
+	edgeX, betweenX, edgeY, betweenY := tableSpacing(table, grid)
+	width := table.Inner.X2 - table.Inner.X1 + 1
+	n := grid.columns
+
+	avail := width - 2*edgeX - betweenX*maxInt(n-1, 0)
+	var columnWidths []int
+	if style.TableLayout == "fixed" && style.Width != "" && !isAuto(style.Width) {
+		columnWidths = grid.fixedColumnWidths(width, betweenX, avail)
+	} else {
+		minWidths, maxWidths, fixed := grid.columnBounds(width, betweenX)
+		columnWidths = autoColumnWidths(minWidths, maxWidths, fixed, avail)
+	}
+	columnX := make([]int, n+1)
+	columnX[0] = table.Inner.X1 + edgeX
+	for i, w := range columnWidths {
+		columnX[i+1] = columnX[i] + w + betweenX
+	}
+
+	// Cells are laid out at the origin in the width of their columns to find
+	// the heights of the rows
+	rowParents := make(map[*Dom][]*Dom)
+	for _, group := range grid.groups {
+		groupParents := append(append([]*Dom(nil), parents...), group)
+		if group.TagStyle.Display == "table-row" {
+			rowParents[group] = groupParents
+			continue
+		}
+		for _, row := range group.sourceChildren() {
+			rowParents[row] = append(append([]*Dom(nil), groupParents...), row)
+		}
+	}
+	heights := make([]int, len(grid.rows))
+	baselines := make([]int, len(grid.rows))
+	cellBaselines := make(map[*tableCell]int)
+	for r, row := range grid.rows {
+		heights[r] = getIntPx(row.dom.TagStyle.Height, cbHeight)
+		for _, cell := range row.cells {
+			cellStyle := cell.dom.TagStyle
+			cellWidth := columnX[cell.column+cell.colSpan] - betweenX - columnX[cell.column]
+			contentWidth := cellWidth - getIntPx(cellStyle.Padding.Left, width) - getIntPx(cellStyle.Padding.Right, width)
+			layoutBox(cell.dom, rowParents[row.dom], 0, 0, contentWidth, width, cbHeight)
+			cell.dom.Outer = cell.dom.Container
+			if cellStyle.VerticalAlign == "" || cellStyle.VerticalAlign == "baseline" {
+				baseline, ok := firstBaseline(cell.dom)
+				if !ok {
+					baseline = cell.dom.Inner.Y2 + 1 - cell.dom.Container.Y1
+				}
+				cellBaselines[cell] = baseline
+				baselines[r] = maxInt(baselines[r], baseline)
+			}
+		}
+	}
+	cellHeight := func(cell *tableCell) int {
+		return cell.dom.Container.Y2 - cell.dom.Container.Y1 + 1
+	}
+	for r, row := range grid.rows {
+		for _, cell := range row.cells {
+			height := cellHeight(cell)
+			if baseline, ok := cellBaselines[cell]; ok {
+				height += baselines[r] - baseline
+			}
+			if cell.rowSpan == 1 {
+				heights[r] = maxInt(heights[r], height)
+			}
+		}
+	}
+	// Cells spanning rows make the rows taller by what they miss
+	for _, cell := range grid.cells {
+		if cell.rowSpan > 1 {
+			spanned := heights[cell.row : cell.row+cell.rowSpan]
+			growColumns(spanned, make([]int, len(spanned)), cellHeight(cell)-betweenY*(cell.rowSpan-1))
+		}
+	}
+	total := 2*edgeY + betweenY*maxInt(len(heights)-1, 0)
+	for _, height := range heights {
+		total += height
+	}
+	if !table.isAutoHeight() && len(heights) > 0 {
+		if extra := table.Inner.Y2 - table.Inner.Y1 + 1 - total; extra > 0 {
+			distribute(heights, heights, extra)
+			total += extra
+		}
+	}
+	rowY := make([]int, len(heights)+1)
+	rowY[0] = table.Inner.Y1 + edgeY
+	for r, height := range heights {
+		rowY[r+1] = rowY[r] + height + betweenY
+	}
+
+	for r, row := range grid.rows {
+		for _, cell := range row.cells {
+			dom := cell.dom
+			top := rowY[r]
+			areaHeight := rowY[r+cell.rowSpan] - betweenY - top
+			offset := 0
+			switch dom.TagStyle.VerticalAlign {
+			case "top":
+			case "middle":
+				offset = (areaHeight - cellHeight(cell)) / 2
+			case "bottom":
+				offset = areaHeight - cellHeight(cell)
+			default:
+				offset = baselines[r] - cellBaselines[cell]
+			}
+			dom.shift(columnX[cell.column]-dom.Container.X1, top+offset-dom.Container.Y1)
+			dom.Container.Y1 = top
+			dom.Container.Y2 = top + areaHeight - 1
+			dom.baseline += offset
+			dom.Outer = dom.Container
+			if dom.TagStyle.Position == "relative" {
+				dom.layoutAbsolutes()
+				dom.shift(relativeOffset(dom, width, cbHeight))
+			}
+			if r == 0 && !table.hasBaseline {
+				if baseline, ok := firstBaseline(dom); ok {
+					table.baseline = dom.Container.Y1 + baseline - table.Container.Y1
+					table.hasBaseline = true
+				}
+			}
+		}
+		rowDom := row.dom
+		rowDom.Container = Rectangle{X1: columnX[0], Y1: rowY[r], X2: columnX[n] - betweenX - 1, Y2: rowY[r] + heights[r] - 1}
+		rowDom.Inner = rowDom.Container
+		rowDom.Outer = rowDom.Container
+		rowDom.Children = rowDom.sourceChildren()
+		if rowDom.TagStyle.Position == "relative" {
+			rowDom.layoutAbsolutes()
+			rowDom.shift(relativeOffset(rowDom, width, cbHeight))
+		}
+	}
+
+	var children []*Dom
+	r := 0
+	for _, group := range grid.groups {
+		children = append(children, group)
+		if group.TagStyle.Display == "table-row" {
+			r++
+			continue
+		}
+		rows := len(group.sourceChildren())
+		bottom := rowY[r] - 1
+		if rows > 0 {
+			bottom = rowY[r+rows] - betweenY - 1
+		}
+		group.Container = Rectangle{X1: columnX[0], Y1: rowY[r], X2: columnX[n] - betweenX - 1, Y2: bottom}
+		group.Inner = group.Container
+		group.Outer = group.Container
+		group.Children = group.sourceChildren()
+		if group.TagStyle.Position == "relative" {
+			group.layoutAbsolutes()
+			group.shift(relativeOffset(group, width, cbHeight))
+		}
+		r += rows
+	}
+
+	endY := table.Inner.Y1 + total - 1
+	if !table.isAutoHeight() && table.Inner.Y2 < endY {
+		// The height of a table is a minimum
+		table.Inner.Y2 = endY
+	}
+	return children, EndOffset{Y2: endY}
+}
+
+// intrinsicTableWidth returns the min-content and max-content widths of the
+// content of a table.
+func intrinsicTableWidth(dom *Dom) (int, int) {
+	grid := newTableGrid(dom)
+	edgeX, betweenX, _, _ := tableSpacing(dom, grid)
+	minWidths, maxWidths, _ := grid.columnBounds(-1, betweenX)
+	minWidth := 2*edgeX + betweenX*maxInt(grid.columns-1, 0)
+	maxWidth := minWidth
+	for i := range minWidths {
+		minWidth += minWidths[i]
+		maxWidth += maxWidths[i]
+	}
+	return maxInt(minWidth, 0), maxInt(maxWidth, 0)
+}
@@ -0,0 +1,75 @@
+package html2img
+
+import "testing"
+
+func TestTableLayout(t *testing.T) {
+	css := "body { margin: 0 } table { border-spacing: 0 } td { padding: 0; height: 20px }"
+	runBoxTests(t, []boxTest{
+		{
+			name:    "fixed widths",
+			css:     css,
+			content: `<table><tr><td id="a" style="width: 100px"></td><td id="b" style="width: 50px"></td></tr><tr><td id="c"></td><td id="d"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 149, 19}, "c": {0, 20, 99, 39}, "d": {100, 20, 149, 39}},
+		},
+		{
+			name:    "table width distributed",
+			css:     css,
+			content: `<table style="width: 300px; table-layout: fixed"><tr><td id="a" style="width: 100px"></td><td id="b"></td><td id="c"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {0, 0, 99, 19}, "b": {100, 0, 199, 19}, "c": {200, 0, 299, 19}},
+		},
+		{
+			name:    "border-spacing",
+			css:     css,
+			content: `<table style="border-spacing: 10px 5px"><tr><td id="a" style="width: 50px"></td><td id="b" style="width: 50px"></td></tr><tr><td id="c"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {10, 5, 59, 24}, "b": {70, 5, 119, 24}, "c": {10, 30, 59, 49}},
+		},
+		{
+			name:    "colspan",
+			css:     css,
+			content: `<table><tr><td id="a" colspan="2"></td></tr><tr><td id="b" style="width: 50px"></td><td id="c" style="width: 70px"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {0, 0, 119, 19}, "c": {50, 20, 119, 39}},
+		},
+		{
+			name:    "rowspan",
+			css:     css,
+			content: `<table><tr><td id="a" rowspan="2" style="width: 50px"></td><td id="b" style="width: 50px"></td></tr><tr><td id="c"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 39}, "c": {50, 20, 99, 39}},
+		},
+		{
+			name:    "row height",
+			css:     css,
+			content: `<table><tr><td id="a" style="width: 50px; height: 40px"></td><td id="b" style="width: 50px"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {0, 0, 49, 39}, "b": {50, 0, 99, 39}},
+		},
+		{
+			name:    "centered table",
+			css:     css,
+			content: `<table style="margin: 0 auto"><tr><td id="a" style="width: 100px"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {350, 0, 449, 19}},
+		},
+		{
+			name:    "caption",
+			css:     css + " caption { height: 10px }",
+			content: `<table><caption id="cap"></caption><tr><td id="a" style="width: 100px"></td></tr></table>`,
+			want:    map[string]Rectangle{"cap": {0, 0, 99, 9}, "a": {0, 10, 99, 29}},
+		},
+		{
+			name:    "relative cell",
+			css:     css,
+			content: `<table><tr><td id="a" style="width: 50px; position: relative; left: 5px; top: 3px"><div id="abs" style="position: absolute; left: 1px; top: 1px; width: 5px; height: 5px"></div></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {5, 3, 54, 22}, "abs": {6, 4, 10, 8}},
+		},
+		{
+			name:    "relative row",
+			css:     css,
+			content: `<table><tr id="r" style="position: relative; top: 10px"><td id="a" style="width: 50px"></td></tr></table>`,
+			want:    map[string]Rectangle{"a": {0, 10, 49, 29}},
+		},
+		{
+			name:    "display table",
+			css:     css + " .t { display: table } .r { display: table-row } .c { display: table-cell; height: 20px; width: 30px }",
+			content: `<div class="t"><div class="r"><div id="a" class="c"></div><div id="b" class="c"></div></div></div>`,
+			want:    map[string]Rectangle{"a": {0, 0, 29, 19}, "b": {30, 0, 59, 19}},
+		},
+	})
+}
@@ -0,0 +1,148 @@
+package html2img
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/math/f64"
+)
+
+var transformFuncRe = regexp.MustCompile(`([a-zA-Z0-9]+)\(([^)]*)\)`)
+
+// getTransform returns the matrix mapping a box painted without its transform
+// onto the page, applied around the transform origin.
+func getTransform(style *TagStyle, box Rectangle) f64.Aff3 {
+	width := float64(box.X2 - box.X1 + 1)
+	height := float64(box.Y2 - box.Y1 + 1)
+	originX, originY := getTransformOrigin(style.TransformOrigin, width, height)
+	originX += float64(box.X1)
+	originY += float64(box.Y1)
+
+	matrix := f64.Aff3{1, 0, originX, 0, 1, originY}
+	for _, fn := range transformFuncRe.FindAllStringSubmatch(style.Transform, -1) {
+		args := strings.FieldsFunc(fn[2], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		})
+		matrix = mulAff3(matrix, getTransformFunc(strings.ToLower(fn[1]), args, width, height))
+	}
+	return mulAff3(matrix, f64.Aff3{1, 0, -originX, 0, 1, -originY})
+}
+
+// getTransformFunc returns the matrix of a single transform function.
+func getTransformFunc(name string, args []string, width, height float64) f64.Aff3 {
+	arg := func(i int, ref float64, def float64) float64 {
+		if i >= len(args) {
+			return def
+		}
+		if strings.HasSuffix(args[i], "%") {
+			percent, _ := strconv.ParseFloat(strings.TrimSuffix(args[i], "%"), 64)
+			return percent * ref / 100
+		}
+		value, _ := strconv.ParseFloat(strings.TrimSuffix(args[i], "px"), 64)
+		return value
+	}
+	angle := func(i int) float64 {
+		if i >= len(args) {
+			return 0
+		}
+		return getAngle(args[i])
+	}
+	switch name {
+	case "translate":
+		return f64.Aff3{1, 0, arg(0, width, 0), 0, 1, arg(1, height, 0)}
+	case "translatex":
+		return f64.Aff3{1, 0, arg(0, width, 0), 0, 1, 0}
+	case "translatey":
+		return f64.Aff3{1, 0, 0, 0, 1, arg(0, height, 0)}
+	case "scale":
+		sx := arg(0, 1, 1)
+		return f64.Aff3{sx, 0, 0, 0, arg(1, 1, sx), 0}
+	case "scalex":
+		return f64.Aff3{arg(0, 1, 1), 0, 0, 0, 1, 0}
+	case "scaley":
+		return f64.Aff3{1, 0, 0, 0, arg(0, 1, 1), 0}
+	case "rotate":
+		sin, cos := math.Sincos(angle(0))
+		return f64.Aff3{cos, -sin, 0, sin, cos, 0}
+	case "skew":
+		return f64.Aff3{1, math.Tan(angle(0)), 0, math.Tan(angle(1)), 1, 0}
+	case "skewx":
+		return f64.Aff3{1, math.Tan(angle(0)), 0, 0, 1, 0}
+	case "skewy":
+		return f64.Aff3{1, 0, 0, math.Tan(angle(0)), 1, 0}
+	case "matrix":
+		// matrix(a, b, c, d, e, f) maps x to a*x + c*y + e and y to b*x + d*y + f
+		return f64.Aff3{arg(0, 1, 1), arg(2, 1, 0), arg(4, 1, 0), arg(1, 1, 0), arg(3, 1, 1), arg(5, 1, 0)}
+	}
+	return f64.Aff3{1, 0, 0, 0, 1, 0}
+}
+
+// getAngle returns an angle in radians.
+func getAngle(angle string) float64 {
+	units := []struct {
+		suffix string
+		ratio  float64
+	}{
+		{"deg", math.Pi / 180},
+		{"grad", math.Pi / 200},
+		{"rad", 1},
+		{"turn", 2 * math.Pi},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(angle, unit.suffix) {
+			value, _ := strconv.ParseFloat(strings.TrimSuffix(angle, unit.suffix), 64)
+			return value * unit.ratio
+		}
+	}
+	value, _ := strconv.ParseFloat(angle, 64)
+	return value
+}
+
+// getTransformOrigin returns the transform origin relative to the box,
+// defaulting to its center.
+func getTransformOrigin(origin string, width, height float64) (float64, float64) {
+	x, y := width/2, height/2
+	parts := strings.Fields(origin)
+	if len(parts) == 1 && (parts[0] == "top" || parts[0] == "bottom") {
+		parts = []string{"center", parts[0]}
+	}
+	if len(parts) >= 2 && (parts[0] == "top" || parts[0] == "bottom" || parts[1] == "left" || parts[1] == "right") {
+		parts[0], parts[1] = parts[1], parts[0]
+	}
+	for i, part := range parts {
+		if i > 1 {
+			break
+		}
+		ref := width
+		if i == 1 {
+			ref = height
+		}
+		var value float64
+		switch part {
+		case "left", "top":
+			value = 0
+		case "center":
+			value = ref / 2
+		case "right", "bottom":
+			value = ref
+		default:
+			value = float64(getIntPx(part, int(ref)))
+		}
+		if i == 0 {
+			x = value
+		} else {
+			y = value
+		}
+	}
+	return x, y
+}
+
+// mulAff3 returns the matrix applying n first and then m.
+func mulAff3(m, n f64.Aff3) f64.Aff3 {
+	return f64.Aff3{
+		m[0]*n[0] + m[1]*n[3], m[0]*n[1] + m[1]*n[4], m[0]*n[2] + m[1]*n[5] + m[2],
+		m[3]*n[0] + m[4]*n[3], m[3]*n[1] + m[4]*n[4], m[3]*n[2] + m[4]*n[5] + m[5],
+	}
+}
@@ -0,0 +1,70 @@
+package html2img
+
+import (
+	"sync"
+)
+
+// DefaultUserAgentStyle is the stylesheet giving html elements their default
+// look.
+const DefaultUserAgentStyle = `
+p, dl, ul, ol, menu { margin: 1em 0; }
+blockquote, figure { margin: 1em 40px; }
+pre { margin: 1em 0; white-space: pre; }
+center { text-align: center; }
+h1 { font-size: 2em; margin: 0.67em 0; }
+h2 { font-size: 1.5em; margin: 0.83em 0; }
+h3 { font-size: 1.17em; margin: 1em 0; }
+h4 { font-size: 1em; margin: 1.33em 0; }
+h5 { font-size: 0.83em; margin: 1.67em 0; }
+h6 { font-size: 0.67em; margin: 2.33em 0; }
+h1, h2, h3, h4, h5, h6, b, strong, th { font-weight: bold; }
+hr { height: 2px; margin: 0.5em 0; border-top: 1px solid #9a9a9a; border-bottom: 1px solid #eeeeee; }
+ul, ol, menu { padding-left: 40px; }
+ul ul, ol ul, ul ol, ol ol, ul menu, ol menu, menu ul, menu ol { margin: 0; }
+ul ul, ol ul, menu ul, ul menu { list-style-type: circle; }
+ul ul ul, ul ol ul, ol ul ul, ol ol ul { list-style-type: square; }
+dd { margin-left: 40px; }
+th { text-align: center; padding: 1px; }
+td { padding: 1px; }
+table { border-spacing: 2px; }
+caption { text-align: center; }
+address, i, em, cite, var, dfn { font-style: italic; }
+u, ins { text-decoration: underline; }
+s, strike, del { text-decoration: line-through; }
+a:link { color: #0000ee; text-decoration: underline; }
+mark { background-color: #ffff00; color: #000000; }
+small { font-size: smaller; }
+big { font-size: larger; }
+sub { vertical-align: sub; font-size: smaller; }
+sup { vertical-align: super; font-size: smaller; }
+nobr { white-space: nowrap; }
+`
+
+var (
+	defaultUserAgentStyles    []*TagStyle
+	defaultUserAgentStyleOnce sync.Once
+)
+
+// parseUserAgentStyle parses a user agent stylesheet, whose rules come before
+// the author rules in the cascade.
+func parseUserAgentStyle(style string) []*TagStyle {
+	tagStyleList := ParseStyle([]string{style})
+	for _, tagStyle := range tagStyleList {
+		tagStyle.userAgent = true
+	}
+	return tagStyleList
+}
+
+// userAgentStyles returns the rules of the user agent stylesheet of r.
+func (r *Renderer) userAgentStyles() []*TagStyle {
+	switch {
+	case r.DisableUserAgentStyle:
+		return nil
+	case r.UserAgentStyle != "":
+		return parseUserAgentStyle(r.UserAgentStyle)
+	}
+	defaultUserAgentStyleOnce.Do(func() {
+		defaultUserAgentStyles = parseUserAgentStyle(DefaultUserAgentStyle)
+	})
+	return defaultUserAgentStyles
+}
@@ -0,0 +1,77 @@
+package html2img
+
+import "testing"
+
+func TestUserAgentStyle(t *testing.T) {
+	block := `<div style="height: 10px"></div>`
+	tests := []struct {
+		name     string
+		renderer *Renderer
+		content  string
+		want     map[string]Rectangle
+	}{
+		{"p margins", &Renderer{}, block + `<p id="p" style="height: 10px"></p>`, map[string]Rectangle{"p": {0, 26, 799, 35}}},
+		{"h1 margins in its font size", &Renderer{}, block + `<h1 id="h" style="height: 10px"></h1>`, map[string]Rectangle{"h": {0, 31, 799, 40}}},
+		{"hr", &Renderer{}, block + `<hr id="hr">`, map[string]Rectangle{"hr": {0, 18, 799, 19}}},
+		{"list padding", &Renderer{}, `<ul style="margin: 0"><li id="li" style="height: 10px"></li></ul>`, map[string]Rectangle{"li": {40, 0, 799, 9}}},
+		{"blockquote", &Renderer{}, `<blockquote id="q" style="margin-top: 0; height: 10px"></blockquote>`, map[string]Rectangle{"q": {40, 0, 759, 9}}},
+		{"disabled", &Renderer{DisableUserAgentStyle: true}, block + `<p id="p" style="height: 10px"></p>`, map[string]Rectangle{"p": {0, 10, 799, 19}}},
+		{"replaced", &Renderer{UserAgentStyle: "p { margin: 5px 0 }"}, block + `<h1 id="h" style="height: 10px"></h1><p id="p" style="height: 10px"></p>`,
+			map[string]Rectangle{"h": {0, 10, 799, 19}, "p": {0, 25, 799, 34}}},
+		{"author rules override", &Renderer{UserAgentStyle: "p#p { margin-top: 30px }"}, block + `<style>p { margin-top: 2px }</style><p id="p" style="height: 10px"></p>`,
+			map[string]Rectangle{"p": {0, 12, 799, 21}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := layoutHTML(t, test.renderer, "<body>"+test.content+"</body>")
+			for id, want := range test.want {
+				if got := rect(t, body, id); got != want {
+					t.Errorf("#%v = %+v, want %+v", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUserAgentFonts(t *testing.T) {
+	tests := []struct {
+		content string
+		size    float64
+		bold    bool
+		italic  bool
+	}{
+		{`<h1 id="e">a</h1>`, 32, true, false},
+		{`<h2 id="e">a</h2>`, 24, true, false},
+		{`<h6 id="e">a</h6>`, 10.72, true, false},
+		{`<b id="e">a</b>`, 16, true, false},
+		{`<strong id="e">a</strong>`, 16, true, false},
+		{`<em id="e">a</em>`, 16, false, true},
+		{`<p><small id="e">a</small></p>`, 16 / 1.2, false, false},
+		{`<p style="font-size: 20px"><big id="e">a</big></p>`, 24, false, false},
+		{`<table><tr><th id="e">a</th></tr></table>`, 16, true, false},
+	}
+	for _, test := range tests {
+		body := layoutHTML(t, &Renderer{}, "<body>"+test.content+"</body>")
+		d := findDom(body, "e")
+		if d == nil {
+			t.Errorf("%v: no element", test.content)
+			continue
+		}
+		size := getFontSize(d.TagStyle)
+		if size < test.size-0.01 || size > test.size+0.01 || isBold(d.TagStyle) != test.bold || isItalic(d.TagStyle) != test.italic {
+			t.Errorf("%v: size %v bold %v italic %v, want %v %v %v", test.content,
+				size, isBold(d.TagStyle), isItalic(d.TagStyle), test.size, test.bold, test.italic)
+		}
+	}
+}
+
+func TestRenderUserAgentStyle(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"hr and br", styledDocument("", "<p>a<br>b</p><hr><p>c<br><br></p>")},
+		{"headings", styledDocument("", "<h1>a</h1><h2>b</h2><h3>c</h3><h4>d</h4><h5>e</h5><h6>f</h6>")},
+		{"phrasing", styledDocument("", "<p><u>a</u> <s>b</s> <mark>c</mark> <sub>d</sub><sup>e</sup> <a href=x>f</a></p>")},
+	})
+	runRenderTests(t, &Renderer{UserAgentStyle: "p { margin: foo; color: } }}{"}, []renderTest{
+		{"invalid user agent style", styledDocument("", "<p>a</p>")},
+	})
+}
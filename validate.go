@@ -0,0 +1,299 @@
+package html2img
+
+import (
+	"strconv"
+	"strings"
+)
+
+// valueValidators check the values of the properties whose syntax is known.
+// A declaration whose value its validator rejects is invalid and ignored.
+var valueValidators = map[string]func(string) bool{
+	"width":  lengthOrKeyword(true, false, "auto", "min-content", "max-content", "fit-content"),
+	"height": lengthOrKeyword(true, false, "auto", "min-content", "max-content", "fit-content"),
+
+	"left":   lengthOrKeyword(true, true, "auto"),
+	"top":    lengthOrKeyword(true, true, "auto"),
+	"right":  lengthOrKeyword(true, true, "auto"),
+	"bottom": lengthOrKeyword(true, true, "auto"),
+
+	"margin-left":    lengthOrKeyword(true, true, "auto"),
+	"margin-top":     lengthOrKeyword(true, true, "auto"),
+	"margin-right":   lengthOrKeyword(true, true, "auto"),
+	"margin-bottom":  lengthOrKeyword(true, true, "auto"),
+	"padding-left":   lengthOrKeyword(true, false),
+	"padding-top":    lengthOrKeyword(true, false),
+	"padding-right":  lengthOrKeyword(true, false),
+	"padding-bottom": lengthOrKeyword(true, false),
+
+	"display": keywords("none", "inline", "block", "inline-block", "flow-root", "list-item", "contents",
+		"flex", "inline-flex", "grid", "inline-grid",
+		"table", "inline-table", "table-caption", "table-row", "table-cell", "table-column", "table-column-group",
+		"table-row-group", "table-header-group", "table-footer-group"),
+	"visibility": keywords("visible", "hidden", "collapse"),
+	"position":   keywords("static", "relative", "absolute", "fixed", "sticky"),
+	"float":      keywords("none", "left", "right"),
+	"clear":      keywords("none", "left", "right", "both"),
+	"overflow":   keywords("visible", "hidden", "clip", "scroll", "auto"),
+	"z-index":    func(value string) bool { return value == "auto" || isInteger(value) },
+	"opacity": func(value string) bool {
+		return isNumber(value) || (strings.HasSuffix(value, "%") && isNumber(strings.TrimSuffix(value, "%")))
+	},
+
+	"color":             isColorValue,
+	"background-color":  isColorValue,
+	"column-rule-color": isColorValue,
+
+	"font-size": func(value string) bool {
+		_, keyword := fontSizeKeywords[value]
+		return keyword || value == "smaller" || value == "larger" || isLength(value, true, false)
+	},
+	"line-height": func(value string) bool {
+		return value == "normal" || isNonNegativeNumber(value) || isLength(value, true, false)
+	},
+	"text-align":     keywords("left", "right", "center", "justify", "start", "end"),
+	"vertical-align": lengthOrKeyword(true, true, "baseline", "sub", "super", "text-top", "text-bottom", "middle", "top", "bottom"),
+	"font-style":     keywords("normal", "italic", "oblique"),
+	"font-weight": func(value string) bool {
+		switch value {
+		case "normal", "bold", "bolder", "lighter":
+			return true
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		return err == nil && weight >= 1 && weight <= 1000
+	},
+	"white-space": keywords("normal", "pre", "nowrap", "pre-wrap", "pre-line", "break-spaces"),
+
+	"flex-direction": keywords("row", "row-reverse", "column", "column-reverse"),
+	"flex-wrap":      keywords("nowrap", "wrap", "wrap-reverse"),
+	"flex-grow":      isNonNegativeNumber,
+	"flex-shrink":    isNonNegativeNumber,
+	"flex-basis":     lengthOrKeyword(true, false, "auto", "content", "min-content", "max-content", "fit-content"),
+	"order":          isInteger,
+	"row-gap":        lengthOrKeyword(true, false, "normal"),
+	"column-gap":     lengthOrKeyword(true, false, "normal"),
+
+	"grid-template-columns": isTrackList,
+	"grid-template-rows":    isTrackList,
+	"grid-template-areas":   isGridAreas,
+	"grid-auto-columns":     isTrackSize,
+	"grid-auto-rows":        isTrackSize,
+	"grid-auto-flow": func(value string) bool {
+		fields := strings.Fields(value)
+		if len(fields) == 2 && fields[0] == "dense" {
+			fields[0], fields[1] = fields[1], fields[0]
+		}
+		switch len(fields) {
+		case 1:
+			return fields[0] == "row" || fields[0] == "column" || fields[0] == "dense"
+		case 2:
+			return (fields[0] == "row" || fields[0] == "column") && fields[1] == "dense"
+		}
+		return false
+	},
+	"grid-row-start":    isGridLine,
+	"grid-row-end":      isGridLine,
+	"grid-column-start": isGridLine,
+	"grid-column-end":   isGridLine,
+
+	"table-layout":    keywords("auto", "fixed"),
+	"border-collapse": keywords("separate", "collapse"),
+	"caption-side":    keywords("top", "bottom"),
+	"border-spacing": func(value string) bool {
+		values := splitValues(value)
+		if len(values) < 1 || len(values) > 2 {
+			return false
+		}
+		for _, v := range values {
+			if !isLength(v, false, false) {
+				return false
+			}
+		}
+		return true
+	},
+
+	"column-rule-width": func(value string) bool {
+		return borderWidthKeywords[value] != "" || isLength(value, false, false)
+	},
+	"column-rule-style": func(value string) bool { return borderStyles[value] },
+
+	"list-style-type":     func(value string) bool { return listStyleTypes[value] },
+	"list-style-position": keywords("inside", "outside"),
+	"list-style-image":    func(value string) bool { return value == "none" || cssURL(value) != "" },
+
+	"content": func(value string) bool {
+		if value == "none" || value == "normal" {
+			return true
+		}
+		_, ok := parseContent(value)
+		return ok
+	},
+	"counter-reset":     isCounterList,
+	"counter-increment": isCounterList,
+	"counter-set":       isCounterList,
+}
+
+// isValidValue reports whether value is valid for the property cssKey. The
+// CSS-wide keywords are valid for every property.
+func isValidValue(cssKey, value string) bool {
+	if cssWideKeywords[value] {
+		return true
+	}
+	validator, exist := valueValidators[cssKey]
+	return !exist || validator(value)
+}
+
+func keywords(values ...string) func(string) bool {
+	return func(value string) bool {
+		return containsString(values, value)
+	}
+}
+
+// lengthOrKeyword returns a validator of the values that are a length or one
+// of values.
+func lengthOrKeyword(percentages, negatives bool, values ...string) func(string) bool {
+	return func(value string) bool {
+		return containsString(values, value) || isLength(value, percentages, negatives)
+	}
+}
+
+// isLength reports whether value is a length, or a percentage when
+// percentages is set. A negative length is valid when negatives is set, the
+// math functions being valid whatever their result.
+func isLength(value string, percentages, negatives bool) bool {
+	base := -1.0
+	if percentages {
+		base = 100
+	}
+	values := trimWhitespace(parseComponentValues(tokenizeCSS(value)))
+	px, ok := defaultLengthContext(base).evalLength(values)
+	if !ok {
+		return false
+	}
+	return negatives || px >= 0 || isMathFunction(&values[0])
+}
+
+func isTrackList(value string) bool {
+	_, ok := parseTrackList(value, -1, 0)
+	return ok
+}
+
+func isTrackSize(value string) bool {
+	_, ok := parseTrackSize(value, -1)
+	return ok
+}
+
+// isGridAreas reports whether value is none or rows of area names in
+// strings, with as many columns in every row and rectangular areas.
+func isGridAreas(value string) bool {
+	if value == "none" {
+		return true
+	}
+	for _, token := range tokenizeCSS(value) {
+		if token.kind != tokenString && token.kind != tokenWhitespace {
+			return false
+		}
+	}
+	rows := gridAreaRows(value)
+	for _, row := range rows {
+		if len(row) != len(rows[0]) {
+			return false
+		}
+	}
+	if len(rows) == 0 {
+		return false
+	}
+	areas := make(map[string]gridArea)
+	parseGridAreas(value, areas)
+	cells := make(map[string]int)
+	for _, row := range rows {
+		for _, name := range row {
+			cells[name]++
+		}
+	}
+	for name, area := range areas {
+		if cells[name] != area.row.span*area.column.span {
+			return false
+		}
+		for r := area.row.start; r < area.row.start+area.row.span; r++ {
+			for c := area.column.start; c < area.column.start+area.column.span; c++ {
+				if rows[r][c] != name {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func isCounterList(value string) bool {
+	_, ok := parseCounters(value, 0)
+	return ok
+}
+
+func isNonNegativeNumber(value string) bool {
+	n, err := strconv.ParseFloat(value, 64)
+	return err == nil && n >= 0
+}
+
+func isInteger(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// borderWidthKeywords are the px of the keywords of a border width.
+var borderWidthKeywords = map[string]string{
+	"thin": "1px", "medium": "3px", "thick": "5px",
+}
+
+var borderStyles = map[string]bool{
+	"none": true, "hidden": true, "dotted": true, "dashed": true, "solid": true,
+	"double": true, "groove": true, "ridge": true, "inset": true, "outset": true,
+}
+
+// parseBorder parses the value of a border shorthand: a width, a style and a
+// color in any order, each of them optional. Those left out take their
+// initial value, medium, none and currentcolor. It returns false when value
+// is not a border.
+func parseBorder(value string) (width, style, color string, ok bool) {
+	if cssWideKeywords[value] {
+		return value, value, value, true
+	}
+	attrList := splitValues(value)
+	if len(attrList) < 1 || len(attrList) > 3 {
+		return "", "", "", false
+	}
+	for _, attr := range attrList {
+		switch {
+		case borderStyles[attr] && style == "":
+			style = attr
+		case borderWidthKeywords[attr] != "" && width == "":
+			width = borderWidthKeywords[attr]
+		case isLength(attr, false, false) && width == "":
+			width = attr
+		case isColorValue(attr) && color == "":
+			color = attr
+		default:
+			return "", "", "", false
+		}
+	}
+	if width == "" {
+		width = borderWidthKeywords["medium"]
+	}
+	if style == "" {
+		style = "none"
+	}
+	if color == "" {
+		color = "currentcolor"
+	}
+	return width, style, color, true
+}
+
+func isColor(value string) bool {
+	_, ok := parseColor(value)
+	return ok
+}
+
+// isColorValue reports whether value is a color or currentcolor.
+func isColorValue(value string) bool {
+	return isCurrentColor(value) || isColor(value)
+}
@@ -0,0 +1,147 @@
+package html2img
+
+import "testing"
+
+func TestIsValidValue(t *testing.T) {
+	tests := []struct {
+		property string
+		value    string
+		want     bool
+	}{
+		{"width", "10px", true},
+		{"width", "50%", true},
+		{"width", "auto", true},
+		{"width", "calc(100% - 10px)", true},
+		{"width", "-10px", false},
+		{"width", "10", false},
+		{"width", "0", true},
+		{"width", "10xp", false},
+		{"width", "left", false},
+		{"margin-left", "-10px", true},
+		{"padding-left", "-1px", false},
+		{"padding-left", "auto", false},
+		{"display", "flex", true},
+		{"display", "foo", false},
+		{"z-index", "-2", true},
+		{"z-index", "1.5", false},
+		{"opacity", "0.5", true},
+		{"opacity", "50%", true},
+		{"opacity", "half", false},
+		{"color", "red", true},
+		{"color", "currentcolor", true},
+		{"color", "12px", false},
+		{"font-size", "large", true},
+		{"font-size", "-1px", false},
+		{"font-weight", "650", true},
+		{"font-weight", "1001", false},
+		{"line-height", "1.5", true},
+		{"line-height", "-1", false},
+		{"flex-grow", "-1", false},
+		{"border-spacing", "1px 2px", true},
+		{"border-spacing", "1px 2px 3px", false},
+		{"grid-auto-flow", "dense column", true},
+		{"grid-auto-flow", "row column", false},
+		{"grid-template-areas", `"a a" "b c"`, true},
+		{"grid-template-areas", `"a b" "b a"`, false},
+		{"grid-template-areas", `"a" "b c"`, false},
+		{"column-rule-width", "thick", true},
+		{"list-style-type", "lower-roman", true},
+		{"list-style-type", "roman", false},
+		{"list-style-image", "url(a.png)", true},
+		{"content", `"a" counter(x)`, true},
+		{"content", "foo", false},
+		{"counter-reset", "a 2 b", true},
+		{"counter-reset", "a b c 1.5", false},
+		{"width", "inherit", true},
+		{"display", "unset", true},
+		{"unknown-property", "anything", true},
+	}
+	for _, test := range tests {
+		if got := isValidValue(test.property, test.value); got != test.want {
+			t.Errorf("isValidValue(%v, %q) = %v, want %v", test.property, test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseBorder(t *testing.T) {
+	tests := []struct {
+		value               string
+		width, style, color string
+		ok                  bool
+	}{
+		{"1px solid red", "1px", "solid", "red", true},
+		{"red solid 1px", "1px", "solid", "red", true},
+		{"solid red", "3px", "solid", "red", true},
+		{"2px", "2px", "none", "currentcolor", true},
+		{"dashed", "3px", "dashed", "currentcolor", true},
+		{"thin dotted", "1px", "dotted", "currentcolor", true},
+		{"rgb(1, 2, 3) thick", "5px", "none", "rgb(1, 2, 3)", true},
+		{"none", "3px", "none", "currentcolor", true},
+		{"0", "0", "none", "currentcolor", true},
+		{"inherit", "inherit", "inherit", "inherit", true},
+		{"1px 2px", "", "", "", false},
+		{"solid dashed", "", "", "", false},
+		{"red blue", "", "", "", false},
+		{"1px solid red blue", "", "", "", false},
+		{"-1px solid", "", "", "", false},
+		{"1px wavy", "", "", "", false},
+		{"", "", "", "", false},
+	}
+	for _, test := range tests {
+		width, style, color, ok := parseBorder(test.value)
+		if width != test.width || style != test.style || color != test.color || ok != test.ok {
+			t.Errorf("parseBorder(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", test.value,
+				width, style, color, ok, test.width, test.style, test.color, test.ok)
+		}
+	}
+}
+
+func TestSetTagStyle(t *testing.T) {
+	tests := []struct {
+		property string
+		value    string
+		ok       bool
+		field    func(*TagStyle) Pos
+		want     Pos
+	}{
+		{"margin", "1px", true, marginOf, Pos{Top: "1px", Right: "1px", Bottom: "1px", Left: "1px"}},
+		{"margin", "1px 2px", true, marginOf, Pos{Top: "1px", Right: "2px", Bottom: "1px", Left: "2px"}},
+		{"margin", "1px 2px 3px", true, marginOf, Pos{Top: "1px", Right: "2px", Bottom: "3px", Left: "2px"}},
+		{"margin", "1px 2px 3px 4px", true, marginOf, Pos{Top: "1px", Right: "2px", Bottom: "3px", Left: "4px"}},
+		{"margin", "auto -5px", true, marginOf, Pos{Top: "auto", Right: "-5px", Bottom: "auto", Left: "-5px"}},
+		{"margin", "1px 2px 3px 4px 5px", false, marginOf, Pos{}},
+		{"margin", "1px foo", false, marginOf, Pos{}},
+		{"margin", "inherit", true, marginOf, Pos{Top: "inherit", Right: "inherit", Bottom: "inherit", Left: "inherit"}},
+		{"padding", "1px -2px", false, paddingOf, Pos{}},
+		{"border", "2px solid red", true, borderWidthOf, Pos{Top: "2px", Right: "2px", Bottom: "2px", Left: "2px"}},
+		{"border-left", "thick", true, borderWidthOf, Pos{Left: "5px"}},
+		{"border", "2px 3px", false, borderWidthOf, Pos{}},
+	}
+	for _, test := range tests {
+		style := &TagStyle{}
+		if ok := setTagStyle(style, test.property, test.value); ok != test.ok {
+			t.Errorf("setTagStyle(%v, %q) = %v, want %v", test.property, test.value, ok, test.ok)
+		}
+		if got := test.field(style); got != test.want {
+			t.Errorf("%v: %q gives %+v, want %+v", test.property, test.value, got, test.want)
+		}
+	}
+}
+
+func marginOf(style *TagStyle) Pos      { return style.Margin }
+func paddingOf(style *TagStyle) Pos     { return style.Padding }
+func borderWidthOf(style *TagStyle) Pos { return style.BorderWidth }
+
+func TestRenderInvalidValues(t *testing.T) {
+	runRenderTests(t, &Renderer{}, []renderTest{
+		{"invalid lengths", styledDocument("div { width: 10xp; height: -5px; margin: 1px 2px 3px 4px 5px; padding: calc(1px +) }", "<div>a</div>")},
+		{"invalid keywords", styledDocument("div { display: foo; position: middle; float: center; overflow: x }", "<div>a</div>")},
+		{"invalid border", styledDocument("div { border: 1px 2px; border-left: solid dashed; border-top: }", "<div>a</div>")},
+		{"empty values", styledDocument("div { width: ; color: ; font-size: ; font-family: '' }", "<div>a</div>")},
+		{"unsupported selectors", styledDocument("::selection { color: red } ::placeholder { color: red } li::marker { color: red } input:checked { color: red } div { color: blue }", `<div>a</div><input type="checkbox" checked><ul><li>b</li></ul>`)},
+		{"unusual shorthands", styledDocument("div { border: none; border-top: 1px solid; border-left: 0; margin: 1px 2px 3px 4px 5px; padding: 1px 2px 3px 4px 5px }", "<div>a</div>")},
+		{"invalid shorthands", styledDocument("div { gap: 1px 2px 3px; flex-flow: row wrap column; grid-template: 1px; border-spacing: 1px 2px 3px; border-radius: 1px 2px 3px 4px 5px; flex: 1 1 auto 3 }", "<div>a</div>")},
+		{"unknown list style", styledDocument("li { list-style-type: hebrew }", "<ul><li>a</li></ul>")},
+		{"huge values", styledDocument("div { width: 1e30px; margin-left: -1e30px; font-size: 1e20px; z-index: 99999999999999999999 }", "<div>a</div>")},
+	})
+}
@@ -0,0 +1,222 @@
+package html2img
+
+import (
+	"strings"
+)
+
+func isVarFunction(v *componentValue) bool {
+	return v.isFunction() && strings.EqualFold(v.token.value, "var")
+}
+
+// hasVar reports whether values use var().
+func hasVar(values []componentValue) bool {
+	for i := range values {
+		if isVarFunction(&values[i]) || hasVar(values[i].children) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVar returns the name of the custom property of the arguments of a
+// var() and its fallback, if it has one.
+func parseVar(args []componentValue) (string, []componentValue, bool, bool) {
+	args = trimWhitespace(args)
+	if len(args) == 0 || args[0].token.kind != tokenIdent || !strings.HasPrefix(args[0].token.value, "--") {
+		return "", nil, false, false
+	}
+	name := args[0].token.value
+	rest := trimWhitespace(args[1:])
+	if len(rest) == 0 {
+		return name, nil, false, true
+	}
+	if rest[0].token.kind != tokenComma {
+		return "", nil, false, false
+	}
+	return name, trimWhitespace(rest[1:]), true, true
+}
+
+// validVars reports whether every var() of values, including the ones of the
+// fallbacks, names a custom property.
+func validVars(values []componentValue) bool {
+	for i := range values {
+		if isVarFunction(&values[i]) {
+			if _, _, _, valid := parseVar(values[i].children); !valid {
+				return false
+			}
+		}
+		if !validVars(values[i].children) {
+			return false
+		}
+	}
+	return true
+}
+
+// substituteVars returns the text of values with every var() replaced by the
+// value of its custom property in vars or by its fallback. It returns false
+// when a var() has neither, which makes the declaration invalid.
+func substituteVars(values []componentValue, vars map[string]string) (string, bool) {
+	var text strings.Builder
+	ok := writeSubstituted(&text, values, vars)
+	return strings.Trim(text.String(), CUT_SET_LIST), ok
+}
+
+func writeSubstituted(text *strings.Builder, values []componentValue, vars map[string]string) bool {
+	for i := range values {
+		v := &values[i]
+		switch {
+		case isVarFunction(v):
+			name, fallback, hasFallback, valid := parseVar(v.children)
+			if !valid {
+				return false
+			}
+			if value, exist := vars[name]; exist {
+				text.WriteString(value)
+			} else if !hasFallback || !writeSubstituted(text, fallback, vars) {
+				return false
+			}
+		case v.isFunction() || v.isBlock():
+			text.WriteString(v.token.text)
+			if !writeSubstituted(text, v.children, vars) {
+				return false
+			}
+			text.WriteString(closingTokens[v.token.kind])
+		default:
+			writeComponentValue(text, v)
+		}
+	}
+	return true
+}
+
+// varNames calls f with the name of the custom property of every var() of
+// values, including the ones of the fallbacks.
+func varNames(values []componentValue, f func(string)) {
+	for i := range values {
+		v := &values[i]
+		if isVarFunction(v) {
+			if name, fallback, _, valid := parseVar(v.children); valid {
+				f(name)
+				varNames(fallback, f)
+			}
+			continue
+		}
+		varNames(v.children, f)
+	}
+}
+
+// varResolver computes the custom properties of an element from the ones it
+// declares and the ones it inherits. The references between the declared
+// properties are walked depth first to find their strongly connected
+// components, the cycles, with Tarjan's algorithm.
+type varResolver struct {
+	declared map[string]string
+	vars     map[string]string
+	// Order in which the properties are visited
+	index map[string]int
+	// Lowest index reachable from a property through the ones on the stack
+	lowlink map[string]int
+	stack   []string
+	onStack map[string]bool
+}
+
+// resolveCustomProperties returns the custom properties of an element. The
+// inherited ones are replaced by the declared ones, whose var() are
+// substituted. A declared property referencing itself, directly or not, is
+// invalid and has no value, and the ones referencing it use their fallback.
+func resolveCustomProperties(declared, inherited map[string]string) map[string]string {
+	if len(declared) == 0 {
+		return inherited
+	}
+	r := &varResolver{
+		declared: declared,
+		vars:     make(map[string]string, len(inherited)+len(declared)),
+		index:    make(map[string]int, len(declared)),
+		lowlink:  make(map[string]int, len(declared)),
+		onStack:  make(map[string]bool, len(declared)),
+	}
+	for name, value := range inherited {
+		r.vars[name] = value
+	}
+	for name := range declared {
+		if _, visited := r.index[name]; !visited {
+			r.resolve(name)
+		}
+	}
+	return r.vars
+}
+
+// resolve visits the declared property name and the ones it references. The
+// properties of a component are computed once all of it is visited, after
+// the components it references.
+func (r *varResolver) resolve(name string) {
+	value := r.declared[name]
+	r.index[name] = len(r.index)
+	r.lowlink[name] = r.index[name]
+	r.stack = append(r.stack, name)
+	r.onStack[name] = true
+
+	values := parseComponentValues(tokenizeCSS(value))
+	selfReference := false
+	varNames(values, func(ref string) {
+		if _, exist := r.declared[ref]; !exist {
+			// Inherited values are already resolved
+			return
+		}
+		if _, visited := r.index[ref]; !visited {
+			r.resolve(ref)
+			r.lowlink[name] = minInt(r.lowlink[name], r.lowlink[ref])
+		} else if r.onStack[ref] {
+			r.lowlink[name] = minInt(r.lowlink[name], r.index[ref])
+		}
+		selfReference = selfReference || ref == name
+	})
+	if r.lowlink[name] != r.index[name] {
+		return
+	}
+
+	var component []string
+	for {
+		top := r.stack[len(r.stack)-1]
+		r.stack = r.stack[:len(r.stack)-1]
+		r.onStack[top] = false
+		component = append(component, top)
+		if top == name {
+			break
+		}
+	}
+	if len(component) > 1 || selfReference {
+		for _, member := range component {
+			delete(r.vars, member)
+		}
+		return
+	}
+	switch value {
+	case "inherit", "unset":
+		return
+	case "initial":
+		delete(r.vars, name)
+		return
+	}
+	substituted, ok := substituteVars(values, r.vars)
+	if !ok {
+		delete(r.vars, name)
+		return
+	}
+	r.vars[name] = substituted
+}
+
+// variableStyle returns the rule setting the variables injected by a Renderer
+// on the root element, above the values the stylesheets give it.
+func variableStyle(variables map[string]string) *TagStyle {
+	custom := make(map[string]string, len(variables))
+	for name, value := range variables {
+		if !strings.HasPrefix(name, "--") {
+			name = "--" + name
+		}
+		custom[name] = value
+	}
+	return &TagStyle{
+		Selector:  ":root",
+		important: &TagStyle{CustomProperties: custom},
+	}
+}
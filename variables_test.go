@@ -0,0 +1,86 @@
+package html2img
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveCustomProperties(t *testing.T) {
+	tests := []struct {
+		name      string
+		declared  map[string]string
+		inherited map[string]string
+		want      map[string]string
+	}{
+		{"declared", map[string]string{"--a": "1px"}, nil, map[string]string{"--a": "1px"}},
+		{"inherited", nil, map[string]string{"--a": "1px"}, map[string]string{"--a": "1px"}},
+		{"overridden", map[string]string{"--a": "2px"}, map[string]string{"--a": "1px", "--b": "3px"}, map[string]string{"--a": "2px", "--b": "3px"}},
+		{"reference", map[string]string{"--a": "var(--b) solid", "--b": "1px"}, nil, map[string]string{"--a": "1px solid", "--b": "1px"}},
+		{"inherited reference", map[string]string{"--a": "var(--b)"}, map[string]string{"--b": "red"}, map[string]string{"--a": "red", "--b": "red"}},
+		{"chain", map[string]string{"--a": "var(--b)", "--b": "var(--c)", "--c": "x"}, nil, map[string]string{"--a": "x", "--b": "x", "--c": "x"}},
+		{"fallback", map[string]string{"--a": "var(--b, 2px)"}, nil, map[string]string{"--a": "2px"}},
+		{"nested fallback", map[string]string{"--a": "var(--b, var(--c, 3px))"}, nil, map[string]string{"--a": "3px"}},
+		{"missing", map[string]string{"--a": "var(--b)"}, map[string]string{"--c": "1"}, map[string]string{"--c": "1"}},
+		{"self reference", map[string]string{"--a": "var(--a)"}, map[string]string{"--a": "1px"}, map[string]string{}},
+		{"cycle", map[string]string{"--a": "var(--b)", "--b": "var(--a)", "--c": "1"}, nil, map[string]string{"--c": "1"}},
+		{"cycle in fallback", map[string]string{"--a": "var(--x, var(--b))", "--b": "var(--a)"}, nil, map[string]string{}},
+		{"reference to cycle", map[string]string{"--a": "var(--b)", "--b": "var(--a)", "--c": "var(--a, 4px)"}, nil, map[string]string{"--c": "4px"}},
+		{"cycle through a visited property", map[string]string{"--s": "var(--y) var(--x)", "--y": "var(--s)", "--x": "var(--y)", "--c": "var(--x, 5px)"}, nil, map[string]string{"--c": "5px"}},
+		{"initial", map[string]string{"--a": "initial"}, map[string]string{"--a": "1px"}, map[string]string{}},
+		{"inherit", map[string]string{"--a": "inherit"}, map[string]string{"--a": "1px"}, map[string]string{"--a": "1px"}},
+	}
+	for _, test := range tests {
+		got := resolveCustomProperties(test.declared, test.inherited)
+		if len(got) != 0 || len(test.want) != 0 {
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+			}
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	runComputedStyleTests(t, colorOf, []computedStyleTest{
+		{"substituted", ":root { --c: red } p { color: var(--c) }", `<p id="e">a</p>`, "red"},
+		{"case sensitive names", ":root { --C: red } p { color: var(--c, blue) }", `<p id="e">a</p>`, "blue"},
+		{"inherited", "div { --c: red } p { color: var(--c) }", `<div><p id="e">a</p></div>`, "red"},
+		{"not in scope", "section { --c: red } p { color: var(--c, blue) }", `<div><p id="e">a</p></div>`, "blue"},
+		{"fallback", "p { color: var(--missing, green) }", `<p id="e">a</p>`, "green"},
+		{"fallback with commas", "p { color: var(--missing, rgb(1, 2, 3)) }", `<p id="e">a</p>`, "rgb(1, 2, 3)"},
+		{"in a function", ":root { --g: 20 } p { color: rgb(10, var(--g), 30) }", `<p id="e">a</p>`, "rgb(10, 20, 30)"},
+		{"invalid at computed time inherits", "div { color: red } :root { --c: 12px } p { color: blue; color: var(--c) }", `<div><p id="e">a</p></div>`, "red"},
+		{"missing without fallback", "div { color: red } p { color: blue } p { color: var(--missing) }", `<div><p id="e">a</p></div>`, "red"},
+		{"cycle", "div { color: red } p { --a: var(--b); --b: var(--a); color: var(--a, green) }", `<div><p id="e">a</p></div>`, "green"},
+		{"invalid var syntax", "p { color: red; color: var(c) }", `<p id="e">a</p>`, "red"},
+		{"invalid fallback var syntax", "p { color: red; color: var(--c, var(1)) }", `<p id="e">a</p>`, "red"},
+		{"invalid declaration beside var", "p { color: red; color: 12px; margin-left: var(--m, 1px) }", `<p id="e">a</p>`, "red"},
+		{"important", ":root { --c: red !important; --c: blue } p { color: var(--c) }", `<p id="e">a</p>`, "red"},
+	})
+	runComputedStyleTests(t, func(s *TagStyle) string { return s.Margin.Left }, []computedStyleTest{
+		{"in a shorthand", ":root { --m: 1px 2px } p { margin: var(--m) }", `<p id="e">a</p>`, "2px"},
+		{"not inherited property", "div { --m: 5px } p { margin-left: var(--m) }", `<div><p id="e">a</p></div>`, "5px"},
+		{"invalid at computed time not inherited", "div { margin-left: 5px } p { margin-left: var(--missing) }", `<div><p id="e">a</p></div>`, ""},
+	})
+}
+
+func TestRendererVariables(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables map[string]string
+		css       string
+		want      string
+	}{
+		{"with dashes", map[string]string{"--c": "red"}, "p { color: var(--c) }", "red"},
+		{"without dashes", map[string]string{"c": "red"}, "p { color: var(--c) }", "red"},
+		{"above stylesheets", map[string]string{"c": "red"}, ":root { --c: blue } p { color: var(--c) }", "red"},
+		{"below descendants", map[string]string{"c": "red"}, "p { --c: blue; color: var(--c) }", "blue"},
+		{"references", map[string]string{"a": "var(--b)", "b": "green"}, "p { color: var(--a) }", "green"},
+	}
+	for _, test := range tests {
+		r := &Renderer{Variables: test.variables}
+		body := layoutHTML(t, r, "<html><head><style>"+test.css+`</style></head><body><p id="e">a</p></body></html>`)
+		if got := findDom(body, "e").TagStyle.Color; got != test.want {
+			t.Errorf("%v: color = %q, want %q", test.name, got, test.want)
+		}
+	}
+}